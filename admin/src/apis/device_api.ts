@@ -25,24 +25,38 @@ export interface SystemMonitorProcess {
   cpu: number
   memory: number
   status: string
+  program?: string
+  rss?: number
+  create_time?: number
+  username?: string
 }
 
 export interface SystemMonitorCpu {
   usage: number
   cores: number
   temperature: number
+  load1?: number
+  load5?: number
+  load15?: number
 }
 
 export interface SystemMonitorMemory {
   used: number
   total: number
   available: number
+  used_percent?: number
+  swap_used?: number
+  swap_total?: number
 }
 
 export interface SystemMonitorDisk {
   used: number
   total: number
   free: number
+  mount?: string
+  device?: string
+  fstype?: string
+  used_percent?: number
 }
 
 export interface SystemMonitorNetwork {
@@ -58,6 +72,10 @@ export interface SystemMonitorData {
   disk?: SystemMonitorDisk
   network?: Array<SystemMonitorNetwork>
   processes?: Array<SystemMonitorProcess>
+  disks?: Array<SystemMonitorDisk>
+  uptime?: number
+  boot_time?: number
+  process_count?: number
 }
 
 export async function addDevice(data: DeviceModel) {
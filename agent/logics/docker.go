@@ -0,0 +1,218 @@
+package logics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"pcdnagent/common"
+
+	"github.com/liuhengloveyou/pcdn/protos"
+	"go.uber.org/zap"
+)
+
+// docker的API地址，没有这个文件时不采集
+var DockerSocket = "/var/run/docker.sock"
+
+const dockerTimeout = 3 * time.Second
+
+type dockerContainer struct {
+	Id      string   `json:"Id"`
+	Names   []string `json:"Names"`
+	Image   string   `json:"Image"`
+	State   string   `json:"State"`
+	Status  string   `json:"Status"`
+	Created int64    `json:"Created"`
+}
+
+type dockerInspect struct {
+	RestartCount uint32 `json:"RestartCount"`
+	State        struct {
+		StartedAt string `json:"StartedAt"`
+	} `json:"State"`
+}
+
+type dockerStats struct {
+	CpuStats struct {
+		CpuUsage struct {
+			TotalUsage uint64 `json:"total_usage"` // 纳秒
+		} `json:"cpu_usage"`
+	} `json:"cpu_stats"`
+	MemoryStats struct {
+		Usage uint64            `json:"usage"`
+		Limit uint64            `json:"limit"`
+		Stats map[string]uint64 `json:"stats"`
+	} `json:"memory_stats"`
+	Networks map[string]struct {
+		RxBytes uint64 `json:"rx_bytes"`
+		TxBytes uint64 `json:"tx_bytes"`
+	} `json:"networks"`
+}
+
+// 上次心跳时容器的累计值，用来算两次心跳之间的CPU和网络速率
+type containerSample struct {
+	cpuTotal uint64
+	rx, tx   uint64
+	at       time.Time
+}
+
+var (
+	containerMu      sync.Mutex
+	containerSamples = make(map[string]containerSample)
+)
+
+// FillDockerInfo 填充docker容器信息，没装docker或者API不通时不填
+func FillDockerInfo(heartbeat *protos.Heartbeat) {
+	if _, err := os.Stat(DockerSocket); err != nil {
+		return
+	}
+
+	containers, err := dockerContainers(DockerSocket)
+	if err != nil {
+		common.Logger.Warn("dockerContainers ERR: ", zap.Error(err))
+		return
+	}
+	heartbeat.Monitor.Containers = containers
+}
+
+func dockerContainers(socket string) ([]*protos.SystemMonitorContainer, error) {
+	client := dockerClient(socket)
+
+	var list []dockerContainer
+	if err := dockerGet(client, "/containers/json?all=1", &list); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	rst := make([]*protos.SystemMonitorContainer, len(list))
+	stats := make([]*dockerStats, len(list))
+	var wg sync.WaitGroup
+	for i, c := range list {
+		rst[i] = &protos.SystemMonitorContainer{
+			Id:      shortContainerId(c.Id),
+			Name:    containerName(c.Names),
+			Image:   c.Image,
+			State:   c.State,
+			Status:  c.Status,
+			Created: c.Created,
+		}
+
+		wg.Add(1)
+		go func(i int, id string, running bool) {
+			defer wg.Done()
+
+			var inspect dockerInspect
+			if err := dockerGet(client, "/containers/"+id+"/json", &inspect); err == nil {
+				rst[i].RestartCount = inspect.RestartCount
+				if t, err := time.Parse(time.RFC3339Nano, inspect.State.StartedAt); err == nil && t.Year() > 1 {
+					rst[i].StartedAt = t.Unix()
+				}
+			}
+			if !running {
+				return
+			}
+			var s dockerStats
+			if err := dockerGet(client, "/containers/"+id+"/stats?stream=false&one-shot=true", &s); err == nil {
+				stats[i] = &s
+			}
+		}(i, c.Id, c.State == "running")
+	}
+	wg.Wait()
+
+	containerMu.Lock()
+	defer containerMu.Unlock()
+
+	seen := make(map[string]bool, len(list))
+	for i, c := range list {
+		seen[c.Id] = true
+		if stats[i] == nil {
+			delete(containerSamples, c.Id)
+			continue
+		}
+		applyContainerStats(rst[i], stats[i], c.Id, now)
+	}
+	for id := range containerSamples {
+		if !seen[id] {
+			delete(containerSamples, id)
+		}
+	}
+	return rst, nil
+}
+
+// 内存用量和docker stats一致，去掉可回收的page cache；CPU和网络按上次心跳以来的增量算，调用时需持有containerMu
+func applyContainerStats(c *protos.SystemMonitorContainer, s *dockerStats, id string, now time.Time) {
+	c.MemoryUsage = s.MemoryStats.Usage
+	c.MemoryLimit = s.MemoryStats.Limit
+	// cgroup v2是inactive_file，v1是total_inactive_file
+	inactive, ok := s.MemoryStats.Stats["inactive_file"]
+	if !ok {
+		inactive = s.MemoryStats.Stats["total_inactive_file"]
+	}
+	if inactive < c.MemoryUsage {
+		c.MemoryUsage -= inactive
+	}
+
+	for _, n := range s.Networks {
+		c.NetRxBytes += n.RxBytes
+		c.NetTxBytes += n.TxBytes
+	}
+
+	cur := containerSample{cpuTotal: s.CpuStats.CpuUsage.TotalUsage, rx: c.NetRxBytes, tx: c.NetTxBytes, at: now}
+	if prev, ok := containerSamples[id]; ok {
+		elapsed := now.Sub(prev.at)
+		// 容器重启后累计值会变小
+		if elapsed > 0 && cur.cpuTotal >= prev.cpuTotal && cur.rx >= prev.rx && cur.tx >= prev.tx {
+			c.Cpu = float32(float64(cur.cpuTotal-prev.cpuTotal) / float64(elapsed.Nanoseconds()) * 100)
+			c.NetRxRate = float64(cur.rx-prev.rx) / elapsed.Seconds()
+			c.NetTxRate = float64(cur.tx-prev.tx) / elapsed.Seconds()
+		}
+	}
+	containerSamples[id] = cur
+}
+
+func dockerClient(socket string) *http.Client {
+	return &http.Client{
+		Timeout: dockerTimeout,
+		Transport: &http.Transport{
+			DisableKeepAlives: true,
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+}
+
+func dockerGet(client *http.Client, path string, v interface{}) error {
+	resp, err := client.Get("http://docker" + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("docker %s: %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func shortContainerId(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// API返回的名字带/前缀
+func containerName(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(names[0], "/")
+}
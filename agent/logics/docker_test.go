@@ -0,0 +1,97 @@
+package logics
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDockerContainers(t *testing.T) {
+	const fullId = "0123456789abcdef0123456789abcdef"
+	cpuTotal := uint64(1e9)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[
+			{"Id":"` + fullId + `","Names":["/vendor"],"Image":"vendor:1.0","State":"running","Status":"Up 2 hours","Created":1700000000},
+			{"Id":"fedcba9876543210","Names":["/old"],"Image":"busybox","State":"exited","Status":"Exited (1) 3 days ago","Created":1600000000}
+		]`))
+	})
+	mux.HandleFunc("/containers/"+fullId+"/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"RestartCount":3,"State":{"StartedAt":"2024-01-02T03:04:05.123456789Z"}}`))
+	})
+	mux.HandleFunc("/containers/fedcba9876543210/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"RestartCount":0,"State":{"StartedAt":"0001-01-01T00:00:00Z"}}`))
+	})
+	mux.HandleFunc("/containers/"+fullId+"/stats", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("stream") != "false" {
+			t.Errorf("stats should not stream")
+		}
+		w.Write([]byte(`{"cpu_stats":{"cpu_usage":{"total_usage":` + itoa(cpuTotal) + `}},
+			"memory_stats":{"usage":300,"limit":1000,"stats":{"inactive_file":100}},
+			"networks":{"eth0":{"rx_bytes":1000,"tx_bytes":2000},"eth1":{"rx_bytes":10,"tx_bytes":20}}}`))
+	})
+
+	sock := filepath.Join(t.TempDir(), "docker.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skip("unix socket not supported: ", err)
+	}
+	srv := httptest.NewUnstartedServer(mux)
+	srv.Listener = ln
+	srv.Start()
+	defer srv.Close()
+
+	rr, err := dockerContainers(sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rr) != 2 {
+		t.Fatalf("got %d containers", len(rr))
+	}
+	c := rr[0]
+	if c.Id != "0123456789ab" || c.Name != "vendor" || c.State != "running" || c.RestartCount != 3 || c.StartedAt != 1704164645 {
+		t.Errorf("container: got %+v", c)
+	}
+	if c.MemoryUsage != 200 || c.MemoryLimit != 1000 || c.NetRxBytes != 1010 || c.NetTxBytes != 2020 {
+		t.Errorf("stats: got mem %d/%d net %d/%d", c.MemoryUsage, c.MemoryLimit, c.NetRxBytes, c.NetTxBytes)
+	}
+	// 第一次没有速率
+	if c.Cpu != 0 || c.NetRxRate != 0 {
+		t.Errorf("first sample should have no rate: cpu %v rx %v", c.Cpu, c.NetRxRate)
+	}
+	if rr[1].Name != "old" || rr[1].StartedAt != 0 || rr[1].MemoryUsage != 0 {
+		t.Errorf("exited container: got %+v", rr[1])
+	}
+
+	// 把上次的采样时间往前挪1秒，CPU用了0.5秒
+	containerMu.Lock()
+	s := containerSamples[fullId]
+	s.at = s.at.Add(-time.Second)
+	s.rx -= 1000
+	containerSamples[fullId] = s
+	containerMu.Unlock()
+	cpuTotal += 5e8
+
+	rr, err = dockerContainers(sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cpu := rr[0].Cpu; cpu < 45 || cpu > 51 {
+		t.Errorf("cpu: got %v, want about 50", cpu)
+	}
+	if rate := rr[0].NetRxRate; rate < 900 || rate > 1001 {
+		t.Errorf("rx rate: got %v, want about 1000", rate)
+	}
+	if _, ok := containerSamples["fedcba9876543210"]; ok {
+		t.Errorf("stopped container should not keep a sample")
+	}
+}
+
+func itoa(v uint64) string {
+	return strconv.FormatUint(v, 10)
+}
@@ -0,0 +1,122 @@
+package logics
+
+import (
+	"crypto/rand"
+	"os"
+	"regexp"
+	"strings"
+
+	"pcdnagent/common"
+
+	"go.uber.org/zap"
+)
+
+// 认领码和服务器发的凭证保存的位置，重装前不变
+var (
+	ClaimCodeFile = "/opt/pcdnagent/claim_code"
+	TokenFile     = "/opt/pcdnagent/token"
+)
+
+// 没有指定SN时按顺序找: sn.sh写的文件、启动参数、DMI序列号、machine-id
+var (
+	SNFile        = "/etc/pcdnsn"
+	CmdlineFile   = "/proc/cmdline"
+	DMISerialFile = "/sys/class/dmi/id/product_serial"
+	MachineIDFile = "/etc/machine-id"
+)
+
+// 去掉容易看错的0/O、1/I
+const claimCodeChars = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+
+const claimCodeLen = 8
+
+var snRegexp = regexp.MustCompile(`^[A-Za-z0-9_.:-]{4,45}$`)
+
+// 厂商没填时DMI里的占位值
+var junkSerials = map[string]bool{
+	"0": true, "NONE": true, "DEFAULT STRING": true, "TO BE FILLED BY O.E.M.": true,
+	"NOT SPECIFIED": true, "SYSTEM SERIAL NUMBER": true, "0123456789": true,
+}
+
+// DetectSN 找本机的SN，都找不到时返回空
+func DetectSN() string {
+	if sn := validSN(readSysValue(SNFile)); sn != "" {
+		return sn
+	}
+
+	if b, err := os.ReadFile(CmdlineFile); err == nil {
+		for _, arg := range strings.Fields(string(b)) {
+			if v, ok := strings.CutPrefix(arg, "snum="); ok {
+				if sn := validSN(v); sn != "" {
+					return sn
+				}
+			}
+		}
+	}
+
+	if v := readSysValue(DMISerialFile); !junkSerials[strings.ToUpper(v)] {
+		if sn := validSN(strings.ReplaceAll(v, " ", "")); sn != "" {
+			return sn
+		}
+	}
+
+	return validSN(readSysValue(MachineIDFile))
+}
+
+func validSN(s string) string {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if !snRegexp.MatchString(s) {
+		return ""
+	}
+	return s
+}
+
+// ClaimCode 设备的认领码，第一次用时生成并保存
+func ClaimCode() string {
+	if code := readSysValue(ClaimCodeFile); len(code) == claimCodeLen {
+		return code
+	}
+
+	code := generateClaimCode()
+	if err := writeSecretFile(ClaimCodeFile, code); err != nil {
+		common.Logger.Error("ClaimCode save ERR: ", zap.String("file", ClaimCodeFile), zap.Error(err))
+	}
+	return code
+}
+
+// FormatClaimCode 分两段方便抄写，服务器忽略中间的-
+func FormatClaimCode(code string) string {
+	if len(code) != claimCodeLen {
+		return code
+	}
+	return code[:claimCodeLen/2] + "-" + code[claimCodeLen/2:]
+}
+
+// LoadToken 服务器发的凭证，还没认证过时为空
+func LoadToken() string {
+	return readSysValue(TokenFile)
+}
+
+func SaveToken(token string) error {
+	return writeSecretFile(TokenFile, token)
+}
+
+func generateClaimCode() string {
+	b := make([]byte, claimCodeLen)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	for i := range b {
+		b[i] = claimCodeChars[int(b[i])%len(claimCodeChars)]
+	}
+	return string(b)
+}
+
+// 先写临时文件再改名，只有root能读
+func writeSecretFile(fn, value string) error {
+	tmp := fn + ".tmp"
+	if err := os.WriteFile(tmp, []byte(value+"\n"), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fn)
+}
@@ -0,0 +1,93 @@
+package logics
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDetectSN(t *testing.T) {
+	root := t.TempDir()
+	olds := []*string{&SNFile, &CmdlineFile, &DMISerialFile, &MachineIDFile}
+	saved := make([]string, len(olds))
+	for i, p := range olds {
+		saved[i] = *p
+	}
+	defer func() {
+		for i, p := range olds {
+			*p = saved[i]
+		}
+	}()
+	SNFile = filepath.Join(root, "pcdnsn")
+	CmdlineFile = filepath.Join(root, "cmdline")
+	DMISerialFile = filepath.Join(root, "product_serial")
+	MachineIDFile = filepath.Join(root, "machine-id")
+
+	if sn := DetectSN(); sn != "" {
+		t.Fatalf("no source: %q", sn)
+	}
+
+	writeSysFile(t, root, "machine-id", "0123abcd4567ef\n")
+	if sn := DetectSN(); sn != "0123ABCD4567EF" {
+		t.Fatalf("machine-id: %q", sn)
+	}
+
+	// DMI里没填的占位值跳过
+	writeSysFile(t, root, "product_serial", "To Be Filled By O.E.M.\n")
+	if sn := DetectSN(); sn != "0123ABCD4567EF" {
+		t.Fatalf("junk dmi: %q", sn)
+	}
+	writeSysFile(t, root, "product_serial", "PF2 ABC12\n")
+	if sn := DetectSN(); sn != "PF2ABC12" {
+		t.Fatalf("dmi: %q", sn)
+	}
+
+	writeSysFile(t, root, "cmdline", "console=ttyS0 snum=ab-1234 quiet\n")
+	if sn := DetectSN(); sn != "AB-1234" {
+		t.Fatalf("cmdline: %q", sn)
+	}
+
+	// sn.sh找不到SN时写的是-
+	writeSysFile(t, root, "pcdnsn", "-\n")
+	if sn := DetectSN(); sn != "AB-1234" {
+		t.Fatalf("bad pcdnsn: %q", sn)
+	}
+	writeSysFile(t, root, "pcdnsn", "sn20250001\n")
+	if sn := DetectSN(); sn != "SN20250001" {
+		t.Fatalf("pcdnsn: %q", sn)
+	}
+}
+
+func TestClaimCodeAndToken(t *testing.T) {
+	root := t.TempDir()
+	oldCode, oldToken := ClaimCodeFile, TokenFile
+	defer func() { ClaimCodeFile, TokenFile = oldCode, oldToken }()
+	ClaimCodeFile = filepath.Join(root, "claim_code")
+	TokenFile = filepath.Join(root, "token")
+
+	code := ClaimCode()
+	if len(code) != claimCodeLen {
+		t.Fatalf("code len: %q", code)
+	}
+	for _, c := range code {
+		if !strings.ContainsRune(claimCodeChars, c) {
+			t.Fatalf("code char: %q", code)
+		}
+	}
+	if again := ClaimCode(); again != code {
+		t.Fatalf("code changed: %q %q", code, again)
+	}
+	if f := FormatClaimCode(code); f != code[:4]+"-"+code[4:] {
+		t.Fatalf("format: %q", f)
+	}
+
+	if tok := LoadToken(); tok != "" {
+		t.Fatalf("token before save: %q", tok)
+	}
+	if err := SaveToken("abc123"); err != nil {
+		t.Fatal(err)
+	}
+	if tok := LoadToken(); tok != "abc123" {
+		t.Fatalf("token: %q", tok)
+	}
+}
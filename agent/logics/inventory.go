@@ -0,0 +1,216 @@
+package logics
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pcdnagent/common"
+
+	"github.com/liuhengloveyou/pcdn/protos"
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/host"
+	"github.com/shirou/gopsutil/v4/mem"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+// 磁盘和网卡从sysfs读，测试时换成临时目录
+var sysRoot = "/sys"
+
+// 不算物理磁盘的块设备
+var virtualBlockPrefixes = []string{"loop", "ram", "zram", "dm-", "sr", "fd", "nbd"}
+
+var (
+	inventoryMu   sync.Mutex
+	inventoryHash string
+)
+
+// CollectInventory 采集硬件和系统清单，连上服务器时调用
+func CollectInventory() *protos.Inventory {
+	inv := collectInventory()
+
+	inventoryMu.Lock()
+	inventoryHash = inv.Hash
+	inventoryMu.Unlock()
+	return inv
+}
+
+// CheckInventory 定时检查，清单和上次上报的不一样时返回新清单，否则返回nil
+func CheckInventory() *protos.Inventory {
+	inv := collectInventory()
+
+	inventoryMu.Lock()
+	defer inventoryMu.Unlock()
+
+	if inv.Hash == inventoryHash {
+		return nil
+	}
+	common.Logger.Info("inventory changed: ", zap.String("old", inventoryHash), zap.String("new", inv.Hash))
+	inventoryHash = inv.Hash
+	return inv
+}
+
+func collectInventory() *protos.Inventory {
+	ctx := context.Background()
+	inv := &protos.Inventory{}
+
+	if info, err := host.InfoWithContext(ctx); err == nil {
+		inv.Hostname = info.Hostname
+		inv.Os = info.OS
+		inv.Platform = info.Platform
+		inv.PlatformVersion = info.PlatformVersion
+		inv.KernelVersion = info.KernelVersion
+		inv.Arch = info.KernelArch
+	} else {
+		common.Logger.Warn("inventory host info ERR: ", zap.Error(err))
+	}
+
+	if infos, err := cpu.InfoWithContext(ctx); err == nil && len(infos) > 0 {
+		inv.CpuModel = strings.TrimSpace(infos[0].ModelName)
+	}
+	if n, err := cpu.CountsWithContext(ctx, true); err == nil {
+		inv.CpuCores = uint32(n)
+	}
+	if n, err := cpu.CountsWithContext(ctx, false); err == nil {
+		inv.CpuPhysicalCores = uint32(n)
+	}
+	if vm, err := mem.VirtualMemoryWithContext(ctx); err == nil {
+		inv.MemoryTotal = vm.Total
+	}
+
+	inv.Disks = inventoryDisks()
+	inv.Nics = inventoryNics()
+	fillDmiInfo(inv)
+
+	inv.Hash = inventoryDigest(inv)
+	inv.Timestamp = time.Now().UnixMilli()
+	return inv
+}
+
+// 物理磁盘，块设备目录下有device的才算
+func inventoryDisks() []*protos.InventoryDisk {
+	entries, err := os.ReadDir(filepath.Join(sysRoot, "block"))
+	if err != nil {
+		return nil
+	}
+
+	var rst []*protos.InventoryDisk
+	for _, e := range entries {
+		name := e.Name()
+		if isVirtualBlock(name) {
+			continue
+		}
+		dir := filepath.Join(sysRoot, "block", name)
+		if _, err := os.Stat(filepath.Join(dir, "device")); err != nil {
+			continue
+		}
+
+		d := &protos.InventoryDisk{
+			Name:       name,
+			Model:      firstSysValue(filepath.Join(dir, "device", "model"), filepath.Join(dir, "device", "name")),
+			Serial:     firstSysValue(filepath.Join(dir, "device", "serial"), filepath.Join(dir, "device", "wwid")),
+			Rotational: readSysValue(filepath.Join(dir, "queue", "rotational")) == "1",
+		}
+		// size按512字节的扇区计
+		if sectors, err := strconv.ParseUint(readSysValue(filepath.Join(dir, "size")), 10, 64); err == nil {
+			d.Size = sectors * 512
+		}
+		rst = append(rst, d)
+	}
+	return rst
+}
+
+func isVirtualBlock(name string) bool {
+	for _, prefix := range virtualBlockPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// 物理网卡，网卡目录下有device的才算，网桥、veth、tun等虚拟网卡没有
+func inventoryNics() []*protos.InventoryNic {
+	entries, err := os.ReadDir(filepath.Join(sysRoot, "class", "net"))
+	if err != nil {
+		return nil
+	}
+
+	var rst []*protos.InventoryNic
+	for _, e := range entries {
+		dir := filepath.Join(sysRoot, "class", "net", e.Name())
+		if _, err := os.Stat(filepath.Join(dir, "device")); err != nil {
+			continue
+		}
+
+		nic := &protos.InventoryNic{
+			Name:  e.Name(),
+			Mac:   readSysValue(filepath.Join(dir, "address")),
+			Speed: -1,
+		}
+		// 没连线时读speed会出错
+		if speed, err := strconv.Atoi(readSysValue(filepath.Join(dir, "speed"))); err == nil && speed > 0 {
+			nic.Speed = int32(speed)
+		}
+		if mtu, err := strconv.Atoi(readSysValue(filepath.Join(dir, "mtu"))); err == nil {
+			nic.Mtu = uint32(mtu)
+		}
+		if driver, err := os.Readlink(filepath.Join(dir, "device", "driver")); err == nil {
+			nic.Driver = filepath.Base(driver)
+		}
+		rst = append(rst, nic)
+	}
+	return rst
+}
+
+// DMI信息，ARM盒子没有DMI时用设备树里的型号
+func fillDmiInfo(inv *protos.Inventory) {
+	dmi := filepath.Join(sysRoot, "class", "dmi", "id")
+	inv.SysVendor = readSysValue(filepath.Join(dmi, "sys_vendor"))
+	inv.ProductName = readSysValue(filepath.Join(dmi, "product_name"))
+	inv.ProductSerial = readSysValue(filepath.Join(dmi, "product_serial"))
+	inv.BiosVersion = readSysValue(filepath.Join(dmi, "bios_version"))
+
+	if inv.ProductName == "" {
+		inv.ProductName = readSysValue(filepath.Join(sysRoot, "firmware", "devicetree", "base", "model"))
+	}
+}
+
+// 清单的摘要，不算采集时间
+func inventoryDigest(inv *protos.Inventory) string {
+	c := proto.Clone(inv).(*protos.Inventory)
+	c.Hash = ""
+	c.Timestamp = 0
+
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+func firstSysValue(files ...string) string {
+	for _, fn := range files {
+		if v := readSysValue(fn); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// 读sysfs里的一个值，设备树里的字符串以\0结尾
+func readSysValue(fn string) string {
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(b), "\x00"))
+}
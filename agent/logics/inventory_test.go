@@ -0,0 +1,93 @@
+package logics
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/liuhengloveyou/pcdn/protos"
+)
+
+func writeSysFile(t *testing.T, root, rel, content string) {
+	fn := filepath.Join(root, rel)
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fn, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInventoryFromSysfs(t *testing.T) {
+	root := t.TempDir()
+	old := sysRoot
+	sysRoot = root
+	defer func() { sysRoot = old }()
+
+	// 一块SATA机械盘、一块NVMe和一个loop设备
+	writeSysFile(t, root, "block/sda/device/model", "ST4000DM004-2CV1\n")
+	writeSysFile(t, root, "block/sda/device/wwid", "t10.ATA ZFN0ABCD\n")
+	writeSysFile(t, root, "block/sda/size", "7814037168\n")
+	writeSysFile(t, root, "block/sda/queue/rotational", "1\n")
+	writeSysFile(t, root, "block/nvme0n1/device/model", "Samsung SSD 980 1TB\n")
+	writeSysFile(t, root, "block/nvme0n1/device/serial", "S649NX0R123456\n")
+	writeSysFile(t, root, "block/nvme0n1/size", "1953525168\n")
+	writeSysFile(t, root, "block/nvme0n1/queue/rotational", "0\n")
+	writeSysFile(t, root, "block/loop0/size", "100\n")
+
+	// 一块物理网卡、一块没连线的网卡和一个网桥
+	writeSysFile(t, root, "class/net/eth0/address", "00:11:22:33:44:55\n")
+	writeSysFile(t, root, "class/net/eth0/speed", "1000\n")
+	writeSysFile(t, root, "class/net/eth0/mtu", "1500\n")
+	os.MkdirAll(filepath.Join(root, "bus/pci/drivers/igb"), 0755)
+	os.MkdirAll(filepath.Join(root, "class/net/eth0/device"), 0755)
+	os.Symlink(filepath.Join(root, "bus/pci/drivers/igb"), filepath.Join(root, "class/net/eth0/device/driver"))
+	writeSysFile(t, root, "class/net/eth1/address", "00:11:22:33:44:56\n")
+	writeSysFile(t, root, "class/net/eth1/speed", "-1\n")
+	os.MkdirAll(filepath.Join(root, "class/net/eth1/device"), 0755)
+	writeSysFile(t, root, "class/net/br0/address", "00:11:22:33:44:57\n")
+
+	// 没有DMI，设备树里有型号
+	writeSysFile(t, root, "firmware/devicetree/base/model", "Radxa ROCK 5B\x00")
+
+	disks := inventoryDisks()
+	if len(disks) != 2 {
+		t.Fatalf("disks: got %d, want 2", len(disks))
+	}
+	nvme, sda := disks[0], disks[1]
+	if nvme.Name != "nvme0n1" || nvme.Model != "Samsung SSD 980 1TB" || nvme.Serial != "S649NX0R123456" || nvme.Rotational || nvme.Size != 1953525168*512 {
+		t.Errorf("nvme: got %+v", nvme)
+	}
+	if sda.Serial != "t10.ATA ZFN0ABCD" || !sda.Rotational {
+		t.Errorf("sda: got %+v", sda)
+	}
+
+	nics := inventoryNics()
+	if len(nics) != 2 {
+		t.Fatalf("nics: got %d, want 2", len(nics))
+	}
+	if nics[0].Name != "eth0" || nics[0].Mac != "00:11:22:33:44:55" || nics[0].Speed != 1000 || nics[0].Driver != "igb" || nics[0].Mtu != 1500 {
+		t.Errorf("eth0: got %+v", nics[0])
+	}
+	if nics[1].Speed != -1 || nics[1].Driver != "" {
+		t.Errorf("eth1: got %+v", nics[1])
+	}
+
+	inv := &protos.Inventory{}
+	fillDmiInfo(inv)
+	if inv.ProductName != "Radxa ROCK 5B" || inv.SysVendor != "" {
+		t.Errorf("dmi: got %q %q", inv.SysVendor, inv.ProductName)
+	}
+}
+
+func TestInventoryDigest(t *testing.T) {
+	a := &protos.Inventory{CpuModel: "x", MemoryTotal: 1 << 30, Timestamp: 1}
+	b := &protos.Inventory{CpuModel: "x", MemoryTotal: 1 << 30, Timestamp: 2, Hash: "old"}
+	if inventoryDigest(a) != inventoryDigest(b) {
+		t.Errorf("timestamp and hash should not change the digest")
+	}
+	b.Nics = []*protos.InventoryNic{{Name: "eth0", Mac: "00:11:22:33:44:55"}}
+	if inventoryDigest(a) == inventoryDigest(b) {
+		t.Errorf("new nic should change the digest")
+	}
+}
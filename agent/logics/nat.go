@@ -0,0 +1,398 @@
+package logics
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"pcdnagent/common"
+
+	"github.com/liuhengloveyou/pcdn/protos"
+	"go.uber.org/zap"
+)
+
+// NAT类型，和RFC 3489的分类一致
+const (
+	NAT_TYPE_PUBLIC          = "public"               // 没有NAT，公网地址在本机网卡上
+	NAT_TYPE_PUBLIC_FIREWALL = "public_firewall"      // 公网地址在本机，但有防火墙挡住了陌生地址
+	NAT_TYPE_FULL_CONE       = "full_cone"            // NAT1
+	NAT_TYPE_RESTRICTED      = "restricted_cone"      // NAT2
+	NAT_TYPE_PORT_RESTRICTED = "port_restricted_cone" // NAT3
+	NAT_TYPE_SYMMETRIC       = "symmetric"            // NAT4
+	NAT_TYPE_UDP_BLOCKED     = "udp_blocked"          // 所有STUN服务器都不通
+	NAT_TYPE_UNKNOWN         = "unknown"              // 服务器不支持换地址，分不出2/3型
+)
+
+const (
+	stunMagicCookie = 0x2112A442
+	stunHeaderLen   = 20
+
+	stunBindingRequest  = 0x0001
+	stunBindingResponse = 0x0101
+
+	stunAttrMappedAddress    = 0x0001
+	stunAttrChangeRequest    = 0x0003
+	stunAttrChangedAddress   = 0x0005
+	stunAttrXorMappedAddress = 0x0020
+	stunAttrXorMappedOld     = 0x8020
+	stunAttrOtherAddress     = 0x802C
+
+	stunChangeIP   = 0x04
+	stunChangePort = 0x02
+
+	stunTimeout = 1500 * time.Millisecond
+	stunRetries = 2
+)
+
+// STUN服务器，启动参数 -stun_servers 设置
+var StunServers = []string{"stun.miwifi.com:3478", "stun.qq.com:3478"}
+
+var (
+	natMu   sync.Mutex
+	natInfo *protos.NatInfo
+)
+
+type stunResponse struct {
+	mapped *net.UDPAddr
+	// 服务器的另一个地址，用来做换IP换端口的测试
+	other *net.UDPAddr
+}
+
+// DetectNat 检测NAT类型和公网地址，结果和上一次不一样时打日志并记录变化时间
+func DetectNat() *protos.NatInfo {
+	info := detectNat(StunServers, stunTimeout)
+
+	natMu.Lock()
+	defer natMu.Unlock()
+
+	if natInfo == nil || natChanged(natInfo, info) {
+		if natInfo != nil {
+			common.Logger.Info("nat changed: ",
+				zap.String("oldType", natInfo.NatType), zap.String("newType", info.NatType),
+				zap.String("oldIPv4", natInfo.PublicIpv4), zap.String("newIPv4", info.PublicIpv4),
+				zap.Strings("oldIPv6", natInfo.PublicIpv6), zap.Strings("newIPv6", info.PublicIpv6))
+		}
+		info.ChangedAt = info.DetectedAt
+	} else {
+		info.ChangedAt = natInfo.ChangedAt
+	}
+	natInfo = info
+	return info
+}
+
+// FillNatInfo 心跳里带上最近一次检测的结果，还没检测过时不带
+func FillNatInfo(heartbeat *protos.Heartbeat) {
+	natMu.Lock()
+	defer natMu.Unlock()
+
+	if natInfo != nil {
+		heartbeat.Nat = natInfo
+	}
+}
+
+func natChanged(a, b *protos.NatInfo) bool {
+	if a.NatType != b.NatType || a.PublicIpv4 != b.PublicIpv4 || len(a.PublicIpv6) != len(b.PublicIpv6) {
+		return true
+	}
+	for i := range a.PublicIpv6 {
+		if a.PublicIpv6[i] != b.PublicIpv6[i] {
+			return true
+		}
+	}
+	return false
+}
+
+func detectNat(servers []string, timeout time.Duration) *protos.NatInfo {
+	info := &protos.NatInfo{DetectedAt: time.Now().UnixMilli()}
+
+	natType, mapped, local, err := classifyNat(servers, timeout)
+	info.NatType = natType
+	if mapped != nil {
+		info.PublicIpv4 = mapped.IP.String()
+	}
+	if local != nil {
+		info.LocalIpv4 = local.String()
+	}
+	if err != nil {
+		info.ErrMsg = err.Error()
+	}
+	info.PublicIpv6 = publicIPv6(servers, timeout)
+	return info
+}
+
+// classifyNat 按RFC 3489的流程判断NAT类型，返回类型、公网映射地址和出口网卡地址
+func classifyNat(servers []string, timeout time.Duration) (string, *net.UDPAddr, net.IP, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return NAT_TYPE_UNKNOWN, nil, nil, err
+	}
+	defer conn.Close()
+
+	// 测试1: 找一个能通的服务器
+	var server *net.UDPAddr
+	var first *stunResponse
+	var lastErr error
+	for _, s := range servers {
+		addr, err := net.ResolveUDPAddr("udp4", s)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if first, lastErr = stunRequest(conn, addr, 0, timeout); lastErr == nil {
+			server = addr
+			break
+		}
+	}
+	if first == nil {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("没有STUN服务器")
+		}
+		return NAT_TYPE_UDP_BLOCKED, nil, nil, lastErr
+	}
+
+	local := outboundIPv4(server)
+	natType, err := classifyNatWith(conn, server, first, local, servers, timeout)
+	return natType, first.mapped, local, err
+}
+
+func classifyNatWith(conn *net.UDPConn, server *net.UDPAddr, first *stunResponse, local net.IP, servers []string, timeout time.Duration) (string, error) {
+	// 测试2: 让服务器换IP和端口回包
+	_, errChange := stunRequest(conn, server, stunChangeIP|stunChangePort, timeout)
+
+	if isLocalIP(first.mapped.IP, local) {
+		if errChange == nil {
+			return NAT_TYPE_PUBLIC, nil
+		}
+		return NAT_TYPE_PUBLIC_FIREWALL, nil
+	}
+	if errChange == nil {
+		return NAT_TYPE_FULL_CONE, nil
+	}
+
+	// 测试1': 向另一个地址发，映射的端口变了就是对称型
+	other := first.other
+	if other == nil {
+		for _, s := range servers {
+			addr, err := net.ResolveUDPAddr("udp4", s)
+			if err == nil && !addr.IP.Equal(server.IP) {
+				other = addr
+				break
+			}
+		}
+	}
+	if other == nil {
+		return NAT_TYPE_UNKNOWN, fmt.Errorf("STUN服务器不支持换地址")
+	}
+	second, err := stunRequest(conn, other, 0, timeout)
+	if err != nil {
+		return NAT_TYPE_UNKNOWN, err
+	}
+	if !second.mapped.IP.Equal(first.mapped.IP) || second.mapped.Port != first.mapped.Port {
+		return NAT_TYPE_SYMMETRIC, nil
+	}
+
+	// 测试3: 只换端口
+	if _, err := stunRequest(conn, server, stunChangePort, timeout); err == nil {
+		return NAT_TYPE_RESTRICTED, nil
+	}
+	return NAT_TYPE_PORT_RESTRICTED, nil
+}
+
+// 公网IPv6: STUN看到的地址加上网卡上的全局地址，排好序
+func publicIPv6(servers []string, timeout time.Duration) []string {
+	set := make(map[string]bool)
+
+	if conn, err := net.ListenUDP("udp6", nil); err == nil {
+		for _, s := range servers {
+			addr, err := net.ResolveUDPAddr("udp6", s)
+			if err != nil {
+				continue
+			}
+			if resp, err := stunRequest(conn, addr, 0, timeout); err == nil && resp.mapped.IP.To4() == nil {
+				set[resp.mapped.IP.String()] = true
+				break
+			}
+		}
+		conn.Close()
+	}
+
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok || ipnet.IP.To4() != nil {
+				continue
+			}
+			if ipnet.IP.IsGlobalUnicast() && !ipnet.IP.IsPrivate() {
+				set[ipnet.IP.String()] = true
+			}
+		}
+	}
+
+	rst := make([]string, 0, len(set))
+	for ip := range set {
+		rst = append(rst, ip)
+	}
+	sort.Strings(rst)
+	return rst
+}
+
+// 到服务器的出口网卡地址，UDP connect不会发包
+func outboundIPv4(server *net.UDPAddr) net.IP {
+	c, err := net.DialUDP("udp4", nil, server)
+	if err != nil {
+		return nil
+	}
+	defer c.Close()
+	return c.LocalAddr().(*net.UDPAddr).IP
+}
+
+func isLocalIP(ip, local net.IP) bool {
+	if local != nil && ip.Equal(local) {
+		return true
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// stunRequest 发一个Binding请求，超时重发；回包可以来自别的地址，按事务ID匹配
+func stunRequest(conn *net.UDPConn, server *net.UDPAddr, change uint32, timeout time.Duration) (*stunResponse, error) {
+	txId := make([]byte, 12)
+	if _, err := rand.Read(txId); err != nil {
+		return nil, err
+	}
+	req := stunBindingMsg(txId, change)
+
+	buf := make([]byte, 1500)
+	for i := 0; i < stunRetries; i++ {
+		if _, err := conn.WriteToUDP(req, server); err != nil {
+			return nil, err
+		}
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		for {
+			n, _, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Timeout() {
+					break
+				}
+				return nil, err
+			}
+			if resp, err := parseStunResponse(buf[:n], txId); err == nil {
+				return resp, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("STUN %s 超时", server)
+}
+
+func stunBindingMsg(txId []byte, change uint32) []byte {
+	msg := make([]byte, stunHeaderLen, stunHeaderLen+8)
+	binary.BigEndian.PutUint16(msg[0:], stunBindingRequest)
+	binary.BigEndian.PutUint32(msg[4:], stunMagicCookie)
+	copy(msg[8:], txId)
+	if change != 0 {
+		attr := make([]byte, 8)
+		binary.BigEndian.PutUint16(attr[0:], stunAttrChangeRequest)
+		binary.BigEndian.PutUint16(attr[2:], 4)
+		binary.BigEndian.PutUint32(attr[4:], change)
+		msg = append(msg, attr...)
+	}
+	binary.BigEndian.PutUint16(msg[2:], uint16(len(msg)-stunHeaderLen))
+	return msg
+}
+
+func parseStunResponse(b []byte, txId []byte) (*stunResponse, error) {
+	if len(b) < stunHeaderLen || binary.BigEndian.Uint16(b[0:]) != stunBindingResponse || !bytes.Equal(b[8:20], txId) {
+		return nil, fmt.Errorf("not a binding response")
+	}
+	length := int(binary.BigEndian.Uint16(b[2:]))
+	if stunHeaderLen+length > len(b) {
+		return nil, fmt.Errorf("truncated")
+	}
+
+	resp := &stunResponse{}
+	var mapped, xorMapped *net.UDPAddr
+	attrs := b[stunHeaderLen : stunHeaderLen+length]
+	for len(attrs) >= 4 {
+		typ := binary.BigEndian.Uint16(attrs[0:])
+		l := int(binary.BigEndian.Uint16(attrs[2:]))
+		if 4+l > len(attrs) {
+			break
+		}
+		val := attrs[4 : 4+l]
+		switch typ {
+		case stunAttrMappedAddress:
+			mapped = parseStunAddr(val, nil)
+		case stunAttrXorMappedAddress, stunAttrXorMappedOld:
+			xorMapped = parseStunAddr(val, b[4:20])
+		case stunAttrChangedAddress, stunAttrOtherAddress:
+			resp.other = parseStunAddr(val, nil)
+		}
+		// 属性按4字节对齐
+		attrs = attrs[4+(l+3)&^3:]
+	}
+
+	resp.mapped = xorMapped
+	if resp.mapped == nil {
+		resp.mapped = mapped
+	}
+	if resp.mapped == nil {
+		return nil, fmt.Errorf("no mapped address")
+	}
+	return resp, nil
+}
+
+// 解析地址属性，xor不为nil时是XOR-MAPPED-ADDRESS，xor为magic cookie加事务ID
+func parseStunAddr(v []byte, xor []byte) *net.UDPAddr {
+	if len(v) < 8 {
+		return nil
+	}
+	port := binary.BigEndian.Uint16(v[2:])
+	var ip net.IP
+	switch v[1] {
+	case 0x01:
+		ip = net.IP(append([]byte{}, v[4:8]...))
+	case 0x02:
+		if len(v) < 20 {
+			return nil
+		}
+		ip = net.IP(append([]byte{}, v[4:20]...))
+	default:
+		return nil
+	}
+	if xor != nil {
+		port ^= uint16(stunMagicCookie >> 16)
+		for i := range ip {
+			ip[i] ^= xor[i]
+		}
+	}
+	return &net.UDPAddr{IP: ip, Port: int(port)}
+}
+
+// ParseStunServers 解析逗号分隔的服务器列表，没写端口时用3478
+func ParseStunServers(s string) []string {
+	var rst []string
+	for _, one := range strings.Split(s, ",") {
+		if one = strings.TrimSpace(one); one == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(one); err != nil {
+			one = net.JoinHostPort(one, "3478")
+		}
+		rst = append(rst, one)
+	}
+	return rst
+}
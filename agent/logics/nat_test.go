@@ -0,0 +1,192 @@
+package logics
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// 本地的STUN服务器，两个端口模拟服务器的主地址和另一个地址，按nat模拟设备前面的NAT
+type fakeStun struct {
+	primary, other *net.UDPConn
+	// 返回给设备的映射地址，nil时原样返回来源地址
+	mapper func(src *net.UDPAddr, via *net.UDPConn) *net.UDPAddr
+	// 换地址回包能不能穿过NAT
+	allowChangeIP, allowChangePort bool
+}
+
+func newFakeStun(t *testing.T) *fakeStun {
+	s := &fakeStun{}
+	var err error
+	if s.primary, err = net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}); err != nil {
+		t.Fatal(err)
+	}
+	if s.other, err = net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}); err != nil {
+		t.Fatal(err)
+	}
+	go s.serve(s.primary)
+	go s.serve(s.other)
+	t.Cleanup(func() {
+		s.primary.Close()
+		s.other.Close()
+	})
+	return s
+}
+
+func (s *fakeStun) addr() string {
+	return s.primary.LocalAddr().String()
+}
+
+func (s *fakeStun) serve(conn *net.UDPConn) {
+	buf := make([]byte, 1500)
+	for {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		req := buf[:n]
+		if n < stunHeaderLen || binary.BigEndian.Uint16(req) != stunBindingRequest {
+			continue
+		}
+		var change uint32
+		if n >= stunHeaderLen+8 && binary.BigEndian.Uint16(req[stunHeaderLen:]) == stunAttrChangeRequest {
+			change = binary.BigEndian.Uint32(req[stunHeaderLen+4:])
+		}
+		if change&stunChangeIP != 0 && !s.allowChangeIP {
+			continue
+		}
+		if change&stunChangePort != 0 && change&stunChangeIP == 0 && !s.allowChangePort {
+			continue
+		}
+
+		mapped := src
+		if s.mapper != nil {
+			mapped = s.mapper(src, conn)
+		}
+		resp := make([]byte, stunHeaderLen)
+		binary.BigEndian.PutUint16(resp, stunBindingResponse)
+		copy(resp[4:20], req[4:20])
+		resp = append(resp, stunAddrAttr(stunAttrXorMappedAddress, mapped, req[4:20])...)
+		resp = append(resp, stunAddrAttr(stunAttrOtherAddress, s.other.LocalAddr().(*net.UDPAddr), nil)...)
+		binary.BigEndian.PutUint16(resp[2:], uint16(len(resp)-stunHeaderLen))
+
+		from := conn
+		if change != 0 {
+			from = s.other
+		}
+		from.WriteToUDP(resp, src)
+	}
+}
+
+func stunAddrAttr(typ uint16, addr *net.UDPAddr, xor []byte) []byte {
+	ip := append([]byte{}, addr.IP.To4()...)
+	port := uint16(addr.Port)
+	if xor != nil {
+		port ^= uint16(stunMagicCookie >> 16)
+		for i := range ip {
+			ip[i] ^= xor[i]
+		}
+	}
+	attr := make([]byte, 12)
+	binary.BigEndian.PutUint16(attr, typ)
+	binary.BigEndian.PutUint16(attr[2:], 8)
+	attr[5] = 0x01
+	binary.BigEndian.PutUint16(attr[6:], port)
+	copy(attr[8:], ip)
+	return attr
+}
+
+func TestParseStunResponse(t *testing.T) {
+	txId := []byte("0123456789ab")
+	header := make([]byte, stunHeaderLen)
+	binary.BigEndian.PutUint16(header, stunBindingResponse)
+	binary.BigEndian.PutUint32(header[4:], stunMagicCookie)
+	copy(header[8:], txId)
+
+	want := &net.UDPAddr{IP: net.IPv4(203, 0, 113, 7), Port: 40000}
+	msg := append(append([]byte{}, header...), stunAddrAttr(stunAttrXorMappedAddress, want, header[4:20])...)
+	binary.BigEndian.PutUint16(msg[2:], uint16(len(msg)-stunHeaderLen))
+
+	resp, err := parseStunResponse(msg, txId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.mapped.IP.Equal(want.IP) || resp.mapped.Port != want.Port {
+		t.Errorf("mapped: got %v, want %v", resp.mapped, want)
+	}
+	if _, err := parseStunResponse(msg, []byte("another-txid")); err == nil {
+		t.Errorf("response with another transaction id should not match")
+	}
+}
+
+func TestClassifyNat(t *testing.T) {
+	natIP := net.IPv4(203, 0, 113, 9)
+	cone := func(src *net.UDPAddr, via *net.UDPConn) *net.UDPAddr {
+		return &net.UDPAddr{IP: natIP, Port: src.Port}
+	}
+
+	cases := []struct {
+		name          string
+		mapper        func(*net.UDPAddr, *net.UDPConn) *net.UDPAddr
+		changeIP      bool
+		changePort    bool
+		want          string
+		wantPublicIP  string
+		symmetricPort bool
+	}{
+		{name: "public", changeIP: true, changePort: true, want: NAT_TYPE_PUBLIC, wantPublicIP: "127.0.0.1"},
+		{name: "public firewall", want: NAT_TYPE_PUBLIC_FIREWALL, wantPublicIP: "127.0.0.1"},
+		{name: "full cone", mapper: cone, changeIP: true, changePort: true, want: NAT_TYPE_FULL_CONE},
+		{name: "restricted", mapper: cone, changePort: true, want: NAT_TYPE_RESTRICTED},
+		{name: "port restricted", mapper: cone, want: NAT_TYPE_PORT_RESTRICTED},
+		{name: "symmetric", mapper: cone, want: NAT_TYPE_SYMMETRIC, symmetricPort: true},
+	}
+	for _, c := range cases {
+		s := newFakeStun(t)
+		s.mapper = c.mapper
+		if c.symmetricPort {
+			// 每个服务器地址映射出不同的端口
+			s.mapper = func(src *net.UDPAddr, via *net.UDPConn) *net.UDPAddr {
+				return &net.UDPAddr{IP: natIP, Port: via.LocalAddr().(*net.UDPAddr).Port}
+			}
+		}
+		s.allowChangeIP, s.allowChangePort = c.changeIP, c.changePort
+
+		natType, mapped, _, err := classifyNat([]string{s.addr()}, 200*time.Millisecond)
+		if natType != c.want {
+			t.Errorf("%s: got %s (err %v), want %s", c.name, natType, err, c.want)
+		}
+		wantIP := c.wantPublicIP
+		if wantIP == "" {
+			wantIP = natIP.String()
+		}
+		if mapped == nil || mapped.IP.String() != wantIP {
+			t.Errorf("%s: mapped %v, want %s", c.name, mapped, wantIP)
+		}
+	}
+}
+
+func TestClassifyNatBlocked(t *testing.T) {
+	conn, _ := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	closed := conn.LocalAddr().String()
+	conn.Close()
+
+	natType, mapped, _, err := classifyNat([]string{closed}, 100*time.Millisecond)
+	if natType != NAT_TYPE_UDP_BLOCKED || mapped != nil || err == nil {
+		t.Errorf("got %s %v %v", natType, mapped, err)
+	}
+}
+
+func TestParseStunServers(t *testing.T) {
+	got := ParseStunServers(" stun.qq.com, 1.2.3.4:19302,,[2001:db8::1]:3478 ")
+	want := []string{"stun.qq.com:3478", "1.2.3.4:19302", "[2001:db8::1]:3478"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("%d: got %s, want %s", i, got[i], want[i])
+		}
+	}
+}
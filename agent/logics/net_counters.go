@@ -0,0 +1,184 @@
+package logics
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"pcdnagent/common"
+
+	"github.com/liuhengloveyou/pcdn/protos"
+	"go.uber.org/zap"
+)
+
+// 网卡计数器的基数: 开机时间写在持久目录，只在重启后变，用来区分第一次运行和重启；
+// 上次成功上报的计数器写在tmpfs，agent重启后还在，机器重启后就没了
+var (
+	NetBootFile    = "/opt/pcdnagent/net_boot.json"
+	NetCounterFile = "/run/pcdnagent/net_counters.json"
+)
+
+// 开机时间前后差几秒算同一次开机
+const netBootTolerance = 5
+
+type netCounter struct {
+	BytesSent   uint64 `json:"bytesSent"`
+	BytesRecv   uint64 `json:"bytesRecv"`
+	PacketsSent uint64 `json:"packetsSent"`
+	PacketsRecv uint64 `json:"packetsRecv"`
+	Timestamp   int64  `json:"timestamp"` // 秒
+}
+
+type netBaseline struct {
+	BootTime int64                 `json:"bootTime"`
+	Counters map[string]netCounter `json:"counters"`
+}
+
+var (
+	netMu sync.Mutex
+	// 上次成功上报的计数器，nil表示还没加载
+	netReported map[string]netCounter
+	// 这次心跳里的计数器，服务器应答后才变成基数
+	netPending map[string]netCounter
+	// 这次心跳的timestamp，服务器应答里带回来的是它时才提交
+	netPendingAck int64
+	netBoot       int64
+	// 和上次运行时的开机时间不一样，没有基数的网卡从开机算起
+	netRebooted  bool
+	netBootSaved bool
+	// 上一轮采样的时间，0表示agent启动后还没采样过
+	netLastTs int64
+)
+
+// 心跳里每个网卡的增量，调用前FillSystemInfo已经填了开机时间
+func fillNetDelta(n *protos.SystemMonitorNetwork, bootTime int64) {
+	netMu.Lock()
+	defer netMu.Unlock()
+
+	if netReported == nil {
+		loadNetBaseline(bootTime)
+	}
+	if netPending == nil {
+		netPending = make(map[string]netCounter)
+	}
+
+	cur := netCounter{BytesSent: n.BytesSent, BytesRecv: n.BytesRecv, PacketsSent: n.PacketsSent, PacketsRecv: n.PacketsRecv, Timestamp: n.Timestamp}
+	netPending[n.Name] = cur
+
+	prev, ok := netReported[n.Name]
+	if ok {
+		var resetSent, resetRecv bool
+		n.DeltaSent, resetSent = counterDiff(prev.BytesSent, cur.BytesSent)
+		n.DeltaRecv, resetRecv = counterDiff(prev.BytesRecv, cur.BytesRecv)
+		n.DeltaPacketsSent, _ = counterDiff(prev.PacketsSent, cur.PacketsSent)
+		n.DeltaPacketsRecv, _ = counterDiff(prev.PacketsRecv, cur.PacketsRecv)
+		n.DeltaStart = prev.Timestamp
+		n.CounterReset = resetSent || resetRecv
+		return
+	}
+
+	// 没有基数的网卡
+	var start int64
+	switch {
+	case netLastTs > 0:
+		// agent运行中新出现的网卡，计数器从创建时算起
+		start = netLastTs
+	case netRebooted:
+		start = bootTime
+	default:
+		// 第一次运行，或者同一次开机里丢了基数，只记基数；没有增量可丢，不用等发送成功
+		netReported[n.Name] = cur
+		return
+	}
+	n.DeltaSent, n.DeltaRecv = cur.BytesSent, cur.BytesRecv
+	n.DeltaPacketsSent, n.DeltaPacketsRecv = cur.PacketsSent, cur.PacketsRecv
+	n.DeltaStart = start
+	n.CounterReset = true
+}
+
+// 一轮采样结束，记下采样时间和心跳的timestamp
+func finishNetSample(ts, heartbeatTs int64) {
+	netMu.Lock()
+	defer netMu.Unlock()
+	netLastTs = ts
+	netPendingAck = heartbeatTs
+}
+
+// CommitNetworkCounters 收到服务器对心跳的应答后调用，应答的是最近一次心跳时，这次的计数器成为下次增量的基数。
+// 应答的是更早的心跳时不提交，最近一次心跳的增量和它开始时间一样，服务器只算多出来的部分
+func CommitNetworkCounters(ack int64) {
+	netMu.Lock()
+	defer netMu.Unlock()
+
+	if len(netPending) == 0 || ack == 0 || ack != netPendingAck {
+		return
+	}
+	if netReported == nil {
+		netReported = make(map[string]netCounter)
+	}
+	for name, c := range netPending {
+		netReported[name] = c
+	}
+	netPending = nil
+
+	saveNetBaseline()
+}
+
+// 加载基数，调用时需持有netMu
+func loadNetBaseline(bootTime int64) {
+	netReported = make(map[string]netCounter)
+	netBoot = bootTime
+
+	var saved netBaseline
+	if b, err := os.ReadFile(NetBootFile); err == nil && json.Unmarshal(b, &saved) == nil {
+		netRebooted = math.Abs(float64(saved.BootTime-bootTime)) > netBootTolerance
+		netBootSaved = !netRebooted
+	}
+
+	var counters netBaseline
+	if b, err := os.ReadFile(NetCounterFile); err == nil && json.Unmarshal(b, &counters) == nil {
+		if math.Abs(float64(counters.BootTime-bootTime)) <= netBootTolerance && counters.Counters != nil {
+			netReported = counters.Counters
+		}
+	}
+	common.Logger.Info("loadNetBaseline: ", zap.Int64("bootTime", bootTime), zap.Bool("rebooted", netRebooted), zap.Int("ifaces", len(netReported)))
+}
+
+// 调用时需持有netMu
+func saveNetBaseline() {
+	b, _ := json.Marshal(&netBaseline{BootTime: netBoot, Counters: netReported})
+	if err := writeFileMkdir(NetCounterFile, b); err != nil {
+		common.Logger.Warn("saveNetBaseline ERR: ", zap.Error(err))
+	}
+
+	// 开机时间只在变了的时候写
+	if netBootSaved {
+		return
+	}
+	b, _ = json.Marshal(&netBaseline{BootTime: netBoot})
+	if err := writeFileMkdir(NetBootFile, b); err != nil {
+		common.Logger.Warn("saveNetBaseline ERR: ", zap.Error(err))
+		return
+	}
+	netBootSaved = true
+}
+
+func writeFileMkdir(fn string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(fn, b, 0644)
+}
+
+// counterDiff 两次计数的差。变小时，上次的值在32位计数器的上半段算回绕，否则算被清零过，增量从0算起
+func counterDiff(prev, cur uint64) (uint64, bool) {
+	if cur >= prev {
+		return cur - prev, false
+	}
+	if prev >= 1<<31 && prev <= math.MaxUint32 {
+		return cur + (1 << 32) - prev, false
+	}
+	return cur, true
+}
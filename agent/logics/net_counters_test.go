@@ -0,0 +1,103 @@
+package logics
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/liuhengloveyou/pcdn/protos"
+)
+
+func TestCounterDiff(t *testing.T) {
+	cases := []struct {
+		prev, cur uint64
+		want      uint64
+		reset     bool
+	}{
+		{100, 150, 50, false},
+		// 32位计数器回绕
+		{math.MaxUint32 - 9, 20, 30, false},
+		// 64位计数器变小是被清零了
+		{1 << 40, 20, 20, true},
+		// 32位计数器的下半段变小也算清零
+		{1000, 20, 20, true},
+	}
+	for i, c := range cases {
+		got, reset := counterDiff(c.prev, c.cur)
+		if got != c.want || reset != c.reset {
+			t.Errorf("case %d: got %d/%v, want %d/%v", i, got, reset, c.want, c.reset)
+		}
+	}
+}
+
+// 换成临时文件，清掉包里的状态，模拟agent启动
+func restartNetCounters(t *testing.T, dir string) {
+	NetBootFile = filepath.Join(dir, "opt", "net_boot.json")
+	NetCounterFile = filepath.Join(dir, "run", "net_counters.json")
+	netReported, netPending = nil, nil
+	netRebooted, netBootSaved = false, false
+	netLastTs, netPendingAck = 0, 0
+}
+
+func netSample(name string, sent, recv uint64, ts, boot int64) *protos.SystemMonitorNetwork {
+	n := &protos.SystemMonitorNetwork{Name: name, BytesSent: sent, BytesRecv: recv, Timestamp: ts}
+	fillNetDelta(n, boot)
+	finishNetSample(ts, ts)
+	return n
+}
+
+func TestNetDelta(t *testing.T) {
+	oldBoot, oldCounter := NetBootFile, NetCounterFile
+	defer func() { NetBootFile, NetCounterFile = oldBoot, oldCounter }()
+	dir := t.TempDir()
+	const boot = 1000
+
+	// 第一次运行只记基数
+	restartNetCounters(t, dir)
+	n := netSample("eth0", 5000, 8000, 2000, boot)
+	if n.DeltaStart != 0 || n.DeltaSent != 0 || n.BytesSent != 5000 {
+		t.Errorf("first run: got %+v", n)
+	}
+	CommitNetworkCounters(2000)
+
+	n = netSample("eth0", 5600, 8100, 2010, boot)
+	if n.DeltaSent != 600 || n.DeltaRecv != 100 || n.DeltaStart != 2000 || n.CounterReset {
+		t.Errorf("second sample: got %+v", n)
+	}
+	// 没收到应答没有提交，下次的增量从上次应答的基数算
+	n = netSample("eth0", 5700, 8200, 2020, boot)
+	if n.DeltaSent != 700 || n.DeltaStart != 2000 {
+		t.Errorf("after lost ack: got %+v", n)
+	}
+	// 迟到的上一次心跳的应答不提交
+	CommitNetworkCounters(2010)
+	n = netSample("eth0", 5750, 8250, 2025, boot)
+	if n.DeltaSent != 750 || n.DeltaStart != 2000 {
+		t.Errorf("after stale ack: got %+v", n)
+	}
+	CommitNetworkCounters(2025)
+
+	// 新出现的网卡从0算起
+	n = netSample("ppp0", 300, 400, 2030, boot)
+	if n.DeltaSent != 300 || n.DeltaStart != 2025 || !n.CounterReset {
+		t.Errorf("new iface: got %+v", n)
+	}
+	netSample("eth0", 5800, 8300, 2030, boot)
+	CommitNetworkCounters(2030)
+
+	// agent重启，同一次开机，接着tmpfs里的基数算
+	restartNetCounters(t, dir)
+	n = netSample("eth0", 6800, 8300, 2100, boot+2)
+	if n.DeltaSent != 1000 || n.DeltaStart != 2030 {
+		t.Errorf("agent restart: got %+v", n)
+	}
+	CommitNetworkCounters(2100)
+
+	// 机器重启，tmpfs清空了，从开机算起
+	restartNetCounters(t, dir)
+	NetCounterFile = filepath.Join(dir, "run2", "net_counters.json")
+	n = netSample("eth0", 50, 60, 9100, 9000)
+	if n.DeltaSent != 50 || n.DeltaRecv != 60 || n.DeltaStart != 9000 || !n.CounterReset {
+		t.Errorf("reboot: got %+v", n)
+	}
+}
@@ -0,0 +1,413 @@
+package logics
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"pcdnagent/common"
+
+	"github.com/liuhengloveyou/pcdn/protos"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	probeDefaultInterval  = 60
+	probeMinInterval      = 10
+	probeDefaultCount     = 5
+	probeMaxCount         = 20
+	probeDefaultTimeoutMs = 2000
+	probeMaxTargets       = 20
+	// 同一轮里相邻两次探测的间隔
+	probeGap = 200 * time.Millisecond
+)
+
+// 探测设置保存的位置，重启后不用等服务器重新下发
+var ProbeFile = "/opt/pcdnagent/probe.json"
+
+type probeState struct {
+	target  *protos.ProbeTarget
+	nextRun time.Time
+	running bool
+	result  *protos.ProbeResult
+}
+
+var (
+	probeMu     sync.Mutex
+	probeConfig *protos.ProbeConfig
+	probeStates = make(map[string]*probeState)
+)
+
+// ConfigureProbes 替换探测设置，没变的目标保留上一轮的结果
+func ConfigureProbes(cfg *protos.ProbeConfig) error {
+	if cfg == nil {
+		return fmt.Errorf("config is nil")
+	}
+	if len(cfg.Targets) > probeMaxTargets {
+		return fmt.Errorf("探测目标太多: %d", len(cfg.Targets))
+	}
+	names := make(map[string]bool, len(cfg.Targets))
+	for _, t := range cfg.Targets {
+		if err := validateProbeTarget(t); err != nil {
+			return err
+		}
+		if names[t.Name] {
+			return fmt.Errorf("探测目标重名: %s", t.Name)
+		}
+		names[t.Name] = true
+	}
+
+	probeMu.Lock()
+	defer probeMu.Unlock()
+
+	applyProbeConfig(cfg)
+
+	data, err := protojson.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	if len(cfg.Targets) == 0 {
+		if err := os.Remove(ProbeFile); err != nil && !os.IsNotExist(err) {
+			common.Logger.Error("ConfigureProbes remove ERR: ", zap.Error(err))
+		}
+		return nil
+	}
+	if err := os.WriteFile(ProbeFile, data, 0600); err != nil {
+		common.Logger.Error("ConfigureProbes write ERR: ", zap.String("file", ProbeFile), zap.Error(err))
+	}
+	return nil
+}
+
+// RestoreProbes 开机时读取保存的探测设置
+func RestoreProbes() {
+	data, err := os.ReadFile(ProbeFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			common.Logger.Error("RestoreProbes read ERR: ", zap.String("file", ProbeFile), zap.Error(err))
+		}
+		return
+	}
+
+	cfg := &protos.ProbeConfig{}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, cfg); err != nil {
+		common.Logger.Error("RestoreProbes json ERR: ", zap.String("file", ProbeFile), zap.Error(err))
+		return
+	}
+
+	probeMu.Lock()
+	applyProbeConfig(cfg)
+	probeMu.Unlock()
+}
+
+// applyProbeConfig 调用时需持有probeMu
+func applyProbeConfig(cfg *protos.ProbeConfig) {
+	states := make(map[string]*probeState, len(cfg.Targets))
+	for _, t := range cfg.Targets {
+		st := &probeState{target: t}
+		if old, ok := probeStates[t.Name]; ok && old.target.Type == t.Type && old.target.Target == t.Target {
+			st.result = old.result
+			st.nextRun = old.nextRun
+		}
+		states[t.Name] = st
+	}
+	probeConfig = cfg
+	probeStates = states
+}
+
+func validateProbeTarget(t *protos.ProbeTarget) error {
+	if t == nil || t.Name == "" || t.Target == "" {
+		return fmt.Errorf("探测目标不完整")
+	}
+	switch t.Type {
+	case "icmp", "dns":
+	case "tcp":
+		if _, _, err := net.SplitHostPort(t.Target); err != nil {
+			return fmt.Errorf("%s: 地址要带端口: %s", t.Name, t.Target)
+		}
+	case "http":
+		u, err := url.Parse(t.Target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s: URL错误: %s", t.Name, t.Target)
+		}
+	default:
+		return fmt.Errorf("%s: 不支持的探测类型: %s", t.Name, t.Type)
+	}
+	if t.DnsServer != "" {
+		if _, _, err := net.SplitHostPort(t.DnsServer); err != nil {
+			return fmt.Errorf("%s: DNS服务器要带端口: %s", t.Name, t.DnsServer)
+		}
+	}
+
+	if t.Interval == 0 {
+		t.Interval = probeDefaultInterval
+	}
+	if t.Interval < probeMinInterval {
+		t.Interval = probeMinInterval
+	}
+	if t.Count == 0 {
+		t.Count = probeDefaultCount
+	}
+	if t.Count > probeMaxCount {
+		t.Count = probeMaxCount
+	}
+	if t.TimeoutMs == 0 {
+		t.TimeoutMs = probeDefaultTimeoutMs
+	}
+	return nil
+}
+
+// TickProbes 到时间的目标各起一个goroutine探测，上一轮没结束的跳过
+func TickProbes() {
+	now := time.Now()
+
+	probeMu.Lock()
+	defer probeMu.Unlock()
+
+	for _, st := range probeStates {
+		if st.running || now.Before(st.nextRun) {
+			continue
+		}
+		st.running = true
+		st.nextRun = now.Add(time.Duration(st.target.Interval) * time.Second)
+
+		go func(st *probeState) {
+			r := runProbe(st.target)
+
+			probeMu.Lock()
+			st.running = false
+			st.result = r
+			probeMu.Unlock()
+		}(st)
+	}
+}
+
+// FillProbeInfo 每个目标最近一轮的结果放到心跳里
+func FillProbeInfo(heartbeat *protos.Heartbeat) {
+	probeMu.Lock()
+	defer probeMu.Unlock()
+
+	if probeConfig != nil {
+		heartbeat.ProbeVersion = probeConfig.Version
+	}
+	for _, st := range probeStates {
+		if st.result != nil {
+			heartbeat.Probes = append(heartbeat.Probes, st.result)
+		}
+	}
+	sort.Slice(heartbeat.Probes, func(i, j int) bool { return heartbeat.Probes[i].Name < heartbeat.Probes[j].Name })
+}
+
+func runProbe(t *protos.ProbeTarget) *protos.ProbeResult {
+	start := time.Now()
+	timeout := time.Duration(t.TimeoutMs) * time.Millisecond
+
+	var rtts []time.Duration
+	var sent int
+	var err error
+	switch t.Type {
+	case "icmp":
+		rtts, sent, err = probeICMP(t.Target, int(t.Count), timeout)
+	case "tcp":
+		rtts, sent, err = probeRepeat(int(t.Count), func() error {
+			conn, err := net.DialTimeout("tcp", t.Target, timeout)
+			if err == nil {
+				conn.Close()
+			}
+			return err
+		})
+	case "http":
+		client := &http.Client{Timeout: timeout, Transport: &http.Transport{DisableKeepAlives: true}}
+		rtts, sent, err = probeRepeat(int(t.Count), func() error {
+			resp, err := client.Get(t.Target)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= 400 {
+				return fmt.Errorf("http %d", resp.StatusCode)
+			}
+			return nil
+		})
+	case "dns":
+		resolver := probeResolver(t.DnsServer)
+		rtts, sent, err = probeRepeat(int(t.Count), func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			_, err := resolver.LookupHost(ctx, t.Target)
+			return err
+		})
+	}
+
+	r := summarizeProbe(rtts, sent)
+	r.Name, r.Type, r.Target = t.Name, t.Type, t.Target
+	r.Timestamp = start.UnixMilli()
+	if err != nil {
+		r.ErrMsg = err.Error()
+	}
+	return r
+}
+
+// probeRepeat 顺序执行count次，记录成功的耗时和最后一次错误
+func probeRepeat(count int, fn func() error) ([]time.Duration, int, error) {
+	var rtts []time.Duration
+	var lastErr error
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			time.Sleep(probeGap)
+		}
+		start := time.Now()
+		if err := fn(); err != nil {
+			lastErr = err
+			continue
+		}
+		rtts = append(rtts, time.Since(start))
+	}
+	return rtts, count, lastErr
+}
+
+// 指定了DNS服务器时不走系统设置
+func probeResolver(server string) *net.Resolver {
+	if server == "" {
+		return &net.Resolver{PreferGo: true}
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// summarizeProbe 按成功的耗时算时延、抖动和丢包率
+func summarizeProbe(rtts []time.Duration, sent int) *protos.ProbeResult {
+	r := &protos.ProbeResult{Sent: uint32(sent), Received: uint32(len(rtts))}
+	if sent > 0 {
+		r.LossPercent = float64(sent-len(rtts)) * 100 / float64(sent)
+	}
+	if len(rtts) == 0 {
+		return r
+	}
+
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	r.MinMs = math.MaxFloat64
+	var sum, jitter float64
+	for i, d := range rtts {
+		v := ms(d)
+		sum += v
+		r.MinMs = math.Min(r.MinMs, v)
+		r.MaxMs = math.Max(r.MaxMs, v)
+		if i > 0 {
+			jitter += math.Abs(v - ms(rtts[i-1]))
+		}
+	}
+	r.AvgMs = sum / float64(len(rtts))
+	if len(rtts) > 1 {
+		r.JitterMs = jitter / float64(len(rtts)-1)
+	}
+	return r
+}
+
+// probeICMP 发ICMP echo，没有root权限时用内核的ping socket
+func probeICMP(host string, count int, timeout time.Duration) ([]time.Duration, int, error) {
+	ipAddr, err := net.ResolveIPAddr("ip", host)
+	if err != nil {
+		return nil, count, err
+	}
+
+	v6 := ipAddr.IP.To4() == nil
+	network, echoType, replyType := "ip4:icmp", byte(8), byte(0)
+	if v6 {
+		network, echoType, replyType = "ip6:ipv6-icmp", 128, 129
+	}
+
+	var dst net.Addr = ipAddr
+	conn, err := net.ListenPacket(network, "")
+	if err != nil {
+		udpNetwork := "udp4"
+		if v6 {
+			udpNetwork = "udp6"
+		}
+		if conn, err = net.ListenPacket(udpNetwork, ""); err != nil {
+			return nil, count, err
+		}
+		dst = &net.UDPAddr{IP: ipAddr.IP, Zone: ipAddr.Zone}
+	}
+	defer conn.Close()
+
+	// ping socket会改掉id，用随机数据区分自己的应答
+	nonce := make([]byte, 8)
+	rand.Read(nonce)
+	id := uint16(os.Getpid())
+
+	var rtts []time.Duration
+	var lastErr error
+	buf := make([]byte, 1500)
+	for seq := 1; seq <= count; seq++ {
+		if seq > 1 {
+			time.Sleep(probeGap)
+		}
+
+		start := time.Now()
+		conn.SetDeadline(start.Add(timeout))
+		if _, err := conn.WriteTo(icmpEcho(echoType, id, uint16(seq), nonce, !v6), dst); err != nil {
+			lastErr = err
+			continue
+		}
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				lastErr = err
+				break
+			}
+			if isEchoReply(buf[:n], replyType, uint16(seq), nonce) {
+				rtts = append(rtts, time.Since(start))
+				break
+			}
+		}
+	}
+	return rtts, count, lastErr
+}
+
+// icmpEcho ICMPv6的校验和由内核计算
+func icmpEcho(typ byte, id, seq uint16, payload []byte, checksum bool) []byte {
+	b := make([]byte, 8+len(payload))
+	b[0] = typ
+	binary.BigEndian.PutUint16(b[4:], id)
+	binary.BigEndian.PutUint16(b[6:], seq)
+	copy(b[8:], payload)
+	if checksum {
+		binary.BigEndian.PutUint16(b[2:], icmpChecksum(b))
+	}
+	return b
+}
+
+func isEchoReply(b []byte, typ byte, seq uint16, payload []byte) bool {
+	return len(b) >= 8+len(payload) && b[0] == typ && b[1] == 0 &&
+		binary.BigEndian.Uint16(b[6:]) == seq && bytes.Equal(b[8:8+len(payload)], payload)
+}
+
+func icmpChecksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
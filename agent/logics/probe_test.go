@@ -0,0 +1,150 @@
+package logics
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/liuhengloveyou/pcdn/protos"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestSummarizeProbe(t *testing.T) {
+	rtts := []time.Duration{10 * time.Millisecond, 14 * time.Millisecond, 12 * time.Millisecond}
+	r := summarizeProbe(rtts, 4)
+
+	if r.Sent != 4 || r.Received != 3 || r.LossPercent != 25 {
+		t.Errorf("sent/received/loss: got %d/%d/%v", r.Sent, r.Received, r.LossPercent)
+	}
+	if r.MinMs != 10 || r.MaxMs != 14 || r.AvgMs != 12 {
+		t.Errorf("min/max/avg: got %v/%v/%v", r.MinMs, r.MaxMs, r.AvgMs)
+	}
+	// |14-10| 和 |12-14| 的平均
+	if r.JitterMs != 3 {
+		t.Errorf("jitter: got %v, want 3", r.JitterMs)
+	}
+
+	r = summarizeProbe(nil, 5)
+	if r.LossPercent != 100 || r.AvgMs != 0 {
+		t.Errorf("all lost: got loss %v avg %v", r.LossPercent, r.AvgMs)
+	}
+}
+
+func TestValidateProbeTarget(t *testing.T) {
+	cases := []struct {
+		target *protos.ProbeTarget
+		ok     bool
+	}{
+		{&protos.ProbeTarget{Name: "gw", Type: "icmp", Target: "192.168.1.1"}, true},
+		{&protos.ProbeTarget{Name: "cdn", Type: "tcp", Target: "example.com:443"}, true},
+		{&protos.ProbeTarget{Name: "cdn", Type: "tcp", Target: "example.com"}, false},
+		{&protos.ProbeTarget{Name: "web", Type: "http", Target: "https://example.com/ping"}, true},
+		{&protos.ProbeTarget{Name: "web", Type: "http", Target: "example.com"}, false},
+		{&protos.ProbeTarget{Name: "dns", Type: "dns", Target: "example.com", DnsServer: "223.5.5.5:53"}, true},
+		{&protos.ProbeTarget{Name: "dns", Type: "dns", Target: "example.com", DnsServer: "223.5.5.5"}, false},
+		{&protos.ProbeTarget{Name: "x", Type: "udp", Target: "1.1.1.1"}, false},
+		{&protos.ProbeTarget{Type: "icmp", Target: "1.1.1.1"}, false},
+	}
+	for i, c := range cases {
+		if err := validateProbeTarget(c.target); (err == nil) != c.ok {
+			t.Errorf("case %d: got err %v, want ok=%v", i, err, c.ok)
+		}
+	}
+
+	tg := &protos.ProbeTarget{Name: "gw", Type: "icmp", Target: "1.1.1.1", Interval: 1, Count: 100}
+	validateProbeTarget(tg)
+	if tg.Interval != probeMinInterval || tg.Count != probeMaxCount || tg.TimeoutMs != probeDefaultTimeoutMs {
+		t.Errorf("defaults: got interval %d count %d timeout %d", tg.Interval, tg.Count, tg.TimeoutMs)
+	}
+}
+
+func TestIcmpEcho(t *testing.T) {
+	nonce := []byte("12345678")
+	msg := icmpEcho(8, 0x1234, 7, nonce, true)
+	if icmpChecksum(msg) != 0 {
+		t.Errorf("checksum of echo request should verify to 0")
+	}
+
+	reply := append([]byte{}, msg...)
+	reply[0] = 0
+	if !isEchoReply(reply, 0, 7, nonce) {
+		t.Errorf("reply not matched")
+	}
+	if isEchoReply(reply, 0, 8, nonce) || isEchoReply(reply, 0, 7, []byte("87654321")) || isEchoReply(msg, 0, 7, nonce) {
+		t.Errorf("wrong seq, payload or type matched")
+	}
+}
+
+func TestRunProbeTcpHttp(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	tcpTarget := &protos.ProbeTarget{Name: "tcp", Type: "tcp", Target: srv.Listener.Addr().String(), Count: 2}
+	validateProbeTarget(tcpTarget)
+	r := runProbe(tcpTarget)
+	if r.Received != 2 || r.LossPercent != 0 || r.ErrMsg != "" {
+		t.Errorf("tcp: got %+v", r)
+	}
+
+	httpTarget := &protos.ProbeTarget{Name: "http", Type: "http", Target: srv.URL + "/ok", Count: 2}
+	validateProbeTarget(httpTarget)
+	if r := runProbe(httpTarget); r.Received != 2 || r.ErrMsg != "" {
+		t.Errorf("http: got %+v", r)
+	}
+
+	downTarget := &protos.ProbeTarget{Name: "down", Type: "http", Target: srv.URL + "/down", Count: 1}
+	validateProbeTarget(downTarget)
+	if r := runProbe(downTarget); r.Received != 0 || r.LossPercent != 100 || r.ErrMsg == "" {
+		t.Errorf("http down: got %+v", r)
+	}
+
+	// 关掉的端口
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	closed := ln.Addr().String()
+	ln.Close()
+	closedTarget := &protos.ProbeTarget{Name: "closed", Type: "tcp", Target: closed, Count: 1, TimeoutMs: 500}
+	validateProbeTarget(closedTarget)
+	if r := runProbe(closedTarget); r.LossPercent != 100 {
+		t.Errorf("closed tcp: got %+v", r)
+	}
+}
+
+func TestProbeFile(t *testing.T) {
+	oldFile := ProbeFile
+	probeMu.Lock()
+	oldCfg, oldStates := probeConfig, probeStates
+	probeMu.Unlock()
+	defer func() {
+		ProbeFile = oldFile
+		probeMu.Lock()
+		probeConfig, probeStates = oldCfg, oldStates
+		probeMu.Unlock()
+	}()
+	ProbeFile = filepath.Join(t.TempDir(), "probe.json")
+
+	cfg := &protos.ProbeConfig{Targets: []*protos.ProbeTarget{
+		{Name: "dns", Type: "dns", Target: "example.com", Interval: 60, Count: 3, TimeoutMs: 1000, DnsServer: "8.8.8.8:53"},
+	}}
+	if err := ConfigureProbes(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	probeMu.Lock()
+	probeConfig, probeStates = nil, make(map[string]*probeState)
+	probeMu.Unlock()
+	RestoreProbes()
+
+	probeMu.Lock()
+	got := probeConfig
+	probeMu.Unlock()
+	if !proto.Equal(got, cfg) {
+		t.Fatalf("restored: %v", got)
+	}
+}
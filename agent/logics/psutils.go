@@ -4,95 +4,278 @@ import (
 	"context"
 	"fmt"
 	"pcdnagent/common"
+	"sort"
+	"strings"
 
 	"github.com/liuhengloveyou/pcdn/protos"
 	"go.uber.org/zap"
 
-	"github.com/shirou/gopsutil/v4/docker"
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/disk"
+	"github.com/shirou/gopsutil/v4/host"
+	"github.com/shirou/gopsutil/v4/load"
+	"github.com/shirou/gopsutil/v4/mem"
 	"github.com/shirou/gopsutil/v4/process"
+	"github.com/shirou/gopsutil/v4/sensors"
 )
 
+// 心跳里带的进程数，按CPU、内存和TCP连接数各取前N个
+var ProcessTopN = 20
+
+var (
+	// 上次心跳时的进程对象，用来计算两次心跳之间的CPU使用率
+	procCache      = make(map[int32]*process.Process)
+	procCacheStart = make(map[int32]int64)
+)
+
+// FillProcessInfo 填充进程信息，只带CPU、内存占用和TCP连接数最高的ProcessTopN个
 func FillProcessInfo(heartbeat *protos.Heartbeat) {
-	processes, _ := process.ProcessesWithContext(context.Background())
+	ctx := context.Background()
+	processes, err := process.ProcessesWithContext(ctx)
+	if err != nil {
+		common.Logger.Error("ProcessesWithContext ERR", zap.Error(err))
+		return
+	}
+	heartbeat.Monitor.ProcessCount = uint32(len(processes))
+
+	alive := make(map[int32]bool, len(processes))
+	pids := make([]int32, 0, len(processes))
+	all := make([]*protos.SystemMonitorProcess, 0, len(processes))
 	for _, p := range processes {
-		name, _ := p.Name()
-		exe, _ := p.Exe()
-		CPUPercent, _ := p.CPUPercent()
-
-		heartbeat.Monitor.Processes = append(heartbeat.Monitor.Processes, &protos.SystemMonitorProcess{
-			Pid:  p.Pid,
-			Name: name,
-			Exe:  exe,
-			Cpu:  float32(CPUPercent),
+		createTime, _ := p.CreateTimeWithContext(ctx)
+		if cached, ok := procCache[p.Pid]; ok && procCacheStart[p.Pid] == createTime {
+			p = cached
+		} else {
+			procCache[p.Pid] = p
+			procCacheStart[p.Pid] = createTime
+		}
+		alive[p.Pid] = true
+		pids = append(pids, p.Pid)
+
+		cpuPercent, _ := p.PercentWithContext(ctx, 0)
+		memPercent, _ := p.MemoryPercentWithContext(ctx)
+		all = append(all, &protos.SystemMonitorProcess{
+			Pid:        p.Pid,
+			Cpu:        float32(cpuPercent),
+			Memory:     memPercent,
+			CreateTime: createTime,
 		})
 	}
+	for pid := range procCache {
+		if !alive[pid] {
+			delete(procCache, pid)
+			delete(procCacheStart, pid)
+		}
+	}
+
+	// 连接数多的进程也要带上，方便发现异常的程序
+	socks := processSockets(pids)
+	for _, one := range all {
+		if ps, ok := socks[one.Pid]; ok {
+			one.Established = ps.established
+		}
+	}
+
+	for _, one := range topProcesses(all, ProcessTopN) {
+		if ps, ok := socks[one.Pid]; ok {
+			one.ListenPorts = ps.listenPorts
+			one.Sockets = ps.sockets
+		}
+		p := procCache[one.Pid]
+		one.Name, _ = p.NameWithContext(ctx)
+		one.Exe, _ = p.ExeWithContext(ctx)
+		one.Username, _ = p.UsernameWithContext(ctx)
+		if status, err := p.StatusWithContext(ctx); err == nil && len(status) > 0 {
+			one.Status = status[0]
+		}
+		if mem, err := p.MemoryInfoWithContext(ctx); err == nil {
+			one.Rss = mem.RSS
+		}
+		heartbeat.Monitor.Processes = append(heartbeat.Monitor.Processes, one)
+	}
 }
 
-func FillDockerInfo(heartbeat *protos.Heartbeat) {
-	dockerIDList, _ := docker.GetDockerIDList()
-	for _, dockerID := range dockerIDList {
-		fmt.Println(">>>", dockerID)
+// topProcesses CPU、内存和已建立连接数各自前n个的并集，按CPU从高到低
+func topProcesses(all []*protos.SystemMonitorProcess, n int) []*protos.SystemMonitorProcess {
+	if n <= 0 || len(all) <= n {
+		sort.Slice(all, func(i, j int) bool { return all[i].Cpu > all[j].Cpu })
+		return all
+	}
+
+	picked := make(map[int32]bool, 3*n)
+	sort.Slice(all, func(i, j int) bool { return all[i].Established > all[j].Established })
+	for _, p := range all[:n] {
+		if p.Established > 0 {
+			picked[p.Pid] = true
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Memory > all[j].Memory })
+	for _, p := range all[:n] {
+		picked[p.Pid] = true
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Cpu > all[j].Cpu })
+	for _, p := range all[:n] {
+		picked[p.Pid] = true
+	}
+
+	rst := make([]*protos.SystemMonitorProcess, 0, len(picked))
+	for _, p := range all {
+		if picked[p.Pid] {
+			rst = append(rst, p)
+		}
 	}
+	return rst
 }
 
-var prevNewworkStats []NetworkStats
+// FillSystemInfo 填充CPU、内存、磁盘、负载和开机时长
+func FillSystemInfo(heartbeat *protos.Heartbeat) {
+	ctx := context.Background()
+	monitor := heartbeat.Monitor
 
-// FillNetworkInfo 填充网络流量信息到心跳消息中
-func FillNetworkInfo(heartbeat *protos.Heartbeat) {
-	var err error
+	monitor.Cpu = &protos.SystemMonitorCpu{Temperature: cpuTemperature(ctx)}
+	if percent, err := cpu.PercentWithContext(ctx, 0, false); err == nil && len(percent) > 0 {
+		monitor.Cpu.Usage = float32(percent[0])
+	}
+	if cores, err := cpu.CountsWithContext(ctx, true); err == nil {
+		monitor.Cpu.Cores = int32(cores)
+	}
+	if avg, err := load.AvgWithContext(ctx); err == nil {
+		monitor.Cpu.Load1 = float32(avg.Load1)
+		monitor.Cpu.Load5 = float32(avg.Load5)
+		monitor.Cpu.Load15 = float32(avg.Load15)
+	}
 
-	if len(prevNewworkStats) == 0 {
-		// 获取所有网络接口的初始统计信息
-		prevNewworkStats, err = GetNetworkStatsWithContext(context.Background())
-		if err != nil {
-			common.Logger.Error("GetNetworkStatsWithContext ERR", zap.Error(err))
-			return
+	if vm, err := mem.VirtualMemoryWithContext(ctx); err == nil {
+		monitor.Memory = &protos.SystemMonitorMemory{
+			Used:        int64(vm.Used),
+			Total:       int64(vm.Total),
+			Available:   int64(vm.Available),
+			UsedPercent: float32(vm.UsedPercent),
+		}
+		if swap, err := mem.SwapMemoryWithContext(ctx); err == nil {
+			monitor.Memory.SwapUsed = int64(swap.Used)
+			monitor.Memory.SwapTotal = int64(swap.Total)
 		}
-		return
 	}
 
-	// 获取当前统计信息
+	monitor.Disks = diskUsages(ctx)
+	for _, d := range monitor.Disks {
+		if d.Mount == "/" {
+			monitor.Disk = d
+		}
+	}
+
+	if bootTime, err := host.BootTimeWithContext(ctx); err == nil {
+		monitor.BootTime = int64(bootTime)
+	}
+	if uptime, err := host.UptimeWithContext(ctx); err == nil {
+		monitor.Uptime = uptime
+	}
+}
+
+// diskUsages 每个物理分区的用量，同一个设备挂了多次只算第一个挂载点
+func diskUsages(ctx context.Context) []*protos.SystemMonitorDisk {
+	partitions, err := disk.PartitionsWithContext(ctx, false)
+	if err != nil {
+		common.Logger.Error("PartitionsWithContext ERR", zap.Error(err))
+		return nil
+	}
+
+	var rst []*protos.SystemMonitorDisk
+	seen := make(map[string]bool)
+	for _, part := range partitions {
+		if seen[part.Device] {
+			continue
+		}
+		usage, err := disk.UsageWithContext(ctx, part.Mountpoint)
+		if err != nil || usage.Total == 0 {
+			continue
+		}
+		seen[part.Device] = true
+
+		rst = append(rst, &protos.SystemMonitorDisk{
+			Used:        int64(usage.Used),
+			Total:       int64(usage.Total),
+			Free:        int64(usage.Free),
+			Mount:       part.Mountpoint,
+			Device:      part.Device,
+			Fstype:      part.Fstype,
+			UsedPercent: float32(usage.UsedPercent),
+		})
+	}
+	return rst
+}
+
+// cpuTemperature CPU温度，优先用CPU相关的传感器，取最高值
+func cpuTemperature(ctx context.Context) float32 {
+	temps, _ := sensors.TemperaturesWithContext(ctx)
+
+	var cpuMax, anyMax float64
+	for _, t := range temps {
+		if t.Temperature <= 0 || t.Temperature > 150 {
+			continue
+		}
+		anyMax = max(anyMax, t.Temperature)
+
+		key := strings.ToLower(t.SensorKey)
+		for _, prefix := range []string{"coretemp", "k10temp", "cpu", "soc", "x86_pkg_temp"} {
+			if strings.Contains(key, prefix) {
+				cpuMax = max(cpuMax, t.Temperature)
+				break
+			}
+		}
+	}
+
+	if cpuMax > 0 {
+		return float32(cpuMax)
+	}
+	return float32(anyMax)
+}
+
+var prevNewworkStats []NetworkStats
+
+// FillNetworkInfo 填充网络流量信息到心跳消息中，累计计数和增量每次都带上，速率从第二次采样开始有
+func FillNetworkInfo(heartbeat *protos.Heartbeat) {
 	currentStats, err := GetNetworkStatsWithContext(context.Background())
 	if err != nil {
 		common.Logger.Error("GetNetworkStatsWithContext ERR", zap.Error(err))
 		return
 	}
 
-	// 计算并打印每个接口的速率
+	prevStats := make(map[string]NetworkStats, len(prevNewworkStats))
+	for _, prev := range prevNewworkStats {
+		prevStats[prev.Name] = prev
+	}
+
+	var now int64
 	for _, curr := range currentStats {
-		for _, prev := range prevNewworkStats {
-			if curr.Name == prev.Name {
-				// 计算上传和下载速率 (bytes/s)
-				uploadRate := float64(0)
-				if curr.BytesSent >= prev.BytesSent {
-					uploadRate = float64(curr.BytesSent-prev.BytesSent) / float64(curr.Timestamp-prev.Timestamp)
-				}
-
-				downloadRate := float64(0)
-				if curr.BytesRecv >= prev.BytesRecv {
-					downloadRate = float64(curr.BytesRecv-prev.BytesRecv) / float64(curr.Timestamp-prev.Timestamp)
-				}
-
-				heartbeat.Monitor.Network = append(heartbeat.Monitor.Network, &protos.SystemMonitorNetwork{
-					Name:      curr.Name,
-					Timestamp: curr.Timestamp,
-					SendRate:  uploadRate,
-					RecvRate:  downloadRate,
-				})
-
-				// // 转换为更友好的单位
-				// uploadRateStr := formatBytesPerSecond(uploadRate)
-				// downloadRateStr := formatBytesPerSecond(downloadRate)
-				// totalUploadStr := formatBytes(curr.BytesSent)
-				// totalDownloadStr := formatBytes(curr.BytesRecv)
-				// // 打印结果
-				// fmt.Printf("%-10s %-15s %-15s %-15s %-15s\n",
-				// 	curr.Name, uploadRateStr, downloadRateStr, totalUploadStr, totalDownloadStr)
+		n := &protos.SystemMonitorNetwork{
+			Name:        curr.Name,
+			Timestamp:   curr.Timestamp,
+			BytesSent:   curr.BytesSent,
+			BytesRecv:   curr.BytesRecv,
+			PacketsSent: curr.PacketsSent,
+			PacketsRecv: curr.PacketsRecv,
+			Errin:       curr.Errin,
+			Errout:      curr.Errout,
+			Dropin:      curr.Dropin,
+			Dropout:     curr.Dropout,
+		}
 
-				break
-			}
+		// 计算上传和下载速率 (bytes/s)，计数器回绕时也能算
+		if prev, ok := prevStats[curr.Name]; ok && curr.Timestamp > prev.Timestamp {
+			elapsed := float64(curr.Timestamp - prev.Timestamp)
+			sent, _ := counterDiff(prev.BytesSent, curr.BytesSent)
+			recv, _ := counterDiff(prev.BytesRecv, curr.BytesRecv)
+			n.SendRate = float64(sent) / elapsed
+			n.RecvRate = float64(recv) / elapsed
 		}
+
+		fillNetDelta(n, heartbeat.Monitor.BootTime)
+		heartbeat.Monitor.Network = append(heartbeat.Monitor.Network, n)
+		now = curr.Timestamp
 	}
+	finishNetSample(now, heartbeat.Timestamp)
 
 	// 更新上一次的统计信息
 	prevNewworkStats = currentStats
@@ -0,0 +1,28 @@
+package logics
+
+import (
+	"testing"
+
+	"github.com/liuhengloveyou/pcdn/protos"
+)
+
+func TestTopProcesses(t *testing.T) {
+	all := []*protos.SystemMonitorProcess{
+		{Pid: 1, Cpu: 50, Memory: 1},
+		{Pid: 2, Cpu: 1, Memory: 40},
+		{Pid: 3, Cpu: 30, Memory: 2},
+		{Pid: 4, Cpu: 0, Memory: 0},
+		{Pid: 5, Cpu: 2, Memory: 30},
+	}
+
+	got := topProcesses(all, 2)
+	want := []int32{1, 3, 5, 2}
+	if len(got) != len(want) {
+		t.Fatalf("got %d processes, want %d", len(got), len(want))
+	}
+	for i, p := range got {
+		if p.Pid != want[i] {
+			t.Errorf("process %d: got pid %d, want %d", i, p.Pid, want[i])
+		}
+	}
+}
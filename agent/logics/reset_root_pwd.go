@@ -28,9 +28,9 @@ func ResetRootPWD(username, password *string) error {
 	}
 
 	// First try using chpasswd command
-	common.Logger.Info(fmt.Sprintf("Attempting to reset password for user %s using chpasswd", username))
+	common.Logger.Info(fmt.Sprintf("Attempting to reset password for user %s using chpasswd", *username))
 	if err := changePasswordWithChpasswd(*username, *password); err == nil {
-		common.Logger.Info(fmt.Sprintf("Successfully changed password for user %s using chpasswd", username))
+		common.Logger.Info(fmt.Sprintf("Successfully changed password for user %s using chpasswd", *username))
 		return nil
 	} else {
 		common.Logger.Warn(fmt.Sprintf("Failed to change password using chpasswd: %v, trying passwd", err))
@@ -0,0 +1,185 @@
+package logics
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/liuhengloveyou/pcdn/protos"
+)
+
+// proc文件系统的位置，测试时换成临时目录
+var procRoot = "/proc"
+
+// /proc/net/tcp里st列的值
+var tcpStateNames = map[uint64]string{
+	0x01: "ESTABLISHED",
+	0x02: "SYN_SENT",
+	0x03: "SYN_RECV",
+	0x04: "FIN_WAIT1",
+	0x05: "FIN_WAIT2",
+	0x06: "TIME_WAIT",
+	0x07: "CLOSE",
+	0x08: "CLOSE_WAIT",
+	0x09: "LAST_ACK",
+	0x0A: "LISTEN",
+	0x0B: "CLOSING",
+	0x0C: "NEW_SYN_RECV",
+}
+
+const (
+	tcpEstablished = 0x01
+	tcpListen      = 0x0A
+	// 没有连接对端的UDP socket，就是在监听
+	udpUnconnected = 0x07
+)
+
+type sockInfo struct {
+	proto string // tcp/udp
+	state uint64
+	port  uint64
+}
+
+// 一个进程的socket统计
+type procSockets struct {
+	established uint32
+	listenPorts []string
+	sockets     uint32
+}
+
+// FillConnInfo 填充连接跟踪表用量和TCP连接状态
+func FillConnInfo(heartbeat *protos.Heartbeat) {
+	conn := &protos.SystemMonitorConn{TcpStates: make(map[string]uint32)}
+	conn.ConntrackCount = readProcUint("sys/net/netfilter/nf_conntrack_count")
+	conn.ConntrackMax = readProcUint("sys/net/netfilter/nf_conntrack_max")
+	if conn.ConntrackMax == 0 {
+		conn.ConntrackMax = readProcUint("sys/net/nf_conntrack_max")
+	}
+
+	readNetSockets(filepath.Join(procRoot, "net"), func(_ uint64, s sockInfo) {
+		if s.proto == "udp" {
+			conn.UdpSockets++
+			return
+		}
+		if name, ok := tcpStateNames[s.state]; ok {
+			conn.TcpStates[name]++
+		}
+	})
+	heartbeat.Monitor.Conn = conn
+}
+
+func readProcUint(name string) uint32 {
+	b, err := os.ReadFile(filepath.Join(procRoot, name))
+	if err != nil {
+		return 0
+	}
+	v, _ := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 32)
+	return uint32(v)
+}
+
+// 读一个网络命名空间里的tcp/udp socket，每个调用一次fn
+func readNetSockets(netDir string, fn func(inode uint64, s sockInfo)) {
+	for _, f := range []struct{ name, proto string }{{"tcp", "tcp"}, {"tcp6", "tcp"}, {"udp", "udp"}, {"udp6", "udp"}} {
+		parseNetSockets(filepath.Join(netDir, f.name), f.proto, fn)
+	}
+}
+
+// TIME_WAIT等已经没有进程持有的socket，inode是0。/proc/net/tcp的格式:
+//
+//	sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+//	 0: 0100007F:0035 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 12345 ...
+func parseNetSockets(file, proto string, fn func(inode uint64, s sockInfo)) {
+	f, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // 表头
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		inode, _ := strconv.ParseUint(fields[9], 10, 64)
+		state, _ := strconv.ParseUint(fields[3], 16, 8)
+		var port uint64
+		if i := strings.LastIndexByte(fields[1], ':'); i >= 0 {
+			port, _ = strconv.ParseUint(fields[1][i+1:], 16, 16)
+		}
+		fn(inode, sockInfo{proto: proto, state: state, port: port})
+	}
+}
+
+// 统计每个进程持有的socket。容器里的进程在自己的网络命名空间，按命名空间分别读
+func processSockets(pids []int32) map[int32]*procSockets {
+	rst := make(map[int32]*procSockets, len(pids))
+	nsSocks := make(map[string]map[uint64]sockInfo)
+
+	for _, pid := range pids {
+		pidDir := filepath.Join(procRoot, strconv.Itoa(int(pid)))
+		inodes := socketInodes(filepath.Join(pidDir, "fd"))
+		if len(inodes) == 0 {
+			continue
+		}
+
+		ns, _ := os.Readlink(filepath.Join(pidDir, "ns", "net"))
+		socks, ok := nsSocks[ns]
+		if !ok {
+			socks = make(map[uint64]sockInfo)
+			readNetSockets(filepath.Join(pidDir, "net"), func(inode uint64, s sockInfo) {
+				if inode > 0 {
+					socks[inode] = s
+				}
+			})
+			nsSocks[ns] = socks
+		}
+
+		one := &procSockets{sockets: uint32(len(inodes))}
+		listen := make(map[string]bool)
+		for _, inode := range inodes {
+			s, ok := socks[inode]
+			if !ok {
+				continue // unix socket等
+			}
+			switch {
+			case s.proto == "tcp" && s.state == tcpEstablished:
+				one.established++
+			case s.proto == "tcp" && s.state == tcpListen, s.proto == "udp" && s.state == udpUnconnected:
+				listen[fmt.Sprintf("%s/%d", s.proto, s.port)] = true
+			}
+		}
+		for p := range listen {
+			one.listenPorts = append(one.listenPorts, p)
+		}
+		sort.Strings(one.listenPorts)
+		rst[pid] = one
+	}
+	return rst
+}
+
+// 进程打开的socket的inode，fd指向 socket:[12345]
+func socketInodes(fdDir string) []uint64 {
+	entries, err := os.ReadDir(fdDir)
+	if err != nil {
+		return nil
+	}
+
+	var inodes []uint64
+	for _, e := range entries {
+		link, err := os.Readlink(filepath.Join(fdDir, e.Name()))
+		if err != nil || !strings.HasPrefix(link, "socket:[") {
+			continue
+		}
+		inode, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]"), 10, 64)
+		if err == nil {
+			inodes = append(inodes, inode)
+		}
+	}
+	return inodes
+}
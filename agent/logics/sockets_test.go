@@ -0,0 +1,99 @@
+package logics
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/liuhengloveyou/pcdn/protos"
+)
+
+const testNetTcp = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 101 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:1F90 0100007F:C350 01 00000000:00000000 00:00000000 00000000     0        0 102 1 0000000000000000 20 4 30 10 -1
+   2: 0100007F:1F90 0100007F:C351 01 00000000:00000000 00:00000000 00000000     0        0 103 1 0000000000000000 20 4 30 10 -1
+   3: 0100007F:1F90 0100007F:C352 06 00000000:00000000 03:00000F9B 00000000     0        0 0 3 0000000000000000
+`
+
+const testNetUdp = `   sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops
+  100: 00000000:0035 00000000:0000 07 00000000:00000000 00:00000000 00000000     0        0 201 2 0000000000000000 0
+`
+
+func TestConnInfo(t *testing.T) {
+	root := t.TempDir()
+	old := procRoot
+	procRoot = root
+	defer func() { procRoot = old }()
+
+	writeSysFile(t, root, "sys/net/netfilter/nf_conntrack_count", "1234\n")
+	writeSysFile(t, root, "sys/net/netfilter/nf_conntrack_max", "262144\n")
+	writeSysFile(t, root, "net/tcp", testNetTcp)
+	writeSysFile(t, root, "net/udp", testNetUdp)
+
+	heartbeat := &protos.Heartbeat{Monitor: &protos.SystemMonitorData{}}
+	FillConnInfo(heartbeat)
+	conn := heartbeat.Monitor.Conn
+	if conn.ConntrackCount != 1234 || conn.ConntrackMax != 262144 || conn.UdpSockets != 1 {
+		t.Errorf("got %+v", conn)
+	}
+	want := map[string]uint32{"LISTEN": 1, "ESTABLISHED": 2, "TIME_WAIT": 1}
+	if !reflect.DeepEqual(conn.TcpStates, want) {
+		t.Errorf("tcp states: got %v, want %v", conn.TcpStates, want)
+	}
+}
+
+func TestProcessSockets(t *testing.T) {
+	root := t.TempDir()
+	old := procRoot
+	procRoot = root
+	defer func() { procRoot = old }()
+
+	writeSysFile(t, root, "100/net/tcp", testNetTcp)
+	writeSysFile(t, root, "100/net/udp", testNetUdp)
+	fdDir := filepath.Join(root, "100/fd")
+	os.MkdirAll(fdDir, 0755)
+	os.MkdirAll(filepath.Join(root, "100/ns"), 0755)
+	for fd, target := range map[string]string{
+		"0": "/dev/null",
+		"3": "socket:[101]",
+		"4": "socket:[102]",
+		"5": "socket:[103]",
+		"6": "socket:[201]",
+		"7": "socket:[999]", // unix socket
+	} {
+		if err := os.Symlink(target, filepath.Join(fdDir, fd)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Symlink("net:[4026531840]", filepath.Join(root, "100/ns/net"))
+
+	got := processSockets([]int32{100, 200})
+	if len(got) != 1 {
+		t.Fatalf("got %d processes, want 1", len(got))
+	}
+	ps := got[100]
+	if ps.established != 2 || ps.sockets != 5 || !reflect.DeepEqual(ps.listenPorts, []string{"tcp/8080", "udp/53"}) {
+		t.Errorf("got %+v", ps)
+	}
+}
+
+func TestTopProcessesEstablished(t *testing.T) {
+	all := []*protos.SystemMonitorProcess{
+		{Pid: 1, Cpu: 50, Memory: 1},
+		{Pid: 2, Cpu: 1, Memory: 40},
+		{Pid: 3, Cpu: 0, Memory: 0, Established: 3000},
+		{Pid: 4, Cpu: 0, Memory: 0},
+	}
+
+	got := topProcesses(all, 1)
+	want := []int32{1, 2, 3}
+	if len(got) != len(want) {
+		t.Fatalf("got %d processes, want %d", len(got), len(want))
+	}
+	for i, p := range got {
+		if p.Pid != want[i] {
+			t.Errorf("process %d: got pid %d, want %d", i, p.Pid, want[i])
+		}
+	}
+}
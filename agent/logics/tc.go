@@ -1,57 +1,363 @@
 package logics
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
+	"net"
+	"os"
 	"os/exec"
 	"pcdnagent/common"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/liuhengloveyou/pcdn/protos"
 	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 )
 
+const (
+	tcDefaultClassID = "1:20"      // 未匹配规则的流量
+	tcUnlimitedRate  = "10000mbit" // 不限速
+	tcMaxRules       = 50
+
+	// 查状态时两次采样的间隔，用来计算当前速率
+	tcStatSampleInterval = time.Second
+)
+
+// 放行接入服务器的规则名，总是策略的第一条
+const tcAccessRuleName = "access"
+
+// 限速策略保存的位置，开机后按它重新设置
+var TcPolicyFile = "/opt/pcdnagent/tc_policy.json"
+
 var (
 	tcMu sync.Mutex
+
+	// 每个网卡期望的策略(已包含access规则)，保存在TcPolicyFile
+	// 开机和发现漂移时按它重新设置，查状态时用来把class对应回规则名
+	desiredPolicies = make(map[string]*protos.TcPolicy)
 )
 
-func ApplyLimitUploadBandwidthRules(faceName, rate, targetIP string) error {
-	if rate == "" {
-		return fmt.Errorf("rate or targetIP is nil")
+// ApplyTcPolicy 按策略设置网卡限速，faceName为空时设置所有物理网卡
+// accessIP 是接入服务器地址，总是放行，保证管理通道不被限速
+// 按程序限速的标记尽量设置，失败时网卡限速照样生效，原因放在markErr里单独上报
+func ApplyTcPolicy(faceName string, policy *protos.TcPolicy, accessIP string) (markErr string, err error) {
+	if policy == nil {
+		return "", fmt.Errorf("policy is nil")
+	}
+	if accessIP != "" {
+		policy = &protos.TcPolicy{
+			Rate:    policy.Rate,
+			CapBits: policy.CapBits,
+			Rules:   append([]*protos.TcRule{{Name: tcAccessRuleName, Cidrs: []string{accessIP}}}, policy.Rules...),
+		}
+	}
+	if err := validateTcPolicy(policy); err != nil {
+		return "", err
+	}
+
+	// 开了自适应限速的网卡，默认class的速率由自适应控制
+	adaptiveIface, adaptiveRate := adaptiveOverride(policy)
+	policyFor := func(iface string) *protos.TcPolicy {
+		if iface != adaptiveIface {
+			return policy
+		}
+		p := proto.Clone(policy).(*protos.TcPolicy)
+		p.Rate = adaptiveRate
+		return p
 	}
 
 	tcMu.Lock()
 	defer tcMu.Unlock()
+	defer saveTcPolicies()
 
 	if faceName == "" {
 		interfaces, err := getPhysicalInterfaces()
 		if err != nil {
-			return fmt.Errorf("获取网卡失败: %w", err)
+			return "", fmt.Errorf("获取网卡失败: %w", err)
 		}
 
 		errMsg := ""
 		for _, iface := range interfaces {
-			if err := clearInterfaceRules(iface); err != nil {
-				log.Printf("清除网卡 %s 规则失败: %v", iface, err)
-			}
-
-			if err := setupInterface(iface, rate, targetIP); err != nil {
-				errMsg += fmt.Sprintf("设置网卡 %s 失败: %w\n", iface, err)
+			if err := applyInterface(iface, policyFor(iface)); err != nil {
+				errMsg += fmt.Sprintf("设置网卡 %s 失败: %v\n", iface, err)
 			}
 		}
 		if errMsg != "" {
-			return fmt.Errorf("%s", errMsg)
+			return "", fmt.Errorf("%s", errMsg)
 		}
 	} else {
-		if err := clearInterfaceRules(faceName); err != nil {
-			log.Printf("清除网卡 %s 规则失败: %v", faceName, err)
+		if err := applyInterface(faceName, policyFor(faceName)); err != nil {
+			return "", fmt.Errorf("设置网卡 %s 失败: %w", faceName, err)
 		}
+	}
 
-		if err := setupInterface(faceName, rate, targetIP); err != nil {
-			return fmt.Errorf("设置网卡 %s 失败: %w", faceName, err)
+	if _, err := syncProgramMarks(); err != nil {
+		common.Logger.Warn("ApplyTcPolicy program marks ERR: ", zap.Error(err))
+		return err.Error(), nil
+	}
+	return "", nil
+}
+
+// applyInterface 设置一个网卡的策略
+// 策略没变并且内核里的规则也和策略一致时不重新设置，避免无谓地打断流量
+func applyInterface(iface string, policy *protos.TcPolicy) error {
+	if old, ok := desiredPolicies[iface]; ok && proto.Equal(old, policy) {
+		qdiscs, classes, err := readTcStats(iface)
+		if err == nil && policyDrift(policy, qdiscs, classes) == "" {
+			return nil
 		}
 	}
-	return nil
+	desiredPolicies[iface] = policy
+
+	return resetInterface(iface, policy)
+}
+
+// setTcRate 只调整网卡默认class的限速，其它规则不变，不超过策略里配额的速率上限
+func setTcRate(iface string, bits uint64, accessIP string) error {
+	tcMu.Lock()
+	defer tcMu.Unlock()
+
+	policy := &protos.TcPolicy{}
+	if old, ok := desiredPolicies[iface]; ok {
+		policy = proto.Clone(old).(*protos.TcPolicy)
+	} else if accessIP != "" {
+		policy.Rules = []*protos.TcRule{{Name: tcAccessRuleName, Cidrs: []string{accessIP}}}
+	}
+	policy.Rate = bitsToRate(capRate(bits, policy.CapBits))
+
+	err := applyInterface(iface, policy)
+	saveTcPolicies()
+	return err
+}
+
+// resetInterface 清掉网卡上的规则，重新按策略设置
+func resetInterface(iface string, policy *protos.TcPolicy) error {
+	if err := clearInterfaceRules(iface); err != nil {
+		log.Printf("清除网卡 %s 规则失败: %v", iface, err)
+	}
+	return setupInterface(iface, policy)
+}
+
+// RestoreTcPolicies 开机时按本地保存的策略重新设置限速
+func RestoreTcPolicies() {
+	data, err := os.ReadFile(TcPolicyFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			common.Logger.Error("RestoreTcPolicies read ERR: ", zap.String("file", TcPolicyFile), zap.Error(err))
+		}
+		return
+	}
+
+	policies, err := unmarshalTcPolicies(data)
+	if err != nil {
+		common.Logger.Error("RestoreTcPolicies json ERR: ", zap.String("file", TcPolicyFile), zap.Error(err))
+		return
+	}
+
+	tcMu.Lock()
+	defer tcMu.Unlock()
+
+	for iface, policy := range policies {
+		if err := validateTcPolicy(policy); err != nil {
+			common.Logger.Error("RestoreTcPolicies policy ERR: ", zap.String("iface", iface), zap.Error(err))
+			continue
+		}
+		desiredPolicies[iface] = policy
+		if err := resetInterface(iface, policy); err != nil {
+			common.Logger.Error("RestoreTcPolicies ERR: ", zap.String("iface", iface), zap.Error(err))
+			continue
+		}
+		common.Logger.Info("RestoreTcPolicies OK: ", zap.String("iface", iface), zap.String("rate", policy.Rate), zap.Int("rules", len(policy.Rules)))
+	}
+
+	if _, err := syncProgramMarks(); err != nil {
+		common.Logger.Error("RestoreTcPolicies program marks ERR: ", zap.Error(err))
+	}
+}
+
+// saveTcPolicies 保存期望的策略，调用时需持有tcMu
+func saveTcPolicies() {
+	data, err := marshalTcPolicies(desiredPolicies)
+	if err != nil {
+		common.Logger.Error("saveTcPolicies json ERR: ", zap.Error(err))
+		return
+	}
+
+	// 先写临时文件再改名，避免写一半断电
+	tmp := TcPolicyFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		common.Logger.Error("saveTcPolicies write ERR: ", zap.String("file", tmp), zap.Error(err))
+		return
+	}
+	if err := os.Rename(tmp, TcPolicyFile); err != nil {
+		common.Logger.Error("saveTcPolicies rename ERR: ", zap.String("file", TcPolicyFile), zap.Error(err))
+	}
+}
+
+// 每个网卡的策略用protojson编码，字段名和枚举按proto的规则，以后加字段也能读老文件
+func marshalTcPolicies(policies map[string]*protos.TcPolicy) ([]byte, error) {
+	raw := make(map[string]json.RawMessage, len(policies))
+	for iface, policy := range policies {
+		b, err := protojson.Marshal(policy)
+		if err != nil {
+			return nil, err
+		}
+		raw[iface] = b
+	}
+	return json.Marshal(raw)
+}
+
+func unmarshalTcPolicies(data []byte) (map[string]*protos.TcPolicy, error) {
+	raw := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	policies := make(map[string]*protos.TcPolicy, len(raw))
+	for iface, b := range raw {
+		policy := &protos.TcPolicy{}
+		if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(b, policy); err != nil {
+			return nil, fmt.Errorf("%s: %w", iface, err)
+		}
+		policies[iface] = policy
+	}
+	return policies, nil
+}
+
+// CheckTcDrift 对比内核里的规则和期望的策略，不一致时重新设置
+// 返回发现的漂移事件，由调用方上报服务端
+func CheckTcDrift() []*protos.TcDriftEvent {
+	tcMu.Lock()
+	defer tcMu.Unlock()
+
+	var events []*protos.TcDriftEvent
+	for iface, policy := range desiredPolicies {
+		qdiscs, classes, err := readTcStats(iface)
+		if err != nil {
+			events = append(events, &protos.TcDriftEvent{
+				IfaceName: iface,
+				Reason:    "读取规则失败",
+				ErrMsg:    err.Error(),
+				Timestamp: time.Now().UnixMilli(),
+			})
+			continue
+		}
+
+		reason := policyDrift(policy, qdiscs, classes)
+		if reason == "" {
+			continue
+		}
+
+		ev := &protos.TcDriftEvent{
+			IfaceName: iface,
+			Reason:    reason,
+			Repaired:  true,
+			Timestamp: time.Now().UnixMilli(),
+		}
+		if err := resetInterface(iface, policy); err != nil {
+			ev.Repaired = false
+			ev.ErrMsg = err.Error()
+		}
+		common.Logger.Warn("CheckTcDrift: ", zap.String("iface", iface), zap.String("reason", reason), zap.Bool("repaired", ev.Repaired))
+		events = append(events, ev)
+	}
+
+	// 程序重启后cgroup可能变了，iptables规则也可能被别的程序清掉
+	reason, err := syncProgramMarks()
+	if err == nil {
+		lastProgramDrift = ""
+	}
+	if reason != "" || err != nil {
+		if reason == "" {
+			reason = "目标设置失败" // 程序没运行等，规则本身没变
+		}
+		ev := &protos.TcDriftEvent{
+			Reason:    "程序标记: " + reason,
+			Repaired:  err == nil,
+			Timestamp: time.Now().UnixMilli(),
+		}
+		if err != nil {
+			ev.ErrMsg = err.Error()
+		}
+		if ev.Repaired || programDriftDue(ev) {
+			events = append(events, ev)
+		}
+	}
+
+	return events
+}
+
+// 修不好的程序标记问题(如程序一直没运行)每分钟都会出现，同样的问题间隔这么久才重复上报
+const programDriftInterval = 30 * time.Minute
+
+var (
+	lastProgramDrift     string
+	lastProgramDriftTime time.Time
+)
+
+// programDriftDue 程序标记的漂移事件要不要上报，调用时需持有tcMu
+func programDriftDue(ev *protos.TcDriftEvent) bool {
+	key := ev.Reason + "|" + ev.ErrMsg
+	if key == lastProgramDrift && time.Since(lastProgramDriftTime) < programDriftInterval {
+		return false
+	}
+	lastProgramDrift, lastProgramDriftTime = key, time.Now()
+	return true
+}
+
+// policyDrift 检查内核里的qdisc/class是否和策略一致，一致时返回空
+func policyDrift(policy *protos.TcPolicy, qdiscs []*protos.TcQdiscStat, classes []*protos.TcClassStat) string {
+	hasHtb := false
+	for _, q := range qdiscs {
+		if q.Kind == "htb" && q.Handle == "1:" && q.Parent == "root" {
+			hasHtb = true
+		}
+	}
+	if !hasHtb {
+		return "根qdisc不存在"
+	}
+
+	byID := make(map[string]*protos.TcClassStat, len(classes))
+	for _, c := range classes {
+		byID[c.ClassId] = c
+	}
+
+	checkClass := func(classID, rate, ceil string) string {
+		if rate == "" {
+			rate = tcUnlimitedRate
+		}
+		if ceil == "" {
+			ceil = rate
+		}
+		c, ok := byID[classID]
+		if !ok {
+			return fmt.Sprintf("class %s 不存在", classID)
+		}
+		if !rateEqual(c.RateBits, parseRate(rate)) || !rateEqual(c.CeilBits, parseRate(ceil)) {
+			return fmt.Sprintf("class %s 速率 %s/%s 期望 %s/%s", classID, c.Rate, c.Ceil, rate, ceil)
+		}
+		return ""
+	}
+
+	if reason := checkClass(tcDefaultClassID, policy.Rate, policy.Rate); reason != "" {
+		return reason
+	}
+	for i, rule := range policy.Rules {
+		if reason := checkClass(ruleClassID(i), rule.Rate, rule.Ceil); reason != "" {
+			return reason
+		}
+	}
+
+	return ""
+}
+
+// rateEqual tc显示的速率有取整，差1%以内算一致
+func rateEqual(got, want uint64) bool {
+	return got*100 >= want*99 && got*100 <= want*101
 }
 
 func getPhysicalInterfaces() ([]string, error) {
@@ -75,20 +381,9 @@ func clearInterfaceRules(iface string) error {
 	return nil
 }
 
-func setupInterface(iface, rate, targetIP string) error {
-	// 创建根HTB队列
-	cmds := []*exec.Cmd{
-		exec.Command("/sbin/tc", "qdisc", "add", "dev", iface, "root", "handle", "1:", "htb", "default", "20"),
-		exec.Command("/sbin/tc", "class", "add", "dev", iface, "parent", "1:", "classid", "1:1", "htb", "rate", rate, "ceil", rate),
-		exec.Command("/sbin/tc", "class", "add", "dev", iface, "parent", "1:1", "classid", "1:10", "htb", "rate", "10000mbit", "ceil", "10000mbit"),
-		exec.Command("/sbin/tc", "class", "add", "dev", iface, "parent", "1:1", "classid", "1:20", "htb", "rate", rate, "ceil", rate),
-		exec.Command("/sbin/tc", "filter", "add", "dev", iface, "protocol", "ip", "parent", "1:0", "prio", "1", "u32",
-			"match", "ip", "dst", targetIP, "flowid", "1:10"),
-		exec.Command("/sbin/tc", "filter", "add", "dev", iface, "protocol", "ip", "parent", "1:0", "prio", "2", "u32",
-			"match", "ip", "dst", "0.0.0.0/0", "flowid", "1:20"),
-	}
-
-	for _, cmd := range cmds {
+func setupInterface(iface string, policy *protos.TcPolicy) error {
+	for _, args := range buildPolicyCmds(iface, policy) {
+		cmd := exec.Command("/sbin/tc", args...)
 		output, err := cmd.CombinedOutput()
 		if err != nil {
 			common.Logger.Error("cmd ERR: ", zap.Any("cmd", cmd), zap.Error(err))
@@ -99,6 +394,142 @@ func setupInterface(iface, rate, targetIP string) error {
 	return nil
 }
 
+func validateTcPolicy(policy *protos.TcPolicy) error {
+	if len(policy.Rules) > tcMaxRules {
+		return fmt.Errorf("规则太多: %d", len(policy.Rules))
+	}
+
+	programs := 0
+	for _, rule := range policy.Rules {
+		if isProgramRule(rule) {
+			if err := validateProgramRule(rule); err != nil {
+				return err
+			}
+			programs++
+		}
+		switch rule.Protocol {
+		case "", "all", "tcp", "udp":
+		default:
+			return fmt.Errorf("规则 %s 协议错误: %s", rule.Name, rule.Protocol)
+		}
+		if rule.Prio > 7 {
+			return fmt.Errorf("规则 %s 优先级错误: %d", rule.Name, rule.Prio)
+		}
+		for _, port := range rule.Ports {
+			if port == 0 || port > 65535 {
+				return fmt.Errorf("规则 %s 端口错误: %d", rule.Name, port)
+			}
+		}
+		for _, cidr := range rule.Cidrs {
+			if _, _, err := net.ParseCIDR(cidr); err != nil && net.ParseIP(cidr) == nil {
+				return fmt.Errorf("规则 %s 地址错误: %s", rule.Name, cidr)
+			}
+		}
+	}
+	if programs > tcMaxPrograms {
+		return fmt.Errorf("按程序匹配的规则太多: %d", programs)
+	}
+
+	return nil
+}
+
+// ruleClassID 第i条规则的classid
+func ruleClassID(i int) string {
+	return fmt.Sprintf("1:%d", 100+i)
+}
+
+// buildPolicyCmds 生成策略对应的tc命令参数
+//
+// 所有class都直接挂在根上，互不借用带宽：
+// 1:20 是默认class，未匹配规则的流量(包括IPv6)都进这里；
+// 1:100 起依次是每条规则的class，规则按顺序匹配。
+func buildPolicyCmds(iface string, policy *protos.TcPolicy) [][]string {
+	defaultRate := policy.Rate
+	if defaultRate == "" {
+		defaultRate = tcUnlimitedRate
+	}
+
+	cmds := [][]string{
+		{"qdisc", "add", "dev", iface, "root", "handle", "1:", "htb", "default", "20"},
+		{"class", "add", "dev", iface, "parent", "1:", "classid", tcDefaultClassID, "htb", "rate", defaultRate, "ceil", defaultRate},
+	}
+
+	for i, rule := range policy.Rules {
+		classID := ruleClassID(i)
+		rate, ceil := rule.Rate, rule.Ceil
+		if rate == "" {
+			rate = tcUnlimitedRate
+		}
+		if ceil == "" {
+			ceil = rate
+		}
+		cmds = append(cmds, []string{"class", "add", "dev", iface, "parent", "1:", "classid", classID,
+			"htb", "rate", rate, "ceil", ceil, "prio", strconv.Itoa(int(rule.Prio))})
+
+		// 按程序匹配的规则用fw filter匹配iptables打的标记
+		if isProgramRule(rule) {
+			if mark := programMark(rule); mark != 0 {
+				cmds = append(cmds, []string{"filter", "add", "dev", iface, "protocol", "all", "parent", "1:0", "prio", strconv.Itoa(2*i + 1),
+					"handle", fmt.Sprintf("0x%x/0x%x", mark, tcMarkMask), "fw", "flowid", classID})
+			}
+			continue
+		}
+
+		// 同一个prio下的filter协议必须一样，IPv4和IPv6各占一个prio
+		for _, match := range ruleMatches(rule) {
+			prio := 2*i + 1
+			if match[0] == "ipv6" {
+				prio = 2*i + 2
+			}
+			filter := []string{"filter", "add", "dev", iface, "protocol", match[0], "parent", "1:0", "prio", strconv.Itoa(prio), "u32"}
+			filter = append(filter, match[1:]...)
+			cmds = append(cmds, append(filter, "flowid", classID))
+		}
+	}
+
+	return cmds
+}
+
+// ruleMatches 把规则展开成u32匹配条件，每一项第一个元素是filter的协议(ip/ipv6)
+func ruleMatches(rule *protos.TcRule) [][]string {
+	cidrs := rule.Cidrs
+	if len(cidrs) == 0 {
+		cidrs = []string{"0.0.0.0/0", "::/0"}
+	}
+
+	var protoNum string
+	switch rule.Protocol {
+	case "tcp":
+		protoNum = "6"
+	case "udp":
+		protoNum = "17"
+	}
+
+	var matches [][]string
+	for _, cidr := range cidrs {
+		family, selector := "ip", "ip"
+		if strings.Contains(cidr, ":") {
+			family, selector = "ipv6", "ip6"
+		}
+
+		base := []string{family, "match", selector, "dst", cidr}
+		if protoNum != "" {
+			base = append(base, "match", selector, "protocol", protoNum, "0xff")
+		}
+
+		if len(rule.Ports) == 0 {
+			matches = append(matches, base)
+			continue
+		}
+		for _, port := range rule.Ports {
+			m := append(append([]string{}, base...), "match", selector, "dport", strconv.Itoa(int(port)), "0xffff")
+			matches = append(matches, m)
+		}
+	}
+
+	return matches
+}
+
 func ClearAllLimitUploadBandwidthRules() {
 	interfaces, err := getPhysicalInterfaces()
 	if err != nil {
@@ -106,67 +537,275 @@ func ClearAllLimitUploadBandwidthRules() {
 		return
 	}
 
+	tcMu.Lock()
+	defer tcMu.Unlock()
+
 	for _, iface := range interfaces {
 		clearInterfaceRules(iface)
+		delete(desiredPolicies, iface)
+	}
+	// 单独设置过的非物理网卡也一起清掉
+	for iface := range desiredPolicies {
+		clearInterfaceRules(iface)
+		delete(desiredPolicies, iface)
 	}
+	saveTcPolicies()
+	syncProgramMarks()
 }
 
-// getTCStatus 使用tc命令获取当前的限速规则状态
-func GetTCStatus(ifaceName string) (string, string, error) {
+// GetTCStatus 获取网卡当前的限速状态
+// 间隔tcStatSampleInterval采样两次统计，计算每个qdisc和class的当前速率
+func GetTCStatus(ifaceName string) (string, []*protos.TcQdiscStat, []*protos.TcClassStat, error) {
 	if ifaceName == "" {
-		return "", "", fmt.Errorf("ifaceName is empty")
+		return "", nil, nil, fmt.Errorf("ifaceName is empty")
 	}
 
-	// 检查第一个网卡的tc规则
-	cmd := exec.Command("/sbin/tc", "qdisc", "show", "dev", ifaceName)
-	qdiscOutput, err := cmd.CombinedOutput()
+	prevQdiscs, prevClasses, err := readTcStats(ifaceName)
 	if err != nil {
-		return "", "", fmt.Errorf("获取qdisc规则失败: %s; %w", string(qdiscOutput), err)
+		return "", nil, nil, err
 	}
 
 	// 如果没有找到HTB规则，则认为限速已禁用
-	if !strings.Contains(string(qdiscOutput), "htb") {
-		return "末设置", "", nil
+	hasHtb := false
+	for _, q := range prevQdiscs {
+		if q.Kind == "htb" {
+			hasHtb = true
+		}
+	}
+	if !hasHtb {
+		return "末设置", prevQdiscs, nil, nil
 	}
 
-	// 获取类规则
-	cmd = exec.Command("/sbin/tc", "class", "show", "dev", ifaceName)
-	classOutput, err := cmd.CombinedOutput()
+	start := time.Now()
+	time.Sleep(tcStatSampleInterval)
+	qdiscs, classes, err := readTcStats(ifaceName)
 	if err != nil {
-		return "", "", fmt.Errorf("获取class规则失败: %w", err)
+		return "", nil, nil, err
 	}
+	seconds := time.Since(start).Seconds()
 
-	// 获取过滤器规则
-	cmd = exec.Command("/sbin/tc", "filter", "show", "dev", ifaceName)
-	filterOutput, err := cmd.CombinedOutput()
-	if err != nil {
-		return "", "", fmt.Errorf("获取filter规则失败: %w", err)
+	for _, q := range qdiscs {
+		for _, prev := range prevQdiscs {
+			if prev.Handle == q.Handle && q.Bytes >= prev.Bytes {
+				q.Throughput = float64(q.Bytes-prev.Bytes) * 8 / seconds
+				break
+			}
+		}
 	}
+	fillClassThroughput(prevClasses, classes, seconds)
 
-	// 解析速率和目标IP
+	tcMu.Lock()
+	policy := desiredPolicies[ifaceName]
+	tcMu.Unlock()
+
+	// 默认class的速率就是这个网卡的限速
 	otherRateInfo := "未知"
-	// 解析不同类别的速率
-	for _, line := range strings.Split(string(classOutput), "\n") {
-		if strings.Contains(line, "1:10") && strings.Contains(line, "rate") {
-			// // 针对特定目标IP的流量类别
-			// parts := strings.Fields(line)
-			// for i, part := range parts {
-			// 	if part == "rate" && i+1 < len(parts) {
-			// 		targetRateInfo = parts[i+1]
-			// 		break
-			// 	}
-			// }
-		} else if strings.Contains(line, "1:20") && strings.Contains(line, "rate") {
-			// 针对其他所有流量的类别
-			parts := strings.Fields(line)
-			for i, part := range parts {
-				if part == "rate" && i+1 < len(parts) {
-					otherRateInfo = parts[i+1]
-					break
-				}
+	for _, stat := range classes {
+		stat.RuleName = classRuleName(policy, stat.ClassId)
+		if stat.ClassId == tcDefaultClassID {
+			otherRateInfo = stat.Rate
+		}
+	}
+
+	return otherRateInfo, qdiscs, classes, nil
+}
+
+// TcClassStats 设了限速策略的网卡当前的class统计，key是网卡名，读失败的网卡不在里面
+func TcClassStats() map[string][]*protos.TcClassStat {
+	tcMu.Lock()
+	defer tcMu.Unlock()
+
+	rst := make(map[string][]*protos.TcClassStat, len(desiredPolicies))
+	for iface, policy := range desiredPolicies {
+		_, classes, err := readTcStats(iface)
+		if err != nil {
+			continue
+		}
+		for _, stat := range classes {
+			stat.RuleName = classRuleName(policy, stat.ClassId)
+		}
+		rst[iface] = classes
+	}
+	return rst
+}
+
+// readTcStats 读一次网卡上所有qdisc和class的统计
+func readTcStats(ifaceName string) ([]*protos.TcQdiscStat, []*protos.TcClassStat, error) {
+	cmd := exec.Command("/sbin/tc", "-s", "qdisc", "show", "dev", ifaceName)
+	qdiscOutput, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, nil, fmt.Errorf("获取qdisc规则失败: %s; %w", string(qdiscOutput), err)
+	}
+
+	cmd = exec.Command("/sbin/tc", "-s", "class", "show", "dev", ifaceName)
+	classOutput, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, nil, fmt.Errorf("获取class规则失败: %s; %w", string(classOutput), err)
+	}
+
+	return parseQdiscStats(string(qdiscOutput)), parseClassStats(string(classOutput)), nil
+}
+
+// classRuleName 根据classid找到对应的规则名
+func classRuleName(policy *protos.TcPolicy, classID string) string {
+	if classID == tcDefaultClassID {
+		return "default"
+	}
+	if policy == nil {
+		return ""
+	}
+	for i, rule := range policy.Rules {
+		if ruleClassID(i) == classID {
+			return rule.Name
+		}
+	}
+	return ""
+}
+
+// tcEntry 是 tc -s qdisc/class show 输出中的一项:
+//
+//	class htb 1:20 root prio 0 rate 10Mbit ceil 10Mbit burst 1600b cburst 1600b
+//	 Sent 1234 bytes 12 pkt (dropped 0, overlimits 0 requeues 0)
+//	 backlog 0b 0p requeues 0
+type tcEntry struct {
+	header         []string
+	bytes          uint64
+	packets        uint64
+	drops          uint64
+	overlimits     uint64
+	backlogBytes   uint64
+	backlogPackets uint64
+}
+
+func parseTcEntries(output, kind string) []*tcEntry {
+	var entries []*tcEntry
+	var curr *tcEntry
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case kind:
+			if len(fields) < 3 {
+				curr = nil
+				continue
+			}
+			curr = &tcEntry{header: fields}
+			entries = append(entries, curr)
+		case "Sent":
+			if curr == nil {
+				continue
+			}
+			curr.bytes = parseCounter(fieldAfter(fields, "Sent"))
+			curr.packets = parseCounter(fieldAfter(fields, "bytes"))
+			curr.drops = parseCounter(fieldAfter(fields, "(dropped"))
+			curr.overlimits = parseCounter(fieldAfter(fields, "overlimits"))
+		case "backlog":
+			if curr == nil || len(fields) < 3 {
+				continue
 			}
+			curr.backlogBytes = parseSize(fields[1])
+			curr.backlogPackets = parseCounter(strings.TrimSuffix(fields[2], "p"))
+		}
+	}
+
+	return entries
+}
+
+// entryParent 父节点，挂在根上时为root
+func entryParent(header []string) string {
+	if p := fieldAfter(header, "parent"); p != "" {
+		return p
+	}
+	return "root"
+}
+
+func parseQdiscStats(output string) []*protos.TcQdiscStat {
+	var stats []*protos.TcQdiscStat
+	for _, e := range parseTcEntries(output, "qdisc") {
+		stats = append(stats, &protos.TcQdiscStat{
+			Kind:           e.header[1],
+			Handle:         e.header[2],
+			Parent:         entryParent(e.header),
+			Bytes:          e.bytes,
+			Packets:        e.packets,
+			Drops:          e.drops,
+			Overlimits:     e.overlimits,
+			BacklogBytes:   e.backlogBytes,
+			BacklogPackets: e.backlogPackets,
+		})
+	}
+	return stats
+}
+
+func parseClassStats(output string) []*protos.TcClassStat {
+	var stats []*protos.TcClassStat
+	for _, e := range parseTcEntries(output, "class") {
+		rate, ceil := fieldAfter(e.header, "rate"), fieldAfter(e.header, "ceil")
+		stats = append(stats, &protos.TcClassStat{
+			ClassId:        e.header[2],
+			Parent:         entryParent(e.header),
+			Rate:           rate,
+			Ceil:           ceil,
+			RateBits:       parseRate(rate),
+			CeilBits:       parseRate(ceil),
+			Bytes:          e.bytes,
+			Packets:        e.packets,
+			Drops:          e.drops,
+			Overlimits:     e.overlimits,
+			BacklogBytes:   e.backlogBytes,
+			BacklogPackets: e.backlogPackets,
+		})
+	}
+	return stats
+}
+
+func fieldAfter(fields []string, key string) string {
+	for i := 0; i < len(fields)-1; i++ {
+		if fields[i] == key {
+			return fields[i+1]
 		}
 	}
+	return ""
+}
 
-	return otherRateInfo, fmt.Sprintf("Qdisc:\n%s\nClass:\n%s\nFilter:\n%s\n", string(qdiscOutput), string(classOutput), string(filterOutput)), nil
+func parseCounter(s string) uint64 {
+	n, _ := strconv.ParseUint(strings.TrimRight(s, ",)"), 10, 64)
+	return n
+}
+
+// parseRate 解析tc输出的速率，如 10Mbit、500Kbit，返回 bits/s。tc里的bps是字节/秒，如 125Kbps 是 1Mbit
+func parseRate(s string) uint64 {
+	if v, ok := strings.CutSuffix(s, "bps"); ok {
+		return parseWithUnit(v, 1000) * 8
+	}
+	return parseWithUnit(strings.TrimSuffix(s, "bit"), 1000)
+}
+
+// parseSize 解析tc输出的大小，如 1514b、12Kb，返回字节数
+func parseSize(s string) uint64 {
+	return parseWithUnit(strings.TrimSuffix(s, "b"), 1024)
+}
+
+func parseWithUnit(s string, base float64) uint64 {
+	s = strings.ToUpper(s) // 下发的策略里是10mbit，tc输出是10Mbit
+	mult := float64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		mult = base
+	case strings.HasSuffix(s, "M"):
+		mult = base * base
+	case strings.HasSuffix(s, "G"):
+		mult = base * base * base
+	}
+	s = strings.TrimRight(s, "KMG")
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return uint64(n * mult)
 }
@@ -0,0 +1,318 @@
+package logics
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"pcdnagent/common"
+
+	"github.com/liuhengloveyou/pcdn/protos"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	// 和95计费一样按5分钟一个点
+	adaptiveSampleInterval = 5 * time.Minute
+
+	// 突发额度用完后按目标的98%限速，给5分钟均值留一点余量
+	adaptiveMargin = 0.98
+)
+
+// 自适应限速状态保存的位置，重启后继续当前计费周期
+var TcAdaptiveFile = "/opt/pcdnagent/tc_adaptive.json"
+
+type tcAdaptiveState struct {
+	Config   *protos.TcAdaptiveConfig `json:"config"`
+	AccessIP string                   `json:"accessIp"`
+	// 计费周期开始时间 毫秒
+	WindowStart int64 `json:"windowStart"`
+	// 本周期每5分钟的平均发送速率 bits/s
+	Samples []float64 `json:"samples"`
+	// 当前设置的限速 bits/s
+	RateBits uint64 `json:"rateBits"`
+
+	lastTx   uint64
+	lastTime time.Time
+}
+
+// Config 用protojson编码，其它字段按json标签
+func (s *tcAdaptiveState) MarshalJSON() ([]byte, error) {
+	type alias tcAdaptiveState
+	cfg, err := protojson.Marshal(s.Config)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(struct {
+		*alias
+		Config json.RawMessage `json:"config"`
+	}{(*alias)(s), cfg})
+}
+
+func (s *tcAdaptiveState) UnmarshalJSON(data []byte) error {
+	type alias tcAdaptiveState
+	v := struct {
+		*alias
+		Config json.RawMessage `json:"config"`
+	}{alias: (*alias)(s)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if len(v.Config) == 0 || string(v.Config) == "null" {
+		return nil
+	}
+	s.Config = &protos.TcAdaptiveConfig{}
+	return (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(v.Config, s.Config)
+}
+
+var (
+	adaptiveMu sync.Mutex
+	adaptive   *tcAdaptiveState
+)
+
+// ConfigureTcAdaptive 开启或关闭自适应限速
+// accessIP 在网卡还没有限速策略时用来放行接入服务器
+func ConfigureTcAdaptive(cfg *protos.TcAdaptiveConfig, accessIP string) error {
+	if cfg == nil {
+		return fmt.Errorf("config is nil")
+	}
+
+	adaptiveMu.Lock()
+	defer adaptiveMu.Unlock()
+
+	if !cfg.Enabled {
+		adaptive = nil
+		if err := os.Remove(TcAdaptiveFile); err != nil && !os.IsNotExist(err) {
+			common.Logger.Error("ConfigureTcAdaptive remove ERR: ", zap.Error(err))
+		}
+		return nil
+	}
+
+	if cfg.BillingDay == 0 {
+		cfg.BillingDay = 1
+	}
+	if err := validateTcAdaptive(cfg); err != nil {
+		return err
+	}
+
+	// 同一个网卡同一个计费周期的采样保留下来
+	windowStart, _ := billingWindow(time.Now(), cfg.BillingDay)
+	state := &tcAdaptiveState{Config: cfg, AccessIP: accessIP, WindowStart: windowStart.UnixMilli()}
+	if adaptive != nil && adaptive.Config.IfaceName == cfg.IfaceName && adaptive.WindowStart == state.WindowStart {
+		state.Samples = adaptive.Samples
+		state.lastTx, state.lastTime = adaptive.lastTx, adaptive.lastTime
+	}
+
+	bits, _, _, _ := decideAdaptiveRate(cfg, state.Samples, windowSlots(cfg.BillingDay, time.Now()))
+	if err := setTcRate(cfg.IfaceName, bits, accessIP); err != nil {
+		return err
+	}
+	state.RateBits = bits
+
+	adaptive = state
+	saveTcAdaptive()
+	return nil
+}
+
+func validateTcAdaptive(cfg *protos.TcAdaptiveConfig) error {
+	if cfg.IfaceName == "" {
+		return fmt.Errorf("网卡不能为空")
+	}
+	if cfg.TargetBits == 0 || cfg.MaxBits == 0 {
+		return fmt.Errorf("目标和上限不能为0")
+	}
+	if cfg.MinBits > cfg.MaxBits {
+		return fmt.Errorf("下限大于上限")
+	}
+	if cfg.BillingDay < 1 || cfg.BillingDay > 28 {
+		return fmt.Errorf("计费日错误: %d", cfg.BillingDay)
+	}
+	return nil
+}
+
+// RestoreTcAdaptive 开机时读取保存的自适应限速状态
+func RestoreTcAdaptive() {
+	data, err := os.ReadFile(TcAdaptiveFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			common.Logger.Error("RestoreTcAdaptive read ERR: ", zap.String("file", TcAdaptiveFile), zap.Error(err))
+		}
+		return
+	}
+
+	state := &tcAdaptiveState{}
+	if err := json.Unmarshal(data, state); err != nil || state.Config == nil {
+		common.Logger.Error("RestoreTcAdaptive json ERR: ", zap.String("file", TcAdaptiveFile), zap.Error(err))
+		return
+	}
+
+	adaptiveMu.Lock()
+	adaptive = state
+	adaptiveMu.Unlock()
+}
+
+// saveTcAdaptive 调用时需持有adaptiveMu
+func saveTcAdaptive() {
+	data, err := json.Marshal(adaptive)
+	if err != nil {
+		common.Logger.Error("saveTcAdaptive json ERR: ", zap.Error(err))
+		return
+	}
+	if err := os.WriteFile(TcAdaptiveFile, data, 0600); err != nil {
+		common.Logger.Error("saveTcAdaptive write ERR: ", zap.String("file", TcAdaptiveFile), zap.Error(err))
+	}
+}
+
+// adaptiveOverride 开启自适应限速的网卡和当前限速，下发普通限速策略时默认class用这个速率
+// 策略带了配额的速率上限时不超过上限，配额限速或停止后自适应不会再放开
+func adaptiveOverride(policy *protos.TcPolicy) (iface, rate string) {
+	adaptiveMu.Lock()
+	defer adaptiveMu.Unlock()
+
+	if adaptive == nil || adaptive.RateBits == 0 {
+		return "", ""
+	}
+	return adaptive.Config.IfaceName, bitsToRate(capRate(adaptive.RateBits, policy.GetCapBits()))
+}
+
+// capRate capBits大于0时速率不超过capBits
+func capRate(bits, capBits uint64) uint64 {
+	if capBits > 0 && bits > capBits {
+		return capBits
+	}
+	return bits
+}
+
+// TcAdaptiveRate 自适应限速当前设置的速率，没开启时ok为false
+func TcAdaptiveRate() (iface string, bits uint64, ok bool) {
+	adaptiveMu.Lock()
+	defer adaptiveMu.Unlock()
+
+	if adaptive == nil {
+		return "", 0, false
+	}
+	return adaptive.Config.IfaceName, adaptive.RateBits, true
+}
+
+// TickTcAdaptive 每5分钟采样一次网卡发送量，需要时调整限速
+// 有调整时返回调整事件，由调用方上报服务端
+func TickTcAdaptive() *protos.TcAdjustEvent {
+	adaptiveMu.Lock()
+	defer adaptiveMu.Unlock()
+
+	if adaptive == nil {
+		return nil
+	}
+	cfg := adaptive.Config
+	now := time.Now()
+
+	tx, err := readTxBytes(cfg.IfaceName)
+	if err != nil {
+		common.Logger.Error("TickTcAdaptive ERR: ", zap.String("iface", cfg.IfaceName), zap.Error(err))
+		return nil
+	}
+
+	// 进入新的计费周期，重新开始统计
+	windowStart, _ := billingWindow(now, cfg.BillingDay)
+	if windowStart.UnixMilli() != adaptive.WindowStart {
+		adaptive.WindowStart = windowStart.UnixMilli()
+		adaptive.Samples = nil
+	}
+
+	if !adaptive.lastTime.IsZero() && tx >= adaptive.lastTx {
+		seconds := now.Sub(adaptive.lastTime).Seconds()
+		if seconds > 0 {
+			adaptive.Samples = append(adaptive.Samples, float64(tx-adaptive.lastTx)*8/seconds)
+		}
+	}
+	adaptive.lastTx, adaptive.lastTime = tx, now
+
+	bits, reason, used, total := decideAdaptiveRate(cfg, adaptive.Samples, windowSlots(cfg.BillingDay, now))
+	defer saveTcAdaptive()
+
+	if rateEqual(bits, adaptive.RateBits) {
+		return nil
+	}
+
+	ev := &protos.TcAdjustEvent{
+		IfaceName:  cfg.IfaceName,
+		OldBits:    adaptive.RateBits,
+		NewBits:    bits,
+		P95Bits:    samplesP95(adaptive.Samples),
+		TargetBits: cfg.TargetBits,
+		BurstUsed:  used,
+		BurstTotal: total,
+		Reason:     reason,
+		Timestamp:  now.UnixMilli(),
+	}
+	if err := setTcRate(cfg.IfaceName, bits, adaptive.AccessIP); err != nil {
+		ev.ErrMsg = err.Error()
+	} else {
+		adaptive.RateBits = bits
+	}
+	common.Logger.Info("TickTcAdaptive: ", zap.String("iface", cfg.IfaceName), zap.Uint64("old", ev.OldBits), zap.Uint64("new", bits), zap.String("reason", reason))
+
+	return ev
+}
+
+// decideAdaptiveRate 计算应该设置的限速
+// 95计费时每个计费周期最高的5%个点不计费，这些点就是可以超过目标的突发额度:
+// 额度没用完时放开到上限，用完以后限制在目标以下
+func decideAdaptiveRate(cfg *protos.TcAdaptiveConfig, samples []float64, slots int) (bits uint64, reason string, used, total uint32) {
+	total = uint32(slots * 5 / 100)
+	for _, v := range samples {
+		if v > float64(cfg.TargetBits) {
+			used++
+		}
+	}
+
+	if used < total {
+		bits = cfg.MaxBits
+		reason = fmt.Sprintf("突发额度剩余 %d/%d", total-used, total)
+	} else {
+		bits = uint64(float64(cfg.TargetBits) * adaptiveMargin)
+		reason = fmt.Sprintf("突发额度用完 %d/%d", used, total)
+	}
+
+	if bits < cfg.MinBits {
+		bits = cfg.MinBits
+	}
+	if bits > cfg.MaxBits {
+		bits = cfg.MaxBits
+	}
+	return
+}
+
+// billingWindow 当前时间所在的计费周期 [start, end)，每月day号开始
+func billingWindow(now time.Time, day uint32) (start, end time.Time) {
+	start = time.Date(now.Year(), now.Month(), int(day), 0, 0, 0, 0, now.Location())
+	if now.Before(start) {
+		start = start.AddDate(0, -1, 0)
+	}
+	return start, start.AddDate(0, 1, 0)
+}
+
+// windowSlots 计费周期里5分钟点的个数
+func windowSlots(day uint32, now time.Time) int {
+	start, end := billingWindow(now, day)
+	return int(end.Sub(start) / adaptiveSampleInterval)
+}
+
+func samplesP95(samples []float64) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	sorted := append([]float64{}, samples...)
+	sort.Float64s(sorted)
+
+	idx := (len(sorted)*95+99)/100 - 1
+	return sorted[idx]
+}
+
+func bitsToRate(bits uint64) string {
+	return fmt.Sprintf("%dkbit", bits/1000)
+}
@@ -0,0 +1,88 @@
+package logics
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/liuhengloveyou/pcdn/protos"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestBillingWindow(t *testing.T) {
+	now := time.Date(2025, 3, 5, 12, 0, 0, 0, time.UTC)
+
+	start, end := billingWindow(now, 10)
+	if !start.Equal(time.Date(2025, 2, 10, 0, 0, 0, 0, time.UTC)) || !end.Equal(time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("window: %v - %v", start, end)
+	}
+
+	start, _ = billingWindow(now, 1)
+	if !start.Equal(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("window start: %v", start)
+	}
+	if slots := windowSlots(1, now); slots != 31*24*12 {
+		t.Errorf("slots: %d", slots)
+	}
+}
+
+func TestDecideAdaptiveRate(t *testing.T) {
+	cfg := &protos.TcAdaptiveConfig{TargetBits: 100e6, MinBits: 50e6, MaxBits: 500e6}
+
+	// 100个点允许5个超过目标
+	samples := []float64{200e6, 200e6, 200e6, 200e6, 80e6}
+	bits, _, used, total := decideAdaptiveRate(cfg, samples, 100)
+	if bits != cfg.MaxBits || used != 4 || total != 5 {
+		t.Errorf("burst: %d %d/%d", bits, used, total)
+	}
+
+	samples = append(samples, 200e6)
+	bits, _, used, _ = decideAdaptiveRate(cfg, samples, 100)
+	if bits != 98e6 || used != 5 {
+		t.Errorf("limited: %d %d", bits, used)
+	}
+
+	cfg.MinBits = 99e6
+	if bits, _, _, _ = decideAdaptiveRate(cfg, samples, 100); bits != 99e6 {
+		t.Errorf("min: %d", bits)
+	}
+}
+
+func TestTcAdaptiveStateJSON(t *testing.T) {
+	state := &tcAdaptiveState{
+		Config:      &protos.TcAdaptiveConfig{Enabled: true, IfaceName: "eth0", TargetBits: 100000000, MaxBits: 200000000, BillingDay: 5},
+		AccessIP:    "1.2.3.4",
+		WindowStart: 1700000000000,
+		Samples:     []float64{1, 2.5},
+		RateBits:    150000000,
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := &tcAdaptiveState{}
+	if err := json.Unmarshal(data, got); err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(got.Config, state.Config) || got.AccessIP != state.AccessIP || got.WindowStart != state.WindowStart ||
+		len(got.Samples) != 2 || got.RateBits != state.RateBits {
+		t.Fatalf("%s => %+v", data, got)
+	}
+}
+
+func TestAdaptiveOverrideCap(t *testing.T) {
+	old := adaptive
+	defer func() { adaptive = old }()
+	adaptive = &tcAdaptiveState{Config: &protos.TcAdaptiveConfig{IfaceName: "eth0"}, RateBits: 200000000}
+
+	if iface, rate := adaptiveOverride(&protos.TcPolicy{Rate: "500mbit"}); iface != "eth0" || rate != "200000kbit" {
+		t.Fatalf("no cap: %s %s", iface, rate)
+	}
+	// 配额限速后自适应不能再放开
+	if _, rate := adaptiveOverride(&protos.TcPolicy{Rate: "10mbit", CapBits: 10000000}); rate != "10000kbit" {
+		t.Fatalf("cap: %s", rate)
+	}
+	if _, rate := adaptiveOverride(&protos.TcPolicy{CapBits: 300000000}); rate != "200000kbit" {
+		t.Fatalf("cap above rate: %s", rate)
+	}
+}
@@ -0,0 +1,441 @@
+package logics
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"pcdnagent/common"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/liuhengloveyou/pcdn/protos"
+	"github.com/shirou/gopsutil/v4/process"
+	"go.uber.org/zap"
+)
+
+// 按程序限速: iptables在OUTPUT链上按cgroup给本机程序发出的包打fwmark，
+// tc用fw filter把带标记的包送进规则对应的HTB class。
+const (
+	tcMarkChain = "PCDN_TC"
+	// 只用fwmark的16-23位，不影响其它程序(如多线路策略路由)使用的标记
+	tcMarkMask     = 0x00ff0000
+	tcMarkShift    = 16
+	tcMaxPrograms  = 255
+	tcProgramProcs = "cgroup.procs"
+)
+
+// cgroup v2 挂载点
+var CgroupRoot = "/sys/fs/cgroup"
+
+// 按程序匹配的规则打标记的目标
+type programTarget struct {
+	name   string // 规则名
+	target string // process:xxx unit:xxx cgroup:xxx
+	cgroup string // 实际匹配的cgroup路径，相对CgroupRoot
+	mark   uint32
+}
+
+var (
+	// 每个程序目标分到的fwmark，调用时需持有tcMu
+	programMarks = make(map[string]uint32)
+
+	programMu sync.Mutex
+	// 当前iptables里打标记的目标
+	programTargets []*programTarget
+	// 上次心跳时每个标记的累计字节数，用来算速率
+	prevProgramBytes = make(map[uint32]uint64)
+	prevProgramTime  time.Time
+)
+
+// isProgramRule 规则是不是按程序匹配
+func isProgramRule(rule *protos.TcRule) bool {
+	return rule.Process != "" || rule.Unit != "" || rule.Cgroup != ""
+}
+
+func programKey(rule *protos.TcRule) string {
+	switch {
+	case rule.Cgroup != "":
+		return "cgroup:" + strings.Trim(rule.Cgroup, "/")
+	case rule.Unit != "":
+		return "unit:" + rule.Unit
+	}
+	return "process:" + rule.Process
+}
+
+// programMark 程序目标的fwmark，第一次用到时分配，用满时返回0
+func programMark(rule *protos.TcRule) uint32 {
+	key := programKey(rule)
+	if mark, ok := programMarks[key]; ok {
+		return mark
+	}
+
+	used := make(map[uint32]bool, len(programMarks))
+	for _, mark := range programMarks {
+		used[mark] = true
+	}
+	for i := uint32(1); i <= tcMaxPrograms; i++ {
+		mark := i << tcMarkShift
+		if !used[mark] {
+			programMarks[key] = mark
+			return mark
+		}
+	}
+	return 0
+}
+
+func validateProgramRule(rule *protos.TcRule) error {
+	n := 0
+	for _, s := range []string{rule.Process, rule.Unit, rule.Cgroup} {
+		if s != "" {
+			n++
+		}
+	}
+	if n > 1 {
+		return fmt.Errorf("规则 %s 只能指定进程、unit、cgroup中的一个", rule.Name)
+	}
+	if len(rule.Cidrs) > 0 || len(rule.Ports) > 0 || (rule.Protocol != "" && rule.Protocol != "all") {
+		return fmt.Errorf("规则 %s 按程序匹配时不能再指定地址、端口、协议", rule.Name)
+	}
+	if strings.Contains(rule.Cgroup, "..") {
+		return fmt.Errorf("规则 %s cgroup错误: %s", rule.Name, rule.Cgroup)
+	}
+	return nil
+}
+
+// resolveProgramCgroup 规则对应的cgroup路径
+// 进程名按第一个在运行的同名进程所在的cgroup，同一个cgroup里的其它进程也会一起限速
+func resolveProgramCgroup(rule *protos.TcRule) (string, error) {
+	switch {
+	case rule.Cgroup != "":
+		return strings.Trim(rule.Cgroup, "/"), nil
+
+	case rule.Unit != "":
+		output, err := exec.Command("systemctl", "show", "-p", "ControlGroup", "--value", rule.Unit).Output()
+		if err != nil {
+			return "", fmt.Errorf("查询unit %s 失败: %w", rule.Unit, err)
+		}
+		path := strings.Trim(strings.TrimSpace(string(output)), "/")
+		if path == "" {
+			return "", fmt.Errorf("unit %s 没有运行", rule.Unit)
+		}
+		return path, nil
+	}
+
+	processes, err := process.ProcessesWithContext(context.Background())
+	if err != nil {
+		return "", err
+	}
+	for _, p := range processes {
+		if name, _ := p.Name(); name != rule.Process {
+			continue
+		}
+		data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", p.Pid))
+		if err != nil {
+			continue
+		}
+		if path := parseCgroupFile(string(data)); path != "" {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("进程 %s 没有运行或在根cgroup里", rule.Process)
+}
+
+// parseCgroupFile 从/proc/<pid>/cgroup里取cgroup v2的路径，根cgroup返回空
+func parseCgroupFile(data string) string {
+	for _, line := range strings.Split(data, "\n") {
+		if strings.HasPrefix(line, "0::") {
+			return strings.Trim(strings.TrimSpace(line[3:]), "/")
+		}
+	}
+	return ""
+}
+
+// syncProgramMarks 按所有网卡的期望策略重新设置iptables标记，调用时需持有tcMu
+// 目标和内核里的规则都没变时不动；重新设置过时返回原因
+func syncProgramMarks() (string, error) {
+	ifaces := make([]string, 0, len(desiredPolicies))
+	for iface := range desiredPolicies {
+		ifaces = append(ifaces, iface)
+	}
+	sort.Strings(ifaces)
+
+	var targets []*programTarget
+	var errMsg []string
+	keys := make(map[string]bool)
+	for _, iface := range ifaces {
+		for _, rule := range desiredPolicies[iface].Rules {
+			if !isProgramRule(rule) {
+				continue
+			}
+			key := programKey(rule)
+			if keys[key] {
+				continue
+			}
+			keys[key] = true
+
+			mark := programMark(rule)
+			if mark == 0 {
+				errMsg = append(errMsg, fmt.Sprintf("规则 %s: 程序太多", rule.Name))
+				continue
+			}
+			path, err := resolveProgramCgroup(rule)
+			if err != nil {
+				errMsg = append(errMsg, fmt.Sprintf("规则 %s: %v", rule.Name, err))
+				continue
+			}
+			targets = append(targets, &programTarget{name: rule.Name, target: key, cgroup: path, mark: mark})
+		}
+	}
+	// 不再用的目标释放标记
+	for key := range programMarks {
+		if !keys[key] {
+			delete(programMarks, key)
+		}
+	}
+
+	programMu.Lock()
+	defer programMu.Unlock()
+
+	reason := ""
+	if !programTargetsEqual(programTargets, targets) {
+		reason = "程序目标变化"
+	} else if len(targets) > 0 {
+		reason = programMarksDrift(len(targets))
+	}
+
+	if reason != "" {
+		if err := writeProgramMarks(targets); err != nil {
+			errMsg = append(errMsg, err.Error())
+		}
+		programTargets = targets
+		prevProgramBytes = make(map[uint32]uint64)
+	}
+
+	if len(errMsg) > 0 {
+		return reason, fmt.Errorf("%s", strings.Join(errMsg, "\n"))
+	}
+	return reason, nil
+}
+
+func programTargetsEqual(a, b []*programTarget) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if *a[i] != *b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// programMarkBins 机器上有的iptables命令，没有ip6tables时只设置IPv4
+func programMarkBins() []string {
+	var bins []string
+	for _, bin := range []string{"iptables", "ip6tables"} {
+		if _, err := exec.LookPath(bin); err == nil {
+			bins = append(bins, bin)
+		}
+	}
+	return bins
+}
+
+// programMarksDrift IPv4和IPv6分别检查内核里的标记规则，一致时返回空
+func programMarksDrift(targets int) string {
+	for _, bin := range programMarkBins() {
+		counters, err := readBinProgramCounters(bin)
+		if err != nil || exec.Command(bin, "-t", "mangle", "-C", "OUTPUT", "-j", tcMarkChain).Run() != nil {
+			return bin + " 标记规则不存在"
+		}
+		if len(counters) != targets {
+			return bin + " 标记规则不一致"
+		}
+	}
+	return ""
+}
+
+// writeProgramMarks 重建标记链，没有目标时删掉
+// IPv4和IPv6各自设置，一个失败不影响另一个
+func writeProgramMarks(targets []*programTarget) error {
+	var errMsg []string
+	for _, bin := range programMarkBins() {
+		if err := writeBinProgramMarks(bin, targets); err != nil {
+			common.Logger.Error("writeProgramMarks ERR: ", zap.String("bin", bin), zap.Error(err))
+			errMsg = append(errMsg, err.Error())
+		}
+	}
+	if len(errMsg) > 0 {
+		return fmt.Errorf("%s", strings.Join(errMsg, "\n"))
+	}
+	return nil
+}
+
+func writeBinProgramMarks(bin string, targets []*programTarget) error {
+	run := func(args ...string) error {
+		cmd := exec.Command(bin, append([]string{"-t", "mangle"}, args...)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("命令执行失败: %s\n错误输出: %s", cmd.String(), string(output))
+		}
+		return nil
+	}
+
+	if len(targets) == 0 {
+		run("-D", "OUTPUT", "-j", tcMarkChain)
+		run("-F", tcMarkChain)
+		run("-X", tcMarkChain)
+		return nil
+	}
+
+	run("-N", tcMarkChain) // 链已经存在时会失败，忽略
+	for _, args := range buildProgramMarkCmds(targets) {
+		if err := run(args...); err != nil {
+			return err
+		}
+	}
+	if run("-C", "OUTPUT", "-j", tcMarkChain) != nil {
+		return run("-I", "OUTPUT", "-j", tcMarkChain)
+	}
+	return nil
+}
+
+// buildProgramMarkCmds 清空标记链后重新添加的iptables参数(不含-t mangle)
+// 每条只给还没有标记的包打，按规则顺序第一个匹配的生效
+func buildProgramMarkCmds(targets []*programTarget) [][]string {
+	mask := fmt.Sprintf("0x%x", tcMarkMask)
+	cmds := [][]string{{"-F", tcMarkChain}}
+
+	for _, t := range targets {
+		cmds = append(cmds, []string{"-A", tcMarkChain, "-m", "cgroup", "--path", t.cgroup,
+			"-m", "mark", "--mark", "0/" + mask,
+			"-j", "MARK", "--set-xmark", fmt.Sprintf("0x%x/%s", t.mark, mask)})
+	}
+	return cmds
+}
+
+// readProgramCounters 标记链里每个标记的累计字节数，IPv4和IPv6加在一起，读不到的一边不算
+func readProgramCounters() (map[uint32]uint64, error) {
+	rst := make(map[uint32]uint64)
+	var lastErr error
+	ok := false
+	for _, bin := range programMarkBins() {
+		counters, err := readBinProgramCounters(bin)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		ok = true
+		for mark, bytes := range counters {
+			rst[mark] += bytes
+		}
+	}
+	if !ok {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("没有iptables")
+		}
+		return nil, lastErr
+	}
+	return rst, nil
+}
+
+func readBinProgramCounters(bin string) (map[uint32]uint64, error) {
+	output, err := exec.Command(bin, "-t", "mangle", "-nvx", "-L", tcMarkChain).Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseProgramCounters(string(output)), nil
+}
+
+// parseProgramCounters 解析 iptables -nvx -L 的输出
+func parseProgramCounters(output string) map[uint32]uint64 {
+	rst := make(map[uint32]uint64)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[2] != "MARK" {
+			continue
+		}
+		bytes, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		set := fieldAfter(fields, "xset")
+		if set == "" {
+			continue
+		}
+		mark, err := strconv.ParseUint(strings.Split(set, "/")[0], 0, 32)
+		if err != nil {
+			continue
+		}
+		rst[uint32(mark)] += bytes
+	}
+	return rst
+}
+
+// FillProgramInfo 按程序限速的规则的流量和进程填到心跳里，需在FillProcessInfo之后调用
+func FillProgramInfo(heartbeat *protos.Heartbeat) {
+	programMu.Lock()
+	defer programMu.Unlock()
+
+	if len(programTargets) == 0 {
+		return
+	}
+
+	counters, err := readProgramCounters()
+	if err != nil {
+		common.Logger.Error("FillProgramInfo ERR: ", zap.Error(err))
+		return
+	}
+	now := time.Now()
+	elapsed := now.Sub(prevProgramTime).Seconds()
+
+	programOf := make(map[int32]string)
+	for _, t := range programTargets {
+		one := &protos.SystemMonitorProgram{
+			Name:      t.name,
+			Target:    t.target,
+			Cgroup:    t.cgroup,
+			Pids:      cgroupPids(t.cgroup),
+			BytesSent: counters[t.mark],
+		}
+		if prev, ok := prevProgramBytes[t.mark]; ok && elapsed > 0 && one.BytesSent >= prev {
+			one.SendRate = float64(one.BytesSent-prev) / elapsed
+		}
+		prevProgramBytes[t.mark] = one.BytesSent
+
+		for _, pid := range one.Pids {
+			programOf[pid] = t.name
+		}
+		heartbeat.Monitor.Programs = append(heartbeat.Monitor.Programs, one)
+	}
+	prevProgramTime = now
+
+	for _, p := range heartbeat.Monitor.Processes {
+		p.Program = programOf[p.Pid]
+	}
+}
+
+// cgroupPids cgroup和子cgroup里的进程
+func cgroupPids(path string) []int32 {
+	var pids []int32
+	filepath.WalkDir(filepath.Join(CgroupRoot, path), func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || d.Name() != tcProgramProcs {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil
+		}
+		for _, line := range strings.Fields(string(data)) {
+			if pid, err := strconv.ParseInt(line, 10, 32); err == nil {
+				pids = append(pids, int32(pid))
+			}
+		}
+		return nil
+	})
+	return pids
+}
@@ -0,0 +1,304 @@
+package logics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/liuhengloveyou/pcdn/protos"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestBuildPolicyCmds(t *testing.T) {
+	policy := &protos.TcPolicy{
+		Rate: "10mbit",
+		Rules: []*protos.TcRule{
+			{Name: "access", Cidrs: []string{"1.2.3.4"}},
+			{Name: "web", Cidrs: []string{"10.0.0.0/8", "2001:db8::/32"}, Ports: []uint32{80, 443}, Protocol: "tcp", Rate: "2mbit", Ceil: "5mbit", Prio: 3},
+		},
+	}
+	if err := validateTcPolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, args := range buildPolicyCmds("eth0", policy) {
+		got = append(got, strings.Join(args, " "))
+	}
+
+	want := []string{
+		"qdisc add dev eth0 root handle 1: htb default 20",
+		"class add dev eth0 parent 1: classid 1:20 htb rate 10mbit ceil 10mbit",
+		"class add dev eth0 parent 1: classid 1:100 htb rate 10000mbit ceil 10000mbit prio 0",
+		"filter add dev eth0 protocol ip parent 1:0 prio 1 u32 match ip dst 1.2.3.4 flowid 1:100",
+		"class add dev eth0 parent 1: classid 1:101 htb rate 2mbit ceil 5mbit prio 3",
+		"filter add dev eth0 protocol ip parent 1:0 prio 3 u32 match ip dst 10.0.0.0/8 match ip protocol 6 0xff match ip dport 80 0xffff flowid 1:101",
+		"filter add dev eth0 protocol ip parent 1:0 prio 3 u32 match ip dst 10.0.0.0/8 match ip protocol 6 0xff match ip dport 443 0xffff flowid 1:101",
+		"filter add dev eth0 protocol ipv6 parent 1:0 prio 4 u32 match ip6 dst 2001:db8::/32 match ip6 protocol 6 0xff match ip6 dport 80 0xffff flowid 1:101",
+		"filter add dev eth0 protocol ipv6 parent 1:0 prio 4 u32 match ip6 dst 2001:db8::/32 match ip6 protocol 6 0xff match ip6 dport 443 0xffff flowid 1:101",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d cmds, want %d:\n%s", len(got), len(want), strings.Join(got, "\n"))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("cmd %d:\n got: %s\nwant: %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestValidateTcPolicy(t *testing.T) {
+	bad := []*protos.TcRule{
+		{Name: "proto", Protocol: "icmp"},
+		{Name: "prio", Prio: 8},
+		{Name: "port", Ports: []uint32{70000}},
+		{Name: "cidr", Cidrs: []string{"10.0.0.0/33"}},
+	}
+	for _, rule := range bad {
+		if err := validateTcPolicy(&protos.TcPolicy{Rules: []*protos.TcRule{rule}}); err == nil {
+			t.Errorf("rule %s should be invalid", rule.Name)
+		}
+	}
+}
+
+func TestParseClassStats(t *testing.T) {
+	output := `class htb 1:101 root prio 3 rate 2Mbit ceil 5Mbit burst 1600b cburst 1600b
+ Sent 52000 bytes 40 pkt (dropped 3, overlimits 7 requeues 0)
+ backlog 3028b 2p requeues 0
+ lended: 40 borrowed: 0 giants: 0
+class htb 1:20 root prio 0 rate 10Mbit ceil 10Mbit burst 1600b cburst 1600b
+ Sent 1234 bytes 12 pkt (dropped 0, overlimits 0 requeues 0)
+ backlog 0b 0p requeues 0
+`
+	stats := parseClassStats(output)
+	if len(stats) != 2 {
+		t.Fatalf("got %d stats", len(stats))
+	}
+
+	s := stats[0]
+	if s.ClassId != "1:101" || s.Parent != "root" || s.Rate != "2Mbit" || s.Ceil != "5Mbit" ||
+		s.RateBits != 2000000 || s.CeilBits != 5000000 ||
+		s.Bytes != 52000 || s.Packets != 40 || s.Drops != 3 || s.Overlimits != 7 ||
+		s.BacklogBytes != 3028 || s.BacklogPackets != 2 {
+		t.Errorf("bad stat: %v", s)
+	}
+
+	policy := &protos.TcPolicy{Rules: []*protos.TcRule{{Name: "access"}, {Name: "web"}}}
+	if name := classRuleName(policy, s.ClassId); name != "web" {
+		t.Errorf("rule name: %s", name)
+	}
+	if name := classRuleName(policy, stats[1].ClassId); name != "default" {
+		t.Errorf("rule name: %s", name)
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want uint64
+	}{
+		{"10Mbit", 10000000},
+		{"500Kbit", 500000},
+		{"10mbit", 10000000},
+		{"1Gbit", 1000000000},
+		{"800bit", 800},
+		// bps是字节/秒
+		{"125Kbps", 1000000},
+		{"100bps", 800},
+		{"", 0},
+		{"bad", 0},
+	}
+	for _, tt := range tests {
+		if got := parseRate(tt.in); got != tt.want {
+			t.Errorf("%q: got %d want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseQdiscStats(t *testing.T) {
+	output := `qdisc htb 1: root refcnt 2 r2q 10 default 0x20 direct_packets_stat 0 direct_qlen 1000
+ Sent 98765 bytes 80 pkt (dropped 1, overlimits 12 requeues 0)
+ backlog 12Kb 9p requeues 0
+qdisc fq_codel 0: parent :1 limit 10240p flows 1024 quantum 1514 target 5ms interval 100ms memory_limit 32Mb ecn drop_batch 64
+ Sent 0 bytes 0 pkt (dropped 0, overlimits 0 requeues 0)
+ backlog 0b 0p requeues 0
+`
+	stats := parseQdiscStats(output)
+	if len(stats) != 2 {
+		t.Fatalf("got %d stats", len(stats))
+	}
+
+	q := stats[0]
+	if q.Kind != "htb" || q.Handle != "1:" || q.Parent != "root" || q.Bytes != 98765 || q.Packets != 80 ||
+		q.Drops != 1 || q.Overlimits != 12 || q.BacklogBytes != 12*1024 || q.BacklogPackets != 9 {
+		t.Errorf("bad stat: %v", q)
+	}
+	if stats[1].Kind != "fq_codel" || stats[1].Parent != ":1" {
+		t.Errorf("bad stat: %v", stats[1])
+	}
+}
+
+func TestPolicyDrift(t *testing.T) {
+	policy := &protos.TcPolicy{
+		Rate:  "10mbit",
+		Rules: []*protos.TcRule{{Name: "access"}, {Name: "web", Rate: "2mbit", Ceil: "5mbit"}},
+	}
+	qdiscs := parseQdiscStats("qdisc htb 1: root refcnt 2 r2q 10 default 0x20 direct_packets_stat 0 direct_qlen 1000\n")
+	classes := parseClassStats(`class htb 1:20 root prio 0 rate 10Mbit ceil 10Mbit burst 1600b cburst 1600b
+class htb 1:100 root prio 0 rate 10Gbit ceil 10Gbit burst 0b cburst 0b
+class htb 1:101 root prio 0 rate 2Mbit ceil 5Mbit burst 1600b cburst 1600b
+`)
+
+	if reason := policyDrift(policy, qdiscs, classes); reason != "" {
+		t.Errorf("unexpected drift: %s", reason)
+	}
+	if reason := policyDrift(policy, nil, classes); reason == "" {
+		t.Error("missing qdisc should drift")
+	}
+	if reason := policyDrift(policy, qdiscs, classes[:2]); reason == "" {
+		t.Error("missing class should drift")
+	}
+
+	policy.Rules[1].Ceil = "6mbit"
+	if reason := policyDrift(policy, qdiscs, classes); reason == "" {
+		t.Error("changed ceil should drift")
+	}
+}
+
+func TestClassesWithinLimit(t *testing.T) {
+	classes := []*protos.TcClassStat{
+		{ClassId: "1:20", CeilBits: 10000000, Throughput: 10300000},
+		{ClassId: "1:100", CeilBits: 10000000000, Throughput: 50000000},
+	}
+	if !classesWithinLimit(classes) {
+		t.Error("should pass")
+	}
+
+	classes[0].Throughput = 12000000
+	if classesWithinLimit(classes) {
+		t.Error("should fail")
+	}
+}
+
+func TestPolicyTxLimit(t *testing.T) {
+	cases := []struct {
+		policy *protos.TcPolicy
+		want   uint64
+	}{
+		{nil, 0},
+		{&protos.TcPolicy{}, 0},
+		{&protos.TcPolicy{Rate: "10mbit", Rules: []*protos.TcRule{{Name: "access"}}}, 10000000},
+		{&protos.TcPolicy{Rate: "10mbit", Rules: []*protos.TcRule{{Name: "access"}, {Name: "web", Rate: "2mbit", Ceil: "5mbit"}, {Name: "dns", Rate: "1mbit"}}}, 16000000},
+		{&protos.TcPolicy{Rate: "10mbit", Rules: []*protos.TcRule{{Name: "web"}}}, 0},
+	}
+	for i, c := range cases {
+		if got := policyTxLimit(c.policy); got != c.want {
+			t.Errorf("%d: %d != %d", i, got, c.want)
+		}
+	}
+}
+
+func TestBuildPolicyCmdsProgram(t *testing.T) {
+	programMarks = make(map[string]uint32)
+	policy := &protos.TcPolicy{
+		Rules: []*protos.TcRule{
+			{Name: "vendor-a", Unit: "vendor-a.service", Rate: "20mbit"},
+			{Name: "vendor-b", Process: "vendorb", Rate: "5mbit"},
+		},
+	}
+	if err := validateTcPolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, args := range buildPolicyCmds("eth0", policy)[2:] {
+		got = append(got, strings.Join(args, " "))
+	}
+	want := []string{
+		"class add dev eth0 parent 1: classid 1:100 htb rate 20mbit ceil 20mbit prio 0",
+		"filter add dev eth0 protocol all parent 1:0 prio 1 handle 0x10000/0xff0000 fw flowid 1:100",
+		"class add dev eth0 parent 1: classid 1:101 htb rate 5mbit ceil 5mbit prio 0",
+		"filter add dev eth0 protocol all parent 1:0 prio 3 handle 0x20000/0xff0000 fw flowid 1:101",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	bad := []*protos.TcRule{
+		{Name: "both", Process: "a", Unit: "a.service"},
+		{Name: "cidr", Process: "a", Cidrs: []string{"1.2.3.4"}},
+		{Name: "path", Cgroup: "../etc"},
+	}
+	for _, rule := range bad {
+		if err := validateTcPolicy(&protos.TcPolicy{Rules: []*protos.TcRule{rule}}); err == nil {
+			t.Errorf("rule %s should be invalid", rule.Name)
+		}
+	}
+}
+
+func TestParseProgramCounters(t *testing.T) {
+	output := `Chain PCDN_TC (1 references)
+    pkts      bytes target     prot opt in     out     source               destination
+    1200  1500000 MARK       all  --  *      *       0.0.0.0/0            0.0.0.0/0            cgroup system.slice/vendor-a.service mark match 0x0/0xff0000 MARK xset 0x10000/0xff0000
+      10     4000 MARK       all  --  *      *       0.0.0.0/0            0.0.0.0/0            cgroup user.slice/vendorb mark match 0x0/0xff0000 MARK xset 0x20000/0xff0000
+`
+	got := parseProgramCounters(output)
+	if got[0x10000] != 1500000 || got[0x20000] != 4000 || len(got) != 2 {
+		t.Errorf("got %v", got)
+	}
+
+	if path := parseCgroupFile("12:pids:/x\n0::/system.slice/vendor-a.service\n"); path != "system.slice/vendor-a.service" {
+		t.Errorf("cgroup path: %s", path)
+	}
+	if path := parseCgroupFile("0::/\n"); path != "" {
+		t.Errorf("root cgroup: %s", path)
+	}
+}
+
+func TestTcPoliciesFile(t *testing.T) {
+	policies := map[string]*protos.TcPolicy{
+		"eth0": {Rate: "10mbit", Rules: []*protos.TcRule{{Name: "access", Cidrs: []string{"1.2.3.4"}}, {Name: "web", Ports: []uint32{80}, Prio: 2}}},
+		"eth1": {Rules: []*protos.TcRule{{Name: "vendor", Unit: "vendor.service", Rate: "5mbit"}}},
+	}
+	data, err := marshalTcPolicies(policies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := unmarshalTcPolicies(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(policies) {
+		t.Fatalf("got %d policies", len(got))
+	}
+	for iface, want := range policies {
+		if !proto.Equal(got[iface], want) {
+			t.Fatalf("%s: %v != %v", iface, got[iface], want)
+		}
+	}
+
+	// 以前用encoding/json保存的文件
+	old := []byte(`{"eth0":{"rate":"10mbit","rules":[{"name":"access","cidrs":["1.2.3.4"]}]}}`)
+	if got, err = unmarshalTcPolicies(old); err != nil || got["eth0"].GetRate() != "10mbit" || len(got["eth0"].Rules) != 1 {
+		t.Fatalf("old file: %v %v", got, err)
+	}
+}
+
+func TestProgramDriftDue(t *testing.T) {
+	defer func() { lastProgramDrift = "" }()
+	lastProgramDrift = ""
+
+	ev := &protos.TcDriftEvent{Reason: "程序标记: 目标设置失败", ErrMsg: "进程 vendor 没有运行"}
+	if !programDriftDue(ev) {
+		t.Fatal("first event")
+	}
+	if programDriftDue(ev) {
+		t.Fatal("same event again")
+	}
+	if !programDriftDue(&protos.TcDriftEvent{Reason: ev.Reason, ErrMsg: "进程 other 没有运行"}) {
+		t.Fatal("different event")
+	}
+	lastProgramDriftTime = lastProgramDriftTime.Add(-programDriftInterval)
+	if !programDriftDue(&protos.TcDriftEvent{Reason: ev.Reason, ErrMsg: "进程 other 没有运行"}) {
+		t.Fatal("after interval")
+	}
+}
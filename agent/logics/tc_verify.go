@@ -0,0 +1,154 @@
+package logics
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/liuhengloveyou/pcdn/protos"
+)
+
+const (
+	tcVerifyMaxSeconds = 60
+
+	// htb允许一定的突发，平均速率超过ceil 5%以上才算限速没生效
+	tcVerifyTolerance = 1.05
+)
+
+// tcSample 一次采样: 网卡累计发送字节数和每个class的统计
+type tcSample struct {
+	txBytes uint64
+	classes []*protos.TcClassStat
+	err     error
+}
+
+// VerifyTcPolicy 设置限速后采样seconds秒，检查网卡上每个限速class的平均速率没有超过ceil
+// 和 stat.sh 手工验证的方法一样，faceName为空时验证所有物理网卡
+func VerifyTcPolicy(faceName string, seconds uint32) *protos.TcVerifyResult {
+	if seconds > tcVerifyMaxSeconds {
+		seconds = tcVerifyMaxSeconds
+	}
+	result := &protos.TcVerifyResult{Passed: true, Seconds: seconds}
+
+	ifaces := []string{faceName}
+	if faceName == "" {
+		var err error
+		if ifaces, err = getPhysicalInterfaces(); err != nil {
+			result.Passed = false
+			result.Ifaces = append(result.Ifaces, &protos.TcVerifyIface{ErrMsg: fmt.Sprintf("获取网卡失败: %v", err)})
+			return result
+		}
+	}
+
+	// 所有网卡在同一个时间窗口里采样
+	starts := make(map[string]*tcSample, len(ifaces))
+	for _, iface := range ifaces {
+		starts[iface] = takeTcSample(iface)
+	}
+	begin := time.Now()
+	time.Sleep(time.Duration(seconds) * time.Second)
+	elapsed := time.Since(begin).Seconds()
+
+	tcMu.Lock()
+	policies := make(map[string]*protos.TcPolicy, len(desiredPolicies))
+	for iface, policy := range desiredPolicies {
+		policies[iface] = policy
+	}
+	tcMu.Unlock()
+
+	for _, iface := range ifaces {
+		one := &protos.TcVerifyIface{IfaceName: iface}
+		start, end := starts[iface], takeTcSample(iface)
+		if start.err != nil || end.err != nil {
+			one.ErrMsg = fmt.Sprintf("采样失败: %v %v", start.err, end.err)
+		} else {
+			if end.txBytes >= start.txBytes {
+				one.TxBits = float64(end.txBytes-start.txBytes) * 8 / elapsed
+			}
+			fillClassThroughput(start.classes, end.classes, elapsed)
+			for _, c := range end.classes {
+				c.RuleName = classRuleName(policies[iface], c.ClassId)
+			}
+			one.Classes = end.classes
+			one.Passed = classesWithinLimit(end.classes)
+			if limit := policyTxLimit(policies[iface]); limit > 0 && one.TxBits > float64(limit)*tcVerifyTolerance {
+				one.Passed = false
+				one.ErrMsg = fmt.Sprintf("网卡发送速率 %.0f 超过限速 %d", one.TxBits, limit)
+			}
+		}
+
+		result.Passed = result.Passed && one.Passed
+		result.Ifaces = append(result.Ifaces, one)
+	}
+
+	return result
+}
+
+// policyTxLimit 策略允许的网卡总发送速率 bits/s: 默认class加上每条规则的ceil
+// 放行接入服务器的流量不算; 有不限速的class时返回0，不检查总速率
+func policyTxLimit(policy *protos.TcPolicy) uint64 {
+	if policy == nil || policy.Rate == "" {
+		return 0
+	}
+	limit := parseRate(policy.Rate)
+	for _, rule := range policy.Rules {
+		if rule.Name == tcAccessRuleName {
+			continue
+		}
+		ceil := rule.Ceil
+		if ceil == "" {
+			ceil = rule.Rate
+		}
+		if ceil == "" {
+			return 0
+		}
+		limit += parseRate(ceil)
+	}
+	return limit
+}
+
+func takeTcSample(iface string) *tcSample {
+	s := &tcSample{}
+	if s.txBytes, s.err = readTxBytes(iface); s.err != nil {
+		return s
+	}
+	_, s.classes, s.err = readTcStats(iface)
+	return s
+}
+
+// readTxBytes 网卡累计发送字节数
+func readTxBytes(iface string) (uint64, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/sys/class/net/%s/statistics/tx_bytes", iface))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// fillClassThroughput 按两次采样的字节数差计算每个class的平均速率
+func fillClassThroughput(prev, curr []*protos.TcClassStat, seconds float64) {
+	for _, c := range curr {
+		for _, p := range prev {
+			if p.ClassId == c.ClassId && c.Bytes >= p.Bytes {
+				c.Throughput = float64(c.Bytes-p.Bytes) * 8 / seconds
+				break
+			}
+		}
+	}
+}
+
+// classesWithinLimit 每个限速class的平均速率都没有超过ceil
+func classesWithinLimit(classes []*protos.TcClassStat) bool {
+	unlimited := parseRate(tcUnlimitedRate)
+	for _, c := range classes {
+		if c.CeilBits == 0 || c.CeilBits >= unlimited {
+			continue
+		}
+		if c.Throughput > float64(c.CeilBits)*tcVerifyTolerance {
+			return false
+		}
+	}
+	return true
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/signal"
 	"pcdnagent/common"
+	"pcdnagent/logics"
 	"pcdnagent/upgrade"
 	"syscall"
 	"time"
@@ -30,8 +31,11 @@ var (
 	tcpServer     = flag.String("tcp_server", "101.37.182.58:10001", "tcp服务地址")
 	updateServer  = flag.String("update_server", "http://update.intelliflyt.com/update/", "更新服务器地址")
 	upgradeServer = flag.String("upgrade_server", "http://update.intelliflyt.com/upgrade/", "升级服务器地址")
-	DeviceSN      = flag.String("sn", "SN-1234567890", "设备SN")
+	DeviceSN      = flag.String("sn", "", "设备SN, 为空时依次从/etc/pcdnsn、启动参数snum、DMI序列号和machine-id取")
 	dnsServer     = flag.String("dns_server", "", "自定义DNS服务器地址, 如: 8.8.8.8:53")
+	topProcesses  = flag.Int("top_processes", 20, "心跳里带的进程数，按CPU、内存和TCP连接数各取前N个")
+	stunServers   = flag.String("stun_servers", "stun.miwifi.com:3478,stun.qq.com:3478", "检测NAT类型用的STUN服务器，逗号分隔")
+	metricsAddr   = flag.String("metrics_addr", "", "本地Prometheus指标的监听地址, 如: 127.0.0.1:9101, 为空时不开启")
 )
 
 // go-selfupdate setup and config
@@ -87,6 +91,8 @@ func main() {
 	}
 
 	gocommon.SingleInstane("/tmp/pcdnagent.pid")
+	logics.ProcessTopN = *topProcesses
+	logics.StunServers = logics.ParseStunServers(*stunServers)
 
 	// 初始化升级服务
 	if err := checkAndUpgrade(); err != nil {
@@ -103,6 +109,19 @@ func main() {
 		fmt.Println("tcp_server is nil")
 		return
 	}
+	if deviceSN() == "" {
+		common.Logger.Error("没有找到设备SN, 用-sn指定")
+	}
+
+	// 重启后内核里的限速规则没了，按本地保存的策略重新设置
+	logics.RestoreTcPolicies()
+	logics.RestoreTcAdaptive()
+	logics.RestoreProbes()
+
+	// 启动时检测一次NAT，之后定时检测
+	go logics.DetectNat()
+
+	StartMetricsServer(*metricsAddr)
 
 	go func() {
 		for {
@@ -126,7 +145,7 @@ func checkAndUpgrade() error {
 		return nil
 	}
 
-	if *DeviceSN == "" {
+	if deviceSN() == "" {
 		common.Logger.Warn("Device SN not configured, upgrade service disabled")
 		return nil
 	}
@@ -138,7 +157,7 @@ func checkAndUpgrade() error {
 	}
 
 	// 创建简单升级器
-	upgrader := upgrade.NewSimpleUpgrader(*upgradeServer, Version, *DeviceSN)
+	upgrader := upgrade.NewSimpleUpgrader(*upgradeServer, Version, deviceSN())
 
 	// 启动时检查一次更新
 	if err := upgrader.CheckAndUpgrade(); err != nil {
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"pcdnagent/common"
+	"pcdnagent/logics"
+
+	"github.com/liuhengloveyou/pcdn/protos/prom"
+	"go.uber.org/zap"
+)
+
+// 本机的运行指标，开了-metrics_addr时在本地导出给站点自己的Prometheus抓
+var (
+	promBuildInfo        = prom.NewGauge("pcdnagent_build_info", "agent的版本", "version", "commit")
+	promConnected        = prom.NewGauge("pcdnagent_connected", "和接入服务器的连接是否正常")
+	promConnects         = prom.NewCounter("pcdnagent_connects_total", "连接接入服务器的次数，result: ok/error", "result")
+	promHeartbeats       = prom.NewCounter("pcdnagent_heartbeats_total", "发送心跳的次数，result: ok/error", "result")
+	promHeartbeatBytes   = prom.NewCounter("pcdnagent_heartbeat_bytes_total", "发出的心跳字节数")
+	promHeartbeatCollect = prom.NewHistogram("pcdnagent_heartbeat_collect_seconds", "采集一次心跳数据的耗时", prom.DurationBuckets)
+	promLastHeartbeat    = prom.NewGauge("pcdnagent_last_heartbeat_timestamp_seconds", "最近一次成功发送心跳的时间")
+	promTasks            = prom.NewCounter("pcdnagent_tasks_total", "执行的任务数，result: ok/error", "type", "result")
+	promTaskDuration     = prom.NewHistogram("pcdnagent_task_seconds", "执行任务的耗时", prom.DurationBuckets, "type")
+	promTcDrifts         = prom.NewCounter("pcdnagent_tc_drift_events_total", "发现的限速规则漂移", "repaired")
+	promTcAdjusts        = prom.NewCounter("pcdnagent_tc_adjust_events_total", "自适应限速的调整次数")
+
+	// 抓取时现查的限速统计
+	promTcClassBytes      = prom.NewCounter("pcdnagent_tc_class_bytes_total", "限速class累计发送的字节数", "iface", "class", "rule")
+	promTcClassDrops      = prom.NewCounter("pcdnagent_tc_class_drops_total", "限速class累计丢弃的包数", "iface", "class", "rule")
+	promTcClassOverlimits = prom.NewCounter("pcdnagent_tc_class_overlimits_total", "限速class累计超限的次数", "iface", "class", "rule")
+	promTcClassRate       = prom.NewGauge("pcdnagent_tc_class_rate_bits", "限速class配置的rate bits/s", "iface", "class", "rule")
+	promTcAdaptiveRate    = prom.NewGauge("pcdnagent_tc_adaptive_rate_bits", "自适应限速当前设置的速率 bits/s", "iface")
+)
+
+// StartMetricsServer 在addr上开/metrics，addr为空时不开
+func StartMetricsServer(addr string) {
+	if addr == "" {
+		return
+	}
+	promBuildInfo.Set(1, Version, CommitID)
+	prom.OnScrape(scrapeTcMetrics)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", prom.Handler)
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			common.Logger.Error("StartMetricsServer ERR: ", zap.String("addr", addr), zap.Error(err))
+		}
+	}()
+}
+
+func scrapeTcMetrics() {
+	promTcClassBytes.Reset()
+	promTcClassDrops.Reset()
+	promTcClassOverlimits.Reset()
+	promTcClassRate.Reset()
+	for iface, classes := range logics.TcClassStats() {
+		for _, c := range classes {
+			promTcClassBytes.Set(float64(c.Bytes), iface, c.ClassId, c.RuleName)
+			promTcClassDrops.Set(float64(c.Drops), iface, c.ClassId, c.RuleName)
+			promTcClassOverlimits.Set(float64(c.Overlimits), iface, c.ClassId, c.RuleName)
+			promTcClassRate.Set(float64(c.RateBits), iface, c.ClassId, c.RuleName)
+		}
+	}
+
+	promTcAdaptiveRate.Reset()
+	if iface, bits, ok := logics.TcAdaptiveRate(); ok {
+		promTcAdaptiveRate.Set(float64(bits), iface)
+	}
+}
+
+func promResult(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+func promBool(b bool) string {
+	return strconv.FormatBool(b)
+}
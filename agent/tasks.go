@@ -2,8 +2,11 @@ package main
 
 import (
 	"fmt"
+	"pcdnagent/common"
+	"pcdnagent/logics"
 
 	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
 )
 
 func InitTasks() {
@@ -25,6 +28,65 @@ func InitTasks() {
 		return
 	}
 
+	// 每分钟检查限速规则是否被改动，发现漂移时重新设置并上报
+	if _, err := c.AddFunc("0 * * * * *", func() {
+		for _, ev := range logics.CheckTcDrift() {
+			promTcDrifts.Inc(promBool(ev.Repaired))
+			select {
+			case tcDriftCh <- ev:
+			default:
+				common.Logger.Warn("tcDriftCh full, drop event: ", zap.String("iface", ev.IfaceName), zap.String("reason", ev.Reason))
+			}
+		}
+	}); err != nil {
+		return
+	}
+
+	// 自适应限速每5分钟采样一次
+	if _, err := c.AddFunc("0 */5 * * * *", func() {
+		if ev := logics.TickTcAdaptive(); ev != nil {
+			promTcAdjusts.Inc()
+			select {
+			case tcAdjustCh <- ev:
+			default:
+				common.Logger.Warn("tcAdjustCh full, drop event: ", zap.String("iface", ev.IfaceName), zap.String("reason", ev.Reason))
+			}
+		}
+	}); err != nil {
+		return
+	}
+
+	// 网络质量探测，每个目标按自己的间隔执行
+	if _, err := c.AddFunc("*/5 * * * * *", func() {
+		logics.TickProbes()
+	}); err != nil {
+		return
+	}
+
+	// 每10分钟检查一次硬件和系统清单，有变化时上报
+	if _, err := c.AddFunc("15 */10 * * * *", func() {
+		if inv := logics.CheckInventory(); inv != nil {
+			// 上一次的还没发出去时换成新的
+			select {
+			case <-inventoryCh:
+			default:
+			}
+			select {
+			case inventoryCh <- inv:
+			default:
+			}
+		}
+	}); err != nil {
+		return
+	}
+
+	// 每10分钟检测一次NAT类型和公网地址
+	if _, err := c.AddFunc("30 */10 * * * *", func() {
+		logics.DetectNat()
+	}); err != nil {
+		return
+	}
+
 	c.Start()
 
 	fmt.Println("Starting cron")
@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"pcdnagent/common"
@@ -21,14 +23,45 @@ import (
 
 var taskCh = make(chan *protos.Task, 100)
 
+// 在后台执行完的任务，由写协程应答
+type taskDone struct {
+	task  *protos.Task
+	start time.Time
+}
+
+var taskDoneCh = make(chan *taskDone, 10)
+
+// 待上报的限速漂移事件
+var tcDriftCh = make(chan *protos.TcDriftEvent, 100)
+
+// 待上报的自适应限速调整事件
+var tcAdjustCh = make(chan *protos.TcAdjustEvent, 100)
+
+// 有变化待上报的硬件和系统清单，只留最新的
+var inventoryCh = make(chan *protos.Inventory, 1)
+
+// 当前连接的认证结果，老版本服务器不应答时一直是UNKNOWN
+var enrollStatus atomic.Int32
+
+// 没有用-sn指定时本机找到的SN
+var (
+	detectSNOnce sync.Once
+	detectedSN   string
+)
+
 func InitTcpClient(addr string) (err error) {
 	conn, err := net.Dial("tcp", addr)
+	promConnects.Inc(promResult(err))
 	if err != nil {
 		common.Logger.Error("net.Dial ", zap.Error(err))
 		return
 	}
 	defer conn.Close()
 
+	promConnected.Set(1)
+	defer promConnected.Set(0)
+	enrollStatus.Store(int32(protos.EnrollStatus_ENROLL_STATUS_UNKNOWN))
+
 	go processRead(conn)
 	processWrite(conn)
 
@@ -86,13 +119,48 @@ func processWrite(conn net.Conn) {
 	ticker := time.NewTicker(10 * time.Second)
 	defer ticker.Stop()
 
+	// 连上后先认证，再报一次清单
+	if err := sendEnroll(conn); err != nil {
+		return
+	}
+	inv := logics.CollectInventory()
+	inv.Sn = deviceSN()
+	if err := sendProtoMsg(conn, protos.MsgType_MSG_TYPE_INVENTORY, inv); err != nil {
+		return
+	}
+
 	for {
 		select {
 		case task := <-taskCh:
 			if err := processTaskReal(conn, task); err != nil {
 				common.Logger.Error("processTaskReal ERR: ", zap.Error(err))
 			}
+		case done := <-taskDoneCh:
+			finishTask(conn, done.task, done.start)
+		case ev := <-tcDriftCh:
+			ev.Sn = deviceSN()
+			if err := sendProtoMsg(conn, protos.MsgType_MSG_TYPE_TC_DRIFT, ev); err != nil {
+				return
+			}
+		case ev := <-tcAdjustCh:
+			ev.Sn = deviceSN()
+			if err := sendProtoMsg(conn, protos.MsgType_MSG_TYPE_TC_ADJUST, ev); err != nil {
+				return
+			}
+		case inv := <-inventoryCh:
+			inv.Sn = deviceSN()
+			if err := sendProtoMsg(conn, protos.MsgType_MSG_TYPE_INVENTORY, inv); err != nil {
+				return
+			}
 		case <-ticker.C:
+			// 还没被认领时只重新认证，认领后服务器会发凭证
+			switch protos.EnrollStatus(enrollStatus.Load()) {
+			case protos.EnrollStatus_ENROLL_STATUS_PENDING, protos.EnrollStatus_ENROLL_STATUS_REJECTED:
+				if err := sendEnroll(conn); err != nil {
+					return
+				}
+				continue
+			}
 			if err := sendHeartbeat(conn); err != nil {
 				return
 			}
@@ -108,6 +176,8 @@ func processOneMsg(conn net.Conn, msgType uint32, msgByte []byte) error {
 		return processTaskMsg(msgByte)
 	case uint32(protos.MsgType_MSG_TYPE_HTTP_PROXY_REQ):
 		return proxy.ProcessHttpProxyReqMsg(conn, msgByte)
+	case uint32(protos.MsgType_MSG_TYPE_ENROLL):
+		return processEnrollMsg(msgByte)
 	default:
 		common.Logger.Sugar().Debugf("processOneMsg type ERR: %v\n", msgType, string(msgByte))
 	}
@@ -119,17 +189,18 @@ func processOneMsg(conn net.Conn, msgType uint32, msgByte []byte) error {
 
 // 发送心跳
 func sendHeartbeat(conn net.Conn) error {
+	start := time.Now()
+
 	// 创建心跳包
 	heartbeat := &protos.Heartbeat{
-		Sn:        "SN-00001",
+		Sn:        deviceSN(),
 		Ver:       Version,
 		Timestamp: time.Now().UnixMilli(),
 		Monitor:   &protos.SystemMonitorData{},
 	}
 
-	if DeviceSN != nil && *DeviceSN != "" {
-		heartbeat.Sn = strings.ToUpper(*DeviceSN)
-	}
+	// CPU、内存、磁盘、负载
+	logics.FillSystemInfo(heartbeat)
 
 	// PS进程信息
 	logics.FillProcessInfo(heartbeat)
@@ -137,12 +208,28 @@ func sendHeartbeat(conn net.Conn) error {
 	// 网络流量信息
 	logics.FillNetworkInfo(heartbeat)
 
+	// 连接跟踪和TCP连接状态
+	logics.FillConnInfo(heartbeat)
+
+	// 按程序限速的流量
+	logics.FillProgramInfo(heartbeat)
+
+	// docker容器
+	logics.FillDockerInfo(heartbeat)
+
+	// 网络质量探测
+	logics.FillProbeInfo(heartbeat)
+
+	// NAT类型和公网地址
+	logics.FillNatInfo(heartbeat)
+
 	// 序列化为二进制数据
 	data, err := proto.Marshal(heartbeat)
 	if err != nil {
 		common.Logger.Error("心跳包序列化失败: ", zap.Error(err))
 		return err
 	}
+	promHeartbeatCollect.Observe(time.Since(start).Seconds())
 
 	// 构建消息头
 	buf := new(bytes.Buffer)
@@ -165,10 +252,13 @@ func sendHeartbeat(conn net.Conn) error {
 	}
 
 	_, err = conn.Write(buf.Bytes())
+	promHeartbeats.Inc(promResult(err))
 	if err != nil {
 		common.Logger.Error("发送心跳包失败: %v", zap.Error(err))
 		return err
 	}
+	promHeartbeatBytes.Add(float64(buf.Len()))
+	promLastHeartbeat.Set(float64(time.Now().Unix()))
 
 	common.Logger.Debug("sendHeartbeat OK: ", zap.Any("sn", heartbeat.Sn), zap.Any("ver", heartbeat.Ver), zap.Any("ts", heartbeat.Timestamp), zap.Any("msgLen", msgLen))
 
@@ -218,6 +308,52 @@ func sendTaskResp(conn net.Conn, task *protos.Task) error {
 	return nil
 }
 
+func deviceSN() string {
+	if DeviceSN != nil && *DeviceSN != "" {
+		return strings.ToUpper(*DeviceSN)
+	}
+	detectSNOnce.Do(func() {
+		detectedSN = logics.DetectSN()
+	})
+	return detectedSN
+}
+
+// 带上保存的凭证和认领码，库里没有这台设备时服务器把它放进待认领列表
+func sendEnroll(conn net.Conn) error {
+	return sendProtoMsg(conn, protos.MsgType_MSG_TYPE_ENROLL, &protos.Enroll{
+		Sn:        deviceSN(),
+		Ver:       Version,
+		ClaimCode: logics.ClaimCode(),
+		Token:     logics.LoadToken(),
+	})
+}
+
+// 上报事件类的消息
+func sendProtoMsg(conn net.Conn, msgType protos.MsgType, msg proto.Message) error {
+	if conn == nil {
+		return fmt.Errorf("sendProtoMsg ERR: conn nil")
+	}
+
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		common.Logger.Error("序列化失败: ", zap.Error(err))
+		return err
+	}
+
+	buf := new(bytes.Buffer)
+	buf.Write([]byte("\r\n"))
+	binary.Write(buf, binary.LittleEndian, uint32(msgType))
+	binary.Write(buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+
+	if _, err = conn.Write(buf.Bytes()); err != nil {
+		common.Logger.Error("conn.Write ERR: ", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
 func processHeartbeatMsg(msgByte []byte) error {
 	var req protos.Heartbeat
 	if err := proto.Unmarshal(msgByte, &req); err != nil {
@@ -225,6 +361,40 @@ func processHeartbeatMsg(msgByte []byte) error {
 		return err
 	}
 	common.Logger.Debug("heartbeat: ", zap.Any("sn", req.Sn), zap.Any("ver", req.Ver), zap.Any("Timestamp", req.Timestamp))
+	// 服务器处理完了，流量增量的基数往前移
+	logics.CommitNetworkCounters(req.AckTimestamp)
+
+	return nil
+}
+
+func processEnrollMsg(msgByte []byte) error {
+	var resp protos.Enroll
+	if err := proto.Unmarshal(msgByte, &resp); err != nil {
+		common.Logger.Sugar().Errorf("processEnrollMsg err: ", string(msgByte), err)
+		return err
+	}
+	old := protos.EnrollStatus(enrollStatus.Swap(int32(resp.Status)))
+
+	switch resp.Status {
+	case protos.EnrollStatus_ENROLL_STATUS_PENDING:
+		if old != resp.Status {
+			code := logics.FormatClaimCode(logics.ClaimCode())
+			common.Logger.Info("设备等待认领: ", zap.String("sn", resp.Sn), zap.String("code", code))
+			fmt.Printf("设备等待认领 SN: %s 认领码: %s\n", resp.Sn, code)
+		}
+	case protos.EnrollStatus_ENROLL_STATUS_OK:
+		if resp.Token != "" {
+			if err := logics.SaveToken(resp.Token); err != nil {
+				common.Logger.Error("SaveToken ERR: ", zap.String("file", logics.TokenFile), zap.Error(err))
+				return err
+			}
+			common.Logger.Info("设备认证成功，已保存凭证: ", zap.String("sn", resp.Sn))
+		}
+	case protos.EnrollStatus_ENROLL_STATUS_REJECTED:
+		if old != resp.Status {
+			common.Logger.Error("设备认证失败: ", zap.String("sn", resp.Sn))
+		}
+	}
 
 	return nil
 }
@@ -244,33 +414,53 @@ func processTaskMsg(msgByte []byte) error {
 
 func processTaskReal(conn net.Conn, task *protos.Task) error {
 	common.Logger.Debug("processTaskReal: ", zap.Any("task", task.String()))
+	start := time.Now()
 
-	var resp string = "OK"
 	var err error
 	if task.TaskType == protos.TaskType_TASK_TYPE_RESETPWD {
 		// 重置密码
 		err = logics.ResetRootPWD(task.Username, task.Pwd)
 	} else if task.TaskType == protos.TaskType_TASK_TYPE_TC {
-		if task.Rate == nil {
-			return fmt.Errorf("rate or targetIP or ifaceName is nil")
+		// 老版本服务端只下发rate
+		policy := task.TcPolicy
+		if policy == nil && task.Rate != nil {
+			policy = &protos.TcPolicy{Rate: *task.Rate}
 		}
-		targetIp := strings.Split(*tcpServer, ":")[0]
-		if targetIp == "" && task.TargetIp != nil {
-			targetIp = *task.TargetIp
+		if policy == nil {
+			err = fmt.Errorf("rate or policy is nil")
+		} else {
+			targetIp := accessServerIP()
+			if targetIp == "" && task.TargetIp != nil {
+				targetIp = *task.TargetIp
+			}
+			// 网卡限速
+			task.TcProgramErr, err = logics.ApplyTcPolicy(task.GetIfaceName(), policy, targetIp)
+			if err == nil && task.TcVerifySeconds > 0 {
+				// 采样验证限速是否生效，要等采样时长，验证完再应答，不能挡住心跳
+				go func() {
+					task.TcVerify = logics.VerifyTcPolicy(task.GetIfaceName(), task.TcVerifySeconds)
+					taskDoneCh <- &taskDone{task: task, start: start}
+				}()
+				return nil
+			}
 		}
-		// 网卡限速
-		err = logics.ApplyLimitUploadBandwidthRules(*task.IfaceName, *task.Rate, targetIp)
+	} else if task.TaskType == protos.TaskType_TASK_TYPE_TC_ADAPTIVE {
+		// 自适应限速
+		err = logics.ConfigureTcAdaptive(task.TcAdaptive, accessServerIP())
+	} else if task.TaskType == protos.TaskType_TASK_TYPE_PROBE_CONFIG {
+		// 网络质量探测
+		err = logics.ConfigureProbes(task.ProbeConfig)
 	} else if task.TaskType == protos.TaskType_TASK_TYPE_TC_CLEAN {
 		// 清除限速
 		logics.ClearAllLimitUploadBandwidthRules()
 	} else if task.TaskType == protos.TaskType_TASK_TYPE_TC_STATUS {
 		if task.IfaceName == nil {
+			promTasks.Inc(task.TaskType.String(), "error")
 			return fmt.Errorf("rate or targetIP or ifaceName is nil")
 		}
 		var rate string
-		rate, resp, err = logics.GetTCStatus(*task.IfaceName)
+		rate, task.TcQdiscStats, task.TcStats, err = logics.GetTCStatus(*task.IfaceName)
 		task.Rate = &rate
-		task.ErrMsg = resp
 	} else if task.TaskType == protos.TaskType_TASK_TYPE_ROUTER_ADMIN {
 		// 路由器管理功能
 		err = logics.HandleRouterAdmin(task)
@@ -289,15 +479,43 @@ func processTaskReal(conn net.Conn, task *protos.Task) error {
 		// 	proxy.RemoveProxyConnection(*task.ProxyId)
 	}
 
-	if err != nil {
-		sendTaskResp(conn, task)
-	} else {
-		sendTaskResp(conn, task)
+	if err != nil && task.ErrMsg == "" {
+		task.ErrMsg = err.Error()
 	}
+	finishTask(conn, task, start)
 
 	return nil
 }
 
+// finishTask 记录任务结果并应答服务器
+func finishTask(conn net.Conn, task *protos.Task, start time.Time) {
+	if task.ErrMsg != "" {
+		promTasks.Inc(task.TaskType.String(), "error")
+	} else {
+		promTasks.Inc(task.TaskType.String(), "ok")
+	}
+	promTaskDuration.Observe(time.Since(start).Seconds(), task.TaskType.String())
+	sendTaskResp(conn, task)
+}
+
+// accessServerIP 接入服务器的IP，限速时放行
+func accessServerIP() string {
+	host, _, err := net.SplitHostPort(*tcpServer)
+	if err != nil {
+		host = *tcpServer
+	}
+	if host == "" || net.ParseIP(host) != nil {
+		return host
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil || len(ips) == 0 {
+		common.Logger.Warn("accessServerIP lookup ERR: ", zap.String("host", host), zap.Error(err))
+		return ""
+	}
+	return ips[0].String()
+}
+
 // TODO: 代理请求消息处理函数，需要在protobuf中定义相应的消息类型后启用
 // func processProxyRequestMsg(msgByte []byte) error {
 // 	var req protos.ProxyRequest
@@ -0,0 +1,267 @@
+package prom
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Prometheus文本格式的指标导出，agent和服务端共用，只实现了counter/gauge/histogram，够/metrics用
+
+type promMetric interface {
+	writeTo(w *bufio.Writer)
+}
+
+var (
+	promMu      sync.Mutex
+	promMetrics []promMetric
+	// 导出前调用，用来刷新要现查的指标
+	promScrapeHooks []func()
+)
+
+func register(m promMetric) {
+	promMu.Lock()
+	defer promMu.Unlock()
+	promMetrics = append(promMetrics, m)
+}
+
+// OnScrape 每次导出前调用fn
+func OnScrape(fn func()) {
+	promMu.Lock()
+	defer promMu.Unlock()
+	promScrapeHooks = append(promScrapeHooks, fn)
+}
+
+// Vec counter或gauge，按标签值分组
+type Vec struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu   sync.Mutex
+	vals map[string]float64
+}
+
+func newVec(kind, name, help string, labels []string) *Vec {
+	v := &Vec{name: name, help: help, kind: kind, labels: labels, vals: make(map[string]float64)}
+	register(v)
+	return v
+}
+
+func NewCounter(name, help string, labels ...string) *Vec {
+	return newVec("counter", name, help, labels)
+}
+
+func NewGauge(name, help string, labels ...string) *Vec {
+	return newVec("gauge", name, help, labels)
+}
+
+func (v *Vec) Add(delta float64, labelValues ...string) {
+	key := promKey(v.labels, labelValues)
+	v.mu.Lock()
+	v.vals[key] += delta
+	v.mu.Unlock()
+}
+
+func (v *Vec) Inc(labelValues ...string) {
+	v.Add(1, labelValues...)
+}
+
+func (v *Vec) Set(val float64, labelValues ...string) {
+	key := promKey(v.labels, labelValues)
+	v.mu.Lock()
+	v.vals[key] = val
+	v.mu.Unlock()
+}
+
+// Reset 清掉所有标签组合，现查的指标刷新前调用，去掉已经没有的
+func (v *Vec) Reset() {
+	v.mu.Lock()
+	v.vals = make(map[string]float64)
+	v.mu.Unlock()
+}
+
+func (v *Vec) writeTo(w *bufio.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	writeHeader(w, v.name, v.help, v.kind)
+	if len(v.labels) == 0 && len(v.vals) == 0 {
+		fmt.Fprintf(w, "%s 0\n", v.name)
+		return
+	}
+	for _, key := range sortedKeys(v.vals) {
+		fmt.Fprintf(w, "%s%s %s\n", v.name, key, promFloat(v.vals[key]))
+	}
+}
+
+type promGaugeFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+// NewGaugeFunc 导出时调用fn取值
+func NewGaugeFunc(name, help string, fn func() float64) {
+	register(&promGaugeFunc{name: name, help: help, fn: fn})
+}
+
+func (g *promGaugeFunc) writeTo(w *bufio.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.name, promFloat(g.fn()))
+}
+
+type promHistSeries struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Histogram 按标签值分组的直方图
+type Histogram struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*promHistSeries
+}
+
+// 秒为单位的耗时常用的桶
+var DurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*promHistSeries)}
+	register(h)
+	return h
+}
+
+func (h *Histogram) Observe(val float64, labelValues ...string) {
+	key := promKey(h.labels, labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &promHistSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, b := range h.buckets {
+		if val <= b {
+			s.counts[i]++
+		}
+	}
+	s.sum += val
+	s.count++
+}
+
+func (h *Histogram) writeTo(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := h.series[key]
+		// le要放在已有的标签后面
+		prefix := "{"
+		if key != "" {
+			prefix = key[:len(key)-1] + ","
+		}
+		for i, b := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%sle=\"%s\"} %d\n", h.name, prefix, promFloat(b), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%sle=\"+Inf\"} %d\n", h.name, prefix, s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, key, promFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, key, s.count)
+	}
+}
+
+// Write 按注册顺序导出所有指标
+func Write(out io.Writer) error {
+	promMu.Lock()
+	hooks := append([]func(){}, promScrapeHooks...)
+	metrics := append([]promMetric{}, promMetrics...)
+	promMu.Unlock()
+
+	for _, fn := range hooks {
+		fn()
+	}
+
+	w := bufio.NewWriter(out)
+	for _, m := range metrics {
+		m.writeTo(w)
+	}
+	return w.Flush()
+}
+
+// Handler /metrics的处理函数
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	Write(w)
+}
+
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, strings.NewReplacer("\\", `\\`, "\n", `\n`).Replace(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+// 标签拼成{a="x",b="y"}，少给的标签值为空
+func promKey(labels, values []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		val := ""
+		if i < len(values) {
+			val = values[i]
+		}
+		b.WriteString(l)
+		b.WriteString(`="`)
+		b.WriteString(promLabelEscaper.Replace(val))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var promLabelEscaper = strings.NewReplacer("\\", `\\`, "\"", `\"`, "\n", `\n`)
+
+func promFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
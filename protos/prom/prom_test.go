@@ -0,0 +1,41 @@
+package prom
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	c := NewCounter("test_frames_total", "消息数", "type")
+	c.Inc("HEARTBEAT")
+	c.Add(2, "HEARTBEAT")
+	c.Inc(`a"b`)
+	NewGauge("test_empty", "没有标签也没有值")
+	h := NewHistogram("test_seconds", "耗时", []float64{0.1, 1}, "type")
+	h.Observe(0.5, "TC")
+	h.Observe(3, "TC")
+
+	var buf bytes.Buffer
+	if err := Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"# TYPE test_frames_total counter\n",
+		"test_frames_total{type=\"HEARTBEAT\"} 3\n",
+		"test_frames_total{type=\"a\\\"b\"} 1\n",
+		"test_empty 0\n",
+		"# TYPE test_seconds histogram\n",
+		"test_seconds_bucket{type=\"TC\",le=\"0.1\"} 0\n",
+		"test_seconds_bucket{type=\"TC\",le=\"1\"} 1\n",
+		"test_seconds_bucket{type=\"TC\",le=\"+Inf\"} 2\n",
+		"test_seconds_sum{type=\"TC\"} 3.5\n",
+		"test_seconds_count{type=\"TC\"} 2\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
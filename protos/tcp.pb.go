@@ -31,6 +31,10 @@ const (
 	MsgType_MSG_TYPE_TASKRESP        MsgType = 3 // 任务应答
 	MsgType_MSG_TYPE_HTTP_PROXY_REQ  MsgType = 4 // HTTP代理请求
 	MsgType_MSG_TYPE_HTTP_PROXY_RESP MsgType = 5 // HTTP代理响应
+	MsgType_MSG_TYPE_TC_DRIFT        MsgType = 6 // 限速规则漂移事件
+	MsgType_MSG_TYPE_TC_ADJUST       MsgType = 7 // 自适应限速调整事件
+	MsgType_MSG_TYPE_INVENTORY       MsgType = 8 // 硬件和系统清单
+	MsgType_MSG_TYPE_ENROLL          MsgType = 9 // 设备认证和认领
 )
 
 // Enum value maps for MsgType.
@@ -42,6 +46,10 @@ var (
 		3: "MSG_TYPE_TASKRESP",
 		4: "MSG_TYPE_HTTP_PROXY_REQ",
 		5: "MSG_TYPE_HTTP_PROXY_RESP",
+		6: "MSG_TYPE_TC_DRIFT",
+		7: "MSG_TYPE_TC_ADJUST",
+		8: "MSG_TYPE_INVENTORY",
+		9: "MSG_TYPE_ENROLL",
 	}
 	MsgType_value = map[string]int32{
 		"MSG_TYPE_UNKNOWN":         0,
@@ -50,6 +58,10 @@ var (
 		"MSG_TYPE_TASKRESP":        3,
 		"MSG_TYPE_HTTP_PROXY_REQ":  4,
 		"MSG_TYPE_HTTP_PROXY_RESP": 5,
+		"MSG_TYPE_TC_DRIFT":        6,
+		"MSG_TYPE_TC_ADJUST":       7,
+		"MSG_TYPE_INVENTORY":       8,
+		"MSG_TYPE_ENROLL":          9,
 	}
 )
 
@@ -90,6 +102,8 @@ const (
 	TaskType_TASK_TYPE_TC_CLEAN     TaskType = 3 // 网卡限速清理
 	TaskType_TASK_TYPE_TC_STATUS    TaskType = 4 // 网卡限速状态
 	TaskType_TASK_TYPE_ROUTER_ADMIN TaskType = 5 // 路由器管理
+	TaskType_TASK_TYPE_TC_ADAPTIVE  TaskType = 6 // 自适应限速设置
+	TaskType_TASK_TYPE_PROBE_CONFIG TaskType = 7 // 网络质量探测设置
 )
 
 // Enum value maps for TaskType.
@@ -101,6 +115,8 @@ var (
 		3: "TASK_TYPE_TC_CLEAN",
 		4: "TASK_TYPE_TC_STATUS",
 		5: "TASK_TYPE_ROUTER_ADMIN",
+		6: "TASK_TYPE_TC_ADAPTIVE",
+		7: "TASK_TYPE_PROBE_CONFIG",
 	}
 	TaskType_value = map[string]int32{
 		"TASK_TYPE_UNKNOWN":      0,
@@ -109,6 +125,8 @@ var (
 		"TASK_TYPE_TC_CLEAN":     3,
 		"TASK_TYPE_TC_STATUS":    4,
 		"TASK_TYPE_ROUTER_ADMIN": 5,
+		"TASK_TYPE_TC_ADAPTIVE":  6,
+		"TASK_TYPE_PROBE_CONFIG": 7,
 	}
 )
 
@@ -139,13 +157,74 @@ func (TaskType) EnumDescriptor() ([]byte, []int) {
 	return file_tcp_proto_rawDescGZIP(), []int{1}
 }
 
+// 设备认证的结果
+type EnrollStatus int32
+
+const (
+	EnrollStatus_ENROLL_STATUS_UNKNOWN  EnrollStatus = 0
+	EnrollStatus_ENROLL_STATUS_PENDING  EnrollStatus = 1 // 还没有被认领，在待认领列表里
+	EnrollStatus_ENROLL_STATUS_OK       EnrollStatus = 2 // 认证通过
+	EnrollStatus_ENROLL_STATUS_REJECTED EnrollStatus = 3 // 凭证不对
+)
+
+// Enum value maps for EnrollStatus.
+var (
+	EnrollStatus_name = map[int32]string{
+		0: "ENROLL_STATUS_UNKNOWN",
+		1: "ENROLL_STATUS_PENDING",
+		2: "ENROLL_STATUS_OK",
+		3: "ENROLL_STATUS_REJECTED",
+	}
+	EnrollStatus_value = map[string]int32{
+		"ENROLL_STATUS_UNKNOWN":  0,
+		"ENROLL_STATUS_PENDING":  1,
+		"ENROLL_STATUS_OK":       2,
+		"ENROLL_STATUS_REJECTED": 3,
+	}
+)
+
+func (x EnrollStatus) Enum() *EnrollStatus {
+	p := new(EnrollStatus)
+	*p = x
+	return p
+}
+
+func (x EnrollStatus) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (EnrollStatus) Descriptor() protoreflect.EnumDescriptor {
+	return file_tcp_proto_enumTypes[2].Descriptor()
+}
+
+func (EnrollStatus) Type() protoreflect.EnumType {
+	return &file_tcp_proto_enumTypes[2]
+}
+
+func (x EnrollStatus) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use EnrollStatus.Descriptor instead.
+func (EnrollStatus) EnumDescriptor() ([]byte, []int) {
+	return file_tcp_proto_rawDescGZIP(), []int{2}
+}
+
 type Heartbeat struct {
 	state     protoimpl.MessageState `protogen:"open.v1"`
 	Sn        string                 `protobuf:"bytes,1,opt,name=sn,proto3" json:"sn,omitempty"`
 	Ver       string                 `protobuf:"bytes,2,opt,name=ver,proto3" json:"ver,omitempty"`
 	Timestamp int64                  `protobuf:"varint,3,opt,name=timestamp,proto3" json:"timestamp,omitempty"` // 使用int64类型表示Unix时间戳
 	// 进程信息
-	Monitor       *SystemMonitorData `protobuf:"bytes,4,opt,name=monitor,proto3" json:"monitor,omitempty"`
+	Monitor *SystemMonitorData `protobuf:"bytes,4,opt,name=monitor,proto3" json:"monitor,omitempty"`
+	// 网络质量探测，每个目标最近一轮的结果
+	Probes []*ProbeResult `protobuf:"bytes,5,rep,name=probes,proto3" json:"probes,omitempty"`
+	// 当前探测设置的版本，服务器据此判断要不要重新下发
+	ProbeVersion string `protobuf:"bytes,6,opt,name=probe_version,json=probeVersion,proto3" json:"probe_version,omitempty"`
+	// NAT类型和公网地址，定时检测
+	Nat *NatInfo `protobuf:"bytes,7,opt,name=nat,proto3" json:"nat,omitempty"`
+	// 服务器的应答里带上处理完的心跳的timestamp，agent收到后这次的网卡计数才成为增量的基数
+	AckTimestamp  int64 `protobuf:"varint,8,opt,name=ack_timestamp,json=ackTimestamp,proto3" json:"ack_timestamp,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -208,6 +287,111 @@ func (x *Heartbeat) GetMonitor() *SystemMonitorData {
 	return nil
 }
 
+func (x *Heartbeat) GetProbes() []*ProbeResult {
+	if x != nil {
+		return x.Probes
+	}
+	return nil
+}
+
+func (x *Heartbeat) GetProbeVersion() string {
+	if x != nil {
+		return x.ProbeVersion
+	}
+	return ""
+}
+
+func (x *Heartbeat) GetNat() *NatInfo {
+	if x != nil {
+		return x.Nat
+	}
+	return nil
+}
+
+func (x *Heartbeat) GetAckTimestamp() int64 {
+	if x != nil {
+		return x.AckTimestamp
+	}
+	return 0
+}
+
+// agent连上后先发，服务端应答认证结果；没认证通过时agent定时重发
+type Enroll struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Sn            string                 `protobuf:"bytes,1,opt,name=sn,proto3" json:"sn,omitempty"`
+	Ver           string                 `protobuf:"bytes,2,opt,name=ver,proto3" json:"ver,omitempty"`
+	ClaimCode     string                 `protobuf:"bytes,3,opt,name=claim_code,json=claimCode,proto3" json:"claim_code,omitempty"`    // 设备上显示的认领码
+	Token         string                 `protobuf:"bytes,4,opt,name=token,proto3" json:"token,omitempty"`                             // 设备凭证，认领后第一次认证时服务端下发，之后连接时带上
+	Status        EnrollStatus           `protobuf:"varint,5,opt,name=status,proto3,enum=protos.EnrollStatus" json:"status,omitempty"` // 服务端的应答
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Enroll) Reset() {
+	*x = Enroll{}
+	mi := &file_tcp_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Enroll) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Enroll) ProtoMessage() {}
+
+func (x *Enroll) ProtoReflect() protoreflect.Message {
+	mi := &file_tcp_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Enroll.ProtoReflect.Descriptor instead.
+func (*Enroll) Descriptor() ([]byte, []int) {
+	return file_tcp_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Enroll) GetSn() string {
+	if x != nil {
+		return x.Sn
+	}
+	return ""
+}
+
+func (x *Enroll) GetVer() string {
+	if x != nil {
+		return x.Ver
+	}
+	return ""
+}
+
+func (x *Enroll) GetClaimCode() string {
+	if x != nil {
+		return x.ClaimCode
+	}
+	return ""
+}
+
+func (x *Enroll) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *Enroll) GetStatus() EnrollStatus {
+	if x != nil {
+		return x.Status
+	}
+	return EnrollStatus_ENROLL_STATUS_UNKNOWN
+}
+
 type DeviceAgent struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Sn            string                 `protobuf:"bytes,1,opt,name=sn,proto3" json:"sn,omitempty"`
@@ -221,7 +405,7 @@ type DeviceAgent struct {
 
 func (x *DeviceAgent) Reset() {
 	*x = DeviceAgent{}
-	mi := &file_tcp_proto_msgTypes[1]
+	mi := &file_tcp_proto_msgTypes[2]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -233,7 +417,7 @@ func (x *DeviceAgent) String() string {
 func (*DeviceAgent) ProtoMessage() {}
 
 func (x *DeviceAgent) ProtoReflect() protoreflect.Message {
-	mi := &file_tcp_proto_msgTypes[1]
+	mi := &file_tcp_proto_msgTypes[2]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -246,7 +430,7 @@ func (x *DeviceAgent) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use DeviceAgent.ProtoReflect.Descriptor instead.
 func (*DeviceAgent) Descriptor() ([]byte, []int) {
-	return file_tcp_proto_rawDescGZIP(), []int{1}
+	return file_tcp_proto_rawDescGZIP(), []int{2}
 }
 
 func (x *DeviceAgent) GetSn() string {
@@ -302,14 +486,30 @@ type Task struct {
 	// 任务执行结果
 	ErrMsg string `protobuf:"bytes,11,opt,name=err_msg,json=errMsg,proto3" json:"err_msg,omitempty"`
 	// 路由器管理URL
-	Url           *string `protobuf:"bytes,12,opt,name=url,proto3,oneof" json:"url,omitempty"`
+	Url *string `protobuf:"bytes,12,opt,name=url,proto3,oneof" json:"url,omitempty"`
+	// 多规则限速策略，为空时按 rate/target_ip 处理
+	TcPolicy *TcPolicy `protobuf:"bytes,13,opt,name=tc_policy,json=tcPolicy,proto3" json:"tc_policy,omitempty"`
+	// 限速状态：每个class的统计
+	TcStats []*TcClassStat `protobuf:"bytes,14,rep,name=tc_stats,json=tcStats,proto3" json:"tc_stats,omitempty"`
+	// 限速状态：每个qdisc的统计
+	TcQdiscStats []*TcQdiscStat `protobuf:"bytes,15,rep,name=tc_qdisc_stats,json=tcQdiscStats,proto3" json:"tc_qdisc_stats,omitempty"`
+	// 限速后验证的采样时长(秒)，0表示不验证
+	TcVerifySeconds uint32 `protobuf:"varint,16,opt,name=tc_verify_seconds,json=tcVerifySeconds,proto3" json:"tc_verify_seconds,omitempty"`
+	// 限速验证结果
+	TcVerify *TcVerifyResult `protobuf:"bytes,17,opt,name=tc_verify,json=tcVerify,proto3" json:"tc_verify,omitempty"`
+	// 自适应限速设置
+	TcAdaptive *TcAdaptiveConfig `protobuf:"bytes,18,opt,name=tc_adaptive,json=tcAdaptive,proto3" json:"tc_adaptive,omitempty"`
+	// 网络质量探测设置
+	ProbeConfig *ProbeConfig `protobuf:"bytes,19,opt,name=probe_config,json=probeConfig,proto3" json:"probe_config,omitempty"`
+	// 按程序限速的标记设置失败的原因，网卡限速不受影响
+	TcProgramErr  string `protobuf:"bytes,20,opt,name=tc_program_err,json=tcProgramErr,proto3" json:"tc_program_err,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *Task) Reset() {
 	*x = Task{}
-	mi := &file_tcp_proto_msgTypes[2]
+	mi := &file_tcp_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -321,7 +521,7 @@ func (x *Task) String() string {
 func (*Task) ProtoMessage() {}
 
 func (x *Task) ProtoReflect() protoreflect.Message {
-	mi := &file_tcp_proto_msgTypes[2]
+	mi := &file_tcp_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -334,7 +534,7 @@ func (x *Task) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Task.ProtoReflect.Descriptor instead.
 func (*Task) Descriptor() ([]byte, []int) {
-	return file_tcp_proto_rawDescGZIP(), []int{2}
+	return file_tcp_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *Task) GetTaskId() string {
@@ -421,34 +621,95 @@ func (x *Task) GetUrl() string {
 	return ""
 }
 
-// 系统监控进程信息
-type SystemMonitorProcess struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Pid           int32                  `protobuf:"varint,1,opt,name=pid,proto3" json:"pid,omitempty"`
-	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
-	Exe           string                 `protobuf:"bytes,3,opt,name=exe,proto3" json:"exe,omitempty"`
-	Cpu           float32                `protobuf:"fixed32,4,opt,name=cpu,proto3" json:"cpu,omitempty"`
-	Memory        float32                `protobuf:"fixed32,5,opt,name=memory,proto3" json:"memory,omitempty"`
-	Status        string                 `protobuf:"bytes,6,opt,name=status,proto3" json:"status,omitempty"`
+func (x *Task) GetTcPolicy() *TcPolicy {
+	if x != nil {
+		return x.TcPolicy
+	}
+	return nil
+}
+
+func (x *Task) GetTcStats() []*TcClassStat {
+	if x != nil {
+		return x.TcStats
+	}
+	return nil
+}
+
+func (x *Task) GetTcQdiscStats() []*TcQdiscStat {
+	if x != nil {
+		return x.TcQdiscStats
+	}
+	return nil
+}
+
+func (x *Task) GetTcVerifySeconds() uint32 {
+	if x != nil {
+		return x.TcVerifySeconds
+	}
+	return 0
+}
+
+func (x *Task) GetTcVerify() *TcVerifyResult {
+	if x != nil {
+		return x.TcVerify
+	}
+	return nil
+}
+
+func (x *Task) GetTcAdaptive() *TcAdaptiveConfig {
+	if x != nil {
+		return x.TcAdaptive
+	}
+	return nil
+}
+
+func (x *Task) GetProbeConfig() *ProbeConfig {
+	if x != nil {
+		return x.ProbeConfig
+	}
+	return nil
+}
+
+func (x *Task) GetTcProgramErr() string {
+	if x != nil {
+		return x.TcProgramErr
+	}
+	return ""
+}
+
+// 限速规则: 匹配到的流量进入一个独立的HTB class
+type TcRule struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Name     string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Cidrs    []string               `protobuf:"bytes,2,rep,name=cidrs,proto3" json:"cidrs,omitempty"`         // 目标地址，支持IPv4/IPv6 CIDR或单个IP，空表示全部
+	Ports    []uint32               `protobuf:"varint,3,rep,packed,name=ports,proto3" json:"ports,omitempty"` // 目标端口，空表示全部
+	Protocol string                 `protobuf:"bytes,4,opt,name=protocol,proto3" json:"protocol,omitempty"`   // tcp/udp，空表示全部
+	Rate     string                 `protobuf:"bytes,5,opt,name=rate,proto3" json:"rate,omitempty"`           // 保证带宽，如 10mbit，空表示不限速
+	Ceil     string                 `protobuf:"bytes,6,opt,name=ceil,proto3" json:"ceil,omitempty"`           // 最大带宽，空时等于rate
+	Prio     uint32                 `protobuf:"varint,7,opt,name=prio,proto3" json:"prio,omitempty"`          // HTB优先级 0-7，越小越优先
+	// 按程序匹配，三选一；设置后不能再带地址/端口/协议
+	Process       string `protobuf:"bytes,8,opt,name=process,proto3" json:"process,omitempty"` // 进程名，匹配进程所在的cgroup
+	Unit          string `protobuf:"bytes,9,opt,name=unit,proto3" json:"unit,omitempty"`       // systemd unit，如 vendor.service
+	Cgroup        string `protobuf:"bytes,10,opt,name=cgroup,proto3" json:"cgroup,omitempty"`  // cgroup v2 路径，如 system.slice/vendor.service
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *SystemMonitorProcess) Reset() {
-	*x = SystemMonitorProcess{}
-	mi := &file_tcp_proto_msgTypes[3]
+func (x *TcRule) Reset() {
+	*x = TcRule{}
+	mi := &file_tcp_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *SystemMonitorProcess) String() string {
+func (x *TcRule) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*SystemMonitorProcess) ProtoMessage() {}
+func (*TcRule) ProtoMessage() {}
 
-func (x *SystemMonitorProcess) ProtoReflect() protoreflect.Message {
-	mi := &file_tcp_proto_msgTypes[3]
+func (x *TcRule) ProtoReflect() protoreflect.Message {
+	mi := &file_tcp_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -459,78 +720,106 @@ func (x *SystemMonitorProcess) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use SystemMonitorProcess.ProtoReflect.Descriptor instead.
-func (*SystemMonitorProcess) Descriptor() ([]byte, []int) {
-	return file_tcp_proto_rawDescGZIP(), []int{3}
+// Deprecated: Use TcRule.ProtoReflect.Descriptor instead.
+func (*TcRule) Descriptor() ([]byte, []int) {
+	return file_tcp_proto_rawDescGZIP(), []int{4}
 }
 
-func (x *SystemMonitorProcess) GetPid() int32 {
+func (x *TcRule) GetName() string {
 	if x != nil {
-		return x.Pid
+		return x.Name
 	}
-	return 0
+	return ""
 }
 
-func (x *SystemMonitorProcess) GetName() string {
+func (x *TcRule) GetCidrs() []string {
 	if x != nil {
-		return x.Name
+		return x.Cidrs
+	}
+	return nil
+}
+
+func (x *TcRule) GetPorts() []uint32 {
+	if x != nil {
+		return x.Ports
+	}
+	return nil
+}
+
+func (x *TcRule) GetProtocol() string {
+	if x != nil {
+		return x.Protocol
 	}
 	return ""
 }
 
-func (x *SystemMonitorProcess) GetExe() string {
+func (x *TcRule) GetRate() string {
 	if x != nil {
-		return x.Exe
+		return x.Rate
 	}
 	return ""
 }
 
-func (x *SystemMonitorProcess) GetCpu() float32 {
+func (x *TcRule) GetCeil() string {
 	if x != nil {
-		return x.Cpu
+		return x.Ceil
 	}
-	return 0
+	return ""
 }
 
-func (x *SystemMonitorProcess) GetMemory() float32 {
+func (x *TcRule) GetPrio() uint32 {
 	if x != nil {
-		return x.Memory
+		return x.Prio
 	}
 	return 0
 }
 
-func (x *SystemMonitorProcess) GetStatus() string {
+func (x *TcRule) GetProcess() string {
 	if x != nil {
-		return x.Status
+		return x.Process
 	}
 	return ""
 }
 
-// 系统监控CPU信息
-type SystemMonitorCpu struct {
+func (x *TcRule) GetUnit() string {
+	if x != nil {
+		return x.Unit
+	}
+	return ""
+}
+
+func (x *TcRule) GetCgroup() string {
+	if x != nil {
+		return x.Cgroup
+	}
+	return ""
+}
+
+// 限速策略
+type TcPolicy struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Usage         float32                `protobuf:"fixed32,1,opt,name=usage,proto3" json:"usage,omitempty"`
-	Cores         int32                  `protobuf:"varint,2,opt,name=cores,proto3" json:"cores,omitempty"`
-	Temperature   float32                `protobuf:"fixed32,3,opt,name=temperature,proto3" json:"temperature,omitempty"`
+	Rate          string                 `protobuf:"bytes,1,opt,name=rate,proto3" json:"rate,omitempty"`                       // 未匹配任何规则的流量的限速，空表示不限速
+	Rules         []*TcRule              `protobuf:"bytes,2,rep,name=rules,proto3" json:"rules,omitempty"`                     // 按顺序匹配
+	CapBits       uint64                 `protobuf:"varint,3,opt,name=cap_bits,json=capBits,proto3" json:"cap_bits,omitempty"` // 配额超了时默认class的速率上限 (bits/s)，自适应限速也不能超过，0表示不限
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *SystemMonitorCpu) Reset() {
-	*x = SystemMonitorCpu{}
-	mi := &file_tcp_proto_msgTypes[4]
+func (x *TcPolicy) Reset() {
+	*x = TcPolicy{}
+	mi := &file_tcp_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *SystemMonitorCpu) String() string {
+func (x *TcPolicy) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*SystemMonitorCpu) ProtoMessage() {}
+func (*TcPolicy) ProtoMessage() {}
 
-func (x *SystemMonitorCpu) ProtoReflect() protoreflect.Message {
-	mi := &file_tcp_proto_msgTypes[4]
+func (x *TcPolicy) ProtoReflect() protoreflect.Message {
+	mi := &file_tcp_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -541,57 +830,2068 @@ func (x *SystemMonitorCpu) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use SystemMonitorCpu.ProtoReflect.Descriptor instead.
-func (*SystemMonitorCpu) Descriptor() ([]byte, []int) {
-	return file_tcp_proto_rawDescGZIP(), []int{4}
+// Deprecated: Use TcPolicy.ProtoReflect.Descriptor instead.
+func (*TcPolicy) Descriptor() ([]byte, []int) {
+	return file_tcp_proto_rawDescGZIP(), []int{5}
 }
 
-func (x *SystemMonitorCpu) GetUsage() float32 {
+func (x *TcPolicy) GetRate() string {
 	if x != nil {
-		return x.Usage
+		return x.Rate
 	}
-	return 0
+	return ""
 }
 
-func (x *SystemMonitorCpu) GetCores() int32 {
+func (x *TcPolicy) GetRules() []*TcRule {
 	if x != nil {
-		return x.Cores
+		return x.Rules
 	}
-	return 0
+	return nil
 }
 
-func (x *SystemMonitorCpu) GetTemperature() float32 {
+func (x *TcPolicy) GetCapBits() uint64 {
 	if x != nil {
-		return x.Temperature
+		return x.CapBits
 	}
 	return 0
 }
 
-// 系统监控内存信息
-type SystemMonitorMemory struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Used          int64                  `protobuf:"varint,1,opt,name=used,proto3" json:"used,omitempty"`
-	Total         int64                  `protobuf:"varint,2,opt,name=total,proto3" json:"total,omitempty"`
-	Available     int64                  `protobuf:"varint,3,opt,name=available,proto3" json:"available,omitempty"`
+// 限速class统计
+type TcClassStat struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	ClassId        string                 `protobuf:"bytes,1,opt,name=class_id,json=classId,proto3" json:"class_id,omitempty"`
+	RuleName       string                 `protobuf:"bytes,2,opt,name=rule_name,json=ruleName,proto3" json:"rule_name,omitempty"`
+	Rate           string                 `protobuf:"bytes,3,opt,name=rate,proto3" json:"rate,omitempty"`
+	Ceil           string                 `protobuf:"bytes,4,opt,name=ceil,proto3" json:"ceil,omitempty"`
+	Bytes          uint64                 `protobuf:"varint,5,opt,name=bytes,proto3" json:"bytes,omitempty"`     // 累计发送字节数
+	Packets        uint64                 `protobuf:"varint,6,opt,name=packets,proto3" json:"packets,omitempty"` // 累计发送包数
+	Drops          uint64                 `protobuf:"varint,7,opt,name=drops,proto3" json:"drops,omitempty"`
+	Overlimits     uint64                 `protobuf:"varint,8,opt,name=overlimits,proto3" json:"overlimits,omitempty"`
+	Parent         string                 `protobuf:"bytes,9,opt,name=parent,proto3" json:"parent,omitempty"`                                         // 父节点，挂在根上时为root
+	RateBits       uint64                 `protobuf:"varint,10,opt,name=rate_bits,json=rateBits,proto3" json:"rate_bits,omitempty"`                   // 配置的rate (bits/s)
+	CeilBits       uint64                 `protobuf:"varint,11,opt,name=ceil_bits,json=ceilBits,proto3" json:"ceil_bits,omitempty"`                   // 配置的ceil (bits/s)
+	BacklogBytes   uint64                 `protobuf:"varint,12,opt,name=backlog_bytes,json=backlogBytes,proto3" json:"backlog_bytes,omitempty"`       // 队列积压字节数
+	BacklogPackets uint64                 `protobuf:"varint,13,opt,name=backlog_packets,json=backlogPackets,proto3" json:"backlog_packets,omitempty"` // 队列积压包数
+	Throughput     float64                `protobuf:"fixed64,14,opt,name=throughput,proto3" json:"throughput,omitempty"`                              // 当前速率 (bits/s)
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *TcClassStat) Reset() {
+	*x = TcClassStat{}
+	mi := &file_tcp_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TcClassStat) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TcClassStat) ProtoMessage() {}
+
+func (x *TcClassStat) ProtoReflect() protoreflect.Message {
+	mi := &file_tcp_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TcClassStat.ProtoReflect.Descriptor instead.
+func (*TcClassStat) Descriptor() ([]byte, []int) {
+	return file_tcp_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *TcClassStat) GetClassId() string {
+	if x != nil {
+		return x.ClassId
+	}
+	return ""
+}
+
+func (x *TcClassStat) GetRuleName() string {
+	if x != nil {
+		return x.RuleName
+	}
+	return ""
+}
+
+func (x *TcClassStat) GetRate() string {
+	if x != nil {
+		return x.Rate
+	}
+	return ""
+}
+
+func (x *TcClassStat) GetCeil() string {
+	if x != nil {
+		return x.Ceil
+	}
+	return ""
+}
+
+func (x *TcClassStat) GetBytes() uint64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+func (x *TcClassStat) GetPackets() uint64 {
+	if x != nil {
+		return x.Packets
+	}
+	return 0
+}
+
+func (x *TcClassStat) GetDrops() uint64 {
+	if x != nil {
+		return x.Drops
+	}
+	return 0
+}
+
+func (x *TcClassStat) GetOverlimits() uint64 {
+	if x != nil {
+		return x.Overlimits
+	}
+	return 0
+}
+
+func (x *TcClassStat) GetParent() string {
+	if x != nil {
+		return x.Parent
+	}
+	return ""
+}
+
+func (x *TcClassStat) GetRateBits() uint64 {
+	if x != nil {
+		return x.RateBits
+	}
+	return 0
+}
+
+func (x *TcClassStat) GetCeilBits() uint64 {
+	if x != nil {
+		return x.CeilBits
+	}
+	return 0
+}
+
+func (x *TcClassStat) GetBacklogBytes() uint64 {
+	if x != nil {
+		return x.BacklogBytes
+	}
+	return 0
+}
+
+func (x *TcClassStat) GetBacklogPackets() uint64 {
+	if x != nil {
+		return x.BacklogPackets
+	}
+	return 0
+}
+
+func (x *TcClassStat) GetThroughput() float64 {
+	if x != nil {
+		return x.Throughput
+	}
+	return 0
+}
+
+// 限速qdisc统计
+type TcQdiscStat struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Handle         string                 `protobuf:"bytes,1,opt,name=handle,proto3" json:"handle,omitempty"`
+	Kind           string                 `protobuf:"bytes,2,opt,name=kind,proto3" json:"kind,omitempty"`     // htb/fq_codel等
+	Parent         string                 `protobuf:"bytes,3,opt,name=parent,proto3" json:"parent,omitempty"` // 父节点，根qdisc为root
+	Bytes          uint64                 `protobuf:"varint,4,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	Packets        uint64                 `protobuf:"varint,5,opt,name=packets,proto3" json:"packets,omitempty"`
+	Drops          uint64                 `protobuf:"varint,6,opt,name=drops,proto3" json:"drops,omitempty"`
+	Overlimits     uint64                 `protobuf:"varint,7,opt,name=overlimits,proto3" json:"overlimits,omitempty"`
+	BacklogBytes   uint64                 `protobuf:"varint,8,opt,name=backlog_bytes,json=backlogBytes,proto3" json:"backlog_bytes,omitempty"`
+	BacklogPackets uint64                 `protobuf:"varint,9,opt,name=backlog_packets,json=backlogPackets,proto3" json:"backlog_packets,omitempty"`
+	Throughput     float64                `protobuf:"fixed64,10,opt,name=throughput,proto3" json:"throughput,omitempty"` // 当前速率 (bits/s)
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *TcQdiscStat) Reset() {
+	*x = TcQdiscStat{}
+	mi := &file_tcp_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TcQdiscStat) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TcQdiscStat) ProtoMessage() {}
+
+func (x *TcQdiscStat) ProtoReflect() protoreflect.Message {
+	mi := &file_tcp_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TcQdiscStat.ProtoReflect.Descriptor instead.
+func (*TcQdiscStat) Descriptor() ([]byte, []int) {
+	return file_tcp_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *TcQdiscStat) GetHandle() string {
+	if x != nil {
+		return x.Handle
+	}
+	return ""
+}
+
+func (x *TcQdiscStat) GetKind() string {
+	if x != nil {
+		return x.Kind
+	}
+	return ""
+}
+
+func (x *TcQdiscStat) GetParent() string {
+	if x != nil {
+		return x.Parent
+	}
+	return ""
+}
+
+func (x *TcQdiscStat) GetBytes() uint64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+func (x *TcQdiscStat) GetPackets() uint64 {
+	if x != nil {
+		return x.Packets
+	}
+	return 0
+}
+
+func (x *TcQdiscStat) GetDrops() uint64 {
+	if x != nil {
+		return x.Drops
+	}
+	return 0
+}
+
+func (x *TcQdiscStat) GetOverlimits() uint64 {
+	if x != nil {
+		return x.Overlimits
+	}
+	return 0
+}
+
+func (x *TcQdiscStat) GetBacklogBytes() uint64 {
+	if x != nil {
+		return x.BacklogBytes
+	}
+	return 0
+}
+
+func (x *TcQdiscStat) GetBacklogPackets() uint64 {
+	if x != nil {
+		return x.BacklogPackets
+	}
+	return 0
+}
+
+func (x *TcQdiscStat) GetThroughput() float64 {
+	if x != nil {
+		return x.Throughput
+	}
+	return 0
+}
+
+// 限速验证: 设置限速后采样一段时间，检查实际速率没有超过限速
+type TcVerifyResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Passed        bool                   `protobuf:"varint,1,opt,name=passed,proto3" json:"passed,omitempty"`
+	Seconds       uint32                 `protobuf:"varint,2,opt,name=seconds,proto3" json:"seconds,omitempty"` // 采样时长
+	Ifaces        []*TcVerifyIface       `protobuf:"bytes,3,rep,name=ifaces,proto3" json:"ifaces,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TcVerifyResult) Reset() {
+	*x = TcVerifyResult{}
+	mi := &file_tcp_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TcVerifyResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TcVerifyResult) ProtoMessage() {}
+
+func (x *TcVerifyResult) ProtoReflect() protoreflect.Message {
+	mi := &file_tcp_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TcVerifyResult.ProtoReflect.Descriptor instead.
+func (*TcVerifyResult) Descriptor() ([]byte, []int) {
+	return file_tcp_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *TcVerifyResult) GetPassed() bool {
+	if x != nil {
+		return x.Passed
+	}
+	return false
+}
+
+func (x *TcVerifyResult) GetSeconds() uint32 {
+	if x != nil {
+		return x.Seconds
+	}
+	return 0
+}
+
+func (x *TcVerifyResult) GetIfaces() []*TcVerifyIface {
+	if x != nil {
+		return x.Ifaces
+	}
+	return nil
+}
+
+type TcVerifyIface struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	IfaceName     string                 `protobuf:"bytes,1,opt,name=iface_name,json=ifaceName,proto3" json:"iface_name,omitempty"`
+	Passed        bool                   `protobuf:"varint,2,opt,name=passed,proto3" json:"passed,omitempty"`
+	TxBits        float64                `protobuf:"fixed64,3,opt,name=tx_bits,json=txBits,proto3" json:"tx_bits,omitempty"` // 网卡平均发送速率 (bits/s)
+	Classes       []*TcClassStat         `protobuf:"bytes,4,rep,name=classes,proto3" json:"classes,omitempty"`               // throughput 是采样期间的平均速率
+	ErrMsg        string                 `protobuf:"bytes,5,opt,name=err_msg,json=errMsg,proto3" json:"err_msg,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TcVerifyIface) Reset() {
+	*x = TcVerifyIface{}
+	mi := &file_tcp_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TcVerifyIface) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TcVerifyIface) ProtoMessage() {}
+
+func (x *TcVerifyIface) ProtoReflect() protoreflect.Message {
+	mi := &file_tcp_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TcVerifyIface.ProtoReflect.Descriptor instead.
+func (*TcVerifyIface) Descriptor() ([]byte, []int) {
+	return file_tcp_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *TcVerifyIface) GetIfaceName() string {
+	if x != nil {
+		return x.IfaceName
+	}
+	return ""
+}
+
+func (x *TcVerifyIface) GetPassed() bool {
+	if x != nil {
+		return x.Passed
+	}
+	return false
+}
+
+func (x *TcVerifyIface) GetTxBits() float64 {
+	if x != nil {
+		return x.TxBits
+	}
+	return 0
+}
+
+func (x *TcVerifyIface) GetClasses() []*TcClassStat {
+	if x != nil {
+		return x.Classes
+	}
+	return nil
+}
+
+func (x *TcVerifyIface) GetErrMsg() string {
+	if x != nil {
+		return x.ErrMsg
+	}
+	return ""
+}
+
+// 自适应限速: agent按网卡发送量跟踪自己的95值，在min/max之间调整默认class的限速
+type TcAdaptiveConfig struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Enabled       bool                   `protobuf:"varint,1,opt,name=enabled,proto3" json:"enabled,omitempty"`
+	IfaceName     string                 `protobuf:"bytes,2,opt,name=iface_name,json=ifaceName,proto3" json:"iface_name,omitempty"`
+	TargetBits    uint64                 `protobuf:"varint,3,opt,name=target_bits,json=targetBits,proto3" json:"target_bits,omitempty"` // 目标95值 (bits/s)
+	MinBits       uint64                 `protobuf:"varint,4,opt,name=min_bits,json=minBits,proto3" json:"min_bits,omitempty"`          // 限速下限
+	MaxBits       uint64                 `protobuf:"varint,5,opt,name=max_bits,json=maxBits,proto3" json:"max_bits,omitempty"`          // 限速上限
+	BillingDay    uint32                 `protobuf:"varint,6,opt,name=billing_day,json=billingDay,proto3" json:"billing_day,omitempty"` // 计费周期从每月几号开始，1-28
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TcAdaptiveConfig) Reset() {
+	*x = TcAdaptiveConfig{}
+	mi := &file_tcp_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TcAdaptiveConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TcAdaptiveConfig) ProtoMessage() {}
+
+func (x *TcAdaptiveConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_tcp_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TcAdaptiveConfig.ProtoReflect.Descriptor instead.
+func (*TcAdaptiveConfig) Descriptor() ([]byte, []int) {
+	return file_tcp_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *TcAdaptiveConfig) GetEnabled() bool {
+	if x != nil {
+		return x.Enabled
+	}
+	return false
+}
+
+func (x *TcAdaptiveConfig) GetIfaceName() string {
+	if x != nil {
+		return x.IfaceName
+	}
+	return ""
+}
+
+func (x *TcAdaptiveConfig) GetTargetBits() uint64 {
+	if x != nil {
+		return x.TargetBits
+	}
+	return 0
+}
+
+func (x *TcAdaptiveConfig) GetMinBits() uint64 {
+	if x != nil {
+		return x.MinBits
+	}
+	return 0
+}
+
+func (x *TcAdaptiveConfig) GetMaxBits() uint64 {
+	if x != nil {
+		return x.MaxBits
+	}
+	return 0
+}
+
+func (x *TcAdaptiveConfig) GetBillingDay() uint32 {
+	if x != nil {
+		return x.BillingDay
+	}
+	return 0
+}
+
+// 自适应限速调整事件
+type TcAdjustEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Sn            string                 `protobuf:"bytes,1,opt,name=sn,proto3" json:"sn,omitempty"`
+	IfaceName     string                 `protobuf:"bytes,2,opt,name=iface_name,json=ifaceName,proto3" json:"iface_name,omitempty"`
+	OldBits       uint64                 `protobuf:"varint,3,opt,name=old_bits,json=oldBits,proto3" json:"old_bits,omitempty"`
+	NewBits       uint64                 `protobuf:"varint,4,opt,name=new_bits,json=newBits,proto3" json:"new_bits,omitempty"`
+	P95Bits       float64                `protobuf:"fixed64,5,opt,name=p95_bits,json=p95Bits,proto3" json:"p95_bits,omitempty"` // 本计费周期到目前的95值
+	TargetBits    uint64                 `protobuf:"varint,6,opt,name=target_bits,json=targetBits,proto3" json:"target_bits,omitempty"`
+	BurstUsed     uint32                 `protobuf:"varint,7,opt,name=burst_used,json=burstUsed,proto3" json:"burst_used,omitempty"`    // 已超过目标的5分钟点数
+	BurstTotal    uint32                 `protobuf:"varint,8,opt,name=burst_total,json=burstTotal,proto3" json:"burst_total,omitempty"` // 本计费周期允许超过目标的点数
+	Reason        string                 `protobuf:"bytes,9,opt,name=reason,proto3" json:"reason,omitempty"`
+	ErrMsg        string                 `protobuf:"bytes,10,opt,name=err_msg,json=errMsg,proto3" json:"err_msg,omitempty"`
+	Timestamp     int64                  `protobuf:"varint,11,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TcAdjustEvent) Reset() {
+	*x = TcAdjustEvent{}
+	mi := &file_tcp_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TcAdjustEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TcAdjustEvent) ProtoMessage() {}
+
+func (x *TcAdjustEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_tcp_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TcAdjustEvent.ProtoReflect.Descriptor instead.
+func (*TcAdjustEvent) Descriptor() ([]byte, []int) {
+	return file_tcp_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *TcAdjustEvent) GetSn() string {
+	if x != nil {
+		return x.Sn
+	}
+	return ""
+}
+
+func (x *TcAdjustEvent) GetIfaceName() string {
+	if x != nil {
+		return x.IfaceName
+	}
+	return ""
+}
+
+func (x *TcAdjustEvent) GetOldBits() uint64 {
+	if x != nil {
+		return x.OldBits
+	}
+	return 0
+}
+
+func (x *TcAdjustEvent) GetNewBits() uint64 {
+	if x != nil {
+		return x.NewBits
+	}
+	return 0
+}
+
+func (x *TcAdjustEvent) GetP95Bits() float64 {
+	if x != nil {
+		return x.P95Bits
+	}
+	return 0
+}
+
+func (x *TcAdjustEvent) GetTargetBits() uint64 {
+	if x != nil {
+		return x.TargetBits
+	}
+	return 0
+}
+
+func (x *TcAdjustEvent) GetBurstUsed() uint32 {
+	if x != nil {
+		return x.BurstUsed
+	}
+	return 0
+}
+
+func (x *TcAdjustEvent) GetBurstTotal() uint32 {
+	if x != nil {
+		return x.BurstTotal
+	}
+	return 0
+}
+
+func (x *TcAdjustEvent) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *TcAdjustEvent) GetErrMsg() string {
+	if x != nil {
+		return x.ErrMsg
+	}
+	return ""
+}
+
+func (x *TcAdjustEvent) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+// 限速漂移事件: agent发现内核里的限速规则和本地保存的策略不一致
+type TcDriftEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Sn            string                 `protobuf:"bytes,1,opt,name=sn,proto3" json:"sn,omitempty"`
+	IfaceName     string                 `protobuf:"bytes,2,opt,name=iface_name,json=ifaceName,proto3" json:"iface_name,omitempty"`
+	Reason        string                 `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`               // 不一致的地方
+	Repaired      bool                   `protobuf:"varint,4,opt,name=repaired,proto3" json:"repaired,omitempty"`          // 是否已重新设置
+	ErrMsg        string                 `protobuf:"bytes,5,opt,name=err_msg,json=errMsg,proto3" json:"err_msg,omitempty"` // 重新设置失败的原因
+	Timestamp     int64                  `protobuf:"varint,6,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TcDriftEvent) Reset() {
+	*x = TcDriftEvent{}
+	mi := &file_tcp_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TcDriftEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TcDriftEvent) ProtoMessage() {}
+
+func (x *TcDriftEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_tcp_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TcDriftEvent.ProtoReflect.Descriptor instead.
+func (*TcDriftEvent) Descriptor() ([]byte, []int) {
+	return file_tcp_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *TcDriftEvent) GetSn() string {
+	if x != nil {
+		return x.Sn
+	}
+	return ""
+}
+
+func (x *TcDriftEvent) GetIfaceName() string {
+	if x != nil {
+		return x.IfaceName
+	}
+	return ""
+}
+
+func (x *TcDriftEvent) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *TcDriftEvent) GetRepaired() bool {
+	if x != nil {
+		return x.Repaired
+	}
+	return false
+}
+
+func (x *TcDriftEvent) GetErrMsg() string {
+	if x != nil {
+		return x.ErrMsg
+	}
+	return ""
+}
+
+func (x *TcDriftEvent) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+// 系统监控进程信息
+type SystemMonitorProcess struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Pid           int32                  `protobuf:"varint,1,opt,name=pid,proto3" json:"pid,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Exe           string                 `protobuf:"bytes,3,opt,name=exe,proto3" json:"exe,omitempty"`
+	Cpu           float32                `protobuf:"fixed32,4,opt,name=cpu,proto3" json:"cpu,omitempty"`       // CPU使用率，两次心跳之间的平均值，单核100%
+	Memory        float32                `protobuf:"fixed32,5,opt,name=memory,proto3" json:"memory,omitempty"` // 内存占用百分比
+	Status        string                 `protobuf:"bytes,6,opt,name=status,proto3" json:"status,omitempty"`
+	Program       string                 `protobuf:"bytes,7,opt,name=program,proto3" json:"program,omitempty"`                          // 按程序限速时所属的规则名
+	Rss           uint64                 `protobuf:"varint,8,opt,name=rss,proto3" json:"rss,omitempty"`                                 // 常驻内存 字节
+	CreateTime    int64                  `protobuf:"varint,9,opt,name=create_time,json=createTime,proto3" json:"create_time,omitempty"` // 启动时间 毫秒
+	Username      string                 `protobuf:"bytes,10,opt,name=username,proto3" json:"username,omitempty"`
+	Established   uint32                 `protobuf:"varint,11,opt,name=established,proto3" json:"established,omitempty"`                   // 已建立的TCP连接数
+	ListenPorts   []string               `protobuf:"bytes,12,rep,name=listen_ports,json=listenPorts,proto3" json:"listen_ports,omitempty"` // 监听的端口，如 tcp/8080、udp/53
+	Sockets       uint32                 `protobuf:"varint,13,opt,name=sockets,proto3" json:"sockets,omitempty"`                           // 打开的socket数
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SystemMonitorProcess) Reset() {
+	*x = SystemMonitorProcess{}
+	mi := &file_tcp_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SystemMonitorProcess) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SystemMonitorProcess) ProtoMessage() {}
+
+func (x *SystemMonitorProcess) ProtoReflect() protoreflect.Message {
+	mi := &file_tcp_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SystemMonitorProcess.ProtoReflect.Descriptor instead.
+func (*SystemMonitorProcess) Descriptor() ([]byte, []int) {
+	return file_tcp_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *SystemMonitorProcess) GetPid() int32 {
+	if x != nil {
+		return x.Pid
+	}
+	return 0
+}
+
+func (x *SystemMonitorProcess) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *SystemMonitorProcess) GetExe() string {
+	if x != nil {
+		return x.Exe
+	}
+	return ""
+}
+
+func (x *SystemMonitorProcess) GetCpu() float32 {
+	if x != nil {
+		return x.Cpu
+	}
+	return 0
+}
+
+func (x *SystemMonitorProcess) GetMemory() float32 {
+	if x != nil {
+		return x.Memory
+	}
+	return 0
+}
+
+func (x *SystemMonitorProcess) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *SystemMonitorProcess) GetProgram() string {
+	if x != nil {
+		return x.Program
+	}
+	return ""
+}
+
+func (x *SystemMonitorProcess) GetRss() uint64 {
+	if x != nil {
+		return x.Rss
+	}
+	return 0
+}
+
+func (x *SystemMonitorProcess) GetCreateTime() int64 {
+	if x != nil {
+		return x.CreateTime
+	}
+	return 0
+}
+
+func (x *SystemMonitorProcess) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *SystemMonitorProcess) GetEstablished() uint32 {
+	if x != nil {
+		return x.Established
+	}
+	return 0
+}
+
+func (x *SystemMonitorProcess) GetListenPorts() []string {
+	if x != nil {
+		return x.ListenPorts
+	}
+	return nil
+}
+
+func (x *SystemMonitorProcess) GetSockets() uint32 {
+	if x != nil {
+		return x.Sockets
+	}
+	return 0
+}
+
+// 系统监控CPU信息
+type SystemMonitorCpu struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Usage         float32                `protobuf:"fixed32,1,opt,name=usage,proto3" json:"usage,omitempty"`
+	Cores         int32                  `protobuf:"varint,2,opt,name=cores,proto3" json:"cores,omitempty"`
+	Temperature   float32                `protobuf:"fixed32,3,opt,name=temperature,proto3" json:"temperature,omitempty"` // 摄氏度，读不到时为0
+	Load1         float32                `protobuf:"fixed32,4,opt,name=load1,proto3" json:"load1,omitempty"`             // 1/5/15分钟平均负载
+	Load5         float32                `protobuf:"fixed32,5,opt,name=load5,proto3" json:"load5,omitempty"`
+	Load15        float32                `protobuf:"fixed32,6,opt,name=load15,proto3" json:"load15,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SystemMonitorCpu) Reset() {
+	*x = SystemMonitorCpu{}
+	mi := &file_tcp_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SystemMonitorCpu) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SystemMonitorCpu) ProtoMessage() {}
+
+func (x *SystemMonitorCpu) ProtoReflect() protoreflect.Message {
+	mi := &file_tcp_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SystemMonitorCpu.ProtoReflect.Descriptor instead.
+func (*SystemMonitorCpu) Descriptor() ([]byte, []int) {
+	return file_tcp_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *SystemMonitorCpu) GetUsage() float32 {
+	if x != nil {
+		return x.Usage
+	}
+	return 0
+}
+
+func (x *SystemMonitorCpu) GetCores() int32 {
+	if x != nil {
+		return x.Cores
+	}
+	return 0
+}
+
+func (x *SystemMonitorCpu) GetTemperature() float32 {
+	if x != nil {
+		return x.Temperature
+	}
+	return 0
+}
+
+func (x *SystemMonitorCpu) GetLoad1() float32 {
+	if x != nil {
+		return x.Load1
+	}
+	return 0
+}
+
+func (x *SystemMonitorCpu) GetLoad5() float32 {
+	if x != nil {
+		return x.Load5
+	}
+	return 0
+}
+
+func (x *SystemMonitorCpu) GetLoad15() float32 {
+	if x != nil {
+		return x.Load15
+	}
+	return 0
+}
+
+// 系统监控内存信息
+type SystemMonitorMemory struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Used          int64                  `protobuf:"varint,1,opt,name=used,proto3" json:"used,omitempty"`
+	Total         int64                  `protobuf:"varint,2,opt,name=total,proto3" json:"total,omitempty"`
+	Available     int64                  `protobuf:"varint,3,opt,name=available,proto3" json:"available,omitempty"`
+	UsedPercent   float32                `protobuf:"fixed32,4,opt,name=used_percent,json=usedPercent,proto3" json:"used_percent,omitempty"`
+	SwapUsed      int64                  `protobuf:"varint,5,opt,name=swap_used,json=swapUsed,proto3" json:"swap_used,omitempty"`
+	SwapTotal     int64                  `protobuf:"varint,6,opt,name=swap_total,json=swapTotal,proto3" json:"swap_total,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SystemMonitorMemory) Reset() {
+	*x = SystemMonitorMemory{}
+	mi := &file_tcp_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SystemMonitorMemory) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SystemMonitorMemory) ProtoMessage() {}
+
+func (x *SystemMonitorMemory) ProtoReflect() protoreflect.Message {
+	mi := &file_tcp_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SystemMonitorMemory.ProtoReflect.Descriptor instead.
+func (*SystemMonitorMemory) Descriptor() ([]byte, []int) {
+	return file_tcp_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *SystemMonitorMemory) GetUsed() int64 {
+	if x != nil {
+		return x.Used
+	}
+	return 0
+}
+
+func (x *SystemMonitorMemory) GetTotal() int64 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+func (x *SystemMonitorMemory) GetAvailable() int64 {
+	if x != nil {
+		return x.Available
+	}
+	return 0
+}
+
+func (x *SystemMonitorMemory) GetUsedPercent() float32 {
+	if x != nil {
+		return x.UsedPercent
+	}
+	return 0
+}
+
+func (x *SystemMonitorMemory) GetSwapUsed() int64 {
+	if x != nil {
+		return x.SwapUsed
+	}
+	return 0
+}
+
+func (x *SystemMonitorMemory) GetSwapTotal() int64 {
+	if x != nil {
+		return x.SwapTotal
+	}
+	return 0
+}
+
+// 系统监控磁盘信息
+type SystemMonitorDisk struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Used          int64                  `protobuf:"varint,1,opt,name=used,proto3" json:"used,omitempty"`
+	Total         int64                  `protobuf:"varint,2,opt,name=total,proto3" json:"total,omitempty"`
+	Free          int64                  `protobuf:"varint,3,opt,name=free,proto3" json:"free,omitempty"`
+	Mount         string                 `protobuf:"bytes,4,opt,name=mount,proto3" json:"mount,omitempty"` // 挂载点
+	Device        string                 `protobuf:"bytes,5,opt,name=device,proto3" json:"device,omitempty"`
+	Fstype        string                 `protobuf:"bytes,6,opt,name=fstype,proto3" json:"fstype,omitempty"`
+	UsedPercent   float32                `protobuf:"fixed32,7,opt,name=used_percent,json=usedPercent,proto3" json:"used_percent,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SystemMonitorDisk) Reset() {
+	*x = SystemMonitorDisk{}
+	mi := &file_tcp_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SystemMonitorDisk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SystemMonitorDisk) ProtoMessage() {}
+
+func (x *SystemMonitorDisk) ProtoReflect() protoreflect.Message {
+	mi := &file_tcp_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SystemMonitorDisk.ProtoReflect.Descriptor instead.
+func (*SystemMonitorDisk) Descriptor() ([]byte, []int) {
+	return file_tcp_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *SystemMonitorDisk) GetUsed() int64 {
+	if x != nil {
+		return x.Used
+	}
+	return 0
+}
+
+func (x *SystemMonitorDisk) GetTotal() int64 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+func (x *SystemMonitorDisk) GetFree() int64 {
+	if x != nil {
+		return x.Free
+	}
+	return 0
+}
+
+func (x *SystemMonitorDisk) GetMount() string {
+	if x != nil {
+		return x.Mount
+	}
+	return ""
+}
+
+func (x *SystemMonitorDisk) GetDevice() string {
+	if x != nil {
+		return x.Device
+	}
+	return ""
+}
+
+func (x *SystemMonitorDisk) GetFstype() string {
+	if x != nil {
+		return x.Fstype
+	}
+	return ""
+}
+
+func (x *SystemMonitorDisk) GetUsedPercent() float32 {
+	if x != nil {
+		return x.UsedPercent
+	}
+	return 0
+}
+
+// 系统监控网络信息
+type SystemMonitorNetwork struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Name        string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`                                   // 网络接口名称
+	BytesSent   uint64                 `protobuf:"varint,2,opt,name=bytes_sent,json=bytesSent,proto3" json:"bytes_sent,omitempty"`       // 发送的字节数
+	BytesRecv   uint64                 `protobuf:"varint,3,opt,name=bytes_recv,json=bytesRecv,proto3" json:"bytes_recv,omitempty"`       // 接收的字节数
+	PacketsSent uint64                 `protobuf:"varint,4,opt,name=packets_sent,json=packetsSent,proto3" json:"packets_sent,omitempty"` // 发送的数据包数
+	PacketsRecv uint64                 `protobuf:"varint,5,opt,name=packets_recv,json=packetsRecv,proto3" json:"packets_recv,omitempty"` // 接收的数据包数
+	Errin       uint64                 `protobuf:"varint,6,opt,name=errin,proto3" json:"errin,omitempty"`                                // 接收错误数
+	Errout      uint64                 `protobuf:"varint,7,opt,name=errout,proto3" json:"errout,omitempty"`                              // 发送错误数
+	Dropin      uint64                 `protobuf:"varint,8,opt,name=dropin,proto3" json:"dropin,omitempty"`                              // 接收丢包数
+	Dropout     uint64                 `protobuf:"varint,9,opt,name=dropout,proto3" json:"dropout,omitempty"`                            // 发送丢包数
+	Timestamp   int64                  `protobuf:"varint,10,opt,name=timestamp,proto3" json:"timestamp,omitempty"`                       // 采样时间
+	SendRate    float64                `protobuf:"fixed64,11,opt,name=send_rate,json=sendRate,proto3" json:"send_rate,omitempty"`        // 发送速率 (bytes/s)
+	RecvRate    float64                `protobuf:"fixed64,12,opt,name=recv_rate,json=recvRate,proto3" json:"recv_rate,omitempty"`        // 接收速率 (bytes/s)
+	// 上次成功上报以来的增量，已经处理了计数器回绕和重启，服务端按它统计流量
+	DeltaSent        uint64 `protobuf:"varint,13,opt,name=delta_sent,json=deltaSent,proto3" json:"delta_sent,omitempty"`
+	DeltaRecv        uint64 `protobuf:"varint,14,opt,name=delta_recv,json=deltaRecv,proto3" json:"delta_recv,omitempty"`
+	DeltaPacketsSent uint64 `protobuf:"varint,15,opt,name=delta_packets_sent,json=deltaPacketsSent,proto3" json:"delta_packets_sent,omitempty"`
+	DeltaPacketsRecv uint64 `protobuf:"varint,16,opt,name=delta_packets_recv,json=deltaPacketsRecv,proto3" json:"delta_packets_recv,omitempty"`
+	DeltaStart       int64  `protobuf:"varint,17,opt,name=delta_start,json=deltaStart,proto3" json:"delta_start,omitempty"`       // 增量的开始时间 秒，0表示agent还没有基数(第一次运行)
+	CounterReset     bool   `protobuf:"varint,18,opt,name=counter_reset,json=counterReset,proto3" json:"counter_reset,omitempty"` // 计数器被清零过(重启或网卡重建)，增量从0算起
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *SystemMonitorNetwork) Reset() {
+	*x = SystemMonitorNetwork{}
+	mi := &file_tcp_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SystemMonitorNetwork) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SystemMonitorNetwork) ProtoMessage() {}
+
+func (x *SystemMonitorNetwork) ProtoReflect() protoreflect.Message {
+	mi := &file_tcp_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SystemMonitorNetwork.ProtoReflect.Descriptor instead.
+func (*SystemMonitorNetwork) Descriptor() ([]byte, []int) {
+	return file_tcp_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *SystemMonitorNetwork) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *SystemMonitorNetwork) GetBytesSent() uint64 {
+	if x != nil {
+		return x.BytesSent
+	}
+	return 0
+}
+
+func (x *SystemMonitorNetwork) GetBytesRecv() uint64 {
+	if x != nil {
+		return x.BytesRecv
+	}
+	return 0
+}
+
+func (x *SystemMonitorNetwork) GetPacketsSent() uint64 {
+	if x != nil {
+		return x.PacketsSent
+	}
+	return 0
+}
+
+func (x *SystemMonitorNetwork) GetPacketsRecv() uint64 {
+	if x != nil {
+		return x.PacketsRecv
+	}
+	return 0
+}
+
+func (x *SystemMonitorNetwork) GetErrin() uint64 {
+	if x != nil {
+		return x.Errin
+	}
+	return 0
+}
+
+func (x *SystemMonitorNetwork) GetErrout() uint64 {
+	if x != nil {
+		return x.Errout
+	}
+	return 0
+}
+
+func (x *SystemMonitorNetwork) GetDropin() uint64 {
+	if x != nil {
+		return x.Dropin
+	}
+	return 0
+}
+
+func (x *SystemMonitorNetwork) GetDropout() uint64 {
+	if x != nil {
+		return x.Dropout
+	}
+	return 0
+}
+
+func (x *SystemMonitorNetwork) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *SystemMonitorNetwork) GetSendRate() float64 {
+	if x != nil {
+		return x.SendRate
+	}
+	return 0
+}
+
+func (x *SystemMonitorNetwork) GetRecvRate() float64 {
+	if x != nil {
+		return x.RecvRate
+	}
+	return 0
+}
+
+func (x *SystemMonitorNetwork) GetDeltaSent() uint64 {
+	if x != nil {
+		return x.DeltaSent
+	}
+	return 0
+}
+
+func (x *SystemMonitorNetwork) GetDeltaRecv() uint64 {
+	if x != nil {
+		return x.DeltaRecv
+	}
+	return 0
+}
+
+func (x *SystemMonitorNetwork) GetDeltaPacketsSent() uint64 {
+	if x != nil {
+		return x.DeltaPacketsSent
+	}
+	return 0
+}
+
+func (x *SystemMonitorNetwork) GetDeltaPacketsRecv() uint64 {
+	if x != nil {
+		return x.DeltaPacketsRecv
+	}
+	return 0
+}
+
+func (x *SystemMonitorNetwork) GetDeltaStart() int64 {
+	if x != nil {
+		return x.DeltaStart
+	}
+	return 0
+}
+
+func (x *SystemMonitorNetwork) GetCounterReset() bool {
+	if x != nil {
+		return x.CounterReset
+	}
+	return false
+}
+
+// 获取设备系统监控数据
+type SystemMonitorData struct {
+	state         protoimpl.MessageState    `protogen:"open.v1"`
+	Cpu           *SystemMonitorCpu         `protobuf:"bytes,1,opt,name=cpu,proto3" json:"cpu,omitempty"`
+	Memory        *SystemMonitorMemory      `protobuf:"bytes,2,opt,name=memory,proto3" json:"memory,omitempty"`
+	Disk          *SystemMonitorDisk        `protobuf:"bytes,3,opt,name=disk,proto3" json:"disk,omitempty"`
+	Network       []*SystemMonitorNetwork   `protobuf:"bytes,4,rep,name=network,proto3" json:"network,omitempty"`
+	Processes     []*SystemMonitorProcess   `protobuf:"bytes,5,rep,name=processes,proto3" json:"processes,omitempty"`
+	Programs      []*SystemMonitorProgram   `protobuf:"bytes,6,rep,name=programs,proto3" json:"programs,omitempty"`
+	Disks         []*SystemMonitorDisk      `protobuf:"bytes,7,rep,name=disks,proto3" json:"disks,omitempty"`                                     // 每个挂载点，disk是根分区
+	Uptime        uint64                    `protobuf:"varint,8,opt,name=uptime,proto3" json:"uptime,omitempty"`                                  // 开机时长 秒
+	BootTime      int64                     `protobuf:"varint,9,opt,name=boot_time,json=bootTime,proto3" json:"boot_time,omitempty"`              // 开机时间 秒
+	ProcessCount  uint32                    `protobuf:"varint,10,opt,name=process_count,json=processCount,proto3" json:"process_count,omitempty"` // 进程总数，processes只带前N个
+	Containers    []*SystemMonitorContainer `protobuf:"bytes,11,rep,name=containers,proto3" json:"containers,omitempty"`                          // docker容器，没装docker时为空
+	Conn          *SystemMonitorConn        `protobuf:"bytes,12,opt,name=conn,proto3" json:"conn,omitempty"`                                      // 连接跟踪和TCP连接状态
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SystemMonitorData) Reset() {
+	*x = SystemMonitorData{}
+	mi := &file_tcp_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SystemMonitorData) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SystemMonitorData) ProtoMessage() {}
+
+func (x *SystemMonitorData) ProtoReflect() protoreflect.Message {
+	mi := &file_tcp_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SystemMonitorData.ProtoReflect.Descriptor instead.
+func (*SystemMonitorData) Descriptor() ([]byte, []int) {
+	return file_tcp_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *SystemMonitorData) GetCpu() *SystemMonitorCpu {
+	if x != nil {
+		return x.Cpu
+	}
+	return nil
+}
+
+func (x *SystemMonitorData) GetMemory() *SystemMonitorMemory {
+	if x != nil {
+		return x.Memory
+	}
+	return nil
+}
+
+func (x *SystemMonitorData) GetDisk() *SystemMonitorDisk {
+	if x != nil {
+		return x.Disk
+	}
+	return nil
+}
+
+func (x *SystemMonitorData) GetNetwork() []*SystemMonitorNetwork {
+	if x != nil {
+		return x.Network
+	}
+	return nil
+}
+
+func (x *SystemMonitorData) GetProcesses() []*SystemMonitorProcess {
+	if x != nil {
+		return x.Processes
+	}
+	return nil
+}
+
+func (x *SystemMonitorData) GetPrograms() []*SystemMonitorProgram {
+	if x != nil {
+		return x.Programs
+	}
+	return nil
+}
+
+func (x *SystemMonitorData) GetDisks() []*SystemMonitorDisk {
+	if x != nil {
+		return x.Disks
+	}
+	return nil
+}
+
+func (x *SystemMonitorData) GetUptime() uint64 {
+	if x != nil {
+		return x.Uptime
+	}
+	return 0
+}
+
+func (x *SystemMonitorData) GetBootTime() int64 {
+	if x != nil {
+		return x.BootTime
+	}
+	return 0
+}
+
+func (x *SystemMonitorData) GetProcessCount() uint32 {
+	if x != nil {
+		return x.ProcessCount
+	}
+	return 0
+}
+
+func (x *SystemMonitorData) GetContainers() []*SystemMonitorContainer {
+	if x != nil {
+		return x.Containers
+	}
+	return nil
+}
+
+func (x *SystemMonitorData) GetConn() *SystemMonitorConn {
+	if x != nil {
+		return x.Conn
+	}
+	return nil
+}
+
+// 连接跟踪表用量和TCP连接状态，只统计主机网络命名空间
+type SystemMonitorConn struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	ConntrackCount uint32                 `protobuf:"varint,1,opt,name=conntrack_count,json=conntrackCount,proto3" json:"conntrack_count,omitempty"`                                                            // 连接跟踪表当前条数，没加载nf_conntrack时为0
+	ConntrackMax   uint32                 `protobuf:"varint,2,opt,name=conntrack_max,json=conntrackMax,proto3" json:"conntrack_max,omitempty"`                                                                  // 连接跟踪表上限
+	TcpStates      map[string]uint32      `protobuf:"bytes,3,rep,name=tcp_states,json=tcpStates,proto3" json:"tcp_states,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"` // 每个状态的TCP连接数，如ESTABLISHED、TIME_WAIT，含IPv6
+	UdpSockets     uint32                 `protobuf:"varint,4,opt,name=udp_sockets,json=udpSockets,proto3" json:"udp_sockets,omitempty"`                                                                        // UDP socket数
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *SystemMonitorConn) Reset() {
+	*x = SystemMonitorConn{}
+	mi := &file_tcp_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SystemMonitorConn) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SystemMonitorConn) ProtoMessage() {}
+
+func (x *SystemMonitorConn) ProtoReflect() protoreflect.Message {
+	mi := &file_tcp_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SystemMonitorConn.ProtoReflect.Descriptor instead.
+func (*SystemMonitorConn) Descriptor() ([]byte, []int) {
+	return file_tcp_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *SystemMonitorConn) GetConntrackCount() uint32 {
+	if x != nil {
+		return x.ConntrackCount
+	}
+	return 0
+}
+
+func (x *SystemMonitorConn) GetConntrackMax() uint32 {
+	if x != nil {
+		return x.ConntrackMax
+	}
+	return 0
+}
+
+func (x *SystemMonitorConn) GetTcpStates() map[string]uint32 {
+	if x != nil {
+		return x.TcpStates
+	}
+	return nil
+}
+
+func (x *SystemMonitorConn) GetUdpSockets() uint32 {
+	if x != nil {
+		return x.UdpSockets
+	}
+	return 0
+}
+
+// docker容器
+type SystemMonitorContainer struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"` // 前12位
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Image         string                 `protobuf:"bytes,3,opt,name=image,proto3" json:"image,omitempty"`
+	State         string                 `protobuf:"bytes,4,opt,name=state,proto3" json:"state,omitempty"`   // running/exited/restarting/paused等
+	Status        string                 `protobuf:"bytes,5,opt,name=status,proto3" json:"status,omitempty"` // 如 Up 3 hours
+	RestartCount  uint32                 `protobuf:"varint,6,opt,name=restart_count,json=restartCount,proto3" json:"restart_count,omitempty"`
+	Cpu           float32                `protobuf:"fixed32,7,opt,name=cpu,proto3" json:"cpu,omitempty"`                                   // CPU使用率，两次心跳之间的平均值，单核100%
+	MemoryUsage   uint64                 `protobuf:"varint,8,opt,name=memory_usage,json=memoryUsage,proto3" json:"memory_usage,omitempty"` // 字节，不含page cache
+	MemoryLimit   uint64                 `protobuf:"varint,9,opt,name=memory_limit,json=memoryLimit,proto3" json:"memory_limit,omitempty"`
+	NetRxBytes    uint64                 `protobuf:"varint,10,opt,name=net_rx_bytes,json=netRxBytes,proto3" json:"net_rx_bytes,omitempty"` // 累计
+	NetTxBytes    uint64                 `protobuf:"varint,11,opt,name=net_tx_bytes,json=netTxBytes,proto3" json:"net_tx_bytes,omitempty"`
+	NetRxRate     float64                `protobuf:"fixed64,12,opt,name=net_rx_rate,json=netRxRate,proto3" json:"net_rx_rate,omitempty"` // bytes/s
+	NetTxRate     float64                `protobuf:"fixed64,13,opt,name=net_tx_rate,json=netTxRate,proto3" json:"net_tx_rate,omitempty"`
+	Created       int64                  `protobuf:"varint,14,opt,name=created,proto3" json:"created,omitempty"`                      // 创建时间 秒
+	StartedAt     int64                  `protobuf:"varint,15,opt,name=started_at,json=startedAt,proto3" json:"started_at,omitempty"` // 最近一次启动时间 秒
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SystemMonitorContainer) Reset() {
+	*x = SystemMonitorContainer{}
+	mi := &file_tcp_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SystemMonitorContainer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SystemMonitorContainer) ProtoMessage() {}
+
+func (x *SystemMonitorContainer) ProtoReflect() protoreflect.Message {
+	mi := &file_tcp_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SystemMonitorContainer.ProtoReflect.Descriptor instead.
+func (*SystemMonitorContainer) Descriptor() ([]byte, []int) {
+	return file_tcp_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *SystemMonitorContainer) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *SystemMonitorContainer) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *SystemMonitorContainer) GetImage() string {
+	if x != nil {
+		return x.Image
+	}
+	return ""
+}
+
+func (x *SystemMonitorContainer) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *SystemMonitorContainer) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *SystemMonitorContainer) GetRestartCount() uint32 {
+	if x != nil {
+		return x.RestartCount
+	}
+	return 0
+}
+
+func (x *SystemMonitorContainer) GetCpu() float32 {
+	if x != nil {
+		return x.Cpu
+	}
+	return 0
+}
+
+func (x *SystemMonitorContainer) GetMemoryUsage() uint64 {
+	if x != nil {
+		return x.MemoryUsage
+	}
+	return 0
+}
+
+func (x *SystemMonitorContainer) GetMemoryLimit() uint64 {
+	if x != nil {
+		return x.MemoryLimit
+	}
+	return 0
+}
+
+func (x *SystemMonitorContainer) GetNetRxBytes() uint64 {
+	if x != nil {
+		return x.NetRxBytes
+	}
+	return 0
+}
+
+func (x *SystemMonitorContainer) GetNetTxBytes() uint64 {
+	if x != nil {
+		return x.NetTxBytes
+	}
+	return 0
+}
+
+func (x *SystemMonitorContainer) GetNetRxRate() float64 {
+	if x != nil {
+		return x.NetRxRate
+	}
+	return 0
+}
+
+func (x *SystemMonitorContainer) GetNetTxRate() float64 {
+	if x != nil {
+		return x.NetTxRate
+	}
+	return 0
+}
+
+func (x *SystemMonitorContainer) GetCreated() int64 {
+	if x != nil {
+		return x.Created
+	}
+	return 0
+}
+
+func (x *SystemMonitorContainer) GetStartedAt() int64 {
+	if x != nil {
+		return x.StartedAt
+	}
+	return 0
+}
+
+// 按程序限速的规则的流量
+type SystemMonitorProgram struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`                             // 规则名
+	Target        string                 `protobuf:"bytes,2,opt,name=target,proto3" json:"target,omitempty"`                         // 匹配目标，如 process:xxx unit:xxx cgroup:xxx
+	Cgroup        string                 `protobuf:"bytes,3,opt,name=cgroup,proto3" json:"cgroup,omitempty"`                         // 实际匹配的cgroup路径
+	Pids          []int32                `protobuf:"varint,4,rep,packed,name=pids,proto3" json:"pids,omitempty"`                     // cgroup里的进程
+	BytesSent     uint64                 `protobuf:"varint,5,opt,name=bytes_sent,json=bytesSent,proto3" json:"bytes_sent,omitempty"` // 累计发送字节数
+	SendRate      float64                `protobuf:"fixed64,6,opt,name=send_rate,json=sendRate,proto3" json:"send_rate,omitempty"`   // 发送速率 (bytes/s)
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SystemMonitorProgram) Reset() {
+	*x = SystemMonitorProgram{}
+	mi := &file_tcp_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SystemMonitorProgram) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SystemMonitorProgram) ProtoMessage() {}
+
+func (x *SystemMonitorProgram) ProtoReflect() protoreflect.Message {
+	mi := &file_tcp_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SystemMonitorProgram.ProtoReflect.Descriptor instead.
+func (*SystemMonitorProgram) Descriptor() ([]byte, []int) {
+	return file_tcp_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *SystemMonitorProgram) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *SystemMonitorProgram) GetTarget() string {
+	if x != nil {
+		return x.Target
+	}
+	return ""
+}
+
+func (x *SystemMonitorProgram) GetCgroup() string {
+	if x != nil {
+		return x.Cgroup
+	}
+	return ""
+}
+
+func (x *SystemMonitorProgram) GetPids() []int32 {
+	if x != nil {
+		return x.Pids
+	}
+	return nil
+}
+
+func (x *SystemMonitorProgram) GetBytesSent() uint64 {
+	if x != nil {
+		return x.BytesSent
+	}
+	return 0
+}
+
+func (x *SystemMonitorProgram) GetSendRate() float64 {
+	if x != nil {
+		return x.SendRate
+	}
+	return 0
+}
+
+// 网络质量探测目标
+type ProbeTarget struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`                             // 唯一，作为指标的label
+	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`                             // icmp/tcp/http/dns
+	Target        string                 `protobuf:"bytes,3,opt,name=target,proto3" json:"target,omitempty"`                         // icmp: 主机; tcp: 主机:端口; http: URL; dns: 要解析的域名
+	Interval      uint32                 `protobuf:"varint,4,opt,name=interval,proto3" json:"interval,omitempty"`                    // 探测间隔(秒)
+	Count         uint32                 `protobuf:"varint,5,opt,name=count,proto3" json:"count,omitempty"`                          // 每轮发几次
+	TimeoutMs     uint32                 `protobuf:"varint,6,opt,name=timeout_ms,json=timeoutMs,proto3" json:"timeout_ms,omitempty"` // 每次的超时
+	DnsServer     string                 `protobuf:"bytes,7,opt,name=dns_server,json=dnsServer,proto3" json:"dns_server,omitempty"`  // dns: 指定的DNS服务器 ip:port，空时用系统设置
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProbeTarget) Reset() {
+	*x = ProbeTarget{}
+	mi := &file_tcp_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProbeTarget) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProbeTarget) ProtoMessage() {}
+
+func (x *ProbeTarget) ProtoReflect() protoreflect.Message {
+	mi := &file_tcp_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProbeTarget.ProtoReflect.Descriptor instead.
+func (*ProbeTarget) Descriptor() ([]byte, []int) {
+	return file_tcp_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *ProbeTarget) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ProbeTarget) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *ProbeTarget) GetTarget() string {
+	if x != nil {
+		return x.Target
+	}
+	return ""
+}
+
+func (x *ProbeTarget) GetInterval() uint32 {
+	if x != nil {
+		return x.Interval
+	}
+	return 0
+}
+
+func (x *ProbeTarget) GetCount() uint32 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+func (x *ProbeTarget) GetTimeoutMs() uint32 {
+	if x != nil {
+		return x.TimeoutMs
+	}
+	return 0
+}
+
+func (x *ProbeTarget) GetDnsServer() string {
+	if x != nil {
+		return x.DnsServer
+	}
+	return ""
+}
+
+// 网络质量探测设置，下发后agent保存到本地，整体替换
+type ProbeConfig struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Targets       []*ProbeTarget         `protobuf:"bytes,1,rep,name=targets,proto3" json:"targets,omitempty"`
+	Version       string                 `protobuf:"bytes,2,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProbeConfig) Reset() {
+	*x = ProbeConfig{}
+	mi := &file_tcp_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProbeConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProbeConfig) ProtoMessage() {}
+
+func (x *ProbeConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_tcp_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProbeConfig.ProtoReflect.Descriptor instead.
+func (*ProbeConfig) Descriptor() ([]byte, []int) {
+	return file_tcp_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *ProbeConfig) GetTargets() []*ProbeTarget {
+	if x != nil {
+		return x.Targets
+	}
+	return nil
+}
+
+func (x *ProbeConfig) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+// 一个目标一轮探测的结果，时间单位毫秒
+type ProbeResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Target        string                 `protobuf:"bytes,3,opt,name=target,proto3" json:"target,omitempty"`
+	Sent          uint32                 `protobuf:"varint,4,opt,name=sent,proto3" json:"sent,omitempty"`
+	Received      uint32                 `protobuf:"varint,5,opt,name=received,proto3" json:"received,omitempty"`
+	LossPercent   float64                `protobuf:"fixed64,6,opt,name=loss_percent,json=lossPercent,proto3" json:"loss_percent,omitempty"`
+	AvgMs         float64                `protobuf:"fixed64,7,opt,name=avg_ms,json=avgMs,proto3" json:"avg_ms,omitempty"`
+	MinMs         float64                `protobuf:"fixed64,8,opt,name=min_ms,json=minMs,proto3" json:"min_ms,omitempty"`
+	MaxMs         float64                `protobuf:"fixed64,9,opt,name=max_ms,json=maxMs,proto3" json:"max_ms,omitempty"`
+	JitterMs      float64                `protobuf:"fixed64,10,opt,name=jitter_ms,json=jitterMs,proto3" json:"jitter_ms,omitempty"` // 相邻两次时延差的平均值
+	ErrMsg        string                 `protobuf:"bytes,11,opt,name=err_msg,json=errMsg,proto3" json:"err_msg,omitempty"`         // 最后一次失败的原因
+	Timestamp     int64                  `protobuf:"varint,12,opt,name=timestamp,proto3" json:"timestamp,omitempty"`                // 这一轮开始的时间
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProbeResult) Reset() {
+	*x = ProbeResult{}
+	mi := &file_tcp_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProbeResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProbeResult) ProtoMessage() {}
+
+func (x *ProbeResult) ProtoReflect() protoreflect.Message {
+	mi := &file_tcp_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProbeResult.ProtoReflect.Descriptor instead.
+func (*ProbeResult) Descriptor() ([]byte, []int) {
+	return file_tcp_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *ProbeResult) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ProbeResult) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *ProbeResult) GetTarget() string {
+	if x != nil {
+		return x.Target
+	}
+	return ""
+}
+
+func (x *ProbeResult) GetSent() uint32 {
+	if x != nil {
+		return x.Sent
+	}
+	return 0
+}
+
+func (x *ProbeResult) GetReceived() uint32 {
+	if x != nil {
+		return x.Received
+	}
+	return 0
+}
+
+func (x *ProbeResult) GetLossPercent() float64 {
+	if x != nil {
+		return x.LossPercent
+	}
+	return 0
+}
+
+func (x *ProbeResult) GetAvgMs() float64 {
+	if x != nil {
+		return x.AvgMs
+	}
+	return 0
+}
+
+func (x *ProbeResult) GetMinMs() float64 {
+	if x != nil {
+		return x.MinMs
+	}
+	return 0
+}
+
+func (x *ProbeResult) GetMaxMs() float64 {
+	if x != nil {
+		return x.MaxMs
+	}
+	return 0
+}
+
+func (x *ProbeResult) GetJitterMs() float64 {
+	if x != nil {
+		return x.JitterMs
+	}
+	return 0
+}
+
+func (x *ProbeResult) GetErrMsg() string {
+	if x != nil {
+		return x.ErrMsg
+	}
+	return ""
+}
+
+func (x *ProbeResult) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+// NAT类型和公网地址
+type NatInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	NatType       string                 `protobuf:"bytes,1,opt,name=nat_type,json=natType,proto3" json:"nat_type,omitempty"`           // public/full_cone/restricted_cone/port_restricted_cone/symmetric/udp_blocked/unknown
+	PublicIpv4    string                 `protobuf:"bytes,2,opt,name=public_ipv4,json=publicIpv4,proto3" json:"public_ipv4,omitempty"`  // STUN看到的公网地址
+	PublicIpv6    []string               `protobuf:"bytes,3,rep,name=public_ipv6,json=publicIpv6,proto3" json:"public_ipv6,omitempty"`  // STUN看到的和网卡上的全局IPv6地址
+	LocalIpv4     string                 `protobuf:"bytes,4,opt,name=local_ipv4,json=localIpv4,proto3" json:"local_ipv4,omitempty"`     // 出口网卡地址
+	DetectedAt    int64                  `protobuf:"varint,5,opt,name=detected_at,json=detectedAt,proto3" json:"detected_at,omitempty"` // 检测时间 毫秒
+	ChangedAt     int64                  `protobuf:"varint,6,opt,name=changed_at,json=changedAt,proto3" json:"changed_at,omitempty"`    // 最近一次变化的时间 毫秒
+	ErrMsg        string                 `protobuf:"bytes,7,opt,name=err_msg,json=errMsg,proto3" json:"err_msg,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *SystemMonitorMemory) Reset() {
-	*x = SystemMonitorMemory{}
-	mi := &file_tcp_proto_msgTypes[5]
+func (x *NatInfo) Reset() {
+	*x = NatInfo{}
+	mi := &file_tcp_proto_msgTypes[25]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *SystemMonitorMemory) String() string {
+func (x *NatInfo) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*SystemMonitorMemory) ProtoMessage() {}
+func (*NatInfo) ProtoMessage() {}
 
-func (x *SystemMonitorMemory) ProtoReflect() protoreflect.Message {
-	mi := &file_tcp_proto_msgTypes[5]
+func (x *NatInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_tcp_proto_msgTypes[25]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -602,57 +2902,102 @@ func (x *SystemMonitorMemory) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use SystemMonitorMemory.ProtoReflect.Descriptor instead.
-func (*SystemMonitorMemory) Descriptor() ([]byte, []int) {
-	return file_tcp_proto_rawDescGZIP(), []int{5}
+// Deprecated: Use NatInfo.ProtoReflect.Descriptor instead.
+func (*NatInfo) Descriptor() ([]byte, []int) {
+	return file_tcp_proto_rawDescGZIP(), []int{25}
 }
 
-func (x *SystemMonitorMemory) GetUsed() int64 {
+func (x *NatInfo) GetNatType() string {
 	if x != nil {
-		return x.Used
+		return x.NatType
 	}
-	return 0
+	return ""
 }
 
-func (x *SystemMonitorMemory) GetTotal() int64 {
+func (x *NatInfo) GetPublicIpv4() string {
 	if x != nil {
-		return x.Total
+		return x.PublicIpv4
+	}
+	return ""
+}
+
+func (x *NatInfo) GetPublicIpv6() []string {
+	if x != nil {
+		return x.PublicIpv6
+	}
+	return nil
+}
+
+func (x *NatInfo) GetLocalIpv4() string {
+	if x != nil {
+		return x.LocalIpv4
+	}
+	return ""
+}
+
+func (x *NatInfo) GetDetectedAt() int64 {
+	if x != nil {
+		return x.DetectedAt
 	}
 	return 0
 }
 
-func (x *SystemMonitorMemory) GetAvailable() int64 {
+func (x *NatInfo) GetChangedAt() int64 {
 	if x != nil {
-		return x.Available
+		return x.ChangedAt
 	}
 	return 0
 }
 
-// 系统监控磁盘信息
-type SystemMonitorDisk struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Used          int64                  `protobuf:"varint,1,opt,name=used,proto3" json:"used,omitempty"`
-	Total         int64                  `protobuf:"varint,2,opt,name=total,proto3" json:"total,omitempty"`
-	Free          int64                  `protobuf:"varint,3,opt,name=free,proto3" json:"free,omitempty"`
+func (x *NatInfo) GetErrMsg() string {
+	if x != nil {
+		return x.ErrMsg
+	}
+	return ""
+}
+
+// 硬件和系统清单，连上服务器时和有变化时上报
+type Inventory struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Sn               string                 `protobuf:"bytes,1,opt,name=sn,proto3" json:"sn,omitempty"`
+	Hostname         string                 `protobuf:"bytes,2,opt,name=hostname,proto3" json:"hostname,omitempty"`
+	Os               string                 `protobuf:"bytes,3,opt,name=os,proto3" json:"os,omitempty"`             // linux
+	Platform         string                 `protobuf:"bytes,4,opt,name=platform,proto3" json:"platform,omitempty"` // ubuntu/openwrt等
+	PlatformVersion  string                 `protobuf:"bytes,5,opt,name=platform_version,json=platformVersion,proto3" json:"platform_version,omitempty"`
+	KernelVersion    string                 `protobuf:"bytes,6,opt,name=kernel_version,json=kernelVersion,proto3" json:"kernel_version,omitempty"`
+	Arch             string                 `protobuf:"bytes,7,opt,name=arch,proto3" json:"arch,omitempty"` // x86_64/aarch64等
+	CpuModel         string                 `protobuf:"bytes,8,opt,name=cpu_model,json=cpuModel,proto3" json:"cpu_model,omitempty"`
+	CpuCores         uint32                 `protobuf:"varint,9,opt,name=cpu_cores,json=cpuCores,proto3" json:"cpu_cores,omitempty"` // 逻辑核数
+	CpuPhysicalCores uint32                 `protobuf:"varint,10,opt,name=cpu_physical_cores,json=cpuPhysicalCores,proto3" json:"cpu_physical_cores,omitempty"`
+	MemoryTotal      uint64                 `protobuf:"varint,11,opt,name=memory_total,json=memoryTotal,proto3" json:"memory_total,omitempty"` // 字节
+	Disks            []*InventoryDisk       `protobuf:"bytes,12,rep,name=disks,proto3" json:"disks,omitempty"`
+	Nics             []*InventoryNic        `protobuf:"bytes,13,rep,name=nics,proto3" json:"nics,omitempty"`
+	// DMI信息，读不到时为空
+	SysVendor     string `protobuf:"bytes,14,opt,name=sys_vendor,json=sysVendor,proto3" json:"sys_vendor,omitempty"`
+	ProductName   string `protobuf:"bytes,15,opt,name=product_name,json=productName,proto3" json:"product_name,omitempty"`
+	ProductSerial string `protobuf:"bytes,16,opt,name=product_serial,json=productSerial,proto3" json:"product_serial,omitempty"`
+	BiosVersion   string `protobuf:"bytes,17,opt,name=bios_version,json=biosVersion,proto3" json:"bios_version,omitempty"`
+	Hash          string `protobuf:"bytes,18,opt,name=hash,proto3" json:"hash,omitempty"` // 除timestamp外所有字段的摘要
+	Timestamp     int64  `protobuf:"varint,19,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *SystemMonitorDisk) Reset() {
-	*x = SystemMonitorDisk{}
-	mi := &file_tcp_proto_msgTypes[6]
+func (x *Inventory) Reset() {
+	*x = Inventory{}
+	mi := &file_tcp_proto_msgTypes[26]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *SystemMonitorDisk) String() string {
+func (x *Inventory) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*SystemMonitorDisk) ProtoMessage() {}
+func (*Inventory) ProtoMessage() {}
 
-func (x *SystemMonitorDisk) ProtoReflect() protoreflect.Message {
-	mi := &file_tcp_proto_msgTypes[6]
+func (x *Inventory) ProtoReflect() protoreflect.Message {
+	mi := &file_tcp_proto_msgTypes[26]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -663,192 +3008,246 @@ func (x *SystemMonitorDisk) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use SystemMonitorDisk.ProtoReflect.Descriptor instead.
-func (*SystemMonitorDisk) Descriptor() ([]byte, []int) {
-	return file_tcp_proto_rawDescGZIP(), []int{6}
+// Deprecated: Use Inventory.ProtoReflect.Descriptor instead.
+func (*Inventory) Descriptor() ([]byte, []int) {
+	return file_tcp_proto_rawDescGZIP(), []int{26}
 }
 
-func (x *SystemMonitorDisk) GetUsed() int64 {
+func (x *Inventory) GetSn() string {
 	if x != nil {
-		return x.Used
+		return x.Sn
 	}
-	return 0
+	return ""
 }
 
-func (x *SystemMonitorDisk) GetTotal() int64 {
+func (x *Inventory) GetHostname() string {
 	if x != nil {
-		return x.Total
+		return x.Hostname
 	}
-	return 0
+	return ""
 }
 
-func (x *SystemMonitorDisk) GetFree() int64 {
+func (x *Inventory) GetOs() string {
 	if x != nil {
-		return x.Free
+		return x.Os
 	}
-	return 0
-}
-
-// 系统监控网络信息
-type SystemMonitorNetwork struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`                                   // 网络接口名称
-	BytesSent     uint64                 `protobuf:"varint,2,opt,name=bytes_sent,json=bytesSent,proto3" json:"bytes_sent,omitempty"`       // 发送的字节数
-	BytesRecv     uint64                 `protobuf:"varint,3,opt,name=bytes_recv,json=bytesRecv,proto3" json:"bytes_recv,omitempty"`       // 接收的字节数
-	PacketsSent   uint64                 `protobuf:"varint,4,opt,name=packets_sent,json=packetsSent,proto3" json:"packets_sent,omitempty"` // 发送的数据包数
-	PacketsRecv   uint64                 `protobuf:"varint,5,opt,name=packets_recv,json=packetsRecv,proto3" json:"packets_recv,omitempty"` // 接收的数据包数
-	Errin         uint64                 `protobuf:"varint,6,opt,name=errin,proto3" json:"errin,omitempty"`                                // 接收错误数
-	Errout        uint64                 `protobuf:"varint,7,opt,name=errout,proto3" json:"errout,omitempty"`                              // 发送错误数
-	Dropin        uint64                 `protobuf:"varint,8,opt,name=dropin,proto3" json:"dropin,omitempty"`                              // 接收丢包数
-	Dropout       uint64                 `protobuf:"varint,9,opt,name=dropout,proto3" json:"dropout,omitempty"`                            // 发送丢包数
-	Timestamp     int64                  `protobuf:"varint,10,opt,name=timestamp,proto3" json:"timestamp,omitempty"`                       // 采样时间
-	SendRate      float64                `protobuf:"fixed64,11,opt,name=send_rate,json=sendRate,proto3" json:"send_rate,omitempty"`        // 发送速率 (bytes/s)
-	RecvRate      float64                `protobuf:"fixed64,12,opt,name=recv_rate,json=recvRate,proto3" json:"recv_rate,omitempty"`        // 接收速率 (bytes/s)
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	return ""
 }
 
-func (x *SystemMonitorNetwork) Reset() {
-	*x = SystemMonitorNetwork{}
-	mi := &file_tcp_proto_msgTypes[7]
-	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-	ms.StoreMessageInfo(mi)
+func (x *Inventory) GetPlatform() string {
+	if x != nil {
+		return x.Platform
+	}
+	return ""
 }
 
-func (x *SystemMonitorNetwork) String() string {
-	return protoimpl.X.MessageStringOf(x)
+func (x *Inventory) GetPlatformVersion() string {
+	if x != nil {
+		return x.PlatformVersion
+	}
+	return ""
 }
 
-func (*SystemMonitorNetwork) ProtoMessage() {}
-
-func (x *SystemMonitorNetwork) ProtoReflect() protoreflect.Message {
-	mi := &file_tcp_proto_msgTypes[7]
+func (x *Inventory) GetKernelVersion() string {
 	if x != nil {
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		if ms.LoadMessageInfo() == nil {
-			ms.StoreMessageInfo(mi)
-		}
-		return ms
+		return x.KernelVersion
 	}
-	return mi.MessageOf(x)
+	return ""
 }
 
-// Deprecated: Use SystemMonitorNetwork.ProtoReflect.Descriptor instead.
-func (*SystemMonitorNetwork) Descriptor() ([]byte, []int) {
-	return file_tcp_proto_rawDescGZIP(), []int{7}
+func (x *Inventory) GetArch() string {
+	if x != nil {
+		return x.Arch
+	}
+	return ""
 }
 
-func (x *SystemMonitorNetwork) GetName() string {
+func (x *Inventory) GetCpuModel() string {
 	if x != nil {
-		return x.Name
+		return x.CpuModel
 	}
 	return ""
 }
 
-func (x *SystemMonitorNetwork) GetBytesSent() uint64 {
+func (x *Inventory) GetCpuCores() uint32 {
 	if x != nil {
-		return x.BytesSent
+		return x.CpuCores
 	}
 	return 0
 }
 
-func (x *SystemMonitorNetwork) GetBytesRecv() uint64 {
+func (x *Inventory) GetCpuPhysicalCores() uint32 {
 	if x != nil {
-		return x.BytesRecv
+		return x.CpuPhysicalCores
 	}
 	return 0
 }
 
-func (x *SystemMonitorNetwork) GetPacketsSent() uint64 {
+func (x *Inventory) GetMemoryTotal() uint64 {
 	if x != nil {
-		return x.PacketsSent
+		return x.MemoryTotal
 	}
 	return 0
 }
 
-func (x *SystemMonitorNetwork) GetPacketsRecv() uint64 {
+func (x *Inventory) GetDisks() []*InventoryDisk {
 	if x != nil {
-		return x.PacketsRecv
+		return x.Disks
 	}
-	return 0
+	return nil
 }
 
-func (x *SystemMonitorNetwork) GetErrin() uint64 {
+func (x *Inventory) GetNics() []*InventoryNic {
 	if x != nil {
-		return x.Errin
+		return x.Nics
 	}
-	return 0
+	return nil
 }
 
-func (x *SystemMonitorNetwork) GetErrout() uint64 {
+func (x *Inventory) GetSysVendor() string {
 	if x != nil {
-		return x.Errout
+		return x.SysVendor
 	}
-	return 0
+	return ""
 }
 
-func (x *SystemMonitorNetwork) GetDropin() uint64 {
+func (x *Inventory) GetProductName() string {
 	if x != nil {
-		return x.Dropin
+		return x.ProductName
 	}
-	return 0
+	return ""
 }
 
-func (x *SystemMonitorNetwork) GetDropout() uint64 {
+func (x *Inventory) GetProductSerial() string {
 	if x != nil {
-		return x.Dropout
+		return x.ProductSerial
 	}
-	return 0
+	return ""
 }
 
-func (x *SystemMonitorNetwork) GetTimestamp() int64 {
+func (x *Inventory) GetBiosVersion() string {
+	if x != nil {
+		return x.BiosVersion
+	}
+	return ""
+}
+
+func (x *Inventory) GetHash() string {
+	if x != nil {
+		return x.Hash
+	}
+	return ""
+}
+
+func (x *Inventory) GetTimestamp() int64 {
 	if x != nil {
 		return x.Timestamp
 	}
 	return 0
 }
 
-func (x *SystemMonitorNetwork) GetSendRate() float64 {
+type InventoryDisk struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"` // sda/nvme0n1
+	Model         string                 `protobuf:"bytes,2,opt,name=model,proto3" json:"model,omitempty"`
+	Serial        string                 `protobuf:"bytes,3,opt,name=serial,proto3" json:"serial,omitempty"`
+	Size          uint64                 `protobuf:"varint,4,opt,name=size,proto3" json:"size,omitempty"`             // 字节
+	Rotational    bool                   `protobuf:"varint,5,opt,name=rotational,proto3" json:"rotational,omitempty"` // 机械盘
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InventoryDisk) Reset() {
+	*x = InventoryDisk{}
+	mi := &file_tcp_proto_msgTypes[27]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InventoryDisk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InventoryDisk) ProtoMessage() {}
+
+func (x *InventoryDisk) ProtoReflect() protoreflect.Message {
+	mi := &file_tcp_proto_msgTypes[27]
 	if x != nil {
-		return x.SendRate
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
 	}
-	return 0
+	return mi.MessageOf(x)
 }
 
-func (x *SystemMonitorNetwork) GetRecvRate() float64 {
+// Deprecated: Use InventoryDisk.ProtoReflect.Descriptor instead.
+func (*InventoryDisk) Descriptor() ([]byte, []int) {
+	return file_tcp_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *InventoryDisk) GetName() string {
 	if x != nil {
-		return x.RecvRate
+		return x.Name
+	}
+	return ""
+}
+
+func (x *InventoryDisk) GetModel() string {
+	if x != nil {
+		return x.Model
+	}
+	return ""
+}
+
+func (x *InventoryDisk) GetSerial() string {
+	if x != nil {
+		return x.Serial
+	}
+	return ""
+}
+
+func (x *InventoryDisk) GetSize() uint64 {
+	if x != nil {
+		return x.Size
 	}
 	return 0
 }
 
-// 获取设备系统监控数据
-type SystemMonitorData struct {
-	state         protoimpl.MessageState  `protogen:"open.v1"`
-	Cpu           *SystemMonitorCpu       `protobuf:"bytes,1,opt,name=cpu,proto3" json:"cpu,omitempty"`
-	Memory        *SystemMonitorMemory    `protobuf:"bytes,2,opt,name=memory,proto3" json:"memory,omitempty"`
-	Disk          *SystemMonitorDisk      `protobuf:"bytes,3,opt,name=disk,proto3" json:"disk,omitempty"`
-	Network       []*SystemMonitorNetwork `protobuf:"bytes,4,rep,name=network,proto3" json:"network,omitempty"`
-	Processes     []*SystemMonitorProcess `protobuf:"bytes,5,rep,name=processes,proto3" json:"processes,omitempty"`
+func (x *InventoryDisk) GetRotational() bool {
+	if x != nil {
+		return x.Rotational
+	}
+	return false
+}
+
+type InventoryNic struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Mac           string                 `protobuf:"bytes,2,opt,name=mac,proto3" json:"mac,omitempty"`
+	Speed         int32                  `protobuf:"varint,3,opt,name=speed,proto3" json:"speed,omitempty"` // Mbps，没连线时为-1
+	Driver        string                 `protobuf:"bytes,4,opt,name=driver,proto3" json:"driver,omitempty"`
+	Mtu           uint32                 `protobuf:"varint,5,opt,name=mtu,proto3" json:"mtu,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *SystemMonitorData) Reset() {
-	*x = SystemMonitorData{}
-	mi := &file_tcp_proto_msgTypes[8]
+func (x *InventoryNic) Reset() {
+	*x = InventoryNic{}
+	mi := &file_tcp_proto_msgTypes[28]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *SystemMonitorData) String() string {
+func (x *InventoryNic) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*SystemMonitorData) ProtoMessage() {}
+func (*InventoryNic) ProtoMessage() {}
 
-func (x *SystemMonitorData) ProtoReflect() protoreflect.Message {
-	mi := &file_tcp_proto_msgTypes[8]
+func (x *InventoryNic) ProtoReflect() protoreflect.Message {
+	mi := &file_tcp_proto_msgTypes[28]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -859,44 +3258,44 @@ func (x *SystemMonitorData) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use SystemMonitorData.ProtoReflect.Descriptor instead.
-func (*SystemMonitorData) Descriptor() ([]byte, []int) {
-	return file_tcp_proto_rawDescGZIP(), []int{8}
+// Deprecated: Use InventoryNic.ProtoReflect.Descriptor instead.
+func (*InventoryNic) Descriptor() ([]byte, []int) {
+	return file_tcp_proto_rawDescGZIP(), []int{28}
 }
 
-func (x *SystemMonitorData) GetCpu() *SystemMonitorCpu {
+func (x *InventoryNic) GetName() string {
 	if x != nil {
-		return x.Cpu
+		return x.Name
 	}
-	return nil
+	return ""
 }
 
-func (x *SystemMonitorData) GetMemory() *SystemMonitorMemory {
+func (x *InventoryNic) GetMac() string {
 	if x != nil {
-		return x.Memory
+		return x.Mac
 	}
-	return nil
+	return ""
 }
 
-func (x *SystemMonitorData) GetDisk() *SystemMonitorDisk {
+func (x *InventoryNic) GetSpeed() int32 {
 	if x != nil {
-		return x.Disk
+		return x.Speed
 	}
-	return nil
+	return 0
 }
 
-func (x *SystemMonitorData) GetNetwork() []*SystemMonitorNetwork {
+func (x *InventoryNic) GetDriver() string {
 	if x != nil {
-		return x.Network
+		return x.Driver
 	}
-	return nil
+	return ""
 }
 
-func (x *SystemMonitorData) GetProcesses() []*SystemMonitorProcess {
+func (x *InventoryNic) GetMtu() uint32 {
 	if x != nil {
-		return x.Processes
+		return x.Mtu
 	}
-	return nil
+	return 0
 }
 
 // HTTP代理请求
@@ -915,7 +3314,7 @@ type HttpProxyRequest struct {
 
 func (x *HttpProxyRequest) Reset() {
 	*x = HttpProxyRequest{}
-	mi := &file_tcp_proto_msgTypes[9]
+	mi := &file_tcp_proto_msgTypes[29]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -927,7 +3326,7 @@ func (x *HttpProxyRequest) String() string {
 func (*HttpProxyRequest) ProtoMessage() {}
 
 func (x *HttpProxyRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_tcp_proto_msgTypes[9]
+	mi := &file_tcp_proto_msgTypes[29]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -940,7 +3339,7 @@ func (x *HttpProxyRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use HttpProxyRequest.ProtoReflect.Descriptor instead.
 func (*HttpProxyRequest) Descriptor() ([]byte, []int) {
-	return file_tcp_proto_rawDescGZIP(), []int{9}
+	return file_tcp_proto_rawDescGZIP(), []int{29}
 }
 
 func (x *HttpProxyRequest) GetSessionId() string {
@@ -1006,7 +3405,7 @@ type HttpProxyResponse struct {
 
 func (x *HttpProxyResponse) Reset() {
 	*x = HttpProxyResponse{}
-	mi := &file_tcp_proto_msgTypes[10]
+	mi := &file_tcp_proto_msgTypes[30]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1018,7 +3417,7 @@ func (x *HttpProxyResponse) String() string {
 func (*HttpProxyResponse) ProtoMessage() {}
 
 func (x *HttpProxyResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_tcp_proto_msgTypes[10]
+	mi := &file_tcp_proto_msgTypes[30]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1031,7 +3430,7 @@ func (x *HttpProxyResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use HttpProxyResponse.ProtoReflect.Descriptor instead.
 func (*HttpProxyResponse) Descriptor() ([]byte, []int) {
-	return file_tcp_proto_rawDescGZIP(), []int{10}
+	return file_tcp_proto_rawDescGZIP(), []int{30}
 }
 
 func (x *HttpProxyResponse) GetSessionId() string {
@@ -1073,19 +3472,30 @@ var File_tcp_proto protoreflect.FileDescriptor
 
 const file_tcp_proto_rawDesc = "" +
 	"\n" +
-	"\ttcp.proto\x12\x06protos\"\x80\x01\n" +
+	"\ttcp.proto\x12\x06protos\"\x9a\x02\n" +
 	"\tHeartbeat\x12\x0e\n" +
 	"\x02sn\x18\x01 \x01(\tR\x02sn\x12\x10\n" +
 	"\x03ver\x18\x02 \x01(\tR\x03ver\x12\x1c\n" +
 	"\ttimestamp\x18\x03 \x01(\x03R\ttimestamp\x123\n" +
-	"\amonitor\x18\x04 \x01(\v2\x19.protos.SystemMonitorDataR\amonitor\"\x95\x01\n" +
+	"\amonitor\x18\x04 \x01(\v2\x19.protos.SystemMonitorDataR\amonitor\x12+\n" +
+	"\x06probes\x18\x05 \x03(\v2\x13.protos.ProbeResultR\x06probes\x12#\n" +
+	"\rprobe_version\x18\x06 \x01(\tR\fprobeVersion\x12!\n" +
+	"\x03nat\x18\a \x01(\v2\x0f.protos.NatInfoR\x03nat\x12#\n" +
+	"\rack_timestamp\x18\b \x01(\x03R\fackTimestamp\"\x8d\x01\n" +
+	"\x06Enroll\x12\x0e\n" +
+	"\x02sn\x18\x01 \x01(\tR\x02sn\x12\x10\n" +
+	"\x03ver\x18\x02 \x01(\tR\x03ver\x12\x1d\n" +
+	"\n" +
+	"claim_code\x18\x03 \x01(\tR\tclaimCode\x12\x14\n" +
+	"\x05token\x18\x04 \x01(\tR\x05token\x12,\n" +
+	"\x06status\x18\x05 \x01(\x0e2\x14.protos.EnrollStatusR\x06status\"\x95\x01\n" +
 	"\vDeviceAgent\x12\x0e\n" +
 	"\x02sn\x18\x01 \x01(\tR\x02sn\x12\x10\n" +
 	"\x03ver\x18\x02 \x01(\tR\x03ver\x12\x1f\n" +
 	"\vremote_addr\x18\x03 \x01(\tR\n" +
 	"remoteAddr\x12\x1c\n" +
 	"\ttimestamp\x18\x04 \x01(\x03R\ttimestamp\x12%\n" +
-	"\x0elast_heartbear\x18\x05 \x01(\x03R\rlastHeartbear\"\xa7\x03\n" +
+	"\x0elast_heartbear\x18\x05 \x01(\x03R\rlastHeartbear\"\xbb\x06\n" +
 	"\x04Task\x12\x17\n" +
 	"\atask_id\x18\x01 \x01(\tR\x06taskId\x12-\n" +
 	"\ttask_type\x18\x02 \x01(\x0e2\x10.protos.TaskTypeR\btaskType\x12\x1c\n" +
@@ -1101,33 +3511,160 @@ const file_tcp_proto_rawDesc = "" +
 	"\ttarget_ip\x18\n" +
 	" \x01(\tH\x04R\btargetIp\x88\x01\x01\x12\x17\n" +
 	"\aerr_msg\x18\v \x01(\tR\x06errMsg\x12\x15\n" +
-	"\x03url\x18\f \x01(\tH\x05R\x03url\x88\x01\x01B\v\n" +
+	"\x03url\x18\f \x01(\tH\x05R\x03url\x88\x01\x01\x12-\n" +
+	"\ttc_policy\x18\r \x01(\v2\x10.protos.TcPolicyR\btcPolicy\x12.\n" +
+	"\btc_stats\x18\x0e \x03(\v2\x13.protos.TcClassStatR\atcStats\x129\n" +
+	"\x0etc_qdisc_stats\x18\x0f \x03(\v2\x13.protos.TcQdiscStatR\ftcQdiscStats\x12*\n" +
+	"\x11tc_verify_seconds\x18\x10 \x01(\rR\x0ftcVerifySeconds\x123\n" +
+	"\ttc_verify\x18\x11 \x01(\v2\x16.protos.TcVerifyResultR\btcVerify\x129\n" +
+	"\vtc_adaptive\x18\x12 \x01(\v2\x18.protos.TcAdaptiveConfigR\n" +
+	"tcAdaptive\x126\n" +
+	"\fprobe_config\x18\x13 \x01(\v2\x13.protos.ProbeConfigR\vprobeConfig\x12$\n" +
+	"\x0etc_program_err\x18\x14 \x01(\tR\ftcProgramErrB\v\n" +
 	"\t_usernameB\x06\n" +
 	"\x04_pwdB\r\n" +
 	"\v_iface_nameB\a\n" +
 	"\x05_rateB\f\n" +
 	"\n" +
 	"_target_ipB\x06\n" +
-	"\x04_url\"\x90\x01\n" +
+	"\x04_url\"\xe6\x01\n" +
+	"\x06TcRule\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05cidrs\x18\x02 \x03(\tR\x05cidrs\x12\x14\n" +
+	"\x05ports\x18\x03 \x03(\rR\x05ports\x12\x1a\n" +
+	"\bprotocol\x18\x04 \x01(\tR\bprotocol\x12\x12\n" +
+	"\x04rate\x18\x05 \x01(\tR\x04rate\x12\x12\n" +
+	"\x04ceil\x18\x06 \x01(\tR\x04ceil\x12\x12\n" +
+	"\x04prio\x18\a \x01(\rR\x04prio\x12\x18\n" +
+	"\aprocess\x18\b \x01(\tR\aprocess\x12\x12\n" +
+	"\x04unit\x18\t \x01(\tR\x04unit\x12\x16\n" +
+	"\x06cgroup\x18\n" +
+	" \x01(\tR\x06cgroup\"_\n" +
+	"\bTcPolicy\x12\x12\n" +
+	"\x04rate\x18\x01 \x01(\tR\x04rate\x12$\n" +
+	"\x05rules\x18\x02 \x03(\v2\x0e.protos.TcRuleR\x05rules\x12\x19\n" +
+	"\bcap_bits\x18\x03 \x01(\x04R\acapBits\"\x93\x03\n" +
+	"\vTcClassStat\x12\x19\n" +
+	"\bclass_id\x18\x01 \x01(\tR\aclassId\x12\x1b\n" +
+	"\trule_name\x18\x02 \x01(\tR\bruleName\x12\x12\n" +
+	"\x04rate\x18\x03 \x01(\tR\x04rate\x12\x12\n" +
+	"\x04ceil\x18\x04 \x01(\tR\x04ceil\x12\x14\n" +
+	"\x05bytes\x18\x05 \x01(\x04R\x05bytes\x12\x18\n" +
+	"\apackets\x18\x06 \x01(\x04R\apackets\x12\x14\n" +
+	"\x05drops\x18\a \x01(\x04R\x05drops\x12\x1e\n" +
+	"\n" +
+	"overlimits\x18\b \x01(\x04R\n" +
+	"overlimits\x12\x16\n" +
+	"\x06parent\x18\t \x01(\tR\x06parent\x12\x1b\n" +
+	"\trate_bits\x18\n" +
+	" \x01(\x04R\brateBits\x12\x1b\n" +
+	"\tceil_bits\x18\v \x01(\x04R\bceilBits\x12#\n" +
+	"\rbacklog_bytes\x18\f \x01(\x04R\fbacklogBytes\x12'\n" +
+	"\x0fbacklog_packets\x18\r \x01(\x04R\x0ebacklogPackets\x12\x1e\n" +
+	"\n" +
+	"throughput\x18\x0e \x01(\x01R\n" +
+	"throughput\"\xa5\x02\n" +
+	"\vTcQdiscStat\x12\x16\n" +
+	"\x06handle\x18\x01 \x01(\tR\x06handle\x12\x12\n" +
+	"\x04kind\x18\x02 \x01(\tR\x04kind\x12\x16\n" +
+	"\x06parent\x18\x03 \x01(\tR\x06parent\x12\x14\n" +
+	"\x05bytes\x18\x04 \x01(\x04R\x05bytes\x12\x18\n" +
+	"\apackets\x18\x05 \x01(\x04R\apackets\x12\x14\n" +
+	"\x05drops\x18\x06 \x01(\x04R\x05drops\x12\x1e\n" +
+	"\n" +
+	"overlimits\x18\a \x01(\x04R\n" +
+	"overlimits\x12#\n" +
+	"\rbacklog_bytes\x18\b \x01(\x04R\fbacklogBytes\x12'\n" +
+	"\x0fbacklog_packets\x18\t \x01(\x04R\x0ebacklogPackets\x12\x1e\n" +
+	"\n" +
+	"throughput\x18\n" +
+	" \x01(\x01R\n" +
+	"throughput\"q\n" +
+	"\x0eTcVerifyResult\x12\x16\n" +
+	"\x06passed\x18\x01 \x01(\bR\x06passed\x12\x18\n" +
+	"\aseconds\x18\x02 \x01(\rR\aseconds\x12-\n" +
+	"\x06ifaces\x18\x03 \x03(\v2\x15.protos.TcVerifyIfaceR\x06ifaces\"\xa7\x01\n" +
+	"\rTcVerifyIface\x12\x1d\n" +
+	"\n" +
+	"iface_name\x18\x01 \x01(\tR\tifaceName\x12\x16\n" +
+	"\x06passed\x18\x02 \x01(\bR\x06passed\x12\x17\n" +
+	"\atx_bits\x18\x03 \x01(\x01R\x06txBits\x12-\n" +
+	"\aclasses\x18\x04 \x03(\v2\x13.protos.TcClassStatR\aclasses\x12\x17\n" +
+	"\aerr_msg\x18\x05 \x01(\tR\x06errMsg\"\xc3\x01\n" +
+	"\x10TcAdaptiveConfig\x12\x18\n" +
+	"\aenabled\x18\x01 \x01(\bR\aenabled\x12\x1d\n" +
+	"\n" +
+	"iface_name\x18\x02 \x01(\tR\tifaceName\x12\x1f\n" +
+	"\vtarget_bits\x18\x03 \x01(\x04R\n" +
+	"targetBits\x12\x19\n" +
+	"\bmin_bits\x18\x04 \x01(\x04R\aminBits\x12\x19\n" +
+	"\bmax_bits\x18\x05 \x01(\x04R\amaxBits\x12\x1f\n" +
+	"\vbilling_day\x18\x06 \x01(\rR\n" +
+	"billingDay\"\xbf\x02\n" +
+	"\rTcAdjustEvent\x12\x0e\n" +
+	"\x02sn\x18\x01 \x01(\tR\x02sn\x12\x1d\n" +
+	"\n" +
+	"iface_name\x18\x02 \x01(\tR\tifaceName\x12\x19\n" +
+	"\bold_bits\x18\x03 \x01(\x04R\aoldBits\x12\x19\n" +
+	"\bnew_bits\x18\x04 \x01(\x04R\anewBits\x12\x19\n" +
+	"\bp95_bits\x18\x05 \x01(\x01R\ap95Bits\x12\x1f\n" +
+	"\vtarget_bits\x18\x06 \x01(\x04R\n" +
+	"targetBits\x12\x1d\n" +
+	"\n" +
+	"burst_used\x18\a \x01(\rR\tburstUsed\x12\x1f\n" +
+	"\vburst_total\x18\b \x01(\rR\n" +
+	"burstTotal\x12\x16\n" +
+	"\x06reason\x18\t \x01(\tR\x06reason\x12\x17\n" +
+	"\aerr_msg\x18\n" +
+	" \x01(\tR\x06errMsg\x12\x1c\n" +
+	"\ttimestamp\x18\v \x01(\x03R\ttimestamp\"\xa8\x01\n" +
+	"\fTcDriftEvent\x12\x0e\n" +
+	"\x02sn\x18\x01 \x01(\tR\x02sn\x12\x1d\n" +
+	"\n" +
+	"iface_name\x18\x02 \x01(\tR\tifaceName\x12\x16\n" +
+	"\x06reason\x18\x03 \x01(\tR\x06reason\x12\x1a\n" +
+	"\brepaired\x18\x04 \x01(\bR\brepaired\x12\x17\n" +
+	"\aerr_msg\x18\x05 \x01(\tR\x06errMsg\x12\x1c\n" +
+	"\ttimestamp\x18\x06 \x01(\x03R\ttimestamp\"\xd8\x02\n" +
 	"\x14SystemMonitorProcess\x12\x10\n" +
 	"\x03pid\x18\x01 \x01(\x05R\x03pid\x12\x12\n" +
 	"\x04name\x18\x02 \x01(\tR\x04name\x12\x10\n" +
 	"\x03exe\x18\x03 \x01(\tR\x03exe\x12\x10\n" +
 	"\x03cpu\x18\x04 \x01(\x02R\x03cpu\x12\x16\n" +
 	"\x06memory\x18\x05 \x01(\x02R\x06memory\x12\x16\n" +
-	"\x06status\x18\x06 \x01(\tR\x06status\"`\n" +
+	"\x06status\x18\x06 \x01(\tR\x06status\x12\x18\n" +
+	"\aprogram\x18\a \x01(\tR\aprogram\x12\x10\n" +
+	"\x03rss\x18\b \x01(\x04R\x03rss\x12\x1f\n" +
+	"\vcreate_time\x18\t \x01(\x03R\n" +
+	"createTime\x12\x1a\n" +
+	"\busername\x18\n" +
+	" \x01(\tR\busername\x12 \n" +
+	"\vestablished\x18\v \x01(\rR\vestablished\x12!\n" +
+	"\flisten_ports\x18\f \x03(\tR\vlistenPorts\x12\x18\n" +
+	"\asockets\x18\r \x01(\rR\asockets\"\xa4\x01\n" +
 	"\x10SystemMonitorCpu\x12\x14\n" +
 	"\x05usage\x18\x01 \x01(\x02R\x05usage\x12\x14\n" +
 	"\x05cores\x18\x02 \x01(\x05R\x05cores\x12 \n" +
-	"\vtemperature\x18\x03 \x01(\x02R\vtemperature\"]\n" +
+	"\vtemperature\x18\x03 \x01(\x02R\vtemperature\x12\x14\n" +
+	"\x05load1\x18\x04 \x01(\x02R\x05load1\x12\x14\n" +
+	"\x05load5\x18\x05 \x01(\x02R\x05load5\x12\x16\n" +
+	"\x06load15\x18\x06 \x01(\x02R\x06load15\"\xbc\x01\n" +
 	"\x13SystemMonitorMemory\x12\x12\n" +
 	"\x04used\x18\x01 \x01(\x03R\x04used\x12\x14\n" +
 	"\x05total\x18\x02 \x01(\x03R\x05total\x12\x1c\n" +
-	"\tavailable\x18\x03 \x01(\x03R\tavailable\"Q\n" +
+	"\tavailable\x18\x03 \x01(\x03R\tavailable\x12!\n" +
+	"\fused_percent\x18\x04 \x01(\x02R\vusedPercent\x12\x1b\n" +
+	"\tswap_used\x18\x05 \x01(\x03R\bswapUsed\x12\x1d\n" +
+	"\n" +
+	"swap_total\x18\x06 \x01(\x03R\tswapTotal\"\xba\x01\n" +
 	"\x11SystemMonitorDisk\x12\x12\n" +
 	"\x04used\x18\x01 \x01(\x03R\x04used\x12\x14\n" +
 	"\x05total\x18\x02 \x01(\x03R\x05total\x12\x12\n" +
-	"\x04free\x18\x03 \x01(\x03R\x04free\"\xe6\x02\n" +
+	"\x04free\x18\x03 \x01(\x03R\x04free\x12\x14\n" +
+	"\x05mount\x18\x04 \x01(\tR\x05mount\x12\x16\n" +
+	"\x06device\x18\x05 \x01(\tR\x06device\x12\x16\n" +
+	"\x06fstype\x18\x06 \x01(\tR\x06fstype\x12!\n" +
+	"\fused_percent\x18\a \x01(\x02R\vusedPercent\"\xc6\x04\n" +
 	"\x14SystemMonitorNetwork\x12\x12\n" +
 	"\x04name\x18\x01 \x01(\tR\x04name\x12\x1d\n" +
 	"\n" +
@@ -1143,13 +3680,146 @@ const file_tcp_proto_rawDesc = "" +
 	"\ttimestamp\x18\n" +
 	" \x01(\x03R\ttimestamp\x12\x1b\n" +
 	"\tsend_rate\x18\v \x01(\x01R\bsendRate\x12\x1b\n" +
-	"\trecv_rate\x18\f \x01(\x01R\brecvRate\"\x97\x02\n" +
+	"\trecv_rate\x18\f \x01(\x01R\brecvRate\x12\x1d\n" +
+	"\n" +
+	"delta_sent\x18\r \x01(\x04R\tdeltaSent\x12\x1d\n" +
+	"\n" +
+	"delta_recv\x18\x0e \x01(\x04R\tdeltaRecv\x12,\n" +
+	"\x12delta_packets_sent\x18\x0f \x01(\x04R\x10deltaPacketsSent\x12,\n" +
+	"\x12delta_packets_recv\x18\x10 \x01(\x04R\x10deltaPacketsRecv\x12\x1f\n" +
+	"\vdelta_start\x18\x11 \x01(\x03R\n" +
+	"deltaStart\x12#\n" +
+	"\rcounter_reset\x18\x12 \x01(\bR\fcounterReset\"\xcb\x04\n" +
 	"\x11SystemMonitorData\x12*\n" +
 	"\x03cpu\x18\x01 \x01(\v2\x18.protos.SystemMonitorCpuR\x03cpu\x123\n" +
 	"\x06memory\x18\x02 \x01(\v2\x1b.protos.SystemMonitorMemoryR\x06memory\x12-\n" +
 	"\x04disk\x18\x03 \x01(\v2\x19.protos.SystemMonitorDiskR\x04disk\x126\n" +
 	"\anetwork\x18\x04 \x03(\v2\x1c.protos.SystemMonitorNetworkR\anetwork\x12:\n" +
-	"\tprocesses\x18\x05 \x03(\v2\x1c.protos.SystemMonitorProcessR\tprocesses\"\xa4\x02\n" +
+	"\tprocesses\x18\x05 \x03(\v2\x1c.protos.SystemMonitorProcessR\tprocesses\x128\n" +
+	"\bprograms\x18\x06 \x03(\v2\x1c.protos.SystemMonitorProgramR\bprograms\x12/\n" +
+	"\x05disks\x18\a \x03(\v2\x19.protos.SystemMonitorDiskR\x05disks\x12\x16\n" +
+	"\x06uptime\x18\b \x01(\x04R\x06uptime\x12\x1b\n" +
+	"\tboot_time\x18\t \x01(\x03R\bbootTime\x12#\n" +
+	"\rprocess_count\x18\n" +
+	" \x01(\rR\fprocessCount\x12>\n" +
+	"\n" +
+	"containers\x18\v \x03(\v2\x1e.protos.SystemMonitorContainerR\n" +
+	"containers\x12-\n" +
+	"\x04conn\x18\f \x01(\v2\x19.protos.SystemMonitorConnR\x04conn\"\x89\x02\n" +
+	"\x11SystemMonitorConn\x12'\n" +
+	"\x0fconntrack_count\x18\x01 \x01(\rR\x0econntrackCount\x12#\n" +
+	"\rconntrack_max\x18\x02 \x01(\rR\fconntrackMax\x12G\n" +
+	"\n" +
+	"tcp_states\x18\x03 \x03(\v2(.protos.SystemMonitorConn.TcpStatesEntryR\ttcpStates\x12\x1f\n" +
+	"\vudp_sockets\x18\x04 \x01(\rR\n" +
+	"udpSockets\x1a<\n" +
+	"\x0eTcpStatesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\rR\x05value:\x028\x01\"\xba\x03\n" +
+	"\x16SystemMonitorContainer\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x14\n" +
+	"\x05image\x18\x03 \x01(\tR\x05image\x12\x14\n" +
+	"\x05state\x18\x04 \x01(\tR\x05state\x12\x16\n" +
+	"\x06status\x18\x05 \x01(\tR\x06status\x12#\n" +
+	"\rrestart_count\x18\x06 \x01(\rR\frestartCount\x12\x10\n" +
+	"\x03cpu\x18\a \x01(\x02R\x03cpu\x12!\n" +
+	"\fmemory_usage\x18\b \x01(\x04R\vmemoryUsage\x12!\n" +
+	"\fmemory_limit\x18\t \x01(\x04R\vmemoryLimit\x12 \n" +
+	"\fnet_rx_bytes\x18\n" +
+	" \x01(\x04R\n" +
+	"netRxBytes\x12 \n" +
+	"\fnet_tx_bytes\x18\v \x01(\x04R\n" +
+	"netTxBytes\x12\x1e\n" +
+	"\vnet_rx_rate\x18\f \x01(\x01R\tnetRxRate\x12\x1e\n" +
+	"\vnet_tx_rate\x18\r \x01(\x01R\tnetTxRate\x12\x18\n" +
+	"\acreated\x18\x0e \x01(\x03R\acreated\x12\x1d\n" +
+	"\n" +
+	"started_at\x18\x0f \x01(\x03R\tstartedAt\"\xaa\x01\n" +
+	"\x14SystemMonitorProgram\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x16\n" +
+	"\x06target\x18\x02 \x01(\tR\x06target\x12\x16\n" +
+	"\x06cgroup\x18\x03 \x01(\tR\x06cgroup\x12\x12\n" +
+	"\x04pids\x18\x04 \x03(\x05R\x04pids\x12\x1d\n" +
+	"\n" +
+	"bytes_sent\x18\x05 \x01(\x04R\tbytesSent\x12\x1b\n" +
+	"\tsend_rate\x18\x06 \x01(\x01R\bsendRate\"\xbd\x01\n" +
+	"\vProbeTarget\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x16\n" +
+	"\x06target\x18\x03 \x01(\tR\x06target\x12\x1a\n" +
+	"\binterval\x18\x04 \x01(\rR\binterval\x12\x14\n" +
+	"\x05count\x18\x05 \x01(\rR\x05count\x12\x1d\n" +
+	"\n" +
+	"timeout_ms\x18\x06 \x01(\rR\ttimeoutMs\x12\x1d\n" +
+	"\n" +
+	"dns_server\x18\a \x01(\tR\tdnsServer\"V\n" +
+	"\vProbeConfig\x12-\n" +
+	"\atargets\x18\x01 \x03(\v2\x13.protos.ProbeTargetR\atargets\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\tR\aversion\"\xb9\x02\n" +
+	"\vProbeResult\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x16\n" +
+	"\x06target\x18\x03 \x01(\tR\x06target\x12\x12\n" +
+	"\x04sent\x18\x04 \x01(\rR\x04sent\x12\x1a\n" +
+	"\breceived\x18\x05 \x01(\rR\breceived\x12!\n" +
+	"\floss_percent\x18\x06 \x01(\x01R\vlossPercent\x12\x15\n" +
+	"\x06avg_ms\x18\a \x01(\x01R\x05avgMs\x12\x15\n" +
+	"\x06min_ms\x18\b \x01(\x01R\x05minMs\x12\x15\n" +
+	"\x06max_ms\x18\t \x01(\x01R\x05maxMs\x12\x1b\n" +
+	"\tjitter_ms\x18\n" +
+	" \x01(\x01R\bjitterMs\x12\x17\n" +
+	"\aerr_msg\x18\v \x01(\tR\x06errMsg\x12\x1c\n" +
+	"\ttimestamp\x18\f \x01(\x03R\ttimestamp\"\xde\x01\n" +
+	"\aNatInfo\x12\x19\n" +
+	"\bnat_type\x18\x01 \x01(\tR\anatType\x12\x1f\n" +
+	"\vpublic_ipv4\x18\x02 \x01(\tR\n" +
+	"publicIpv4\x12\x1f\n" +
+	"\vpublic_ipv6\x18\x03 \x03(\tR\n" +
+	"publicIpv6\x12\x1d\n" +
+	"\n" +
+	"local_ipv4\x18\x04 \x01(\tR\tlocalIpv4\x12\x1f\n" +
+	"\vdetected_at\x18\x05 \x01(\x03R\n" +
+	"detectedAt\x12\x1d\n" +
+	"\n" +
+	"changed_at\x18\x06 \x01(\x03R\tchangedAt\x12\x17\n" +
+	"\aerr_msg\x18\a \x01(\tR\x06errMsg\"\xe9\x04\n" +
+	"\tInventory\x12\x0e\n" +
+	"\x02sn\x18\x01 \x01(\tR\x02sn\x12\x1a\n" +
+	"\bhostname\x18\x02 \x01(\tR\bhostname\x12\x0e\n" +
+	"\x02os\x18\x03 \x01(\tR\x02os\x12\x1a\n" +
+	"\bplatform\x18\x04 \x01(\tR\bplatform\x12)\n" +
+	"\x10platform_version\x18\x05 \x01(\tR\x0fplatformVersion\x12%\n" +
+	"\x0ekernel_version\x18\x06 \x01(\tR\rkernelVersion\x12\x12\n" +
+	"\x04arch\x18\a \x01(\tR\x04arch\x12\x1b\n" +
+	"\tcpu_model\x18\b \x01(\tR\bcpuModel\x12\x1b\n" +
+	"\tcpu_cores\x18\t \x01(\rR\bcpuCores\x12,\n" +
+	"\x12cpu_physical_cores\x18\n" +
+	" \x01(\rR\x10cpuPhysicalCores\x12!\n" +
+	"\fmemory_total\x18\v \x01(\x04R\vmemoryTotal\x12+\n" +
+	"\x05disks\x18\f \x03(\v2\x15.protos.InventoryDiskR\x05disks\x12(\n" +
+	"\x04nics\x18\r \x03(\v2\x14.protos.InventoryNicR\x04nics\x12\x1d\n" +
+	"\n" +
+	"sys_vendor\x18\x0e \x01(\tR\tsysVendor\x12!\n" +
+	"\fproduct_name\x18\x0f \x01(\tR\vproductName\x12%\n" +
+	"\x0eproduct_serial\x18\x10 \x01(\tR\rproductSerial\x12!\n" +
+	"\fbios_version\x18\x11 \x01(\tR\vbiosVersion\x12\x12\n" +
+	"\x04hash\x18\x12 \x01(\tR\x04hash\x12\x1c\n" +
+	"\ttimestamp\x18\x13 \x01(\x03R\ttimestamp\"\x85\x01\n" +
+	"\rInventoryDisk\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05model\x18\x02 \x01(\tR\x05model\x12\x16\n" +
+	"\x06serial\x18\x03 \x01(\tR\x06serial\x12\x12\n" +
+	"\x04size\x18\x04 \x01(\x04R\x04size\x12\x1e\n" +
+	"\n" +
+	"rotational\x18\x05 \x01(\bR\n" +
+	"rotational\"t\n" +
+	"\fInventoryNic\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x10\n" +
+	"\x03mac\x18\x02 \x01(\tR\x03mac\x12\x14\n" +
+	"\x05speed\x18\x03 \x01(\x05R\x05speed\x12\x16\n" +
+	"\x06driver\x18\x04 \x01(\tR\x06driver\x12\x10\n" +
+	"\x03mtu\x18\x05 \x01(\rR\x03mtu\"\xa4\x02\n" +
 	"\x10HttpProxyRequest\x12\x1d\n" +
 	"\n" +
 	"session_id\x18\x01 \x01(\tR\tsessionId\x12\x1b\n" +
@@ -1172,21 +3842,32 @@ const file_tcp_proto_rawDesc = "" +
 	"\x05error\x18\x05 \x01(\tR\x05error\x1a:\n" +
 	"\fHeadersEntry\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
-	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01*\x9c\x01\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01*\xf8\x01\n" +
 	"\aMsgType\x12\x14\n" +
 	"\x10MSG_TYPE_UNKNOWN\x10\x00\x12\x16\n" +
 	"\x12MSG_TYPE_HEARTBEAT\x10\x01\x12\x11\n" +
 	"\rMSG_TYPE_TASK\x10\x02\x12\x15\n" +
 	"\x11MSG_TYPE_TASKRESP\x10\x03\x12\x1b\n" +
 	"\x17MSG_TYPE_HTTP_PROXY_REQ\x10\x04\x12\x1c\n" +
-	"\x18MSG_TYPE_HTTP_PROXY_RESP\x10\x05*\x98\x01\n" +
+	"\x18MSG_TYPE_HTTP_PROXY_RESP\x10\x05\x12\x15\n" +
+	"\x11MSG_TYPE_TC_DRIFT\x10\x06\x12\x16\n" +
+	"\x12MSG_TYPE_TC_ADJUST\x10\a\x12\x16\n" +
+	"\x12MSG_TYPE_INVENTORY\x10\b\x12\x13\n" +
+	"\x0fMSG_TYPE_ENROLL\x10\t*\xcf\x01\n" +
 	"\bTaskType\x12\x15\n" +
 	"\x11TASK_TYPE_UNKNOWN\x10\x00\x12\x16\n" +
 	"\x12TASK_TYPE_RESETPWD\x10\x01\x12\x10\n" +
 	"\fTASK_TYPE_TC\x10\x02\x12\x16\n" +
 	"\x12TASK_TYPE_TC_CLEAN\x10\x03\x12\x17\n" +
 	"\x13TASK_TYPE_TC_STATUS\x10\x04\x12\x1a\n" +
-	"\x16TASK_TYPE_ROUTER_ADMIN\x10\x05B'Z%github.com/liuhengloveyou/pcdn/protosb\x06proto3"
+	"\x16TASK_TYPE_ROUTER_ADMIN\x10\x05\x12\x19\n" +
+	"\x15TASK_TYPE_TC_ADAPTIVE\x10\x06\x12\x1a\n" +
+	"\x16TASK_TYPE_PROBE_CONFIG\x10\a*v\n" +
+	"\fEnrollStatus\x12\x19\n" +
+	"\x15ENROLL_STATUS_UNKNOWN\x10\x00\x12\x19\n" +
+	"\x15ENROLL_STATUS_PENDING\x10\x01\x12\x14\n" +
+	"\x10ENROLL_STATUS_OK\x10\x02\x12\x1a\n" +
+	"\x16ENROLL_STATUS_REJECTED\x10\x03B'Z%github.com/liuhengloveyou/pcdn/protosb\x06proto3"
 
 var (
 	file_tcp_proto_rawDescOnce sync.Once
@@ -1200,40 +3881,82 @@ func file_tcp_proto_rawDescGZIP() []byte {
 	return file_tcp_proto_rawDescData
 }
 
-var file_tcp_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
-var file_tcp_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
+var file_tcp_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
+var file_tcp_proto_msgTypes = make([]protoimpl.MessageInfo, 34)
 var file_tcp_proto_goTypes = []any{
-	(MsgType)(0),                 // 0: protos.MsgType
-	(TaskType)(0),                // 1: protos.TaskType
-	(*Heartbeat)(nil),            // 2: protos.Heartbeat
-	(*DeviceAgent)(nil),          // 3: protos.DeviceAgent
-	(*Task)(nil),                 // 4: protos.Task
-	(*SystemMonitorProcess)(nil), // 5: protos.SystemMonitorProcess
-	(*SystemMonitorCpu)(nil),     // 6: protos.SystemMonitorCpu
-	(*SystemMonitorMemory)(nil),  // 7: protos.SystemMonitorMemory
-	(*SystemMonitorDisk)(nil),    // 8: protos.SystemMonitorDisk
-	(*SystemMonitorNetwork)(nil), // 9: protos.SystemMonitorNetwork
-	(*SystemMonitorData)(nil),    // 10: protos.SystemMonitorData
-	(*HttpProxyRequest)(nil),     // 11: protos.HttpProxyRequest
-	(*HttpProxyResponse)(nil),    // 12: protos.HttpProxyResponse
-	nil,                          // 13: protos.HttpProxyRequest.HeadersEntry
-	nil,                          // 14: protos.HttpProxyResponse.HeadersEntry
+	(MsgType)(0),                   // 0: protos.MsgType
+	(TaskType)(0),                  // 1: protos.TaskType
+	(EnrollStatus)(0),              // 2: protos.EnrollStatus
+	(*Heartbeat)(nil),              // 3: protos.Heartbeat
+	(*Enroll)(nil),                 // 4: protos.Enroll
+	(*DeviceAgent)(nil),            // 5: protos.DeviceAgent
+	(*Task)(nil),                   // 6: protos.Task
+	(*TcRule)(nil),                 // 7: protos.TcRule
+	(*TcPolicy)(nil),               // 8: protos.TcPolicy
+	(*TcClassStat)(nil),            // 9: protos.TcClassStat
+	(*TcQdiscStat)(nil),            // 10: protos.TcQdiscStat
+	(*TcVerifyResult)(nil),         // 11: protos.TcVerifyResult
+	(*TcVerifyIface)(nil),          // 12: protos.TcVerifyIface
+	(*TcAdaptiveConfig)(nil),       // 13: protos.TcAdaptiveConfig
+	(*TcAdjustEvent)(nil),          // 14: protos.TcAdjustEvent
+	(*TcDriftEvent)(nil),           // 15: protos.TcDriftEvent
+	(*SystemMonitorProcess)(nil),   // 16: protos.SystemMonitorProcess
+	(*SystemMonitorCpu)(nil),       // 17: protos.SystemMonitorCpu
+	(*SystemMonitorMemory)(nil),    // 18: protos.SystemMonitorMemory
+	(*SystemMonitorDisk)(nil),      // 19: protos.SystemMonitorDisk
+	(*SystemMonitorNetwork)(nil),   // 20: protos.SystemMonitorNetwork
+	(*SystemMonitorData)(nil),      // 21: protos.SystemMonitorData
+	(*SystemMonitorConn)(nil),      // 22: protos.SystemMonitorConn
+	(*SystemMonitorContainer)(nil), // 23: protos.SystemMonitorContainer
+	(*SystemMonitorProgram)(nil),   // 24: protos.SystemMonitorProgram
+	(*ProbeTarget)(nil),            // 25: protos.ProbeTarget
+	(*ProbeConfig)(nil),            // 26: protos.ProbeConfig
+	(*ProbeResult)(nil),            // 27: protos.ProbeResult
+	(*NatInfo)(nil),                // 28: protos.NatInfo
+	(*Inventory)(nil),              // 29: protos.Inventory
+	(*InventoryDisk)(nil),          // 30: protos.InventoryDisk
+	(*InventoryNic)(nil),           // 31: protos.InventoryNic
+	(*HttpProxyRequest)(nil),       // 32: protos.HttpProxyRequest
+	(*HttpProxyResponse)(nil),      // 33: protos.HttpProxyResponse
+	nil,                            // 34: protos.SystemMonitorConn.TcpStatesEntry
+	nil,                            // 35: protos.HttpProxyRequest.HeadersEntry
+	nil,                            // 36: protos.HttpProxyResponse.HeadersEntry
 }
 var file_tcp_proto_depIdxs = []int32{
-	10, // 0: protos.Heartbeat.monitor:type_name -> protos.SystemMonitorData
-	1,  // 1: protos.Task.task_type:type_name -> protos.TaskType
-	6,  // 2: protos.SystemMonitorData.cpu:type_name -> protos.SystemMonitorCpu
-	7,  // 3: protos.SystemMonitorData.memory:type_name -> protos.SystemMonitorMemory
-	8,  // 4: protos.SystemMonitorData.disk:type_name -> protos.SystemMonitorDisk
-	9,  // 5: protos.SystemMonitorData.network:type_name -> protos.SystemMonitorNetwork
-	5,  // 6: protos.SystemMonitorData.processes:type_name -> protos.SystemMonitorProcess
-	13, // 7: protos.HttpProxyRequest.headers:type_name -> protos.HttpProxyRequest.HeadersEntry
-	14, // 8: protos.HttpProxyResponse.headers:type_name -> protos.HttpProxyResponse.HeadersEntry
-	9,  // [9:9] is the sub-list for method output_type
-	9,  // [9:9] is the sub-list for method input_type
-	9,  // [9:9] is the sub-list for extension type_name
-	9,  // [9:9] is the sub-list for extension extendee
-	0,  // [0:9] is the sub-list for field type_name
+	21, // 0: protos.Heartbeat.monitor:type_name -> protos.SystemMonitorData
+	27, // 1: protos.Heartbeat.probes:type_name -> protos.ProbeResult
+	28, // 2: protos.Heartbeat.nat:type_name -> protos.NatInfo
+	2,  // 3: protos.Enroll.status:type_name -> protos.EnrollStatus
+	1,  // 4: protos.Task.task_type:type_name -> protos.TaskType
+	8,  // 5: protos.Task.tc_policy:type_name -> protos.TcPolicy
+	9,  // 6: protos.Task.tc_stats:type_name -> protos.TcClassStat
+	10, // 7: protos.Task.tc_qdisc_stats:type_name -> protos.TcQdiscStat
+	11, // 8: protos.Task.tc_verify:type_name -> protos.TcVerifyResult
+	13, // 9: protos.Task.tc_adaptive:type_name -> protos.TcAdaptiveConfig
+	26, // 10: protos.Task.probe_config:type_name -> protos.ProbeConfig
+	7,  // 11: protos.TcPolicy.rules:type_name -> protos.TcRule
+	12, // 12: protos.TcVerifyResult.ifaces:type_name -> protos.TcVerifyIface
+	9,  // 13: protos.TcVerifyIface.classes:type_name -> protos.TcClassStat
+	17, // 14: protos.SystemMonitorData.cpu:type_name -> protos.SystemMonitorCpu
+	18, // 15: protos.SystemMonitorData.memory:type_name -> protos.SystemMonitorMemory
+	19, // 16: protos.SystemMonitorData.disk:type_name -> protos.SystemMonitorDisk
+	20, // 17: protos.SystemMonitorData.network:type_name -> protos.SystemMonitorNetwork
+	16, // 18: protos.SystemMonitorData.processes:type_name -> protos.SystemMonitorProcess
+	24, // 19: protos.SystemMonitorData.programs:type_name -> protos.SystemMonitorProgram
+	19, // 20: protos.SystemMonitorData.disks:type_name -> protos.SystemMonitorDisk
+	23, // 21: protos.SystemMonitorData.containers:type_name -> protos.SystemMonitorContainer
+	22, // 22: protos.SystemMonitorData.conn:type_name -> protos.SystemMonitorConn
+	34, // 23: protos.SystemMonitorConn.tcp_states:type_name -> protos.SystemMonitorConn.TcpStatesEntry
+	25, // 24: protos.ProbeConfig.targets:type_name -> protos.ProbeTarget
+	30, // 25: protos.Inventory.disks:type_name -> protos.InventoryDisk
+	31, // 26: protos.Inventory.nics:type_name -> protos.InventoryNic
+	35, // 27: protos.HttpProxyRequest.headers:type_name -> protos.HttpProxyRequest.HeadersEntry
+	36, // 28: protos.HttpProxyResponse.headers:type_name -> protos.HttpProxyResponse.HeadersEntry
+	29, // [29:29] is the sub-list for method output_type
+	29, // [29:29] is the sub-list for method input_type
+	29, // [29:29] is the sub-list for extension type_name
+	29, // [29:29] is the sub-list for extension extendee
+	0,  // [0:29] is the sub-list for field type_name
 }
 
 func init() { file_tcp_proto_init() }
@@ -1241,14 +3964,14 @@ func file_tcp_proto_init() {
 	if File_tcp_proto != nil {
 		return
 	}
-	file_tcp_proto_msgTypes[2].OneofWrappers = []any{}
+	file_tcp_proto_msgTypes[3].OneofWrappers = []any{}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_tcp_proto_rawDesc), len(file_tcp_proto_rawDesc)),
-			NumEnums:      2,
-			NumMessages:   13,
+			NumEnums:      3,
+			NumMessages:   34,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -0,0 +1,315 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+	"pcdn-server/service"
+
+	gocommon "github.com/liuhengloveyou/go-common"
+	goerrors "github.com/liuhengloveyou/go-errors"
+	"go.uber.org/zap"
+)
+
+func initAlertApi() {
+	// 告警规则
+	Apis["/alert/rule/save"] = ApiStruct{
+		Handler:    SaveAlertRule,
+		Method:     "POST",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+	Apis["/alert/rule/delete"] = ApiStruct{
+		Handler:    DeleteAlertRule,
+		Method:     "POST",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+	Apis["/alert/rule/list"] = ApiStruct{
+		Handler:    ListAlertRule,
+		Method:     "GET",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+
+	// 通知渠道
+	Apis["/alert/channel/save"] = ApiStruct{
+		Handler:    SaveAlertChannel,
+		Method:     "POST",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+	Apis["/alert/channel/delete"] = ApiStruct{
+		Handler:    DeleteAlertChannel,
+		Method:     "POST",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+	Apis["/alert/channel/list"] = ApiStruct{
+		Handler:    ListAlertChannel,
+		Method:     "GET",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+	// 给渠道发一条测试通知
+	Apis["/alert/channel/test"] = ApiStruct{
+		Handler:    TestAlertChannel,
+		Method:     "POST",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+
+	// 静默
+	Apis["/alert/silence/save"] = ApiStruct{
+		Handler:    SaveAlertSilence,
+		Method:     "POST",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+	Apis["/alert/silence/delete"] = ApiStruct{
+		Handler:    DeleteAlertSilence,
+		Method:     "POST",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+	Apis["/alert/silence/list"] = ApiStruct{
+		Handler:    ListAlertSilence,
+		Method:     "GET",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+
+	// 告警事件 ?status=firing|resolved&sn=&page=
+	Apis["/alert/events"] = ApiStruct{
+		Handler:    ListAlertEvent,
+		Method:     "GET",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+}
+
+func SaveAlertRule(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	req := models.AlertRule{}
+	if err := common.ReadJsonBodyFromRequest(r, &req, ""); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrParam)
+		return
+	}
+	common.Logger.Debug("SaveAlertRule", zap.Any("req", req), zap.Any("sess", sessionUser))
+
+	id, err := service.AlertService.SaveRule(sessionUser, &req)
+	if err != nil {
+		common.Logger.Error("SaveAlertRule", zap.Any("req", req), zap.Error(err))
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, id)
+}
+
+func DeleteAlertRule(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	req := models.AlertRule{}
+	if err := common.ReadJsonBodyFromRequest(r, &req, ""); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrParam)
+		return
+	}
+
+	if err := service.AlertService.DeleteRule(sessionUser, req.Id); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, "OK")
+}
+
+func ListAlertRule(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	rr, err := service.AlertService.ListRules(sessionUser)
+	if err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, rr)
+}
+
+func SaveAlertChannel(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	req := models.AlertChannel{}
+	if err := common.ReadJsonBodyFromRequest(r, &req, ""); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrParam)
+		return
+	}
+
+	id, err := service.AlertService.SaveChannel(sessionUser, &req)
+	if err != nil {
+		common.Logger.Error("SaveAlertChannel", zap.String("name", req.Name), zap.String("type", req.Type), zap.Error(err))
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, id)
+}
+
+func DeleteAlertChannel(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	req := models.AlertChannel{}
+	if err := common.ReadJsonBodyFromRequest(r, &req, ""); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrParam)
+		return
+	}
+
+	if err := service.AlertService.DeleteChannel(sessionUser, req.Id); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, "OK")
+}
+
+func ListAlertChannel(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	rr, err := service.AlertService.ListChannels(sessionUser)
+	if err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, rr)
+}
+
+// 渠道返回的错误原样给前端，方便排查配置
+func TestAlertChannel(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	req := models.AlertChannel{}
+	if err := common.ReadJsonBodyFromRequest(r, &req, ""); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrParam)
+		return
+	}
+
+	if err := service.AlertService.TestChannel(sessionUser, req.Id); err != nil {
+		if _, ok := err.(*goerrors.Error); ok {
+			gocommon.HttpJsonErr(w, http.StatusOK, err)
+			return
+		}
+		gocommon.HttpErr(w, http.StatusOK, common.ErrService.Code, err.Error())
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, "OK")
+}
+
+func SaveAlertSilence(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	req := models.AlertSilence{}
+	if err := common.ReadJsonBodyFromRequest(r, &req, ""); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrParam)
+		return
+	}
+
+	id, err := service.AlertService.SaveSilence(sessionUser, &req)
+	if err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, id)
+}
+
+func DeleteAlertSilence(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	req := models.AlertSilence{}
+	if err := common.ReadJsonBodyFromRequest(r, &req, ""); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrParam)
+		return
+	}
+
+	if err := service.AlertService.DeleteSilence(sessionUser, req.Id); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, "OK")
+}
+
+func ListAlertSilence(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	rr, err := service.AlertService.ListSilences(sessionUser)
+	if err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, rr)
+}
+
+func ListAlertEvent(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	r.ParseForm()
+	page, _ := strconv.Atoi(r.FormValue("page"))
+	rst, err := service.AlertService.Events(sessionUser, r.FormValue("status"), r.FormValue("sn"), page)
+	if err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, rst)
+}
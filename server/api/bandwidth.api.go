@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+	"pcdn-server/service"
+
+	gocommon "github.com/liuhengloveyou/go-common"
+	"go.uber.org/zap"
+)
+
+func initBandwidthApi() {
+	// 带宽95报表
+	Apis["/bandwidth/report"] = ApiStruct{
+		Handler:    BandwidthReport,
+		Method:     "GET",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+
+	// 带宽95报表导出CSV
+	Apis["/bandwidth/report/csv"] = ApiStruct{
+		Handler:    BandwidthReportCSV,
+		Method:     "GET",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+}
+
+func readBandwidthReport(w http.ResponseWriter, r *http.Request) *models.BandwidthReport {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return nil
+	}
+
+	r.ParseForm()
+	scope := r.FormValue("scope")
+	if scope == "" {
+		scope = "device"
+	}
+
+	report, err := service.BandwidthService.Report(sessionUser, scope, r.FormValue("target"), r.FormValue("iface"), r.FormValue("period"), r.FormValue("date"))
+	if err != nil {
+		common.Logger.Error("BandwidthReport ERR: ", zap.Any("form", r.Form), zap.Error(err))
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return nil
+	}
+
+	return report
+}
+
+func BandwidthReport(w http.ResponseWriter, r *http.Request) {
+	report := readBandwidthReport(w, r)
+	if report == nil {
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, report)
+}
+
+func BandwidthReportCSV(w http.ResponseWriter, r *http.Request) {
+	report := readBandwidthReport(w, r)
+	if report == nil {
+		return
+	}
+
+	filename := fmt.Sprintf("bandwidth-%s-%s-%s.csv", report.Scope, report.Target, report.Total.Period)
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	// 速率导出为Mbps
+	mbps := func(v float64) string {
+		return fmt.Sprintf("%.2f", v/1000/1000)
+	}
+	row := func(name string, stat models.BandwidthStat) []string {
+		return []string{name, stat.Period, fmt.Sprintf("%d", stat.Samples),
+			mbps(stat.P95Send), mbps(stat.PeakSend), mbps(stat.AvgSend),
+			mbps(stat.P95Recv), mbps(stat.PeakRecv), mbps(stat.AvgRecv)}
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"sn", "period", "samples", "p95_send_mbps", "peak_send_mbps", "avg_send_mbps", "p95_recv_mbps", "peak_recv_mbps", "avg_recv_mbps"})
+	cw.Write(row("total", report.Total))
+	for _, stat := range report.Daily {
+		cw.Write(row("total", stat))
+	}
+	for _, stat := range report.Devices {
+		cw.Write(row(stat.SN, stat))
+	}
+	cw.Flush()
+}
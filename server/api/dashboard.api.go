@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"pcdn-server/common"
+	"pcdn-server/service"
+
+	gocommon "github.com/liuhengloveyou/go-common"
+)
+
+func initDashboardApi() {
+	// 首页大盘 ?range=24h|7d&top=10
+	Apis["/dashboard"] = ApiStruct{
+		Handler:    GetDashboard,
+		Method:     "GET",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+}
+
+func GetDashboard(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	r.ParseForm()
+	top, _ := strconv.Atoi(r.FormValue("top"))
+	rst, err := service.DashboardService.Overview(sessionUser, r.FormValue("range"), top)
+	if err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, rst)
+}
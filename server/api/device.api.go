@@ -1,6 +1,7 @@
 package api
 
 import (
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
@@ -11,50 +12,89 @@ import (
 	"pcdn-server/tcpservice"
 
 	gocommon "github.com/liuhengloveyou/go-common"
+	passportprotos "github.com/liuhengloveyou/passport/protos"
 	"go.uber.org/zap"
 )
 
 func initDeviceManagerApi() {
 	// 添加设备接口
 	Apis["/device/add"] = ApiStruct{
-		Handler:   AddDevice,
-		Method:    "POST",
-		NeedLogin: true,
+		Handler:    AddDevice,
+		Method:     "POST",
+		NeedLogin:  true,
+		NeedAccess: true,
 	}
 
 	// 查询设备列表
 	Apis["/device/list"] = ApiStruct{
-		Handler:   ListDevices,
-		Method:    "GET",
-		NeedLogin: true,
+		Handler:    ListDevices,
+		Method:     "GET",
+		NeedLogin:  true,
+		NeedAccess: true,
 	}
 
 	// 更新设备信息
 	Apis["/device/update"] = ApiStruct{
-		Handler:   UpdateAgent,
-		Method:    "POST",
-		NeedLogin: true,
+		Handler:    UpdateAgent,
+		Method:     "POST",
+		NeedLogin:  true,
+		NeedAccess: true,
 	}
 
 	// 重置密码
 	Apis["/device/resetpwd"] = ApiStruct{
-		Handler:   ResetDevicePWD,
-		Method:    "GET",
-		NeedLogin: true,
+		Handler:    ResetDevicePWD,
+		Method:     "GET",
+		NeedLogin:  true,
+		NeedAccess: true,
 	}
 
 	// 查询设备监控信息
 	Apis["/device/monitor"] = ApiStruct{
-		Handler:   GetDeviceMonitorInfo,
-		Method:    "GET",
-		NeedLogin: true,
+		Handler:    GetDeviceMonitorInfo,
+		Method:     "GET",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+
+	// 设备上的docker容器 ?sn=; 历史数据用 /device/metrics 查 container.* 指标
+	Apis["/device/containers"] = ApiStruct{
+		Handler:    GetDeviceContainers,
+		Method:     "GET",
+		NeedLogin:  true,
+		NeedAccess: true,
 	}
 
 	// 获取路由器管理界面URL
 	Apis["/device/router-admin"] = ApiStruct{
-		Handler:   GetRouterAdmin,
-		Method:    "GET",
-		NeedLogin: true,
+		Handler:    GetRouterAdmin,
+		Method:     "GET",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+
+	// 批量设置设备的分组、标签和备注
+	Apis["/device/label"] = ApiStruct{
+		Handler:    LabelDevices,
+		Method:     "POST",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+
+	// 分组树和每个分组的设备数
+	Apis["/device/groups"] = ApiStruct{
+		Handler:    ListDeviceGroups,
+		Method:     "GET",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+
+	// 用到的标签和设备数
+	Apis["/device/tags"] = ApiStruct{
+		Handler:    ListDeviceTags,
+		Method:     "GET",
+		NeedLogin:  true,
+		NeedAccess: true,
 	}
 }
 
@@ -114,8 +154,51 @@ func ListDevices(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// 按NAT类型、运营商、地区、公网IP、分组、标签、在线状态等过滤
+	filter := &models.DeviceFilter{
+		NatType:  r.FormValue("nat_type"),
+		ISP:      r.FormValue("isp"),
+		Province: r.FormValue("province"),
+		City:     r.FormValue("city"),
+		IP:       r.FormValue("ip"),
+
+		CpuModel:  r.FormValue("cpu"),
+		Arch:      r.FormValue("arch"),
+		Platform:  r.FormValue("os"),
+		Kernel:    r.FormValue("kernel"),
+		Vendor:    r.FormValue("vendor"),
+		Product:   r.FormValue("product"),
+		DiskModel: r.FormValue("disk"),
+		NicDriver: r.FormValue("nic_driver"),
+		Mac:       r.FormValue("mac"),
+
+		Group:    r.FormValue("group"),
+		Tag:      r.FormValue("tag"),
+		Remark:   strings.TrimSpace(r.FormValue("remark")),
+		Online:   r.FormValue("online"),
+		Version:  r.FormValue("version"),
+		RemoteIP: r.FormValue("remote_ip"),
+		Sort:     r.FormValue("sort"),
+	}
+	if field, _ := filter.SortField(); field != "" && !models.DeviceStatusSorts[field] && models.DeviceColumnSorts[field] == "" {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrParam)
+		return
+	}
+	// 内存不少于多少GB
+	if gb, err := strconv.ParseFloat(r.FormValue("min_memory_gb"), 64); err == nil && gb > 0 {
+		filter.MinMemory = uint64(gb * (1 << 30))
+	}
+	if filter.IP != "" {
+		ip := net.ParseIP(filter.IP)
+		if ip == nil {
+			gocommon.HttpJsonErr(w, http.StatusOK, common.ErrParam)
+			return
+		}
+		filter.IP = ip.String()
+	}
+
 	// 调用服务层方法获取设备列表
-	devices, total, err := service.DeviceService.Find(sessionUser.UID, page, pageSize)
+	devices, total, err := service.DeviceService.Find(sessionUser, filter, page, pageSize)
 	if err != nil {
 		gocommon.HttpJsonErr(w, http.StatusOK, err)
 		return
@@ -133,12 +216,10 @@ func UpdateAgent(w http.ResponseWriter, r *http.Request) {
 	}
 
 	r.ParseForm()
-	sn := r.FormValue("sn")
-	if sn == "" {
-		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrParam)
+	sn, ok := authorizeDevice(w, sessionUser, r.FormValue("sn"), "/device/update")
+	if !ok {
 		return
 	}
-	sn = strings.ToUpper(sn)
 
 	agentOne := tcpservice.AgentMap[sn]
 	if agentOne == nil {
@@ -175,10 +256,8 @@ func ResetDevicePWD(w http.ResponseWriter, r *http.Request) {
 	}
 
 	r.ParseForm()
-	sn := r.FormValue("sn")
-	if sn == "" {
-		common.Logger.Error("ResetDevicePWD param ERR: ", zap.String("sn", sn), zap.Any("sess", sessionUser))
-		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrParam)
+	sn, ok := authorizeDevice(w, sessionUser, r.FormValue("sn"), "/device/resetpwd")
+	if !ok {
 		return
 	}
 
@@ -202,9 +281,8 @@ func GetDeviceMonitorInfo(w http.ResponseWriter, r *http.Request) {
 	}
 
 	r.ParseForm()
-	sn := r.FormValue("sn")
-	if sn == "" {
-		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrParam)
+	sn, ok := authorizeDevice(w, sessionUser, r.FormValue("sn"), "/device/monitor")
+	if !ok {
 		return
 	}
 
@@ -227,9 +305,8 @@ func GetRouterAdmin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	r.ParseForm()
-	sn := r.FormValue("sn")
-	if sn == "" {
-		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrParam)
+	sn, ok := authorizeDevice(w, sessionUser, r.FormValue("sn"), "/device/router-admin")
+	if !ok {
 		return
 	}
 
@@ -242,3 +319,85 @@ func GetRouterAdmin(w http.ResponseWriter, r *http.Request) {
 
 	gocommon.HttpErr(w, http.StatusOK, 0, map[string]string{"url": url})
 }
+
+func GetDeviceContainers(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	r.ParseForm()
+	rr, err := service.DeviceService.Containers(sessionUser, r.FormValue("sn"))
+	if err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, rr)
+}
+
+// 设备级的接口先检查当前用户有没有这台设备的权限，没有时直接返回错误; 返回大写的SN
+func authorizeDevice(w http.ResponseWriter, sessionUser *passportprotos.User, sn, action string) (string, bool) {
+	dev, err := service.DeviceService.Authorize(sessionUser, sn, action)
+	if err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return "", false
+	}
+	return strings.ToUpper(dev.SN), true
+}
+
+// 批量设置设备的分组、标签和备注
+func LabelDevices(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	req := models.DeviceLabelReq{}
+	if err := common.ReadJsonBodyFromRequest(r, &req, ""); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrParam)
+		return
+	}
+	common.Logger.Debug("LabelDevices", zap.Any("req", req), zap.Any("sess", sessionUser))
+
+	if err := service.DeviceService.Label(sessionUser, &req); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, "OK")
+}
+
+func ListDeviceGroups(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	root, err := service.DeviceService.Groups(sessionUser)
+	if err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, root)
+}
+
+func ListDeviceTags(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	tags, err := service.DeviceService.Tags(sessionUser)
+	if err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, tags)
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+	"pcdn-server/service"
+
+	gocommon "github.com/liuhengloveyou/go-common"
+	"go.uber.org/zap"
+)
+
+func initEnrollApi() {
+	// 用设备显示的SN和认领码认领设备
+	Apis["/device/claim"] = ApiStruct{
+		Handler:    ClaimDevice,
+		Method:     "POST",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+
+	// 连上来还没被认领的设备
+	Apis["/device/pending"] = ApiStruct{
+		Handler:    ListPendingDevices,
+		Method:     "GET",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+
+	// 把设备移出待认领列表，设备下次连上来时用新的认领码重新加进来
+	Apis["/device/pending/reset"] = ApiStruct{
+		Handler:    ResetPendingDevice,
+		Method:     "POST",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+}
+
+func ClaimDevice(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	req := models.DeviceClaimReq{}
+	if err := common.ReadJsonBodyFromRequest(r, &req, ""); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrParam)
+		return
+	}
+	common.Logger.Debug("ClaimDevice", zap.String("sn", req.SN), zap.Any("sess", sessionUser))
+
+	id, err := service.EnrollService.Claim(sessionUser, &req)
+	if err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, id)
+}
+
+func ListPendingDevices(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	r.ParseForm()
+	page := 1
+	pageSize := 30
+	if p, err := strconv.Atoi(r.FormValue("page")); err == nil && p > 0 {
+		page = p
+	}
+	if ps, err := strconv.Atoi(r.FormValue("page_size")); err == nil && ps > 0 {
+		pageSize = ps
+	}
+
+	rr, total, err := service.EnrollService.Pending(sessionUser, page, pageSize)
+	if err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpResponseArray(w, http.StatusOK, 0, rr, total)
+}
+
+func ResetPendingDevice(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	req := models.DeviceClaimReq{}
+	if err := common.ReadJsonBodyFromRequest(r, &req, ""); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrParam)
+		return
+	}
+
+	if err := service.EnrollService.ResetPending(sessionUser, req.SN); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, "OK")
+}
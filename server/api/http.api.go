@@ -12,6 +12,8 @@ import (
 	"time"
 
 	"pcdn-server/common"
+	"pcdn-server/models"
+	"pcdn-server/service"
 
 	gocommon "github.com/liuhengloveyou/go-common"
 	passport "github.com/liuhengloveyou/passport/face"
@@ -24,6 +26,8 @@ type ApiStruct struct {
 	Method     string
 	NeedLogin  bool
 	NeedAccess bool
+	// NeedAccess时检查的操作，为空时GET请求是read，其它是write
+	Act string
 }
 
 var (
@@ -44,6 +48,19 @@ func init() {
 	initTcApi()
 	initDeviceManagerApi()
 	initBusinessLogApi()
+	initBandwidthApi()
+	initQuotaApi()
+	initSiteApi()
+	initMetricsApi()
+	initDashboardApi()
+	initSessionApi()
+	initAlertApi()
+	initProbeApi()
+	initInventoryApi()
+	initTrafficApi()
+	initPromApi()
+	initRbacApi()
+	initEnrollApi()
 }
 
 func InitAndRunHttpApi(addr string) error {
@@ -109,10 +126,26 @@ func (p *HttpApiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if apiHandler.NeedLogin {
-		if ReadSessionFromRequest(r) == nil {
+		sessionUser := ReadSessionFromRequest(r)
+		if sessionUser == nil {
 			gocommon.HttpJsonErr(w, http.StatusUnauthorized, common.ErrNoAuth)
 			return
 		}
+
+		// 按用户在租户里的角色检查接口权限
+		if apiHandler.NeedAccess {
+			act := apiHandler.Act
+			if act == "" {
+				act = models.RBAC_ACT_WRITE
+				if r.Method == http.MethodGet {
+					act = models.RBAC_ACT_READ
+				}
+			}
+			if !service.RbacService.Enforce(sessionUser, apiName, act) {
+				gocommon.HttpJsonErr(w, http.StatusForbidden, common.ErrNoAuth)
+				return
+			}
+		}
 	}
 
 	apiHandler.Handler(w, r)
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"pcdn-server/common"
+	"pcdn-server/service"
+
+	gocommon "github.com/liuhengloveyou/go-common"
+)
+
+func initInventoryApi() {
+	// 设备的硬件和系统清单 ?sn=
+	Apis["/device/inventory"] = ApiStruct{
+		Handler:    GetDeviceInventory,
+		Method:     "GET",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+
+	// 设备清单的变化历史 ?sn=&page=&page_size=
+	Apis["/device/inventory/history"] = ApiStruct{
+		Handler:    ListDeviceInventoryHistory,
+		Method:     "GET",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+}
+
+func GetDeviceInventory(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	r.ParseForm()
+	rst, err := service.InventoryService.Get(sessionUser, r.FormValue("sn"))
+	if err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, rst)
+}
+
+func ListDeviceInventoryHistory(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	r.ParseForm()
+	page, _ := strconv.Atoi(r.FormValue("page"))
+	pageSize, _ := strconv.Atoi(r.FormValue("page_size"))
+	rr, total, err := service.InventoryService.History(sessionUser, r.FormValue("sn"), page, pageSize)
+	if err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpResponseArray(w, http.StatusOK, 0, rr, total)
+}
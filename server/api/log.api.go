@@ -11,8 +11,9 @@ import (
 
 func initBusinessLogApi() {
 	Apis["/log/list"] = ApiStruct{
-		Handler:   ListMyBusinessLog,
-		NeedLogin: true,
+		Handler:    ListMyBusinessLog,
+		NeedLogin:  true,
+		NeedAccess: true,
 	}
 
 }
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pcdn-server/common"
+	"pcdn-server/service"
+
+	gocommon "github.com/liuhengloveyou/go-common"
+)
+
+func initMetricsApi() {
+	// 设备历史指标
+	// ?sn=&metrics=cpu.usage,net.send_rate&label=eth0&start=&end=(毫秒)&step=(秒)
+	Apis["/device/metrics"] = ApiStruct{
+		Handler:    GetDeviceMetrics,
+		Method:     "GET",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+}
+
+func GetDeviceMetrics(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	r.ParseForm()
+	sn, ok := authorizeDevice(w, sessionUser, r.FormValue("sn"), "/device/metrics")
+	if !ok {
+		return
+	}
+	start, _ := strconv.ParseInt(r.FormValue("start"), 10, 64)
+	end, _ := strconv.ParseInt(r.FormValue("end"), 10, 64)
+	step, _ := strconv.ParseInt(r.FormValue("step"), 10, 64)
+
+	var metrics []string
+	if v := r.FormValue("metrics"); v != "" {
+		metrics = strings.Split(v, ",")
+	}
+
+	rr, err := service.MetricsService.Query(sn, metrics, r.FormValue("label"), start, end, step)
+	if err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, rr)
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"net/http"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+	"pcdn-server/service"
+
+	gocommon "github.com/liuhengloveyou/go-common"
+	"go.uber.org/zap"
+)
+
+func initProbeApi() {
+	// 新增或修改网络质量探测目标，保存后下发给设备
+	Apis["/probe/save"] = ApiStruct{
+		Handler:    SaveProbeTarget,
+		Method:     "POST",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+
+	Apis["/probe/delete"] = ApiStruct{
+		Handler:    DeleteProbeTarget,
+		Method:     "POST",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+
+	Apis["/probe/list"] = ApiStruct{
+		Handler:    ListProbeTarget,
+		Method:     "GET",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+
+	// 设备的探测设置和最近一轮结果 ?sn=; 历史数据用 /device/metrics 查 probe.* 指标
+	Apis["/device/probes"] = ApiStruct{
+		Handler:    GetDeviceProbes,
+		Method:     "GET",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+}
+
+func SaveProbeTarget(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	req := models.ProbeTargetModel{}
+	if err := common.ReadJsonBodyFromRequest(r, &req, ""); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrParam)
+		return
+	}
+	common.Logger.Debug("SaveProbeTarget", zap.Any("req", req), zap.Any("sess", sessionUser))
+
+	id, err := service.ProbeService.Save(sessionUser, &req)
+	if err != nil {
+		common.Logger.Error("SaveProbeTarget", zap.Any("req", req), zap.Error(err))
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, id)
+}
+
+func DeleteProbeTarget(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	req := models.ProbeTargetModel{}
+	if err := common.ReadJsonBodyFromRequest(r, &req, ""); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrParam)
+		return
+	}
+
+	if err := service.ProbeService.Delete(sessionUser, req.Id); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, "OK")
+}
+
+func ListProbeTarget(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	rr, err := service.ProbeService.List(sessionUser)
+	if err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, rr)
+}
+
+func GetDeviceProbes(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	r.ParseForm()
+	rst, err := service.ProbeService.Device(sessionUser, r.FormValue("sn"))
+	if err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, rst)
+}
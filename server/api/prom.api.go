@@ -0,0 +1,43 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+
+	"pcdn-server/common"
+
+	"github.com/liuhengloveyou/pcdn/protos/prom"
+)
+
+func initPromApi() {
+	// Prometheus抓取的指标，配置了metrics_token时要带 Authorization: Bearer <token>，没配置时只有本机能访问
+	Apis["/metrics"] = ApiStruct{
+		Handler: PromMetrics,
+		Method:  "GET",
+	}
+}
+
+func PromMetrics(w http.ResponseWriter, r *http.Request) {
+	if token := common.ServConfig.MetricsToken; token != "" {
+		got := r.Header.Get("Authorization")
+		if subtle.ConstantTimeCompare([]byte(got), []byte("Bearer "+token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	} else if !loopbackAddr(r.RemoteAddr) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	prom.Handler(w, r)
+}
+
+func loopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
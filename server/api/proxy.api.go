@@ -25,12 +25,22 @@ func init() {
 
 // 处理路由器管理代理请求
 func handleRouterAdminProxy(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
 	// 获取设备序列号
 	deviceSN := r.URL.Query().Get("sn")
 	if deviceSN == "" {
 		gocommon.HttpJsonErr(w, http.StatusBadRequest, common.ErrParam)
 		return
 	}
+	deviceSN, ok := authorizeDevice(w, sessionUser, deviceSN, "/proxy/router-admin")
+	if !ok {
+		return
+	}
 
 	// 读取请求体
 	body, err := io.ReadAll(r.Body)
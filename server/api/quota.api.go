@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+	"pcdn-server/service"
+
+	gocommon "github.com/liuhengloveyou/go-common"
+	"go.uber.org/zap"
+)
+
+func initQuotaApi() {
+	// GET 查询设备流量配额和用量; POST 设置配额
+	Apis["/device/quota"] = ApiStruct{
+		Handler:    TrafficQuota,
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+
+	// 列出所有设备的配额和用量
+	Apis["/device/quota/list"] = ApiStruct{
+		Handler:    ListTrafficQuota,
+		Method:     "GET",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+}
+
+func TrafficQuota(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		r.ParseForm()
+		sn, ok := authorizeDevice(w, sessionUser, r.FormValue("sn"), "/device/quota")
+		if !ok {
+			return
+		}
+		usage, err := service.TrafficQuotaService.Usage(sn)
+		if err != nil {
+			gocommon.HttpJsonErr(w, http.StatusOK, err)
+			return
+		}
+		gocommon.HttpErr(w, http.StatusOK, 0, usage)
+		return
+	}
+
+	req := models.TrafficQuotaModel{}
+	if err := common.ReadJsonBodyFromRequest(r, &req, ""); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrParam)
+		return
+	}
+	common.Logger.Debug("TrafficQuota", zap.Any("req", req), zap.Any("sess", sessionUser))
+	sn, ok := authorizeDevice(w, sessionUser, req.SN, "/device/quota")
+	if !ok {
+		return
+	}
+	req.SN = sn
+
+	ctx := context.WithValue(r.Context(), "UID", sessionUser.UID)
+	ctx = context.WithValue(ctx, "Nickname", sessionUser.Cellphone.String)
+	ctx = context.WithValue(ctx, "TID", sessionUser.TenantID)
+	if err := service.TrafficQuotaService.Save(ctx, &req); err != nil {
+		common.Logger.Error("TrafficQuota", zap.Any("req", req), zap.Error(err))
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, "OK")
+}
+
+func ListTrafficQuota(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	r.ParseForm()
+	page, _ := strconv.Atoi(r.FormValue("page"))
+	rr, err := service.TrafficQuotaService.List(sessionUser, page)
+	if err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, rr)
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"net/http"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+	"pcdn-server/service"
+
+	gocommon "github.com/liuhengloveyou/go-common"
+	"go.uber.org/zap"
+)
+
+func initRbacApi() {
+	// 当前用户在租户里的角色
+	Apis["/rbac/me"] = ApiStruct{
+		Handler:   GetMyRoles,
+		Method:    "GET",
+		NeedLogin: true,
+	}
+
+	// 租户里用户的角色; GET 列出, POST 分配
+	Apis["/rbac/role"] = ApiStruct{
+		Handler:    UserRoles,
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+
+	Apis["/rbac/role/delete"] = ApiStruct{
+		Handler:    DeleteUserRole,
+		Method:     "POST",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+
+	// 按接口单独给角色授权; GET 列出, POST 新增
+	Apis["/rbac/policy"] = ApiStruct{
+		Handler:    RbacPolicies,
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+
+	Apis["/rbac/policy/delete"] = ApiStruct{
+		Handler:    DeleteRbacPolicy,
+		Method:     "POST",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+}
+
+func GetMyRoles(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, map[string]interface{}{
+		"tenantId": sessionUser.TenantID,
+		"roles":    service.RbacService.MyRoles(sessionUser),
+	})
+}
+
+func UserRoles(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		rr, err := service.RbacService.UserRoles(sessionUser)
+		if err != nil {
+			gocommon.HttpJsonErr(w, http.StatusOK, err)
+			return
+		}
+		gocommon.HttpErr(w, http.StatusOK, 0, rr)
+		return
+	}
+
+	req := models.RbacUserRole{}
+	if err := common.ReadJsonBodyFromRequest(r, &req, ""); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrParam)
+		return
+	}
+	common.Logger.Debug("UserRoles", zap.Any("req", req), zap.Any("sess", sessionUser))
+
+	if err := service.RbacService.AssignRole(sessionUser, &req); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, "OK")
+}
+
+func DeleteUserRole(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	req := models.RbacUserRole{}
+	if err := common.ReadJsonBodyFromRequest(r, &req, ""); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrParam)
+		return
+	}
+
+	if err := service.RbacService.RemoveRole(sessionUser, &req); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, "OK")
+}
+
+func RbacPolicies(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		rr, err := service.RbacService.Policies(sessionUser)
+		if err != nil {
+			gocommon.HttpJsonErr(w, http.StatusOK, err)
+			return
+		}
+		gocommon.HttpErr(w, http.StatusOK, 0, rr)
+		return
+	}
+
+	req := models.RbacPolicy{}
+	if err := common.ReadJsonBodyFromRequest(r, &req, ""); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrParam)
+		return
+	}
+	common.Logger.Debug("RbacPolicies", zap.Any("req", req), zap.Any("sess", sessionUser))
+
+	if err := service.RbacService.AddPolicy(sessionUser, &req); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, "OK")
+}
+
+func DeleteRbacPolicy(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	req := models.RbacPolicy{}
+	if err := common.ReadJsonBodyFromRequest(r, &req, ""); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrParam)
+		return
+	}
+
+	if err := service.RbacService.RemovePolicy(sessionUser, &req); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, "OK")
+}
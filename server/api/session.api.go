@@ -0,0 +1,99 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"pcdn-server/common"
+	"pcdn-server/service"
+
+	gocommon "github.com/liuhengloveyou/go-common"
+)
+
+func initSessionApi() {
+	// 设备的在线会话记录 ?sn=&page=
+	Apis["/device/sessions"] = ApiStruct{
+		Handler:    ListDeviceSessions,
+		Method:     "GET",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+
+	// 设备一个月每天的在线率 ?sn=&month=2006-01&threshold=
+	Apis["/device/uptime"] = ApiStruct{
+		Handler:    GetDeviceUptime,
+		Method:     "GET",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+
+	// 所有设备一个月的在线率，低于阈值的标记出来 ?month=2006-01&threshold=
+	Apis["/device/sla"] = ApiStruct{
+		Handler:    GetDeviceSlaReport,
+		Method:     "GET",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+}
+
+func ListDeviceSessions(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	r.ParseForm()
+	sn, ok := authorizeDevice(w, sessionUser, r.FormValue("sn"), "/device/sessions")
+	if !ok {
+		return
+	}
+	page, _ := strconv.Atoi(r.FormValue("page"))
+	rr, err := service.SessionService.Sessions(sn, page)
+	if err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, rr)
+}
+
+func GetDeviceUptime(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	r.ParseForm()
+	sn, ok := authorizeDevice(w, sessionUser, r.FormValue("sn"), "/device/uptime")
+	if !ok {
+		return
+	}
+	threshold, _ := strconv.ParseFloat(r.FormValue("threshold"), 64)
+	rst, err := service.SessionService.Uptime(sn, r.FormValue("month"), threshold)
+	if err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, rst)
+}
+
+func GetDeviceSlaReport(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	r.ParseForm()
+	threshold, _ := strconv.ParseFloat(r.FormValue("threshold"), 64)
+	rr, err := service.SessionService.SlaReport(sessionUser, r.FormValue("month"), threshold)
+	if err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, rr)
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"net/http"
+	"strconv"
 
 	"pcdn-server/common"
 	"pcdn-server/models"
@@ -16,16 +17,59 @@ func initTcApi() {
 
 	// 网卡限速
 	Apis["/device/tc"] = ApiStruct{
-		Handler:   TrifficLimit,
-		Method:    "POST",
-		NeedLogin: true,
+		Handler:    TrifficLimit,
+		Method:     "POST",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+
+	// 按设备、分组或标签批量限速，后台执行，返回任务ID
+	Apis["/device/tc/batch"] = ApiStruct{
+		Handler:    TrifficLimitBatch,
+		Method:     "POST",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+
+	// 批量限速的进度和每台设备的结果
+	Apis["/device/tc/batch/result"] = ApiStruct{
+		Handler:    TrifficLimitBatchResult,
+		Method:     "GET",
+		NeedLogin:  true,
+		NeedAccess: true,
 	}
 
 	// 网卡限速状态
 	Apis["/device/tc/stat"] = ApiStruct{
-		Handler:   TrifficLimitStatus,
-		Method:    "POST",
-		NeedLogin: true,
+		Handler:    TrifficLimitStatus,
+		Method:     "POST",
+		NeedLogin:  true,
+		NeedAccess: true,
+		// 只是查询
+		Act: models.RBAC_ACT_READ,
+	}
+
+	// 自适应限速设置
+	Apis["/device/tc/adaptive"] = ApiStruct{
+		Handler:    TrifficLimitAdaptive,
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+
+	// 自适应限速调整记录
+	Apis["/device/tc/adaptive/log"] = ApiStruct{
+		Handler:    TrifficLimitAdjustLogs,
+		Method:     "GET",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+
+	// 限速规则漂移记录
+	Apis["/device/tc/drift"] = ApiStruct{
+		Handler:    TrifficLimitDrift,
+		Method:     "GET",
+		NeedLogin:  true,
+		NeedAccess: true,
 	}
 
 }
@@ -52,24 +96,72 @@ func TrifficLimit(w http.ResponseWriter, r *http.Request) {
 		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrParam)
 		return
 	}
+	sn, ok := authorizeDevice(w, sessionUser, req.SN, "/device/tc")
+	if !ok {
+		return
+	}
 	common.Logger.Debug("TrifficLimit", zap.Any("req", req), zap.Any("sess", sessionUser))
 
 	ctx := context.WithValue(r.Context(), "UID", sessionUser.UID)
 	ctx = context.WithValue(ctx, "Nickname", sessionUser.Cellphone.String)
 	ctx = context.WithValue(ctx, "TID", sessionUser.TenantID)
-	val, detail, err := service.TcService.TrifficLimit(ctx, req.SN, req.IfaceName, req.UploadLimit)
+	val, detail, verify, err := service.TcService.TrifficLimit(ctx, sn, req.IfaceName, req.UploadLimit, req.Rules, req.VerifySeconds)
 	if err != nil {
 		common.Logger.Error("TrifficLimit", zap.Any("req", req), zap.Error(err))
 		gocommon.HttpErr(w, http.StatusOK, -1, err)
 		return
 	}
 
-	gocommon.HttpErr(w, http.StatusOK, 0, map[string]string{
+	gocommon.HttpErr(w, http.StatusOK, 0, map[string]interface{}{
 		"val":    val,
 		"detail": detail,
+		"verify": verify,
 	})
 }
 
+func TrifficLimitBatch(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	req := models.TrifficLimitBatchReq{}
+	if err := common.ReadJsonBodyFromRequest(r, &req, ""); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrParam)
+		return
+	}
+	common.Logger.Debug("TrifficLimitBatch", zap.Any("req", req), zap.Any("sess", sessionUser))
+
+	ctx := context.WithValue(r.Context(), "UID", sessionUser.UID)
+	ctx = context.WithValue(ctx, "Nickname", sessionUser.Cellphone.String)
+	ctx = context.WithValue(ctx, "TID", sessionUser.TenantID)
+	id, err := service.TcService.TrifficLimitBatch(ctx, sessionUser, &req)
+	if err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, map[string]interface{}{"id": id})
+}
+
+func TrifficLimitBatchResult(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	r.ParseForm()
+	job, err := service.TcService.TrifficLimitBatchJob(sessionUser, r.FormValue("id"))
+	if err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, job)
+}
+
 func TrifficLimitStatus(w http.ResponseWriter, r *http.Request) {
 	sessionUser := ReadSessionFromRequest(r)
 	if sessionUser == nil || sessionUser.UID <= 0 {
@@ -87,17 +179,109 @@ func TrifficLimitStatus(w http.ResponseWriter, r *http.Request) {
 		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrParam)
 		return
 	}
+	sn, ok := authorizeDevice(w, sessionUser, req.SN, "/device/tc/stat")
+	if !ok {
+		return
+	}
 	common.Logger.Debug("TrifficLimitStatus", zap.Any("device", req), zap.Any("sess", sessionUser))
 
-	val, detail, err := service.TcService.TrifficLimitStat(req.SN, req.IfaceName)
-	common.Logger.Debug("TrifficLimitStatus", zap.Any("req", req), zap.Any("val", val), zap.Any("detail", detail))
+	stat, err := service.TcService.TrifficLimitStat(sn, req.IfaceName)
+	common.Logger.Debug("TrifficLimitStatus", zap.Any("req", req), zap.Any("stat", stat))
 	if err != nil {
 		gocommon.HttpErr(w, http.StatusOK, -1, err.Error())
 		return
 	}
 
-	gocommon.HttpErr(w, http.StatusOK, 0, map[string]string{
-		"val":    val,
-		"detail": detail,
-	})
+	gocommon.HttpErr(w, http.StatusOK, 0, stat)
+}
+
+func TrifficLimitDrift(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	r.ParseForm()
+	sn, ok := authorizeDevice(w, sessionUser, r.FormValue("sn"), "/device/tc/drift")
+	if !ok {
+		return
+	}
+
+	events, err := service.TcService.DriftEvents(sn)
+	if err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, events)
+}
+
+// GET 查询自适应限速设置; POST 修改
+func TrifficLimitAdaptive(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		r.ParseForm()
+		sn, ok := authorizeDevice(w, sessionUser, r.FormValue("sn"), "/device/tc/adaptive")
+		if !ok {
+			return
+		}
+		m, err := service.TcService.GetAdaptive(sn)
+		if err != nil {
+			gocommon.HttpJsonErr(w, http.StatusOK, err)
+			return
+		}
+		gocommon.HttpErr(w, http.StatusOK, 0, m)
+		return
+	}
+
+	req := models.TcAdaptiveModel{}
+	if err := common.ReadJsonBodyFromRequest(r, &req, ""); err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrParam)
+		return
+	}
+	common.Logger.Debug("TrifficLimitAdaptive", zap.Any("req", req), zap.Any("sess", sessionUser))
+	sn, ok := authorizeDevice(w, sessionUser, req.SN, "/device/tc/adaptive")
+	if !ok {
+		return
+	}
+	req.SN = sn
+
+	ctx := context.WithValue(r.Context(), "UID", sessionUser.UID)
+	ctx = context.WithValue(ctx, "Nickname", sessionUser.Cellphone.String)
+	ctx = context.WithValue(ctx, "TID", sessionUser.TenantID)
+	if err := service.TcService.SetAdaptive(ctx, &req); err != nil {
+		common.Logger.Error("TrifficLimitAdaptive", zap.Any("req", req), zap.Error(err))
+		gocommon.HttpErr(w, http.StatusOK, -1, err.Error())
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, req)
+}
+
+func TrifficLimitAdjustLogs(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	r.ParseForm()
+	sn, ok := authorizeDevice(w, sessionUser, r.FormValue("sn"), "/device/tc/adaptive/log")
+	if !ok {
+		return
+	}
+	page, _ := strconv.Atoi(r.FormValue("page"))
+	logs, err := service.TcService.AdjustLogs(sn, page)
+	if err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, logs)
 }
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"net/http"
+
+	"pcdn-server/common"
+	"pcdn-server/service"
+
+	gocommon "github.com/liuhengloveyou/go-common"
+)
+
+func initTrafficApi() {
+	// 设备每个网卡的小时/天流量合计 ?sn=&iface=&granularity=hour|day&start=2006-01-02&end=2006-01-02
+	Apis["/device/traffic"] = ApiStruct{
+		Handler:    GetDeviceTraffic,
+		Method:     "GET",
+		NeedLogin:  true,
+		NeedAccess: true,
+	}
+}
+
+func GetDeviceTraffic(w http.ResponseWriter, r *http.Request) {
+	sessionUser := ReadSessionFromRequest(r)
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		gocommon.HttpJsonErr(w, http.StatusOK, common.ErrNoAuth)
+		return
+	}
+
+	r.ParseForm()
+	rst, err := service.TrafficService.Query(sessionUser, r.FormValue("sn"), r.FormValue("iface"), r.FormValue("granularity"), r.FormValue("start"), r.FormValue("end"))
+	if err != nil {
+		gocommon.HttpJsonErr(w, http.StatusOK, err)
+		return
+	}
+
+	gocommon.HttpErr(w, http.StatusOK, 0, rst)
+}
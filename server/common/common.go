@@ -4,6 +4,7 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
 	"time"
@@ -12,7 +13,7 @@ import (
 
 	rotatelogs "github.com/lestrrat-go/file-rotatelogs"
 	gocommon "github.com/liuhengloveyou/go-common"
-	"github.com/liuhengloveyou/passport/accessctl"
+	"github.com/liuhengloveyou/pcdn/protos/prom"
 	redis "github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -31,6 +32,10 @@ const (
 	AGENT_MONITOR_KEY_PREFIX = "agent/monitor/"
 	TASK_RESPONSE_KEY_PREFIX = "task/resp/"
 	AGENT_TASK_KEY_PREFIX    = "agent/task/"
+	TC_DRIFT_KEY_PREFIX      = "tc/drift/"
+	TASK_RESULT_KEY_PREFIX   = "task/result/"
+	AGENT_PROBE_KEY_PREFIX   = "agent/probe/"
+	TC_BATCH_KEY_PREFIX      = "tc/batch/"
 )
 
 var confile = flag.String("c", "app.conf.yaml", "配置文件")
@@ -63,6 +68,18 @@ type ConfigStruct struct {
 
 	// 管理员UID
 	AdminUID int64 `yaml:"admin_id"`
+
+	// 设备月在线率低于这个值(%)时标记出来，默认99
+	SlaThreshold float64 `yaml:"sla_threshold"`
+
+	// 离线IP库文件，ip2region的文本格式，查设备公网IP的运营商和地区
+	IPDB string `yaml:"ip_db"`
+
+	// /metrics的访问令牌，设置后要带 Authorization: Bearer <token>
+	MetricsToken string `yaml:"metrics_token"`
+
+	// 租户权限的casbin模型文件，默认rbac_with_domains_model.conf
+	RbacModel string `yaml:"rbac_model"`
 }
 
 func init() {
@@ -89,6 +106,12 @@ func init() {
 			panic(e)
 		}
 	}
+
+	if len(ServConfig.IPDB) > 0 {
+		if e := InitIPDB(ServConfig.IPDB); e != nil {
+			panic(e)
+		}
+	}
 }
 
 func InitLog(logDir, logLevel string) error {
@@ -154,6 +177,8 @@ func InitRedis(redisAddr string) (e error) {
 		DB:       0,  // use default DB
 	})
 
+	RedisClient.AddHook(redisPromHook{})
+
 	// 测试连接
 	e = RedisClient.Ping(context.Background()).Err()
 	if e != nil {
@@ -165,6 +190,41 @@ func InitRedis(redisAddr string) (e error) {
 	return nil
 }
 
+var promRedisErrors = prom.NewCounter("pcdn_redis_errors_total", "Redis命令出错的次数，不含redis.Nil", "cmd")
+
+// 统计Redis命令的错误
+type redisPromHook struct{}
+
+func (redisPromHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := next(ctx, network, addr)
+		if err != nil {
+			promRedisErrors.Inc("dial")
+		}
+		return conn, err
+	}
+}
+
+func (redisPromHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := next(ctx, cmd)
+		if err != nil && err != redis.Nil {
+			promRedisErrors.Inc(cmd.Name())
+		}
+		return err
+	}
+}
+
+func (redisPromHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		err := next(ctx, cmds)
+		if err != nil && err != redis.Nil {
+			promRedisErrors.Inc("pipeline")
+		}
+		return err
+	}
+}
+
 func IsNowOpenningTime(timeArr []string) bool {
 	if len(timeArr) != 2 {
 		return true // 没有限制
@@ -196,16 +256,3 @@ func IsNowOpenningTime(timeArr []string) bool {
 
 	return false
 }
-
-func Enforce(uid, tenantID uint64, obj, act string) bool {
-	roles := accessctl.GetRoleForUserInDomain(uid, tenantID)
-	for i := 0; i < len(roles); i++ {
-		if strings.Compare(roles[i], "root") == 0 {
-			return true
-		}
-	}
-
-	access, _ := accessctl.Enforce(uid, tenantID, obj, act)
-
-	return access
-}
@@ -1,13 +1,37 @@
 package common
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"math/rand"
+	mrand "math/rand"
+	"strings"
 	"time"
 )
 
 // GenerateCode 日期20191025时间戳1571987125435+3位随机数
 func GenerateCode() string {
-	code := fmt.Sprintf("%s%d%03d", time.Now().Format("0102"), time.Now().UnixMilli(), rand.Intn(1000))
+	code := fmt.Sprintf("%s%d%03d", time.Now().Format("0102"), time.Now().UnixMilli(), mrand.Intn(1000))
 	return code
 }
+
+// GenerateToken 设备凭证，32字节随机数的hex
+func GenerateToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// HashSecret 凭证和认领码只存hash
+func HashSecret(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeClaimCode 认领码不区分大小写，忽略空格和-
+func NormalizeClaimCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code)))
+}
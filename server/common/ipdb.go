@@ -0,0 +1,110 @@
+package common
+
+import (
+	"bufio"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// IP库查出来的归属地
+type IPLocation struct {
+	Country  string `json:"country"`
+	Province string `json:"province"`
+	City     string `json:"city"`
+	ISP      string `json:"isp"`
+}
+
+type ipRange struct {
+	start, end netip.Addr
+	loc        *IPLocation
+}
+
+var ipRanges []ipRange
+
+// InitIPDB 加载离线IP库，ip2region的文本格式，一行一段:
+// 开始IP|结束IP|国家|区域|省份|城市|运营商，没有的字段为0; 也支持没有区域字段的新格式
+func InitIPDB(fn string) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var rr []ipRange
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		r, err := parseIPRange(text)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", fn, line, err)
+		}
+		rr = append(rr, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	sort.Slice(rr, func(i, j int) bool { return rr[i].start.Less(rr[j].start) })
+	ipRanges = rr
+	Logger.Info("InitIPDB OK: ", zap.String("file", fn), zap.Int("ranges", len(rr)))
+	return nil
+}
+
+func parseIPRange(text string) (ipRange, error) {
+	fields := strings.Split(text, "|")
+	if len(fields) != 6 && len(fields) != 7 {
+		return ipRange{}, fmt.Errorf("bad fields: %d", len(fields))
+	}
+	start, err := netip.ParseAddr(fields[0])
+	if err != nil {
+		return ipRange{}, err
+	}
+	end, err := netip.ParseAddr(fields[1])
+	if err != nil {
+		return ipRange{}, err
+	}
+	if start.Is4() != end.Is4() || end.Less(start) {
+		return ipRange{}, fmt.Errorf("bad range: %s-%s", fields[0], fields[1])
+	}
+
+	for i := range fields {
+		if fields[i] == "0" {
+			fields[i] = ""
+		}
+	}
+	loc := &IPLocation{Country: fields[2]}
+	if len(fields) == 7 {
+		loc.Province, loc.City, loc.ISP = fields[4], fields[5], fields[6]
+	} else {
+		loc.Province, loc.City, loc.ISP = fields[3], fields[4], fields[5]
+	}
+	return ipRange{start: start.Unmap(), end: end.Unmap(), loc: loc}, nil
+}
+
+// LookupIP 查IP的归属地，没加载IP库或查不到时返回nil
+func LookupIP(ip string) *IPLocation {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil
+	}
+	addr = addr.Unmap()
+
+	// 第一个开始地址大于ip的段的前一段
+	i := sort.Search(len(ipRanges), func(i int) bool { return addr.Less(ipRanges[i].start) })
+	if i == 0 {
+		return nil
+	}
+	r := ipRanges[i-1]
+	if r.start.Is4() != addr.Is4() || r.end.Less(addr) {
+		return nil
+	}
+	return r.loc
+}
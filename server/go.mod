@@ -4,6 +4,7 @@ go 1.24.3
 
 require (
 	github.com/bytedance/sonic v1.13.3
+	github.com/casbin/casbin/v2 v2.107.0
 	github.com/go-playground/validator/v10 v10.26.0
 	github.com/lestrrat-go/file-rotatelogs v2.4.0+incompatible
 	github.com/liuhengloveyou/go-common v0.0.0-20250319112824-c28f82e5a12b
@@ -11,6 +12,7 @@ require (
 	github.com/liuhengloveyou/passport v1.1.0
 	github.com/qiniu/go-sdk/v7 v7.25.3
 	github.com/redis/go-redis/v9 v9.10.0
+	github.com/robfig/cron/v3 v3.0.0
 	go.uber.org/zap v1.27.0
 	google.golang.org/protobuf v1.36.6
 	gorm.io/gorm v1.26.1
@@ -24,7 +26,6 @@ require (
 	github.com/jackc/pgx/v5 v5.7.5 // indirect
 	github.com/jackc/puddle/v2 v2.2.2 // indirect
 	github.com/lib/pq v1.10.9 // indirect
-	github.com/robfig/cron/v3 v3.0.0 // indirect
 	github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common v1.0.1182 // indirect
 	github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/sms v1.0.1115 // indirect
 	golang.org/x/sync v0.15.0 // indirect
@@ -36,7 +37,6 @@ require (
 	github.com/Masterminds/squirrel v1.5.4 // indirect
 	github.com/bmatcuk/doublestar/v4 v4.8.1 // indirect
 	github.com/bytedance/sonic/loader v0.2.4 // indirect
-	github.com/casbin/casbin/v2 v2.107.0 // indirect
 	github.com/casbin/govaluate v1.7.0 // indirect
 	github.com/cespare/xxhash/v2 v2.3.0 // indirect
 	github.com/cloudwego/base64x v0.1.5 // indirect
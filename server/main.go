@@ -16,6 +16,7 @@ import (
 	"pcdn-server/api"
 	"pcdn-server/common"
 	"pcdn-server/repos"
+	"pcdn-server/service"
 	"pcdn-server/tasks"
 	"pcdn-server/tcpservice"
 
@@ -75,6 +76,9 @@ func main() {
 	}
 
 	repos.InitRepos()
+	if err := service.InitRbac(); err != nil {
+		panic("RBAC: " + err.Error())
+	}
 	go tcpservice.InitTcpService(common.ServConfig.TcpServerAddr)
 	go tasks.RunTasks()
 	go tcpservice.RunTcpTasks()
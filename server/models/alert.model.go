@@ -0,0 +1,135 @@
+package models
+
+// 告警规则类型
+const (
+	ALERT_RULE_OFFLINE         = "offline"         // 离线超过Duration秒
+	ALERT_RULE_METRIC          = "metric"          // 指标在Duration秒内的平均值和Threshold比较
+	ALERT_RULE_THROUGHPUT_DROP = "throughput_drop" // 最近Duration秒的上行流量比之前一小时下降超过Threshold%
+	ALERT_RULE_TASK_FAIL       = "task_fail"       // 最近Duration秒下发的任务失败率超过Threshold%
+	ALERT_RULE_CONTAINER       = "container"       // Containers里的容器Duration秒内一直没有运行
+)
+
+// 通知渠道类型
+const (
+	ALERT_CHANNEL_WEBHOOK  = "webhook"
+	ALERT_CHANNEL_SMTP     = "smtp"
+	ALERT_CHANNEL_DINGTALK = "dingtalk"
+	ALERT_CHANNEL_WECOM    = "wecom"
+	ALERT_CHANNEL_FEISHU   = "feishu"
+)
+
+// 告警事件状态
+const (
+	ALERT_STATUS_FIRING   = "firing"
+	ALERT_STATUS_RESOLVED = "resolved"
+)
+
+// 告警规则
+type AlertRule struct {
+	Model
+
+	Name     string `json:"name" gorm:"column:name;type:VARCHAR(64);"`
+	Type     string `json:"type" gorm:"column:type;type:VARCHAR(32);"`
+	Severity string `json:"severity" gorm:"column:severity;type:VARCHAR(16);default:warning;"`
+	Enabled  bool   `json:"enabled" gorm:"column:enabled;"`
+
+	// metric规则的指标名和label，label为空时任意一个label满足就触发
+	Metric string `json:"metric" gorm:"column:metric;type:VARCHAR(32);"`
+	Label  string `json:"label" gorm:"column:label;type:VARCHAR(64);"`
+	// metric规则的比较方式 > 或 <
+	Operator  string  `json:"operator" gorm:"column:operator;type:VARCHAR(2);"`
+	Threshold float64 `json:"threshold" gorm:"column:threshold;default:0;"`
+	// 观察窗口 秒
+	Duration int64 `json:"duration" gorm:"column:duration;default:0;"`
+	// task_fail规则只统计这个类型的任务，空为所有任务
+	TaskType string `json:"taskType" gorm:"column:task_type;type:VARCHAR(32);"`
+	// task_fail规则窗口内至少有这么多任务才计算失败率
+	MinCount int `json:"minCount" gorm:"column:min_count;type:int;default:1;"`
+	// container规则要求运行的容器名
+	Containers StringArr `json:"containers" gorm:"column:containers;type:JSON;"`
+
+	// 生效的设备，都为空时是用户(租户)的所有设备; 分组包括下级分组，有标签时要同时有这些标签
+	Devices StringArr `json:"devices" gorm:"column:devices;type:JSON;"`
+	Group   string    `json:"group" gorm:"column:group_name;type:VARCHAR(64);"`
+	Tags    StringArr `json:"tags" gorm:"column:tags;type:JSON;"`
+
+	// 通知渠道id
+	Channels Int64Arr `json:"channels" gorm:"column:channels;type:JSON;"`
+	// 一直没恢复时每隔多少分钟再通知一次，0不重复
+	RepeatMinutes int64 `json:"repeatMinutes" gorm:"column:repeat_minutes;default:0;"`
+}
+
+func (AlertRule) TableName() string {
+	return "alert_rule"
+}
+
+// 通知渠道
+type AlertChannel struct {
+	Model
+
+	Name string `json:"name" gorm:"column:name;type:VARCHAR(64);"`
+	Type string `json:"type" gorm:"column:type;type:VARCHAR(16);"`
+	// webhook和机器人的地址
+	URL string `json:"url" gorm:"column:url;type:VARCHAR(512);"`
+	// 钉钉/飞书机器人的加签密钥
+	Secret string `json:"secret,omitempty" gorm:"column:secret;type:VARCHAR(128);"`
+
+	// 邮件
+	SmtpHost string    `json:"smtpHost" gorm:"column:smtp_host;type:VARCHAR(128);"`
+	SmtpPort int       `json:"smtpPort" gorm:"column:smtp_port;type:int;default:0;"`
+	Username string    `json:"username" gorm:"column:username;type:VARCHAR(128);"`
+	Password string    `json:"password,omitempty" gorm:"column:password;type:VARCHAR(128);"`
+	From     string    `json:"from" gorm:"column:mail_from;type:VARCHAR(128);"`
+	To       StringArr `json:"to" gorm:"column:mail_to;type:JSON;"`
+}
+
+func (AlertChannel) TableName() string {
+	return "alert_channel"
+}
+
+// 告警事件，同一规则同一设备同时只有一个firing的事件
+type AlertEvent struct {
+	Id       uint64  `json:"id" gorm:"column:id;type:INT;primaryKey;autoIncrement;"`
+	TenantId uint64  `json:"tenantId" gorm:"column:tenant_id;type:INT;index:idx_alert_event_tenant;"`
+	UserId   uint64  `json:"uid" gorm:"column:uid;type:INT;"`
+	RuleId   uint64  `json:"ruleId" gorm:"column:rule_id;type:INT;index:idx_alert_event_rule_sn;"`
+	RuleName string  `json:"ruleName" gorm:"column:rule_name;type:VARCHAR(64);"`
+	Severity string  `json:"severity" gorm:"column:severity;type:VARCHAR(16);"`
+	SN       string  `json:"sn" gorm:"column:sn;type:VARCHAR(45);index:idx_alert_event_rule_sn;"`
+	Status   string  `json:"status" gorm:"column:status;type:VARCHAR(16);index:idx_alert_event_status;"`
+	Value    float64 `json:"value" gorm:"column:value;default:0;"`
+	Message  string  `json:"message" gorm:"column:message;type:VARCHAR(512);"`
+	// 毫秒
+	StartTime  int64 `json:"startTime" gorm:"column:start_time;"`
+	EndTime    int64 `json:"endTime" gorm:"column:end_time;default:0;"`
+	LastNotify int64 `json:"lastNotify" gorm:"column:last_notify;default:0;"`
+	// 发出去的通知次数，被静默的不算
+	NotifyCount int `json:"notifyCount" gorm:"column:notify_count;type:int;default:0;"`
+}
+
+func (AlertEvent) TableName() string {
+	return "alert_event"
+}
+
+// 静默，时间段内匹配的告警不发通知。RuleId为0匹配所有规则，SN为空匹配所有设备
+type AlertSilence struct {
+	Model
+
+	RuleId    uint64 `json:"ruleId" gorm:"column:rule_id;type:INT;default:0;"`
+	SN        string `json:"sn" gorm:"column:sn;type:VARCHAR(45);"`
+	StartTime int64  `json:"startTime" gorm:"column:start_time;"`
+	EndTime   int64  `json:"endTime" gorm:"column:end_time;"`
+	Comment   string `json:"comment" gorm:"column:comment;type:VARCHAR(256);"`
+}
+
+func (AlertSilence) TableName() string {
+	return "alert_silence"
+}
+
+// 设备任务的执行结果，用来算任务失败率
+type TaskResult struct {
+	TaskId   string `json:"taskId"`
+	TaskType string `json:"taskType"`
+	ErrMsg   string `json:"errMsg"`
+	Ts       int64  `json:"ts"`
+}
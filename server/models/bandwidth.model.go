@@ -0,0 +1,57 @@
+package models
+
+// 设备总带宽用的网卡名，由心跳里的各个上行网卡加起来
+const BANDWIDTH_TOTAL_IFACE = "total"
+
+// 带宽采样，每台设备每个网卡5分钟一条，速率是5分钟内的平均值
+type BandwidthSample struct {
+	Id uint64 `json:"id" gorm:"column:id;type:INT;primaryKey;autoIncrement;"`
+
+	SN    string `json:"sn" gorm:"column:sn;uniqueIndex:idx_bw_sample,priority:1;type:VARCHAR(45);not null;"`
+	Iface string `json:"iface" gorm:"column:iface;uniqueIndex:idx_bw_sample,priority:2;type:VARCHAR(45);not null;"`
+	// 5分钟区间的开始时间 毫秒
+	SampleTime int64 `json:"sampleTime" gorm:"column:sample_time;uniqueIndex:idx_bw_sample,priority:3;not null;"`
+
+	// 上行/下行平均速率 bits/s
+	SendRate float64 `json:"sendRate" gorm:"column:send_rate;not null;"`
+	RecvRate float64 `json:"recvRate" gorm:"column:recv_rate;not null;"`
+}
+
+func (BandwidthSample) TableName() string {
+	return "bandwidth_sample"
+}
+
+// 一段时间内的带宽统计，速率单位 bits/s
+type BandwidthStat struct {
+	// 设备SN，汇总时为空
+	SN string `json:"sn,omitempty"`
+	// 统计周期，如 2025-06-01 或 2025-06
+	Period  string `json:"period"`
+	Samples int    `json:"samples"`
+
+	P95Send  float64 `json:"p95Send"`
+	PeakSend float64 `json:"peakSend"`
+	AvgSend  float64 `json:"avgSend"`
+	P95Recv  float64 `json:"p95Recv"`
+	PeakRecv float64 `json:"peakRecv"`
+	AvgRecv  float64 `json:"avgRecv"`
+}
+
+// 带宽报表
+type BandwidthReport struct {
+	// device/group/tenant
+	Scope  string `json:"scope"`
+	Target string `json:"target"`
+	Iface  string `json:"iface"`
+	// day/month
+	Period string `json:"period"`
+	Start  int64  `json:"start"`
+	End    int64  `json:"end"`
+
+	// 所有设备每5分钟的速率相加后的统计
+	Total BandwidthStat `json:"total"`
+	// 按月统计时每天的汇总统计
+	Daily []BandwidthStat `json:"daily,omitempty"`
+	// 每台设备各自的统计
+	Devices []BandwidthStat `json:"devices"`
+}
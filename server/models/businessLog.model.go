@@ -8,8 +8,12 @@ const (
 	BUSINESS_TYPE_DEL_DEVICE    BusinessType = "DELETE_DEVICE"
 
 	BUSINESS_TYPE_CREATE_TC BusinessType = "TC"
+	BUSINESS_TYPE_QUOTA     BusinessType = "QUOTA"
+	BUSINESS_TYPE_SITE      BusinessType = "SITE"
+	BUSINESS_TYPE_RBAC      BusinessType = "RBAC"
 
-	BUSINESS_TYPE_ERR BusinessType = "ERROR"
+	BUSINESS_TYPE_ERR  BusinessType = "ERROR"
+	BUSINESS_TYPE_DENY BusinessType = "DENY"
 )
 
 type BusinessLog struct {
@@ -0,0 +1,31 @@
+package models
+
+// 首页大盘的设备流量
+type DashboardDevice struct {
+	SN       string  `json:"sn"`
+	Version  string  `json:"version"`
+	SendRate float64 `json:"sendRate"` // bits/s
+	RecvRate float64 `json:"recvRate"` // bits/s
+}
+
+// 首页大盘，当前用户(租户)所有设备的汇总
+type Dashboard struct {
+	Total   int `json:"total"`
+	Online  int `json:"online"`
+	Offline int `json:"offline"`
+
+	// 在线设备当前的上行网卡速率合计 bits/s
+	SendRate float64 `json:"sendRate"`
+	RecvRate float64 `json:"recvRate"`
+
+	// 当前上行速率最高的设备
+	TopDevices []DashboardDevice `json:"topDevices"`
+	// 各agent版本的设备数，没有上报过的算unknown
+	Versions map[string]int `json:"versions"`
+
+	// 流量曲线 24h/7d
+	Range string        `json:"range"`
+	Step  int64         `json:"step"` // 毫秒
+	Send  []MetricPoint `json:"send"`
+	Recv  []MetricPoint `json:"recv"`
+}
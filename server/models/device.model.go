@@ -2,6 +2,7 @@ package models
 
 import (
 	"net"
+	"strings"
 	"sync"
 )
 
@@ -18,6 +19,8 @@ type DeviceAgent struct {
 	Timestamp int64 `json:"timestamp" gorm:"-"`
 	// 接入点名
 	AccessName string `json:"accessName" gorm:"-"`
+	// 设备上网络质量探测设置的版本
+	ProbeVersion string `json:"probeVersion,omitempty" gorm:"-"`
 
 	// 设备tcp长连接
 	ClientTcpConn net.Conn `json:"-" gorm:"-"`
@@ -30,16 +33,150 @@ type DeviceModel struct {
 
 	// 设备SN
 	SN string `json:"sn" gorm:"column:sn;uniqueIndex:idx_sn;type:VARCHAR(45);"`
+	// 设备分组，按组统计带宽等; 多级分组用/分隔，如 区域/站点/线路
+	GroupName string `json:"group" gorm:"column:group_name;index:idx_group_name;type:VARCHAR(64);"`
+	// 标签
+	Tags StringArr `json:"tags" gorm:"column:tags;type:JSON;"`
+	// 备注
+	Remark string `json:"remark" gorm:"column:remark;type:VARCHAR(256);"`
 	// agent 版本
 	Version string `json:"version" gorm:"-"`
 	// 设备IP
 	RemoteAddr string `json:"remoteAddr" gorm:"-"`
 	// 最后心跳时间
 	LastHeartbear int64 `json:"lastHeartbear" gorm:"-"`
+	// 最近有没有心跳
+	Online bool `json:"online" gorm:"-"`
 	// 设备心跳带上来的时间
 	Timestamp int64 `json:"timestamp" gorm:"-"`
 	// 接入点名
 	AccessName string `json:"accessName" gorm:"-"`
+
+	// agent检测到的NAT类型和公网地址
+	NatType    string    `json:"natType" gorm:"column:nat_type;index:idx_nat_type;type:VARCHAR(32);"`
+	PublicIPv4 string    `json:"publicIpv4" gorm:"column:public_ipv4;index:idx_public_ipv4;type:VARCHAR(45);"`
+	PublicIPv6 StringArr `json:"publicIpv6" gorm:"column:public_ipv6;type:JSON;"`
+	LocalIPv4  string    `json:"localIpv4" gorm:"column:local_ipv4;type:VARCHAR(45);"`
+	// 公网IP在离线IP库里的运营商和地区
+	ISP      string `json:"isp" gorm:"column:isp;index:idx_isp;type:VARCHAR(64);"`
+	Country  string `json:"country" gorm:"column:country;type:VARCHAR(64);"`
+	Province string `json:"province" gorm:"column:province;index:idx_province;type:VARCHAR(64);"`
+	City     string `json:"city" gorm:"column:city;type:VARCHAR(64);"`
+	// 网络信息最近一次变化的时间 毫秒
+	NetUpdateTime int64 `json:"netUpdateTime" gorm:"column:net_update_time;default:0;"`
+
+	// 认领时认领码的hash，设备第一次来取凭证时要带同样的认领码
+	ClaimCodeHash string `json:"-" gorm:"column:claim_code_hash;type:VARCHAR(64);"`
+	// 设备凭证的hash，为空时是还没认证过的设备
+	TokenHash string `json:"-" gorm:"column:token_hash;type:VARCHAR(64);"`
+	// 设备拿到凭证的时间 毫秒
+	EnrollTime int64 `json:"enrollTime" gorm:"column:enroll_time;default:0;"`
+}
+
+// 设备列表的过滤条件，都为空时不过滤；NatType和ISP可以逗号分隔多个
+type DeviceFilter struct {
+	NatType  string
+	ISP      string
+	Province string
+	City     string
+	// 公网IPv4或IPv6
+	IP string
+
+	// 硬件和系统清单，型号类的按包含匹配，不区分大小写
+	CpuModel  string
+	Arch      string
+	Platform  string
+	Kernel    string // 内核版本前缀
+	Vendor    string
+	Product   string
+	MinMemory uint64 // 字节
+	DiskModel string
+	NicDriver string
+	Mac       string
+
+	// 分组路径，包括下级分组
+	Group string
+	// 逗号分隔，要同时有这些标签
+	Tag string
+	// 备注包含，不区分大小写
+	Remark string
+
+	// 下面几个是心跳带上来的状态，在redis里
+	// 1在线 0离线
+	Online string
+	// agent版本，可以逗号分隔多个
+	Version string
+	// 连接的地址，单个IP或CIDR
+	RemoteIP string
+
+	// 排序字段，前面加-倒序，如 -lastHeartbeat
+	Sort string
+}
+
+// 按心跳状态排序的字段，其它的是表里的字段
+var DeviceStatusSorts = map[string]bool{"lastHeartbeat": true, "version": true, "remoteAddr": true}
+
+// 表里可以排序的字段
+var DeviceColumnSorts = map[string]string{
+	"sn":         "sn",
+	"group":      "group_name",
+	"createTime": "create_time",
+	"updateTime": "update_time",
+	"natType":    "nat_type",
+	"isp":        "isp",
+	"province":   "province",
+}
+
+// SortField 排序字段和是不是倒序
+func (f *DeviceFilter) SortField() (string, bool) {
+	if strings.HasPrefix(f.Sort, "-") {
+		return f.Sort[1:], true
+	}
+	return f.Sort, false
+}
+
+// ByStatus 要不要按redis里的状态过滤或排序，这时不能在数据库里分页
+func (f *DeviceFilter) ByStatus() bool {
+	field, _ := f.SortField()
+	return f.Online != "" || f.Version != "" || f.RemoteIP != "" || DeviceStatusSorts[field]
+}
+
+// 按设备、分组或标签选设备，都为空时是用户(租户)的所有设备
+type DeviceSelector struct {
+	Devices StringArr `json:"devices"`
+	// 分组路径，包括下级分组
+	Group string `json:"group"`
+	// 要同时有这些标签
+	Tags StringArr `json:"tags"`
+}
+
+func (s *DeviceSelector) Empty() bool {
+	return s == nil || (len(s.Devices) == 0 && s.Group == "" && len(s.Tags) == 0)
+}
+
+// 批量设置设备的分组、标签和备注，为nil的不改
+type DeviceLabelReq struct {
+	Devices StringArr `json:"devices"`
+	Group   *string   `json:"group"`
+	// 替换原来的标签
+	Tags *StringArr `json:"tags"`
+	// 在原来的标签上增减
+	AddTags    StringArr `json:"addTags"`
+	RemoveTags StringArr `json:"removeTags"`
+	Remark     *string   `json:"remark"`
+}
+
+// 分组树，Count包括下级分组的设备
+type DeviceGroupNode struct {
+	Name     string             `json:"name"`
+	Path     string             `json:"path"`
+	Count    int64              `json:"count"`
+	Children []*DeviceGroupNode `json:"children,omitempty"`
+}
+
+type DeviceTagCount struct {
+	Tag   string `json:"tag"`
+	Count int64  `json:"count"`
 }
 
 func (DeviceModel) TableName() string {
@@ -0,0 +1,28 @@
+package models
+
+// 连上来但还没被认领的设备
+type DevicePending struct {
+	SN string `json:"sn" gorm:"column:sn;primaryKey;type:VARCHAR(45);"`
+	// 设备第一次连上来时带的认领码的hash，之后不变，管理员重置或过期后重新记
+	ClaimCodeHash string `json:"-" gorm:"column:claim_code_hash;type:VARCHAR(64);not null;"`
+	Version       string `json:"version" gorm:"column:version;type:VARCHAR(64);"`
+	RemoteAddr    string `json:"remoteAddr" gorm:"column:remote_addr;type:VARCHAR(45);"`
+	// 输错认领码的次数，太多时不能再认领
+	Attempts  int   `json:"attempts" gorm:"column:attempts;default:0;"`
+	FirstSeen int64 `json:"firstSeen" gorm:"column:first_seen;not null;"`
+	LastSeen  int64 `json:"lastSeen" gorm:"column:last_seen;not null;index:idx_pending_last_seen;"`
+
+	// 设备上报的硬件和系统清单
+	Inventory *DeviceInventory `json:"inventory,omitempty" gorm:"-"`
+}
+
+func (DevicePending) TableName() string {
+	return "device_pending"
+}
+
+// 认领设备的请求
+type DeviceClaimReq struct {
+	SN    string `json:"sn"`
+	Code  string `json:"code"`
+	Group string `json:"group"`
+}
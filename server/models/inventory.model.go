@@ -0,0 +1,117 @@
+package models
+
+import (
+	"database/sql/driver"
+
+	"github.com/bytedance/sonic"
+)
+
+// 设备的硬件和系统清单，每台设备一行，是最近一次上报的
+type DeviceInventory struct {
+	Id              uint64         `json:"id" gorm:"column:id;type:INT;primaryKey;autoIncrement;"`
+	SN              string         `json:"sn" gorm:"column:sn;uniqueIndex:idx_inventory_sn;type:VARCHAR(45);"`
+	Hash            string         `json:"hash" gorm:"column:hash;type:VARCHAR(32);"`
+	Hostname        string         `json:"hostname" gorm:"column:hostname;type:VARCHAR(128);"`
+	OS              string         `json:"os" gorm:"column:os;type:VARCHAR(32);"`
+	Platform        string         `json:"platform" gorm:"column:platform;type:VARCHAR(64);"`
+	PlatformVersion string         `json:"platformVersion" gorm:"column:platform_version;type:VARCHAR(64);"`
+	KernelVersion   string         `json:"kernelVersion" gorm:"column:kernel_version;type:VARCHAR(128);"`
+	Arch            string         `json:"arch" gorm:"column:arch;type:VARCHAR(32);"`
+	CpuModel        string         `json:"cpuModel" gorm:"column:cpu_model;type:VARCHAR(128);"`
+	CpuCores        uint32         `json:"cpuCores" gorm:"column:cpu_cores;default:0;"`
+	CpuPhysicalCore uint32         `json:"cpuPhysicalCores" gorm:"column:cpu_physical_cores;default:0;"`
+	MemoryTotal     uint64         `json:"memoryTotal" gorm:"column:memory_total;default:0;"`
+	Disks           InventoryDisks `json:"disks" gorm:"column:disks;type:JSON;"`
+	Nics            InventoryNics  `json:"nics" gorm:"column:nics;type:JSON;"`
+	SysVendor       string         `json:"sysVendor" gorm:"column:sys_vendor;type:VARCHAR(128);"`
+	ProductName     string         `json:"productName" gorm:"column:product_name;type:VARCHAR(128);"`
+	ProductSerial   string         `json:"productSerial" gorm:"column:product_serial;type:VARCHAR(128);"`
+	BiosVersion     string         `json:"biosVersion" gorm:"column:bios_version;type:VARCHAR(128);"`
+	// agent采集的时间 毫秒
+	CollectTime int64 `json:"collectTime" gorm:"column:collect_time;"`
+	UpdateTime  int64 `json:"updateTime" gorm:"column:update_time;"`
+}
+
+func (DeviceInventory) TableName() string {
+	return "device_inventory"
+}
+
+type InventoryDisk struct {
+	Name       string `json:"name"`
+	Model      string `json:"model"`
+	Serial     string `json:"serial"`
+	Size       uint64 `json:"size"`
+	Rotational bool   `json:"rotational"`
+}
+
+type InventoryDisks []InventoryDisk
+
+func (m *InventoryDisks) Scan(src interface{}) error {
+	if src == nil {
+		return nil
+	}
+
+	b, _ := src.([]byte)
+	return sonic.Unmarshal(b, m)
+}
+func (m InventoryDisks) Value() (driver.Value, error) {
+	return sonic.Marshal(m)
+}
+
+type InventoryNic struct {
+	Name   string `json:"name"`
+	Mac    string `json:"mac"`
+	Speed  int32  `json:"speed"`
+	Driver string `json:"driver"`
+	Mtu    uint32 `json:"mtu"`
+}
+
+type InventoryNics []InventoryNic
+
+func (m *InventoryNics) Scan(src interface{}) error {
+	if src == nil {
+		return nil
+	}
+
+	b, _ := src.([]byte)
+	return sonic.Unmarshal(b, m)
+}
+func (m InventoryNics) Value() (driver.Value, error) {
+	return sonic.Marshal(m)
+}
+
+// 清单的一个变化
+type InventoryChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+type InventoryChanges []InventoryChange
+
+func (m *InventoryChanges) Scan(src interface{}) error {
+	if src == nil {
+		return nil
+	}
+
+	b, _ := src.([]byte)
+	return sonic.Unmarshal(b, m)
+}
+func (m InventoryChanges) Value() (driver.Value, error) {
+	return sonic.Marshal(m)
+}
+
+// 清单变化历史，第一次上报时Changes为空
+type DeviceInventoryHistory struct {
+	Id      uint64           `json:"id" gorm:"column:id;type:INT;primaryKey;autoIncrement;"`
+	SN      string           `json:"sn" gorm:"column:sn;index:idx_inventory_history_sn;type:VARCHAR(45);"`
+	OldHash string           `json:"oldHash" gorm:"column:old_hash;type:VARCHAR(32);"`
+	NewHash string           `json:"newHash" gorm:"column:new_hash;type:VARCHAR(32);"`
+	Changes InventoryChanges `json:"changes" gorm:"column:changes;type:JSON;"`
+	// 毫秒
+	CreateTime int64 `json:"createTime" gorm:"column:create_time;"`
+}
+
+func (DeviceInventoryHistory) TableName() string {
+	return "device_inventory_history"
+}
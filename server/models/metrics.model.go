@@ -0,0 +1,83 @@
+package models
+
+import "time"
+
+// 设备指标名
+const (
+	METRIC_CPU_USAGE         = "cpu.usage"         // %
+	METRIC_CPU_LOAD1         = "cpu.load1"         // 1分钟平均负载
+	METRIC_CPU_TEMPERATURE   = "cpu.temperature"   // 摄氏度
+	METRIC_MEM_USED          = "mem.used"          // 字节
+	METRIC_MEM_USED_PERCENT  = "mem.used_percent"  // %
+	METRIC_DISK_USED_PERCENT = "disk.used_percent" // %，label是挂载点
+	METRIC_NET_SEND_RATE     = "net.send_rate"     // bits/s，label是网卡，total是上行网卡合计
+	METRIC_NET_RECV_RATE     = "net.recv_rate"     // bits/s
+	METRIC_PROBE_RTT         = "probe.rtt"         // 毫秒，label是探测目标名
+	METRIC_PROBE_JITTER      = "probe.jitter"      // 毫秒
+	METRIC_PROBE_LOSS        = "probe.loss"        // %
+	METRIC_CONTAINER_UP      = "container.up"      // 1运行 0没运行，label是容器名
+	METRIC_CONTAINER_CPU     = "container.cpu"     // %，单核100%
+	METRIC_CONTAINER_MEM     = "container.mem"     // 字节
+	METRIC_CONTAINER_NET_RX  = "container.net_rx"  // bits/s
+	METRIC_CONTAINER_NET_TX  = "container.net_tx"  // bits/s
+	METRIC_CONNTRACK_USAGE   = "conntrack.usage"   // %，连接跟踪表用量
+	METRIC_TCP_CONNS         = "tcp.conns"         // TCP连接数，label是状态，如ESTABLISHED
+)
+
+var AllMetrics = []string{
+	METRIC_CPU_USAGE,
+	METRIC_CPU_LOAD1,
+	METRIC_CPU_TEMPERATURE,
+	METRIC_MEM_USED,
+	METRIC_MEM_USED_PERCENT,
+	METRIC_DISK_USED_PERCENT,
+	METRIC_NET_SEND_RATE,
+	METRIC_NET_RECV_RATE,
+	METRIC_PROBE_RTT,
+	METRIC_PROBE_JITTER,
+	METRIC_PROBE_LOSS,
+	METRIC_CONTAINER_UP,
+	METRIC_CONTAINER_CPU,
+	METRIC_CONTAINER_MEM,
+	METRIC_CONTAINER_NET_RX,
+	METRIC_CONTAINER_NET_TX,
+	METRIC_CONNTRACK_USAGE,
+	METRIC_TCP_CONNS,
+}
+
+// 指标的一个精度层，精度越粗保存越久
+type MetricTier struct {
+	Name      string
+	Table     string
+	Step      int64 // 毫秒
+	Retention time.Duration
+}
+
+// 从细到粗，第一层由心跳按分钟汇总写入，后面的由前一层降采样
+var MetricTiers = []MetricTier{
+	{Name: "1m", Table: "metric_point_1m", Step: 60 * 1000, Retention: 2 * 24 * time.Hour},
+	{Name: "5m", Table: "metric_point_5m", Step: 5 * 60 * 1000, Retention: 30 * 24 * time.Hour},
+	{Name: "1h", Table: "metric_point_1h", Step: 60 * 60 * 1000, Retention: 365 * 24 * time.Hour},
+}
+
+// 一个时间段内的指标汇总，各精度层的表结构一样
+type MetricPoint struct {
+	SN     string `json:"sn,omitempty" gorm:"column:sn;type:VARCHAR(45);primaryKey;"`
+	Metric string `json:"metric,omitempty" gorm:"column:metric;type:VARCHAR(32);primaryKey;"`
+	Label  string `json:"label,omitempty" gorm:"column:label;type:VARCHAR(128);primaryKey;"`
+	// 时间段开始 毫秒
+	Ts    int64   `json:"ts" gorm:"column:ts;primaryKey;autoIncrement:false;"`
+	Avg   float64 `json:"avg" gorm:"column:avg_value;"`
+	Min   float64 `json:"min" gorm:"column:min_value;"`
+	Max   float64 `json:"max" gorm:"column:max_value;"`
+	Count int64   `json:"-" gorm:"column:samples;"`
+}
+
+// 查询结果，一个指标一个label一条曲线
+type MetricSeries struct {
+	Metric string        `json:"metric"`
+	Label  string        `json:"label,omitempty"`
+	Tier   string        `json:"tier"`
+	Step   int64         `json:"step"` // 毫秒
+	Points []MetricPoint `json:"points"`
+}
@@ -101,7 +101,42 @@ type HeartbeatReq struct {
 }
 
 type TrifficLimitReq struct {
-	SN          string `json:"sn" validate:"required"`
-	IfaceName   string `json:"ifaceName"`
-	UploadLimit uint   `json:"uploadLimit" validate:"required"` // mbps
+	SN          string      `json:"sn" validate:"required"`
+	IfaceName   string      `json:"ifaceName"`
+	UploadLimit uint        `json:"uploadLimit"` // mbps，0时只按规则限速
+	Rules       TcRuleArray `json:"rules"`
+	// 设置后验证限速的采样时长(秒)，0不验证
+	VerifySeconds uint32 `json:"verifySeconds"`
+}
+
+// 按设备、分组或标签批量限速，选择条件不能都为空
+type TrifficLimitBatchReq struct {
+	DeviceSelector
+
+	IfaceName     string      `json:"ifaceName"`
+	UploadLimit   uint        `json:"uploadLimit"` // mbps
+	Rules         TcRuleArray `json:"rules"`
+	VerifySeconds uint32      `json:"verifySeconds"`
+}
+
+// 批量限速每台设备的结果，Err不为空时是失败
+type TrifficLimitBatchResult struct {
+	SN     string    `json:"sn"`
+	Val    string    `json:"val"`
+	Detail string    `json:"detail"`
+	Verify *TcVerify `json:"verify,omitempty"`
+	Err    string    `json:"err,omitempty"`
+}
+
+// 后台执行的批量限速，按ID查进度和结果；Results按SN排序，还没做完的只有SN
+type TrifficLimitBatchJob struct {
+	Id        string                    `json:"id"`
+	UserId    uint64                    `json:"uid"`
+	TenantId  uint64                    `json:"tenantId"`
+	Total     int                       `json:"total"`
+	Done      int                       `json:"done"`
+	Finished  bool                      `json:"finished"`
+	StartTime int64                     `json:"startTime"`
+	EndTime   int64                     `json:"endTime,omitempty"`
+	Results   []TrifficLimitBatchResult `json:"results"`
 }
@@ -0,0 +1,48 @@
+package models
+
+import "github.com/liuhengloveyou/pcdn/protos"
+
+// 网络质量探测类型
+const (
+	PROBE_TYPE_ICMP = "icmp"
+	PROBE_TYPE_TCP  = "tcp"
+	PROBE_TYPE_HTTP = "http"
+	PROBE_TYPE_DNS  = "dns"
+)
+
+// 网络质量探测目标，下发给用户(租户)的设备
+type ProbeTargetModel struct {
+	Model
+
+	// 同一用户不能重名，作为指标的label
+	Name string `json:"name" gorm:"column:name;type:VARCHAR(32);"`
+	Type string `json:"type" gorm:"column:type;type:VARCHAR(8);"`
+	// icmp: 主机; tcp: 主机:端口; http: URL; dns: 要解析的域名
+	Target string `json:"target" gorm:"column:target;type:VARCHAR(256);"`
+	// 探测间隔 秒
+	Interval uint32 `json:"interval" gorm:"column:interval_sec;type:int;default:60;"`
+	// 每轮发几次
+	Count     uint32 `json:"count" gorm:"column:probe_count;type:int;default:5;"`
+	TimeoutMs uint32 `json:"timeoutMs" gorm:"column:timeout_ms;type:int;default:2000;"`
+	// dns探测指定的DNS服务器 ip:port
+	DnsServer string `json:"dnsServer" gorm:"column:dns_server;type:VARCHAR(64);"`
+
+	// 探测的设备，都为空时是用户(租户)的所有设备; 分组包括下级分组，有标签时要同时有这些标签
+	Devices StringArr `json:"devices" gorm:"column:devices;type:JSON;"`
+	Group   string    `json:"group" gorm:"column:group_name;type:VARCHAR(64);"`
+	Tags    StringArr `json:"tags" gorm:"column:tags;type:JSON;"`
+}
+
+func (ProbeTargetModel) TableName() string {
+	return "probe_target"
+}
+
+// 设备的探测设置和最近一轮结果
+type DeviceProbes struct {
+	SN string `json:"sn"`
+	// 设备上的设置版本，和Version不一样时说明还没下发成功
+	DeviceVersion string                `json:"deviceVersion"`
+	Version       string                `json:"version"`
+	Targets       []*protos.ProbeTarget `json:"targets"`
+	Results       []*protos.ProbeResult `json:"results"`
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"database/sql/driver"
+
+	"github.com/bytedance/sonic"
+)
+
+// 流量配额超过阈值后的动作
+const (
+	QUOTA_ACTION_WARN     = "warn"     // 只记录告警
+	QUOTA_ACTION_THROTTLE = "throttle" // 上行限速到Rate
+	QUOTA_ACTION_STOP     = "stop"     // 上行基本停掉，只保留管理通道
+)
+
+// 流量配额，每个设备一条，每个计费周期重新统计
+type TrafficQuotaModel struct {
+	Model
+
+	SN string `json:"sn" gorm:"column:sn;uniqueIndex:idx_quota_sn;type:VARCHAR(45);"`
+	// 每个计费周期的流量 GB
+	QuotaGB uint `json:"quotaGB" gorm:"column:quota_gb;type:int;default:0;"`
+	// 计费周期从每月几号开始 1-28
+	ResetDay uint32 `json:"resetDay" gorm:"column:reset_day;type:int;default:1;"`
+	// 统计的方向 send/recv/both
+	Direction string `json:"direction" gorm:"column:direction;type:VARCHAR(8);default:both;"`
+	// 超过阈值后的动作，按百分比从小到大
+	Actions QuotaActionArray `json:"actions" gorm:"column:actions;type:JSON;"`
+
+	// 本计费周期开始时间 毫秒
+	CycleStart int64 `json:"cycleStart" gorm:"column:cycle_start;default:0;"`
+	// 本计费周期已用流量 字节
+	UsedSend uint64 `json:"usedSend" gorm:"column:used_send;default:0;"`
+	UsedRecv uint64 `json:"usedRecv" gorm:"column:used_recv;default:0;"`
+	// 本周期已经触发到的阈值百分比
+	Triggered uint `json:"triggered" gorm:"column:triggered;type:int;default:0;"`
+	// 当前生效的动作，周期结束后恢复
+	Enforced string `json:"enforced" gorm:"column:enforced;type:VARCHAR(16);"`
+	// 限速动作的速率 mbps
+	EnforcedRate uint `json:"enforcedRate" gorm:"column:enforced_rate;type:int;default:0;"`
+}
+
+func (TrafficQuotaModel) TableName() string {
+	return "traffic_quota"
+}
+
+// 用量超过配额的Percent%时执行Action
+type QuotaAction struct {
+	Percent uint   `json:"percent"`
+	Action  string `json:"action"`
+	// throttle的速率 mbps
+	Rate uint `json:"rate"`
+}
+
+type QuotaActionArray []QuotaAction
+
+func (m *QuotaActionArray) Scan(src interface{}) error {
+	if src == nil {
+		return nil
+	}
+
+	b, _ := src.([]byte)
+	return sonic.Unmarshal(b, m)
+}
+func (m QuotaActionArray) Value() (driver.Value, error) {
+	return sonic.Marshal(m)
+}
+
+// 配额用量
+type TrafficQuotaUsage struct {
+	TrafficQuotaModel
+
+	CycleEnd int64 `json:"cycleEnd"`
+	// 按Direction统计的已用流量 字节
+	Used    uint64  `json:"used"`
+	Percent float64 `json:"percent"`
+}
@@ -0,0 +1,41 @@
+package models
+
+// 租户里的内置角色，权限见service.rbacService
+const (
+	ROLE_VIEWER   = "viewer"   // 只能查看
+	ROLE_OPERATOR = "operator" // 可以操作设备，不能管理角色和权限
+	ROLE_ADMIN    = "admin"    // 租户管理员
+)
+
+// 接口的操作类型，GET是read，其它是write
+const (
+	RBAC_ACT_READ  = "read"
+	RBAC_ACT_WRITE = "write"
+)
+
+// casbin的策略规则。p: 角色,租户,接口,操作; g: 用户,角色,租户
+type RbacRule struct {
+	Id    uint64 `json:"id" gorm:"column:id;type:INT;primaryKey;autoIncrement;"`
+	Ptype string `json:"ptype" gorm:"column:ptype;type:VARCHAR(8);not null;uniqueIndex:idx_rbac_rule;"`
+	V0    string `json:"v0" gorm:"column:v0;type:VARCHAR(128);not null;default:'';uniqueIndex:idx_rbac_rule;"`
+	V1    string `json:"v1" gorm:"column:v1;type:VARCHAR(128);not null;default:'';uniqueIndex:idx_rbac_rule;"`
+	V2    string `json:"v2" gorm:"column:v2;type:VARCHAR(128);not null;default:'';uniqueIndex:idx_rbac_rule;"`
+	V3    string `json:"v3" gorm:"column:v3;type:VARCHAR(128);not null;default:'';uniqueIndex:idx_rbac_rule;"`
+}
+
+func (RbacRule) TableName() string {
+	return "rbac_rule"
+}
+
+// 用户在租户里的角色
+type RbacUserRole struct {
+	UID  uint64 `json:"uid"`
+	Role string `json:"role"`
+}
+
+// 给角色额外授权一个接口
+type RbacPolicy struct {
+	Role string `json:"role"`
+	Obj  string `json:"obj"` // 接口路径，如 /device/tc
+	Act  string `json:"act"` // read/write
+}
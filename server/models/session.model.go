@@ -0,0 +1,37 @@
+package models
+
+// 设备一次在线会话：从连上接入服务器发第一个心跳到断开
+type DeviceSession struct {
+	Id         uint64 `json:"id" gorm:"column:id;type:INT;primaryKey;autoIncrement;"`
+	SN         string `json:"sn" gorm:"column:sn;type:VARCHAR(45);index:idx_session_sn;"`
+	AccessName string `json:"accessName" gorm:"column:access_name;type:VARCHAR(64);index:idx_session_access;"`
+	RemoteAddr string `json:"remoteAddr" gorm:"column:remote_addr;type:VARCHAR(64);"`
+	Version    string `json:"version" gorm:"column:version;type:VARCHAR(32);"`
+	// 毫秒，EndTime为0表示还在线
+	StartTime int64 `json:"startTime" gorm:"column:start_time;index:idx_session_start;"`
+	EndTime   int64 `json:"endTime" gorm:"column:end_time;default:0;"`
+	// 最后确认在线的时间，接入服务器重启时按它结束会话
+	LastSeen int64 `json:"lastSeen" gorm:"column:last_seen;default:0;"`
+	// 断开原因
+	Reason string `json:"reason" gorm:"column:reason;type:VARCHAR(255);"`
+}
+
+func (DeviceSession) TableName() string {
+	return "device_session"
+}
+
+// 一天的在线率
+type UptimeDay struct {
+	Date   string  `json:"date"`   // 2006-01-02
+	Uptime float64 `json:"uptime"` // %
+	Online int64   `json:"online"` // 在线秒数
+}
+
+// 设备一个月的在线率
+type DeviceUptime struct {
+	SN      string      `json:"sn"`
+	Month   string      `json:"month"` // 2006-01
+	Uptime  float64     `json:"uptime"`
+	Flagged bool        `json:"flagged"` // 低于可用性阈值
+	Days    []UptimeDay `json:"days,omitempty"`
+}
@@ -0,0 +1,29 @@
+package models
+
+// 共享同一条宽带线路的一组设备，线路的总上行带宽按各设备的实际流量动态分配
+type SiteModel struct {
+	Model
+
+	Name string `json:"name" gorm:"column:name;type:VARCHAR(64);"`
+	// 线路总上行带宽 mbps
+	UplinkMbps uint `json:"uplinkMbps" gorm:"column:uplink_mbps;type:int;default:0;"`
+	// 每台设备至少分到的带宽 mbps，0表示平均值的1/4
+	MinMbps uint `json:"minMbps" gorm:"column:min_mbps;type:int;default:0;"`
+	// 成员设备SN
+	Members StringArr `json:"members" gorm:"column:members;type:JSON;"`
+
+	// 当前下发给每台设备的限速 mbps
+	Allocation MapStringInt `json:"allocation" gorm:"column:allocation;type:JSON;"`
+	// 最后一次重新分配的时间 毫秒
+	RebalanceTime int64 `json:"rebalanceTime" gorm:"column:rebalance_time;default:0;"`
+}
+
+func (SiteModel) TableName() string {
+	return "site"
+}
+
+// 出口IP相同、可能在同一条线路上的设备
+type SiteSuggestion struct {
+	RemoteAddr string   `json:"remoteAddr"`
+	Members    []string `json:"members"`
+}
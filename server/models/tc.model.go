@@ -1,5 +1,12 @@
 package models
 
+import (
+	"database/sql/driver"
+
+	"github.com/bytedance/sonic"
+	"github.com/liuhengloveyou/pcdn/protos"
+)
+
 type TcModel struct {
 	Model
 
@@ -9,11 +16,17 @@ type TcModel struct {
 	// 任务ID
 	TaskID string `json:"taskId" gorm:"column:task_id;uniqueIndex:idx_task_id;type:VARCHAR(45);"`
 
-	// 上行限速 mbps mbit
+	// 上行限速 mbps mbit; 有规则时是未匹配任何规则的流量的限速
 	UpLimit uint `json:"upLimit" gorm:"column:up_limit;type:int;default:0;"`
 	// 下行限速 mbps mbit
 	DownLimit uint `json:"downLimit" gorm:"column:down_limit;type:int;default:0;"`
 
+	// 限速规则，按顺序匹配
+	Rules TcRuleArray `json:"rules" gorm:"column:rules;type:JSON;"`
+
+	// 最近一次设置后的验证结果，没验证时Seconds为0
+	Verify TcVerify `json:"verify" gorm:"column:verify;type:JSON;"`
+
 	// 任务状态
 	Status int `json:"status" gorm:"column:status;type:int;default:0;"`
 }
@@ -21,3 +34,129 @@ type TcModel struct {
 func (TcModel) TableName() string {
 	return "tc"
 }
+
+// 限速规则，匹配到的流量单独限速
+type TcRule struct {
+	Name string `json:"name"`
+	// 目标地址，IPv4/IPv6 CIDR或单个IP，空表示全部
+	CIDRs []string `json:"cidrs"`
+	// 目标端口，空表示全部
+	Ports []uint32 `json:"ports"`
+	// tcp/udp，空表示全部
+	Protocol string `json:"protocol"`
+	// 保证带宽 mbps，0表示不限速
+	Rate uint `json:"rate"`
+	// 最大带宽 mbps，0表示等于rate
+	Ceil uint `json:"ceil"`
+	// HTB优先级 0-7，越小越优先
+	Prio uint32 `json:"prio"`
+
+	// 按程序限速，三选一，设置后不能再带地址/端口/协议
+	// 进程名
+	Process string `json:"process,omitempty"`
+	// systemd unit，如 vendor.service
+	Unit string `json:"unit,omitempty"`
+	// cgroup v2 路径，如 system.slice/vendor.service
+	Cgroup string `json:"cgroup,omitempty"`
+}
+
+type TcRuleArray []TcRule
+
+func (m *TcRuleArray) Scan(src interface{}) error {
+	if src == nil {
+		return nil
+	}
+
+	b, _ := src.([]byte)
+	return sonic.Unmarshal(b, m)
+}
+func (m TcRuleArray) Value() (driver.Value, error) {
+	return sonic.Marshal(m)
+}
+
+// 限速验证结果: 设置后采样一段时间，检查实际速率没有超过限速
+type TcVerify struct {
+	Passed     bool                    `json:"passed"`
+	Seconds    uint32                  `json:"seconds"`
+	VerifyTime int64                   `json:"verifyTime"`
+	Ifaces     []*protos.TcVerifyIface `json:"ifaces"`
+}
+
+func (m *TcVerify) Scan(src interface{}) error {
+	if src == nil {
+		return nil
+	}
+
+	b, _ := src.([]byte)
+	return sonic.Unmarshal(b, m)
+}
+func (m TcVerify) Value() (driver.Value, error) {
+	return sonic.Marshal(m)
+}
+
+// 设备上实际的限速状态
+type TcStatus struct {
+	// 默认class的速率
+	Rate string `json:"val"`
+	// 查询出错时的错误信息
+	Detail  string                `json:"detail"`
+	Qdiscs  []*protos.TcQdiscStat `json:"qdiscs"`
+	Classes []*protos.TcClassStat `json:"classes"`
+
+	// 数据库里保存的限速设置，没有设置过时为空
+	Expected *TcModel `json:"expected"`
+	// 设备实际状态和数据库设置不一致的地方
+	Mismatches []TcMismatch `json:"mismatches"`
+}
+
+// 一处限速设置不一致
+type TcMismatch struct {
+	// 规则名，默认class为default
+	Rule     string `json:"rule"`
+	Field    string `json:"field"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+// 自适应限速设置，每个设备一条
+// agent按网卡发送量跟踪本计费周期的95值，在Min/Max之间自动调整默认class的限速
+type TcAdaptiveModel struct {
+	Model
+
+	SN        string `json:"sn" gorm:"column:sn;uniqueIndex:idx_tc_adaptive_sn;type:VARCHAR(45);"`
+	Enabled   bool   `json:"enabled" gorm:"column:enabled;default:false;"`
+	IfaceName string `json:"ifaceName" gorm:"column:iface_name;type:VARCHAR(45);"`
+	// 目标95值、限速下限、上限 mbps
+	Target uint `json:"target" gorm:"column:target;type:int;default:0;"`
+	Min    uint `json:"min" gorm:"column:min;type:int;default:0;"`
+	Max    uint `json:"max" gorm:"column:max;type:int;default:0;"`
+	// 计费周期从每月几号开始 1-28
+	BillingDay uint32 `json:"billingDay" gorm:"column:billing_day;type:int;default:1;"`
+}
+
+func (TcAdaptiveModel) TableName() string {
+	return "tc_adaptive"
+}
+
+// 自适应限速调整记录，速率单位 bits/s
+type TcAdjustLog struct {
+	Id uint64 `json:"id" gorm:"column:id;type:INT;primaryKey;autoIncrement;"`
+
+	SN         string  `json:"sn" gorm:"column:sn;index:idx_tc_adjust_sn;type:VARCHAR(45);"`
+	IfaceName  string  `json:"ifaceName" gorm:"column:iface_name;type:VARCHAR(45);"`
+	OldBits    uint64  `json:"oldBits" gorm:"column:old_bits;"`
+	NewBits    uint64  `json:"newBits" gorm:"column:new_bits;"`
+	P95Bits    float64 `json:"p95Bits" gorm:"column:p95_bits;"`
+	TargetBits uint64  `json:"targetBits" gorm:"column:target_bits;"`
+	// 已用/总共的突发点数
+	BurstUsed  uint32 `json:"burstUsed" gorm:"column:burst_used;"`
+	BurstTotal uint32 `json:"burstTotal" gorm:"column:burst_total;"`
+	Reason     string `json:"reason" gorm:"column:reason;type:VARCHAR(255);"`
+	ErrMsg     string `json:"errMsg" gorm:"column:err_msg;"`
+	// agent调整的时间 毫秒
+	EventTime int64 `json:"eventTime" gorm:"column:event_time;"`
+}
+
+func (TcAdjustLog) TableName() string {
+	return "tc_adjust_log"
+}
@@ -0,0 +1,32 @@
+package models
+
+// 每台设备每个网卡每小时的流量，由agent上报的计数器增量累加，用来和厂商的结算单对账
+type TrafficHourly struct {
+	SN    string `json:"sn,omitempty" gorm:"column:sn;type:VARCHAR(45);primaryKey;"`
+	Iface string `json:"iface" gorm:"column:iface;type:VARCHAR(45);primaryKey;"`
+	// 小时开始时间 毫秒
+	Ts int64 `json:"ts" gorm:"column:ts;primaryKey;autoIncrement:false;"`
+
+	BytesSent   uint64 `json:"bytesSent" gorm:"column:bytes_sent;default:0;"`
+	BytesRecv   uint64 `json:"bytesRecv" gorm:"column:bytes_recv;default:0;"`
+	PacketsSent uint64 `json:"packetsSent" gorm:"column:packets_sent;default:0;"`
+	PacketsRecv uint64 `json:"packetsRecv" gorm:"column:packets_recv;default:0;"`
+	// 这个小时里计数器被清零的次数(重启或网卡重建)
+	Resets int64 `json:"resets" gorm:"column:resets;default:0;"`
+}
+
+func (TrafficHourly) TableName() string {
+	return "traffic_hourly"
+}
+
+// 一个时间段的流量合计
+type TrafficTotal struct {
+	// 小时为 2006-01-02 15:00，天为 2006-01-02
+	Period      string `json:"period"`
+	Iface       string `json:"iface"`
+	BytesSent   uint64 `json:"bytesSent"`
+	BytesRecv   uint64 `json:"bytesRecv"`
+	PacketsSent uint64 `json:"packetsSent"`
+	PacketsRecv uint64 `json:"packetsRecv"`
+	Resets      int64  `json:"resets"`
+}
@@ -0,0 +1,160 @@
+package repos
+
+import (
+	"time"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+
+	"gorm.io/gorm"
+)
+
+type alertRepo struct {
+}
+
+// tenantId>0时按租户查，否则按uid查
+func ownerScope(tenantId, uid uint64) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		if tenantId > 0 {
+			return tx.Where("tenant_id = ?", tenantId)
+		}
+		return tx.Where("uid = ?", uid)
+	}
+}
+
+func (p *alertRepo) SaveRule(m *models.AlertRule) (uint64, error) {
+	m.UpdateTime = time.Now().UnixMilli()
+	if m.Id == 0 {
+		m.CreateTime = m.UpdateTime
+		err := common.OrmCli.Create(m).Error
+		return m.Id, err
+	}
+	err := common.OrmCli.Model(&models.AlertRule{}).Where("id = ? AND uid = ?", m.Id, m.UserId).
+		Select("name", "type", "severity", "enabled", "metric", "label", "operator", "threshold", "duration",
+			"task_type", "min_count", "devices", "group_name", "tags", "channels", "repeat_minutes", "update_time").
+		Updates(m).Error
+	return m.Id, err
+}
+
+// 删除规则，同时结束它还没恢复的告警
+func (p *alertRepo) DeleteRule(id, uid uint64) error {
+	return common.OrmCli.Transaction(func(tx *gorm.DB) error {
+		rst := tx.Where("id = ? AND uid = ?", id, uid).Delete(&models.AlertRule{})
+		if rst.Error != nil || rst.RowsAffected == 0 {
+			return rst.Error
+		}
+		return tx.Model(&models.AlertEvent{}).Where("rule_id = ? AND status = ?", id, models.ALERT_STATUS_FIRING).
+			Updates(map[string]interface{}{"status": models.ALERT_STATUS_RESOLVED, "end_time": time.Now().UnixMilli()}).Error
+	})
+}
+
+func (p *alertRepo) FindRules(tenantId, uid uint64) ([]models.AlertRule, error) {
+	var rr []models.AlertRule
+	err := common.OrmCli.Scopes(ownerScope(tenantId, uid)).Order("id").Find(&rr).Error
+	return rr, err
+}
+
+func (p *alertRepo) EnabledRules() ([]models.AlertRule, error) {
+	var rr []models.AlertRule
+	err := common.OrmCli.Where("enabled = ?", true).Order("id").Find(&rr).Error
+	return rr, err
+}
+
+func (p *alertRepo) SaveChannel(m *models.AlertChannel) (uint64, error) {
+	m.UpdateTime = time.Now().UnixMilli()
+	if m.Id == 0 {
+		m.CreateTime = m.UpdateTime
+		err := common.OrmCli.Create(m).Error
+		return m.Id, err
+	}
+	err := common.OrmCli.Model(&models.AlertChannel{}).Where("id = ? AND uid = ?", m.Id, m.UserId).
+		Select("name", "type", "url", "secret", "smtp_host", "smtp_port", "username", "password", "mail_from", "mail_to", "update_time").
+		Updates(m).Error
+	return m.Id, err
+}
+
+func (p *alertRepo) DeleteChannel(id, uid uint64) error {
+	return common.OrmCli.Where("id = ? AND uid = ?", id, uid).Delete(&models.AlertChannel{}).Error
+}
+
+func (p *alertRepo) GetChannel(id uint64) (*models.AlertChannel, error) {
+	m := &models.AlertChannel{}
+	err := common.OrmCli.Where("id = ?", id).First(m).Error
+	return m, err
+}
+
+func (p *alertRepo) FindChannels(tenantId, uid uint64) ([]models.AlertChannel, error) {
+	var rr []models.AlertChannel
+	err := common.OrmCli.Scopes(ownerScope(tenantId, uid)).Order("id").Find(&rr).Error
+	return rr, err
+}
+
+func (p *alertRepo) GetChannels(ids []int64) ([]models.AlertChannel, error) {
+	var rr []models.AlertChannel
+	if len(ids) == 0 {
+		return rr, nil
+	}
+	err := common.OrmCli.Where("id IN ?", ids).Find(&rr).Error
+	return rr, err
+}
+
+func (p *alertRepo) CreateSilence(m *models.AlertSilence) (uint64, error) {
+	m.CreateTime = time.Now().UnixMilli()
+	m.UpdateTime = m.CreateTime
+	err := common.OrmCli.Create(m).Error
+	return m.Id, err
+}
+
+func (p *alertRepo) DeleteSilence(id, uid uint64) error {
+	return common.OrmCli.Where("id = ? AND uid = ?", id, uid).Delete(&models.AlertSilence{}).Error
+}
+
+// 还没过期的静默
+func (p *alertRepo) FindSilences(tenantId, uid uint64, now int64) ([]models.AlertSilence, error) {
+	var rr []models.AlertSilence
+	err := common.OrmCli.Scopes(ownerScope(tenantId, uid)).Where("end_time > ?", now).Order("start_time").Find(&rr).Error
+	return rr, err
+}
+
+// 所有用户当前生效的静默
+func (p *alertRepo) ActiveSilences(now int64) ([]models.AlertSilence, error) {
+	var rr []models.AlertSilence
+	err := common.OrmCli.Where("start_time <= ? AND end_time > ?", now, now).Find(&rr).Error
+	return rr, err
+}
+
+func (p *alertRepo) CreateEvent(m *models.AlertEvent) (uint64, error) {
+	err := common.OrmCli.Create(m).Error
+	return m.Id, err
+}
+
+// 更新事件的状态、当前值和通知记录
+func (p *alertRepo) UpdateEvent(m *models.AlertEvent) error {
+	return common.OrmCli.Model(&models.AlertEvent{}).Where("id = ?", m.Id).
+		Select("status", "value", "message", "end_time", "last_notify", "notify_count").Updates(m).Error
+}
+
+// 所有还没恢复的告警
+func (p *alertRepo) FiringEvents() ([]models.AlertEvent, error) {
+	var rr []models.AlertEvent
+	err := common.OrmCli.Where("status = ?", models.ALERT_STATUS_FIRING).Find(&rr).Error
+	return rr, err
+}
+
+// status和sn为空时不过滤，最新的在前
+func (p *alertRepo) FindEvents(tenantId, uid uint64, status, sn string, page, pageSize int) ([]models.AlertEvent, int64, error) {
+	var rr []models.AlertEvent
+	var total int64
+
+	tx := common.OrmCli.Model(&models.AlertEvent{}).Scopes(ownerScope(tenantId, uid))
+	if status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+	if sn != "" {
+		tx = tx.Where("sn = ?", sn)
+	}
+	tx.Count(&total)
+
+	err := tx.Order("start_time desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&rr).Error
+	return rr, total, err
+}
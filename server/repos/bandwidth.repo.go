@@ -0,0 +1,33 @@
+package repos
+
+import (
+	"pcdn-server/common"
+	"pcdn-server/models"
+
+	"gorm.io/gorm/clause"
+)
+
+type bandwidthRepo struct {
+}
+
+// 批量保存带宽采样，同一设备网卡同一周期已经有的不再重复保存
+func (p *bandwidthRepo) CreateBatch(samples []models.BandwidthSample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	return common.OrmCli.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(samples, 100).Error
+}
+
+// 查询设备一段时间内的采样 [start, end)，按时间排序
+func (p *bandwidthRepo) Find(sns []string, iface string, start, end int64) ([]models.BandwidthSample, error) {
+	var samples []models.BandwidthSample
+	if len(sns) == 0 {
+		return samples, nil
+	}
+
+	err := common.OrmCli.Where("sn IN ? AND iface = ? AND sample_time >= ? AND sample_time < ?", sns, iface, start, end).
+		Order("sample_time").
+		Find(&samples).Error
+
+	return samples, err
+}
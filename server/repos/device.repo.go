@@ -1,10 +1,14 @@
 package repos
 
 import (
+	"encoding/json"
+	"strings"
 	"time"
 
 	"pcdn-server/common"
 	"pcdn-server/models"
+
+	"gorm.io/gorm"
 )
 
 type deviceRepo struct {
@@ -25,21 +29,71 @@ func (p *deviceRepo) Get(id, uid uint64) (*models.DeviceModel, error) {
 	return m, tx.Error
 }
 
-// Find 方法用于根据条件查询设备信息
-func (p *deviceRepo) Find(uid uint64, page, pageSize int) ([]models.DeviceModel, int64, error) {
+// GetBySN 按SN查设备
+func (p *deviceRepo) GetBySN(sn string) (*models.DeviceModel, error) {
+	m := &models.DeviceModel{}
+	tx := common.OrmCli.Where("sn = ?", sn).Take(m)
+	return m, tx.Error
+}
+
+// Find 方法用于根据条件查询设备信息，tenantId为0时按uid查，都为0时查全部; filter为nil时不过滤
+func (p *deviceRepo) Find(tenantId, uid uint64, filter *models.DeviceFilter, page, pageSize int) ([]models.DeviceModel, int64, error) {
 	var devices []models.DeviceModel
 	var total int64
 
 	tx := common.OrmCli.Model(&models.DeviceModel{}) // 从 DeviceModel 表开始查询
 
-	// 添加用户ID条件
-	if uid > 0 {
+	// 租户里的设备大家都能看到
+	if tenantId > 0 {
+		tx = tx.Where("tenant_id = ?", tenantId)
+	} else if uid > 0 {
 		tx = tx.Where("uid = ?", uid)
 	}
 
+	// 网络信息条件
+	if filter != nil {
+		if vals := splitFilter(filter.NatType); len(vals) > 0 {
+			tx = tx.Where("nat_type IN ?", vals)
+		}
+		if vals := splitFilter(filter.ISP); len(vals) > 0 {
+			tx = tx.Where("isp IN ?", vals)
+		}
+		if filter.Province != "" {
+			tx = tx.Where("province = ?", filter.Province)
+		}
+		if filter.City != "" {
+			tx = tx.Where("city = ?", filter.City)
+		}
+		if filter.IP != "" {
+			ipv6, _ := json.Marshal([]string{filter.IP})
+			tx = tx.Where("(public_ipv4 = ? OR public_ipv6::jsonb @> ?::jsonb)", filter.IP, string(ipv6))
+		}
+		if inv := inventoryFilter(filter); inv != nil {
+			tx = tx.Where("sn IN (?)", inv)
+		}
+		tx = selectorScope(tx, filter.Group, splitFilter(filter.Tag))
+		if filter.Remark != "" {
+			tx = tx.Where("remark ILIKE ?", "%"+escapeLike(filter.Remark)+"%")
+		}
+	}
+
 	// 获取总记录数
 	tx.Count(&total)
 
+	// 排序，按心跳状态排序的由调用方处理
+	order := "id"
+	if filter != nil {
+		field, desc := filter.SortField()
+		if col, ok := models.DeviceColumnSorts[field]; ok {
+			order = col
+			if desc {
+				order += " DESC"
+			}
+			order += ", id"
+		}
+	}
+	tx = tx.Order(order)
+
 	// 添加分页
 	if page > 0 && pageSize > 0 {
 		offset := (page - 1) * pageSize
@@ -55,6 +109,204 @@ func (p *deviceRepo) Find(uid uint64, page, pageSize int) ([]models.DeviceModel,
 	return devices, total, nil
 }
 
+// 列出设备SN, tenantId为0时按uid查; sel为nil时不过滤
+func (p *deviceRepo) FindSNs(tenantId, uid uint64, sel *models.DeviceSelector) ([]string, error) {
+	var sns []string
+
+	tx := common.OrmCli.Model(&models.DeviceModel{})
+	if tenantId > 0 {
+		tx = tx.Where("tenant_id = ?", tenantId)
+	} else {
+		tx = tx.Where("uid = ?", uid)
+	}
+	if sel != nil {
+		if len(sel.Devices) > 0 {
+			tx = tx.Where("sn IN ?", []string(sel.Devices))
+		}
+		tx = selectorScope(tx, sel.Group, sel.Tags)
+	}
+
+	err := tx.Pluck("sn", &sns).Error
+	return sns, err
+}
+
+// 分组包括下级分组，标签要都有
+func selectorScope(tx *gorm.DB, group string, tags []string) *gorm.DB {
+	if group != "" {
+		tx = tx.Where("(group_name = ? OR group_name LIKE ?)", group, escapeLike(group)+"/%")
+	}
+	if len(tags) > 0 {
+		tagsJson, _ := json.Marshal(tags)
+		tx = tx.Where("tags::jsonb @> ?::jsonb", string(tagsJson))
+	}
+	return tx
+}
+
+// LIKE里的通配符当普通字符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// Label 批量设置设备的分组、备注和标签; tags是每台设备新的标签，为nil时不改
+func (p *deviceRepo) Label(tenantId, uid uint64, sns []string, fields map[string]interface{}, tags map[string]models.StringArr) error {
+	owner := func(tx *gorm.DB) *gorm.DB {
+		if tenantId > 0 {
+			return tx.Where("tenant_id = ?", tenantId)
+		}
+		return tx.Where("uid = ?", uid)
+	}
+
+	now := time.Now().UnixMilli()
+	return common.OrmCli.Transaction(func(tx *gorm.DB) error {
+		if len(fields) > 0 {
+			fields["update_time"] = now
+			if err := tx.Model(&models.DeviceModel{}).Scopes(owner).Where("sn IN ?", sns).Updates(fields).Error; err != nil {
+				return err
+			}
+		}
+		for sn, t := range tags {
+			if err := tx.Model(&models.DeviceModel{}).Scopes(owner).Where("sn = ?", sn).Updates(map[string]interface{}{
+				"tags":        t,
+				"update_time": now,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// FindTags 租户(tenantId为0时用户)的设备现在的标签
+func (p *deviceRepo) FindTags(tenantId, uid uint64, sns []string) (map[string]models.StringArr, error) {
+	var rr []models.DeviceModel
+	tx := common.OrmCli.Select("sn", "tags").Where("sn IN ?", sns)
+	if tenantId > 0 {
+		tx = tx.Where("tenant_id = ?", tenantId)
+	} else {
+		tx = tx.Where("uid = ?", uid)
+	}
+	if err := tx.Find(&rr).Error; err != nil {
+		return nil, err
+	}
+	rst := make(map[string]models.StringArr, len(rr))
+	for _, r := range rr {
+		rst[r.SN] = r.Tags
+	}
+	return rst, nil
+}
+
+// GroupCounts 每个分组的设备数，没分组的是空字符串
+func (p *deviceRepo) GroupCounts(tenantId, uid uint64) (map[string]int64, error) {
+	var rr []struct {
+		GroupName string
+		Count     int64
+	}
+
+	tx := common.OrmCli.Model(&models.DeviceModel{})
+	if tenantId > 0 {
+		tx = tx.Where("tenant_id = ?", tenantId)
+	} else {
+		tx = tx.Where("uid = ?", uid)
+	}
+	if err := tx.Select("COALESCE(group_name, '') AS group_name, COUNT(*) AS count").Group("COALESCE(group_name, '')").Scan(&rr).Error; err != nil {
+		return nil, err
+	}
+
+	rst := make(map[string]int64, len(rr))
+	for _, r := range rr {
+		rst[r.GroupName] += r.Count
+	}
+	return rst, nil
+}
+
+// TagCounts 每个标签的设备数，多的在前
+func (p *deviceRepo) TagCounts(tenantId, uid uint64) ([]models.DeviceTagCount, error) {
+	var rr []models.DeviceTagCount
+
+	tx := common.OrmCli.Table("device, jsonb_array_elements_text(CASE WHEN jsonb_typeof(device.tags::jsonb) = 'array' THEN device.tags::jsonb ELSE '[]'::jsonb END) AS t(tag)")
+	if tenantId > 0 {
+		tx = tx.Where("device.tenant_id = ?", tenantId)
+	} else {
+		tx = tx.Where("device.uid = ?", uid)
+	}
+	err := tx.Select("t.tag AS tag, COUNT(*) AS count").Group("t.tag").Order("count DESC, tag").Scan(&rr).Error
+	return rr, err
+}
+
+// UpdateNet 更新设备的NAT类型、公网地址和归属地
+func (p *deviceRepo) UpdateNet(sn string, m *models.DeviceModel) error {
+	now := time.Now().UnixMilli()
+	tx := common.OrmCli.Model(&models.DeviceModel{}).Where("sn = ?", sn).Updates(map[string]interface{}{
+		"nat_type":        m.NatType,
+		"public_ipv4":     m.PublicIPv4,
+		"public_ipv6":     m.PublicIPv6,
+		"local_ipv4":      m.LocalIPv4,
+		"isp":             m.ISP,
+		"country":         m.Country,
+		"province":        m.Province,
+		"city":            m.City,
+		"net_update_time": m.NetUpdateTime,
+		"update_time":     now,
+	})
+	return tx.Error
+}
+
+// 按清单过滤的子查询，没有清单条件时返回nil
+func inventoryFilter(filter *models.DeviceFilter) *gorm.DB {
+	tx := common.OrmCli.Model(&models.DeviceInventory{}).Select("sn")
+	n := 0
+	like := func(column, v string) {
+		if v != "" {
+			tx = tx.Where(column+" ILIKE ?", "%"+v+"%")
+			n++
+		}
+	}
+
+	like("cpu_model", filter.CpuModel)
+	like("platform", filter.Platform)
+	like("sys_vendor", filter.Vendor)
+	like("product_name", filter.Product)
+	if filter.Arch != "" {
+		tx = tx.Where("arch = ?", filter.Arch)
+		n++
+	}
+	if filter.Kernel != "" {
+		tx = tx.Where("kernel_version LIKE ?", filter.Kernel+"%")
+		n++
+	}
+	if filter.MinMemory > 0 {
+		tx = tx.Where("memory_total >= ?", filter.MinMemory)
+		n++
+	}
+	if filter.DiskModel != "" {
+		tx = tx.Where("EXISTS (SELECT 1 FROM jsonb_array_elements(disks::jsonb) d WHERE d->>'model' ILIKE ?)", "%"+filter.DiskModel+"%")
+		n++
+	}
+	if filter.NicDriver != "" {
+		tx = tx.Where("EXISTS (SELECT 1 FROM jsonb_array_elements(nics::jsonb) n WHERE n->>'driver' = ?)", filter.NicDriver)
+		n++
+	}
+	if filter.Mac != "" {
+		tx = tx.Where("EXISTS (SELECT 1 FROM jsonb_array_elements(nics::jsonb) n WHERE LOWER(n->>'mac') = LOWER(?))", filter.Mac)
+		n++
+	}
+
+	if n == 0 {
+		return nil
+	}
+	return tx
+}
+
+func splitFilter(s string) []string {
+	var rst []string
+	for _, one := range strings.Split(s, ",") {
+		if one = strings.TrimSpace(one); one != "" {
+			rst = append(rst, one)
+		}
+	}
+	return rst
+}
+
 // 更新设备
 func (p *deviceRepo) Update(req *models.DeviceModel) error {
 	req.UpdateTime = time.Now().UnixMilli()
@@ -62,6 +314,16 @@ func (p *deviceRepo) Update(req *models.DeviceModel) error {
 	return tx.Error
 }
 
+// SetToken 保存设备凭证的hash
+func (p *deviceRepo) SetToken(sn, tokenHash string) error {
+	now := time.Now().UnixMilli()
+	return common.OrmCli.Model(&models.DeviceModel{}).Where("sn = ?", sn).Updates(map[string]interface{}{
+		"token_hash":  tokenHash,
+		"enroll_time": now,
+		"update_time": now,
+	}).Error
+}
+
 // 删除设备
 func (p *deviceRepo) Delete(id, uid uint64) error {
 	tx := common.OrmCli.Where("id = ? AND uid = ?", id, uid).Delete(&models.DeviceModel{})
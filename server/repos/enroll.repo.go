@@ -0,0 +1,106 @@
+package repos
+
+import (
+	"time"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type devicePendingRepo struct {
+}
+
+// Touch 记下连上来的未认领设备。认领码和输错次数保留第一次的，
+// 只有管理员重置或者过期删掉以后才会换成新的
+func (p *devicePendingRepo) Touch(m *models.DevicePending) error {
+	return touchPending(common.OrmCli, m).Error
+}
+
+func touchPending(db *gorm.DB, m *models.DevicePending) *gorm.DB {
+	now := time.Now().UnixMilli()
+	m.FirstSeen, m.LastSeen = now, now
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "sn"}},
+		DoUpdates: clause.AssignmentColumns([]string{"version", "remote_addr", "last_seen"}),
+	}).Create(m)
+}
+
+// CountBySource 同一个来源地址的其它待认领设备数
+func (p *devicePendingRepo) CountBySource(remoteAddr, exceptSN string) (int64, error) {
+	var total int64
+	err := common.OrmCli.Model(&models.DevicePending{}).Where("remote_addr = ? AND sn <> ?", remoteAddr, exceptSN).Count(&total).Error
+	return total, err
+}
+
+// DeleteBefore 删掉lastSeen之前就没再连上来的
+func (p *devicePendingRepo) DeleteBefore(lastSeen int64) (int64, error) {
+	tx := common.OrmCli.Where("last_seen < ?", lastSeen).Delete(&models.DevicePending{})
+	return tx.RowsAffected, tx.Error
+}
+
+// 没有时返回nil
+func (p *devicePendingRepo) Get(sn string) (*models.DevicePending, error) {
+	var rr []models.DevicePending
+	if err := common.OrmCli.Where("sn = ?", sn).Limit(1).Find(&rr).Error; err != nil {
+		return nil, err
+	}
+	if len(rr) == 0 {
+		return nil, nil
+	}
+	return &rr[0], nil
+}
+
+// 最近连上来的在前
+func (p *devicePendingRepo) Find(page, pageSize int) ([]models.DevicePending, int64, error) {
+	var rr []models.DevicePending
+	var total int64
+
+	tx := common.OrmCli.Model(&models.DevicePending{})
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := tx.Order("last_seen DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&rr).Error
+	return rr, total, err
+}
+
+func (p *devicePendingRepo) AddAttempt(sn string) error {
+	return common.OrmCli.Model(&models.DevicePending{}).Where("sn = ?", sn).
+		Update("attempts", gorm.Expr("attempts + 1")).Error
+}
+
+func (p *devicePendingRepo) Delete(sn string) error {
+	return common.OrmCli.Where("sn = ?", sn).Delete(&models.DevicePending{}).Error
+}
+
+// Approve 手动添加的设备用认领码认领: 记下认领码并移出待认领列表，设备下次认证时拿到凭证
+func (p *devicePendingRepo) Approve(sn, claimCodeHash string) error {
+	return common.OrmCli.Transaction(func(tx *gorm.DB) error {
+		rst := tx.Model(&models.DeviceModel{}).Where("sn = ? AND COALESCE(token_hash, '') = ''", sn).Updates(map[string]interface{}{
+			"claim_code_hash": claimCodeHash,
+			"update_time":     time.Now().UnixMilli(),
+		})
+		if rst.Error != nil {
+			return rst.Error
+		}
+		if rst.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("sn = ?", sn).Delete(&models.DevicePending{}).Error
+	})
+}
+
+// Claim 新增认领的设备并移出待认领列表
+func (p *devicePendingRepo) Claim(dev *models.DeviceModel) (uint64, error) {
+	dev.CreateTime = time.Now().UnixMilli()
+	dev.UpdateTime = dev.CreateTime
+	err := common.OrmCli.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(dev).Error; err != nil {
+			return err
+		}
+		return tx.Where("sn = ?", dev.SN).Delete(&models.DevicePending{}).Error
+	})
+	return dev.Id, err
+}
@@ -0,0 +1,42 @@
+package repos
+
+import (
+	"strings"
+	"testing"
+
+	"pcdn-server/models"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// go test -v -count=1 -run TestTouchPending pcdn-server/repos
+func TestTouchPending(t *testing.T) {
+	// 不连数据库，只生成SQL
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 别的设备拿同一个SN和另一个认领码再连上来，不能换掉第一次的认领码，也不能清零输错次数
+	tx := touchPending(db, &models.DevicePending{SN: "TEST-PENDING", ClaimCodeHash: "other", Version: "1.0"})
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	sql := tx.Statement.SQL.String()
+	i := strings.Index(sql, "DO UPDATE SET")
+	if i < 0 {
+		t.Fatalf("no upsert: %s", sql)
+	}
+	update := sql[i:]
+	for _, col := range []string{`"version"`, `"remote_addr"`, `"last_seen"`} {
+		if !strings.Contains(update, col) {
+			t.Errorf("%s not updated: %s", col, update)
+		}
+	}
+	for _, col := range []string{"claim_code_hash", "attempts", "first_seen"} {
+		if strings.Contains(update, col) {
+			t.Errorf("%s updated: %s", col, update)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package repos
+
+import (
+	"pcdn-server/common"
+	"pcdn-server/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type inventoryRepo struct {
+}
+
+// 设备当前的清单，没有上报过时返回nil
+func (p *inventoryRepo) Get(sn string) (*models.DeviceInventory, error) {
+	var rr []models.DeviceInventory
+	if err := common.OrmCli.Where("sn = ?", sn).Limit(1).Find(&rr).Error; err != nil {
+		return nil, err
+	}
+	if len(rr) == 0 {
+		return nil, nil
+	}
+	return &rr[0], nil
+}
+
+// Save 保存新清单并记一条变化历史
+func (p *inventoryRepo) Save(m *models.DeviceInventory, history *models.DeviceInventoryHistory) error {
+	return common.OrmCli.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "sn"}},
+			UpdateAll: true,
+		}).Omit("id").Create(m).Error; err != nil {
+			return err
+		}
+		return tx.Create(history).Error
+	})
+}
+
+// 设备清单的变化历史，最新的在前
+func (p *inventoryRepo) FindHistory(sn string, page, pageSize int) ([]models.DeviceInventoryHistory, int64, error) {
+	var rr []models.DeviceInventoryHistory
+	var total int64
+
+	tx := common.OrmCli.Model(&models.DeviceInventoryHistory{}).Where("sn = ?", sn)
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := tx.Order("id desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&rr).Error
+	return rr, total, err
+}
@@ -0,0 +1,92 @@
+package repos
+
+import (
+	"fmt"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+
+	"gorm.io/gorm/clause"
+)
+
+// MetricsStore 设备指标的时序存储，按models.MetricTiers分层保存
+type MetricsStore interface {
+	// 写入第一层
+	Write(points []models.MetricPoint) error
+	// 按step(毫秒)聚合查询一台设备[start, end)的指标，label为空时查所有label
+	Query(tier models.MetricTier, sn string, metrics []string, label string, start, end, step int64) ([]models.MetricPoint, error)
+	// 多台设备的指标按时间相加，每台设备先在step内求平均
+	QuerySum(tier models.MetricTier, sns []string, metric, label string, start, end, step int64) ([]models.MetricPoint, error)
+	// 把from层[start, end)的数据降采样到to层
+	Rollup(from, to models.MetricTier, start, end int64) error
+	// 层里最新的时间，没有数据时为0
+	LastTs(tier models.MetricTier) (int64, error)
+	// 删除层里早于before的数据
+	Expire(tier models.MetricTier, before int64) error
+}
+
+// 用PostgreSQL表保存，每层一张表
+type pgMetricsStore struct {
+}
+
+func (p *pgMetricsStore) Write(points []models.MetricPoint) error {
+	if len(points) == 0 {
+		return nil
+	}
+	return common.OrmCli.Table(models.MetricTiers[0].Table).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		CreateInBatches(points, 500).Error
+}
+
+func (p *pgMetricsStore) Query(tier models.MetricTier, sn string, metrics []string, label string, start, end, step int64) ([]models.MetricPoint, error) {
+	var rr []models.MetricPoint
+
+	bucket := fmt.Sprintf("ts / %d * %d", step, step)
+	tx := common.OrmCli.Table(tier.Table).
+		Select(bucket+" AS ts, metric, label, SUM(avg_value * samples) / SUM(samples) AS avg_value, MIN(min_value) AS min_value, MAX(max_value) AS max_value, SUM(samples) AS samples").
+		Where("sn = ? AND metric IN ? AND ts >= ? AND ts < ?", sn, metrics, start, end)
+	if label != "" {
+		tx = tx.Where("label = ?", label)
+	}
+
+	err := tx.Group("metric, label, " + bucket).Order("metric, label, ts").Find(&rr).Error
+	return rr, err
+}
+
+func (p *pgMetricsStore) QuerySum(tier models.MetricTier, sns []string, metric, label string, start, end, step int64) ([]models.MetricPoint, error) {
+	var rr []models.MetricPoint
+	if len(sns) == 0 {
+		return rr, nil
+	}
+
+	bucket := fmt.Sprintf("ts / %d * %d", step, step)
+	sub := common.OrmCli.Table(tier.Table).
+		Select("sn, "+bucket+" AS ts, SUM(avg_value * samples) / SUM(samples) AS v, MIN(min_value) AS min_v, MAX(max_value) AS max_v").
+		Where("sn IN ? AND metric = ? AND label = ? AND ts >= ? AND ts < ?", sns, metric, label, start, end).
+		Group("sn, " + bucket)
+
+	err := common.OrmCli.Table("(?) AS d", sub).
+		Select("ts, SUM(v) AS avg_value, SUM(min_v) AS min_value, SUM(max_v) AS max_value, COUNT(*) AS samples").
+		Group("ts").Order("ts").Find(&rr).Error
+	return rr, err
+}
+
+func (p *pgMetricsStore) Rollup(from, to models.MetricTier, start, end int64) error {
+	sql := fmt.Sprintf(`INSERT INTO %s (sn, metric, label, ts, avg_value, min_value, max_value, samples)
+SELECT sn, metric, label, ts / %d * %d, SUM(avg_value * samples) / SUM(samples), MIN(min_value), MAX(max_value), SUM(samples)
+FROM %s WHERE ts >= ? AND ts < ?
+GROUP BY sn, metric, label, ts / %d * %d
+ON CONFLICT DO NOTHING`, to.Table, to.Step, to.Step, from.Table, to.Step, to.Step)
+
+	return common.OrmCli.Exec(sql, start, end).Error
+}
+
+func (p *pgMetricsStore) LastTs(tier models.MetricTier) (int64, error) {
+	var ts int64
+	err := common.OrmCli.Table(tier.Table).Select("COALESCE(MAX(ts), 0)").Scan(&ts).Error
+	return ts, err
+}
+
+func (p *pgMetricsStore) Expire(tier models.MetricTier, before int64) error {
+	return common.OrmCli.Table(tier.Table).Where("ts < ?", before).Delete(&models.MetricPoint{}).Error
+}
@@ -0,0 +1,35 @@
+package repos
+
+import (
+	"time"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+)
+
+type probeRepo struct {
+}
+
+func (p *probeRepo) Save(m *models.ProbeTargetModel) (uint64, error) {
+	m.UpdateTime = time.Now().UnixMilli()
+	if m.Id == 0 {
+		m.CreateTime = m.UpdateTime
+		err := common.OrmCli.Create(m).Error
+		return m.Id, err
+	}
+	err := common.OrmCli.Model(&models.ProbeTargetModel{}).Where("id = ? AND uid = ?", m.Id, m.UserId).
+		Select("name", "type", "target", "interval_sec", "probe_count", "timeout_ms", "dns_server", "devices", "group_name", "tags", "update_time").
+		Updates(m).Error
+	return m.Id, err
+}
+
+func (p *probeRepo) Delete(id, uid uint64) error {
+	return common.OrmCli.Where("id = ? AND uid = ?", id, uid).Delete(&models.ProbeTargetModel{}).Error
+}
+
+// tenantId>0时按租户查，否则按uid查
+func (p *probeRepo) Find(tenantId, uid uint64) ([]models.ProbeTargetModel, error) {
+	var rr []models.ProbeTargetModel
+	err := common.OrmCli.Scopes(ownerScope(tenantId, uid)).Order("id").Find(&rr).Error
+	return rr, err
+}
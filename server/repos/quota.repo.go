@@ -0,0 +1,74 @@
+package repos
+
+import (
+	"strings"
+	"time"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+
+	"gorm.io/gorm"
+)
+
+type trafficQuotaRepo struct {
+}
+
+// 保存配额设置，已有记录时只更新设置，不动用量
+func (p *trafficQuotaRepo) Save(m *models.TrafficQuotaModel) error {
+	m.CreateTime = time.Now().UnixMilli()
+	m.UpdateTime = m.CreateTime
+
+	err := common.OrmCli.Create(m).Error
+	if err != nil && (strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "UNIQUE constraint failed")) {
+		return common.OrmCli.Model(&models.TrafficQuotaModel{}).Where("sn = ?", m.SN).
+			Select("quota_gb", "reset_day", "direction", "actions", "update_time").Updates(m).Error
+	}
+	return err
+}
+
+func (p *trafficQuotaRepo) GetBySN(sn string) (*models.TrafficQuotaModel, error) {
+	m := &models.TrafficQuotaModel{}
+	err := common.OrmCli.Where("sn = ?", sn).First(m).Error
+	return m, err
+}
+
+func (p *trafficQuotaRepo) Delete(sn string) error {
+	return common.OrmCli.Where("sn = ?", sn).Delete(&models.TrafficQuotaModel{}).Error
+}
+
+// 分页列出配额, tenantId和uid都为0时列出全部
+func (p *trafficQuotaRepo) Find(tenantId, uid uint64, page, pageSize int) ([]models.TrafficQuotaModel, error) {
+	var rr []models.TrafficQuotaModel
+
+	tx := common.OrmCli.Model(&models.TrafficQuotaModel{})
+	if tenantId > 0 {
+		tx = tx.Where("tenant_id = ?", tenantId)
+	} else if uid > 0 {
+		tx = tx.Where("uid = ?", uid)
+	}
+
+	err := tx.Order("id").Offset((page - 1) * pageSize).Limit(pageSize).Find(&rr).Error
+	return rr, err
+}
+
+// 累加用量，没有配额的设备不会更新
+func (p *trafficQuotaRepo) AddUsage(sn string, sent, recv uint64) error {
+	return common.OrmCli.Model(&models.TrafficQuotaModel{}).Where("sn = ?", sn).Updates(map[string]interface{}{
+		"used_send": gorm.Expr("used_send + ?", sent),
+		"used_recv": gorm.Expr("used_recv + ?", recv),
+	}).Error
+}
+
+// 更新阈值触发状态，不动用量
+func (p *trafficQuotaRepo) UpdateState(m *models.TrafficQuotaModel) error {
+	m.UpdateTime = time.Now().UnixMilli()
+	return common.OrmCli.Model(&models.TrafficQuotaModel{}).Where("sn = ?", m.SN).
+		Select("triggered", "enforced", "enforced_rate", "update_time").Updates(m).Error
+}
+
+// 进入新的计费周期，用量和状态清零
+func (p *trafficQuotaRepo) ResetCycle(m *models.TrafficQuotaModel) error {
+	m.UpdateTime = time.Now().UnixMilli()
+	return common.OrmCli.Model(&models.TrafficQuotaModel{}).Where("sn = ?", m.SN).
+		Select("cycle_start", "used_send", "used_recv", "triggered", "enforced", "enforced_rate", "update_time").Updates(m).Error
+}
@@ -0,0 +1,85 @@
+package repos
+
+import (
+	"pcdn-server/common"
+	"pcdn-server/models"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// rbacRepo 实现casbin的persist.Adapter，策略存在rbac_rule表里
+type rbacRepo struct {
+}
+
+func (p *rbacRepo) LoadPolicy(m model.Model) error {
+	var rules []models.RbacRule
+	if err := common.OrmCli.Order("id").Find(&rules).Error; err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		line := []string{rule.Ptype, rule.V0, rule.V1, rule.V2, rule.V3}
+		// 去掉后面没用到的字段
+		for len(line) > 1 && line[len(line)-1] == "" {
+			line = line[:len(line)-1]
+		}
+		if err := persist.LoadPolicyArray(line, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *rbacRepo) SavePolicy(m model.Model) error {
+	var rules []models.RbacRule
+	for _, sec := range []string{"p", "g"} {
+		for ptype, ast := range m[sec] {
+			for _, rule := range ast.Policy {
+				rules = append(rules, rbacRule(ptype, rule))
+			}
+		}
+	}
+
+	return common.OrmCli.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&models.RbacRule{}).Error; err != nil {
+			return err
+		}
+		if len(rules) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(rules, 500).Error
+	})
+}
+
+func (p *rbacRepo) AddPolicy(sec string, ptype string, rule []string) error {
+	m := rbacRule(ptype, rule)
+	return common.OrmCli.Clauses(clause.OnConflict{DoNothing: true}).Create(&m).Error
+}
+
+func (p *rbacRepo) RemovePolicy(sec string, ptype string, rule []string) error {
+	return p.RemoveFilteredPolicy(sec, ptype, 0, rule...)
+}
+
+// 从fieldIndex开始按fieldValues过滤，空值不过滤
+func (p *rbacRepo) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	tx := common.OrmCli.Where("ptype = ?", ptype)
+	columns := []string{"v0", "v1", "v2", "v3"}
+	for i, v := range fieldValues {
+		if v != "" && fieldIndex+i < len(columns) {
+			tx = tx.Where(columns[fieldIndex+i]+" = ?", v)
+		}
+	}
+	return tx.Delete(&models.RbacRule{}).Error
+}
+
+func rbacRule(ptype string, rule []string) models.RbacRule {
+	m := models.RbacRule{Ptype: ptype}
+	fields := []*string{&m.V0, &m.V1, &m.V2, &m.V3}
+	for i := 0; i < len(rule) && i < len(fields); i++ {
+		*fields[i] = rule[i]
+	}
+	return m
+}
@@ -1,6 +1,8 @@
 package repos
 
 import (
+	"fmt"
+
 	"pcdn-server/common"
 	"pcdn-server/models"
 
@@ -8,9 +10,24 @@ import (
 )
 
 var (
-	DeviceRepo      = &deviceRepo{}
-	BusinessLogRepo = &businessLogRepo{}
-	TcRepo          *tcRepo
+	DeviceRepo       = &deviceRepo{}
+	BusinessLogRepo  = &businessLogRepo{}
+	BandwidthRepo    = &bandwidthRepo{}
+	TcAdaptiveRepo   = &tcAdaptiveRepo{}
+	TrafficQuotaRepo = &trafficQuotaRepo{}
+	SiteRepo         = &siteRepo{}
+	SessionRepo      = &sessionRepo{}
+	AlertRepo        = &alertRepo{}
+	ProbeRepo        = &probeRepo{}
+	InventoryRepo    = &inventoryRepo{}
+	TrafficRepo      = &trafficRepo{}
+	RbacRepo         = &rbacRepo{}
+	UserRepo         = &userRepo{}
+
+	DevicePendingRepo = &devicePendingRepo{}
+
+	MetricsRepo MetricsStore = &pgMetricsStore{}
+	TcRepo      *tcRepo
 )
 
 func InitRepos() {
@@ -30,5 +47,59 @@ func InitModels(db *gorm.DB) error {
 		return err
 	}
 
+	if err := db.AutoMigrate(models.BandwidthSample{}); err != nil {
+		return err
+	}
+
+	if err := db.AutoMigrate(models.TcAdaptiveModel{}, models.TcAdjustLog{}); err != nil {
+		return err
+	}
+
+	if err := db.AutoMigrate(models.TrafficQuotaModel{}); err != nil {
+		return err
+	}
+
+	if err := db.AutoMigrate(models.SiteModel{}); err != nil {
+		return err
+	}
+
+	if err := db.AutoMigrate(models.DeviceSession{}); err != nil {
+		return err
+	}
+
+	if err := db.AutoMigrate(models.AlertRule{}, models.AlertChannel{}, models.AlertEvent{}, models.AlertSilence{}); err != nil {
+		return err
+	}
+
+	if err := db.AutoMigrate(models.ProbeTargetModel{}); err != nil {
+		return err
+	}
+
+	if err := db.AutoMigrate(models.DeviceInventory{}, models.DeviceInventoryHistory{}); err != nil {
+		return err
+	}
+
+	if err := db.AutoMigrate(models.TrafficHourly{}); err != nil {
+		return err
+	}
+
+	if err := db.AutoMigrate(models.RbacRule{}); err != nil {
+		return err
+	}
+
+	if err := db.AutoMigrate(models.DevicePending{}); err != nil {
+		return err
+	}
+
+	for _, tier := range models.MetricTiers {
+		if err := db.Table(tier.Table).AutoMigrate(models.MetricPoint{}); err != nil {
+			return err
+		}
+		// 按时间找最新的点和过期删除，主键以sn开头用不上。索引名在库里要唯一，每层各建一个
+		if err := db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_ts ON %s (ts)", tier.Table, tier.Table)).Error; err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
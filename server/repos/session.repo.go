@@ -0,0 +1,96 @@
+package repos
+
+import (
+	"pcdn-server/common"
+	"pcdn-server/models"
+
+	"gorm.io/gorm"
+)
+
+type sessionRepo struct {
+}
+
+func (p *sessionRepo) Create(m *models.DeviceSession) (uint64, error) {
+	if err := common.OrmCli.Create(m).Error; err != nil {
+		return 0, err
+	}
+	return m.Id, nil
+}
+
+// 结束会话
+func (p *sessionRepo) Close(id uint64, endTime int64, reason string) error {
+	return common.OrmCli.Model(&models.DeviceSession{}).Where("id = ? AND end_time = 0", id).
+		Updates(map[string]interface{}{"end_time": endTime, "last_seen": endTime, "reason": reason}).Error
+}
+
+// 更新还在线的会话的最后在线时间
+func (p *sessionRepo) Touch(ids []uint64, lastSeen int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return common.OrmCli.Model(&models.DeviceSession{}).Where("id IN ? AND end_time = 0", ids).
+		Update("last_seen", lastSeen).Error
+}
+
+// 接入服务器重启时结束上次没结束的会话，结束时间按最后在线时间
+func (p *sessionRepo) CloseOpen(accessName, reason string) error {
+	return common.OrmCli.Model(&models.DeviceSession{}).Where("access_name = ? AND end_time = 0", accessName).
+		Updates(map[string]interface{}{"end_time": gorm.Expr("GREATEST(last_seen, start_time)"), "reason": reason}).Error
+}
+
+// 设备的会话，最新的在前
+func (p *sessionRepo) Find(sn string, page, pageSize int) ([]models.DeviceSession, error) {
+	var rr []models.DeviceSession
+	err := common.OrmCli.Where("sn = ?", sn).Order("start_time desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&rr).Error
+	return rr, err
+}
+
+// 和[start, end)有重叠的会话
+func (p *sessionRepo) FindRange(sns []string, start, end int64) ([]models.DeviceSession, error) {
+	var rr []models.DeviceSession
+	if len(sns) == 0 {
+		return rr, nil
+	}
+	err := common.OrmCli.Where("sn IN ? AND start_time < ? AND (end_time = 0 OR end_time > ?)", sns, end, start).
+		Order("sn, start_time").Find(&rr).Error
+	return rr, err
+}
+
+// 每台设备第一次上线的时间
+func (p *sessionRepo) FirstSeen(sns []string) (map[string]int64, error) {
+	rst := make(map[string]int64, len(sns))
+	if len(sns) == 0 {
+		return rst, nil
+	}
+
+	var rows []struct {
+		SN    string
+		First int64
+	}
+	err := common.OrmCli.Model(&models.DeviceSession{}).Select("sn, MIN(start_time) AS first").
+		Where("sn IN ?", sns).Group("sn").Scan(&rows).Error
+	for _, r := range rows {
+		rst[r.SN] = r.First
+	}
+	return rst, err
+}
+
+// 每台设备最后在线的时间，还在线的会话按last_seen算
+func (p *sessionRepo) LastSeen(sns []string) (map[string]int64, error) {
+	rst := make(map[string]int64, len(sns))
+	if len(sns) == 0 {
+		return rst, nil
+	}
+
+	var rows []struct {
+		SN   string
+		Last int64
+	}
+	err := common.OrmCli.Model(&models.DeviceSession{}).
+		Select("sn, MAX(CASE WHEN end_time = 0 THEN last_seen ELSE end_time END) AS last").
+		Where("sn IN ?", sns).Group("sn").Scan(&rows).Error
+	for _, r := range rows {
+		rst[r.SN] = r.Last
+	}
+	return rst, err
+}
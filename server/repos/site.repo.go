@@ -0,0 +1,70 @@
+package repos
+
+import (
+	"encoding/json"
+	"time"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+)
+
+type siteRepo struct {
+}
+
+func (p *siteRepo) Create(m *models.SiteModel) (uint64, error) {
+	m.CreateTime = time.Now().UnixMilli()
+	m.UpdateTime = m.CreateTime
+	if err := common.OrmCli.Create(m).Error; err != nil {
+		return 0, err
+	}
+	return m.Id, nil
+}
+
+// 更新线路设置，不动分配结果
+func (p *siteRepo) Update(m *models.SiteModel) error {
+	m.UpdateTime = time.Now().UnixMilli()
+	return common.OrmCli.Model(&models.SiteModel{}).Where("id = ? AND uid = ?", m.Id, m.UserId).
+		Select("name", "uplink_mbps", "min_mbps", "members", "update_time").Updates(m).Error
+}
+
+func (p *siteRepo) UpdateAllocation(m *models.SiteModel) error {
+	return common.OrmCli.Model(&models.SiteModel{}).Where("id = ?", m.Id).
+		Select("allocation", "rebalance_time").Updates(m).Error
+}
+
+func (p *siteRepo) Delete(id, uid uint64) error {
+	return common.OrmCli.Where("id = ? AND uid = ?", id, uid).Delete(&models.SiteModel{}).Error
+}
+
+func (p *siteRepo) Get(id uint64) (*models.SiteModel, error) {
+	m := &models.SiteModel{}
+	err := common.OrmCli.Where("id = ?", id).First(m).Error
+	return m, err
+}
+
+// 设备所在的线路
+func (p *siteRepo) GetBySN(sn string) (*models.SiteModel, error) {
+	members, err := json.Marshal([]string{sn})
+	if err != nil {
+		return nil, err
+	}
+
+	m := &models.SiteModel{}
+	err = common.OrmCli.Where("members::jsonb @> ?::jsonb", string(members)).First(m).Error
+	return m, err
+}
+
+// tenantId和uid都为0时查所有线路
+func (p *siteRepo) Find(tenantId, uid uint64, page, pageSize int) ([]models.SiteModel, error) {
+	var rr []models.SiteModel
+
+	tx := common.OrmCli.Model(&models.SiteModel{})
+	if tenantId > 0 {
+		tx = tx.Where("tenant_id = ?", tenantId)
+	} else if uid > 0 {
+		tx = tx.Where("uid = ?", uid)
+	}
+
+	err := tx.Order("id").Offset((page - 1) * pageSize).Limit(pageSize).Find(&rr).Error
+	return rr, err
+}
@@ -36,8 +36,8 @@ func (r *tcRepo) Save(tc *models.TcModel) error {
 		// 检查是否是唯一约束错误（SN重复）
 		if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "UNIQUE constraint failed") {
 			// SN重复，执行更新操作
-			tc.CreateTime = 0
-			return r.DB.Where("sn = ?", tc.SN).Updates(tc).Error
+			// 全字段更新，限速值和规则可能被清空
+			return r.DB.Where("sn = ?", tc.SN).Select("*").Omit("id", "create_time").Updates(tc).Error
 		}
 		// 其他错误直接返回
 		return err
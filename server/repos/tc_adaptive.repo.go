@@ -0,0 +1,41 @@
+package repos
+
+import (
+	"strings"
+	"time"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+)
+
+type tcAdaptiveRepo struct {
+}
+
+// 保存自适应限速设置，每个设备一条
+func (p *tcAdaptiveRepo) Save(m *models.TcAdaptiveModel) error {
+	m.CreateTime = time.Now().UnixMilli()
+	m.UpdateTime = m.CreateTime
+
+	err := common.OrmCli.Create(m).Error
+	if err != nil && (strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "UNIQUE constraint failed")) {
+		return common.OrmCli.Where("sn = ?", m.SN).Select("*").Omit("id", "create_time").Updates(m).Error
+	}
+	return err
+}
+
+func (p *tcAdaptiveRepo) GetBySN(sn string) (*models.TcAdaptiveModel, error) {
+	m := &models.TcAdaptiveModel{}
+	err := common.OrmCli.Where("sn = ?", sn).First(m).Error
+	return m, err
+}
+
+func (p *tcAdaptiveRepo) AddAdjustLog(m *models.TcAdjustLog) error {
+	return common.OrmCli.Create(m).Error
+}
+
+// 调整记录，最新的在前
+func (p *tcAdaptiveRepo) FindAdjustLogs(sn string, page, pageSize int) ([]models.TcAdjustLog, error) {
+	var logs []models.TcAdjustLog
+	err := common.OrmCli.Where("sn = ?", sn).Order("id desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&logs).Error
+	return logs, err
+}
@@ -0,0 +1,46 @@
+package repos
+
+import (
+	"pcdn-server/common"
+	"pcdn-server/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type trafficRepo struct {
+}
+
+// 累加到小时流量上，没有这一行时新建。在一个事务里写，失败时整批都没写，可以重试
+func (p *trafficRepo) AddHourly(rows []models.TrafficHourly) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	return common.OrmCli.Transaction(func(tx *gorm.DB) error {
+		return p.addHourly(tx, rows)
+	})
+}
+
+func (p *trafficRepo) addHourly(tx *gorm.DB, rows []models.TrafficHourly) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "sn"}, {Name: "iface"}, {Name: "ts"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"bytes_sent":   gorm.Expr("traffic_hourly.bytes_sent + excluded.bytes_sent"),
+			"bytes_recv":   gorm.Expr("traffic_hourly.bytes_recv + excluded.bytes_recv"),
+			"packets_sent": gorm.Expr("traffic_hourly.packets_sent + excluded.packets_sent"),
+			"packets_recv": gorm.Expr("traffic_hourly.packets_recv + excluded.packets_recv"),
+			"resets":       gorm.Expr("traffic_hourly.resets + excluded.resets"),
+		}),
+	}).CreateInBatches(&rows, 500).Error
+}
+
+// 设备[start, end)的小时流量，iface为空时所有网卡
+func (p *trafficRepo) FindHourly(sn, iface string, start, end int64) ([]models.TrafficHourly, error) {
+	var rr []models.TrafficHourly
+	tx := common.OrmCli.Where("sn = ? AND ts >= ? AND ts < ?", sn, start, end)
+	if iface != "" {
+		tx = tx.Where("iface = ?", iface)
+	}
+	err := tx.Order("ts, iface").Find(&rr).Error
+	return rr, err
+}
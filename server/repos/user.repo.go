@@ -0,0 +1,23 @@
+package repos
+
+import (
+	"pcdn-server/common"
+
+	"gorm.io/gorm"
+)
+
+// userRepo passport的用户表，和业务表在同一个库
+type userRepo struct {
+}
+
+// TenantID 用户所在的租户，用户不存在时返回gorm.ErrRecordNotFound
+func (p *userRepo) TenantID(uid uint64) (uint64, error) {
+	var rr []uint64
+	if err := common.OrmCli.Table("users").Where("uid = ?", uid).Limit(1).Pluck("tenant_id", &rr).Error; err != nil {
+		return 0, err
+	}
+	if len(rr) == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return rr[0], nil
+}
@@ -0,0 +1,747 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+	"pcdn-server/repos"
+	"pcdn-server/tcpservice"
+
+	passportprotos "github.com/liuhengloveyou/passport/protos"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// 上行流量下降规则和之前这么长时间的平均值比
+	alertDropBaseline = time.Hour
+	// 基线低于这个值(bits/s)时不判断下降
+	alertDropMinBits = 1000 * 1000
+)
+
+type alertService struct {
+}
+
+// 一次检查的结果
+type alertCheck struct {
+	firing  bool
+	value   float64
+	message string
+}
+
+func (s *alertService) SaveRule(sessionUser *passportprotos.User, m *models.AlertRule) (uint64, error) {
+	if err := validateAlertRule(m); err != nil {
+		return 0, err
+	}
+	// 只能是自己的设备
+	sel := &models.DeviceSelector{Devices: m.Devices, Group: m.Group, Tags: m.Tags}
+	if err := normalizeSelector(sessionUser, sel); err != nil {
+		return 0, err
+	}
+	m.Devices, m.Group, m.Tags = sel.Devices, sel.Group, sel.Tags
+	if err := s.checkChannels(sessionUser, m.Channels); err != nil {
+		return 0, err
+	}
+	m.UserId = sessionUser.UID
+	m.TenantId = sessionUser.TenantID
+
+	id, err := repos.AlertRepo.SaveRule(m)
+	if err != nil {
+		logger.Error("alertService.SaveRule DB ERR: ", zap.Error(err))
+		return 0, common.ErrService
+	}
+	return id, nil
+}
+
+func (s *alertService) DeleteRule(sessionUser *passportprotos.User, id uint64) error {
+	if id == 0 {
+		return common.ErrParam
+	}
+	if err := repos.AlertRepo.DeleteRule(id, sessionUser.UID); err != nil {
+		logger.Error("alertService.DeleteRule DB ERR: ", zap.Error(err))
+		return common.ErrService
+	}
+	return nil
+}
+
+func (s *alertService) ListRules(sessionUser *passportprotos.User) ([]models.AlertRule, error) {
+	rr, err := repos.AlertRepo.FindRules(sessionUser.TenantID, sessionUser.UID)
+	if err != nil {
+		logger.Error("alertService.ListRules DB ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+	return rr, nil
+}
+
+// 修改渠道时密码和密钥为空表示不改
+func (s *alertService) SaveChannel(sessionUser *passportprotos.User, m *models.AlertChannel) (uint64, error) {
+	if err := validateAlertChannel(m); err != nil {
+		return 0, err
+	}
+	m.UserId = sessionUser.UID
+	m.TenantId = sessionUser.TenantID
+
+	if m.Id > 0 {
+		old, err := repos.AlertRepo.GetChannel(m.Id)
+		if err != nil || old.UserId != sessionUser.UID {
+			return 0, common.ErrNoAuth
+		}
+		if m.Password == "" {
+			m.Password = old.Password
+		}
+		if m.Secret == "" {
+			m.Secret = old.Secret
+		}
+	}
+
+	id, err := repos.AlertRepo.SaveChannel(m)
+	if err != nil {
+		logger.Error("alertService.SaveChannel DB ERR: ", zap.Error(err))
+		return 0, common.ErrService
+	}
+	return id, nil
+}
+
+func (s *alertService) DeleteChannel(sessionUser *passportprotos.User, id uint64) error {
+	if id == 0 {
+		return common.ErrParam
+	}
+	if err := repos.AlertRepo.DeleteChannel(id, sessionUser.UID); err != nil {
+		logger.Error("alertService.DeleteChannel DB ERR: ", zap.Error(err))
+		return common.ErrService
+	}
+	return nil
+}
+
+// 列出通知渠道，不返回密码和密钥
+func (s *alertService) ListChannels(sessionUser *passportprotos.User) ([]models.AlertChannel, error) {
+	rr, err := repos.AlertRepo.FindChannels(sessionUser.TenantID, sessionUser.UID)
+	if err != nil {
+		logger.Error("alertService.ListChannels DB ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+	for i := range rr {
+		rr[i].Password = ""
+		rr[i].Secret = ""
+	}
+	return rr, nil
+}
+
+// TestChannel 发一条测试通知，返回渠道的错误
+func (s *alertService) TestChannel(sessionUser *passportprotos.User, id uint64) error {
+	ch, err := repos.AlertRepo.GetChannel(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return common.ErrParam
+		}
+		logger.Error("alertService.TestChannel DB ERR: ", zap.Error(err))
+		return common.ErrService
+	}
+	if !ownsAlertObject(sessionUser, ch.TenantId, ch.UserId) {
+		return common.ErrNoAuth
+	}
+
+	now := time.Now().UnixMilli()
+	return sendAlertNotice(ch, &alertNotice{
+		Status:    models.ALERT_STATUS_FIRING,
+		RuleName:  "测试通知",
+		Severity:  "info",
+		SN:        "TEST",
+		Message:   "这是一条测试通知，收到说明通知渠道配置正确",
+		StartTime: now,
+	})
+}
+
+func (s *alertService) SaveSilence(sessionUser *passportprotos.User, m *models.AlertSilence) (uint64, error) {
+	now := time.Now().UnixMilli()
+	if m.StartTime == 0 {
+		m.StartTime = now
+	}
+	if m.EndTime <= m.StartTime || m.EndTime <= now {
+		return 0, common.ErrParam
+	}
+	m.Id = 0
+	// SN为空时对规则的所有设备生效
+	if m.SN = strings.ToUpper(strings.TrimSpace(m.SN)); m.SN != "" {
+		if _, err := DeviceService.Authorize(sessionUser, m.SN, "alert/silence"); err != nil {
+			return 0, err
+		}
+	}
+	m.UserId = sessionUser.UID
+	m.TenantId = sessionUser.TenantID
+
+	id, err := repos.AlertRepo.CreateSilence(m)
+	if err != nil {
+		logger.Error("alertService.SaveSilence DB ERR: ", zap.Error(err))
+		return 0, common.ErrService
+	}
+	return id, nil
+}
+
+func (s *alertService) DeleteSilence(sessionUser *passportprotos.User, id uint64) error {
+	if id == 0 {
+		return common.ErrParam
+	}
+	if err := repos.AlertRepo.DeleteSilence(id, sessionUser.UID); err != nil {
+		logger.Error("alertService.DeleteSilence DB ERR: ", zap.Error(err))
+		return common.ErrService
+	}
+	return nil
+}
+
+// 还没过期的静默
+func (s *alertService) ListSilences(sessionUser *passportprotos.User) ([]models.AlertSilence, error) {
+	rr, err := repos.AlertRepo.FindSilences(sessionUser.TenantID, sessionUser.UID, time.Now().UnixMilli())
+	if err != nil {
+		logger.Error("alertService.ListSilences DB ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+	return rr, nil
+}
+
+func (s *alertService) Events(sessionUser *passportprotos.User, status, sn string, page int) (*models.PageResponse, error) {
+	if page < 1 {
+		page = 1
+	}
+	if status != "" && status != models.ALERT_STATUS_FIRING && status != models.ALERT_STATUS_RESOLVED {
+		return nil, common.ErrParam
+	}
+
+	rr, total, err := repos.AlertRepo.FindEvents(sessionUser.TenantID, sessionUser.UID, status, strings.ToUpper(sn), page, 50)
+	if err != nil {
+		logger.Error("alertService.Events DB ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+	return &models.PageResponse{Total: total, List: rr}, nil
+}
+
+// Evaluate 检查所有启用的规则，新触发的告警和恢复的告警发通知。
+// 同一规则同一设备只有一个未恢复的事件，没恢复前不重复通知(除非设置了RepeatMinutes)；
+// 被静默的告警照常记录，但不发通知，静默期间恢复的也不发恢复通知
+func (s *alertService) Evaluate() {
+	start := time.Now()
+	defer func() {
+		promAlertEvaluate.Observe(time.Since(start).Seconds())
+	}()
+	now := start.UnixMilli()
+
+	rules, err := repos.AlertRepo.EnabledRules()
+	if err != nil {
+		logger.Error("alertService.Evaluate DB ERR: ", zap.Error(err))
+		return
+	}
+	events, err := repos.AlertRepo.FiringEvents()
+	if err != nil {
+		logger.Error("alertService.Evaluate DB ERR: ", zap.Error(err))
+		return
+	}
+	silences, err := repos.AlertRepo.ActiveSilences(now)
+	if err != nil {
+		logger.Error("alertService.Evaluate DB ERR: ", zap.Error(err))
+		return
+	}
+
+	firing := make(map[uint64]map[string]*models.AlertEvent)
+	for i := range events {
+		ev := &events[i]
+		if firing[ev.RuleId] == nil {
+			firing[ev.RuleId] = make(map[string]*models.AlertEvent)
+		}
+		firing[ev.RuleId][ev.SN] = ev
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+		ruleEvents := firing[rule.Id]
+		delete(firing, rule.Id)
+
+		sns, err := s.ruleDevices(rule)
+		if err != nil {
+			logger.Error("alertService.Evaluate devices ERR: ", zap.Uint64("rule", rule.Id), zap.Error(err))
+			continue
+		}
+		checks, err := s.check(rule, sns, now)
+		if err != nil {
+			logger.Error("alertService.Evaluate check ERR: ", zap.Uint64("rule", rule.Id), zap.Error(err))
+			continue
+		}
+
+		channels, err := repos.AlertRepo.GetChannels(rule.Channels)
+		if err != nil {
+			logger.Error("alertService.Evaluate DB ERR: ", zap.Error(err))
+		}
+
+		for sn, c := range checks {
+			ev := ruleEvents[sn]
+			switch {
+			case c.firing && ev == nil:
+				ev = &models.AlertEvent{
+					TenantId:  rule.TenantId,
+					UserId:    rule.UserId,
+					RuleId:    rule.Id,
+					RuleName:  rule.Name,
+					Severity:  rule.Severity,
+					SN:        sn,
+					Status:    models.ALERT_STATUS_FIRING,
+					Value:     c.value,
+					Message:   c.message,
+					StartTime: now,
+				}
+				s.notify(rule, ev, channels, silences, now)
+				if _, err := repos.AlertRepo.CreateEvent(ev); err != nil {
+					logger.Error("alertService.Evaluate DB ERR: ", zap.Error(err))
+				}
+			case c.firing:
+				ev.Value = c.value
+				ev.Message = c.message
+				// 静默结束后补发，或者到了重复通知的时间
+				if ev.NotifyCount == 0 || (rule.RepeatMinutes > 0 && now-ev.LastNotify >= rule.RepeatMinutes*60*1000) {
+					s.notify(rule, ev, channels, silences, now)
+				}
+				if err := repos.AlertRepo.UpdateEvent(ev); err != nil {
+					logger.Error("alertService.Evaluate DB ERR: ", zap.Error(err))
+				}
+			case ev != nil:
+				ev.Status = models.ALERT_STATUS_RESOLVED
+				ev.EndTime = now
+				ev.Value = c.value
+				ev.Message = c.message
+				// 发过告警的才发恢复通知
+				if ev.NotifyCount > 0 {
+					s.notify(rule, ev, channels, silences, now)
+				}
+				if err := repos.AlertRepo.UpdateEvent(ev); err != nil {
+					logger.Error("alertService.Evaluate DB ERR: ", zap.Error(err))
+				}
+			}
+		}
+
+		// 不在规则范围里的设备直接结束
+		inScope := make(map[string]bool, len(sns))
+		for _, sn := range sns {
+			inScope[sn] = true
+		}
+		for sn, ev := range ruleEvents {
+			if !inScope[sn] {
+				s.closeEvent(ev, now)
+			}
+		}
+	}
+
+	// 规则停用了
+	for _, ruleEvents := range firing {
+		for _, ev := range ruleEvents {
+			s.closeEvent(ev, now)
+		}
+	}
+}
+
+// 结束告警但不发恢复通知
+func (s *alertService) closeEvent(ev *models.AlertEvent, now int64) {
+	ev.Status = models.ALERT_STATUS_RESOLVED
+	ev.EndTime = now
+	if err := repos.AlertRepo.UpdateEvent(ev); err != nil {
+		logger.Error("alertService.closeEvent DB ERR: ", zap.Error(err))
+	}
+}
+
+// 没被静默时发通知，异步发送，失败只记日志
+func (s *alertService) notify(rule *models.AlertRule, ev *models.AlertEvent, channels []models.AlertChannel, silences []models.AlertSilence, now int64) {
+	if alertSilenced(rule, ev.SN, silences) || len(channels) == 0 {
+		return
+	}
+	ev.LastNotify = now
+	ev.NotifyCount++
+
+	n := &alertNotice{
+		Status:    ev.Status,
+		RuleId:    rule.Id,
+		RuleName:  rule.Name,
+		Severity:  rule.Severity,
+		SN:        ev.SN,
+		Value:     ev.Value,
+		Message:   ev.Message,
+		StartTime: ev.StartTime,
+		EndTime:   ev.EndTime,
+	}
+	for i := range channels {
+		go func(ch *models.AlertChannel) {
+			if err := sendAlertNotice(ch, n); err != nil {
+				logger.Warn("alertService.notify ERR: ", zap.Uint64("channel", ch.Id), zap.String("type", ch.Type), zap.String("sn", n.SN), zap.Error(err))
+			}
+		}(&channels[i])
+	}
+}
+
+// 规则生效的设备
+func (s *alertService) ruleDevices(rule *models.AlertRule) ([]string, error) {
+	if len(rule.Devices) > 0 {
+		return rule.Devices, nil
+	}
+	sns, err := repos.DeviceRepo.FindSNs(rule.TenantId, rule.UserId, &models.DeviceSelector{Group: rule.Group, Tags: rule.Tags})
+	for i := range sns {
+		sns[i] = strings.ToUpper(sns[i])
+	}
+	return sns, err
+}
+
+// 按规则类型检查，没有数据的设备不在结果里，保持原来的状态
+func (s *alertService) check(rule *models.AlertRule, sns []string, now int64) (map[string]alertCheck, error) {
+	switch rule.Type {
+	case models.ALERT_RULE_OFFLINE:
+		return s.checkOffline(rule, sns, now)
+	case models.ALERT_RULE_METRIC:
+		return s.checkMetric(rule, sns, now)
+	case models.ALERT_RULE_THROUGHPUT_DROP:
+		return s.checkThroughputDrop(rule, sns, now)
+	case models.ALERT_RULE_TASK_FAIL:
+		return s.checkTaskFail(rule, sns, now)
+	case models.ALERT_RULE_CONTAINER:
+		return s.checkContainer(rule, sns, now)
+	}
+	return nil, fmt.Errorf("unknown rule type: %s", rule.Type)
+}
+
+// 离线时间按最后一次心跳或会话的最后在线时间算，从没上线过的设备不告警
+func (s *alertService) checkOffline(rule *models.AlertRule, sns []string, now int64) (map[string]alertCheck, error) {
+	statuses, err := tcpservice.GetAgentStatuses(sns)
+	if err != nil {
+		return nil, err
+	}
+	lastSeen, err := repos.SessionRepo.LastSeen(sns)
+	if err != nil {
+		return nil, err
+	}
+
+	rst := make(map[string]alertCheck, len(sns))
+	for _, sn := range sns {
+		agent := statuses[sn]
+		if tcpservice.IsOnline(agent) {
+			rst[sn] = alertCheck{message: "设备在线"}
+			continue
+		}
+		last := lastSeen[sn]
+		if agent != nil && agent.LastHeartbear > last {
+			last = agent.LastHeartbear
+		}
+		if last == 0 {
+			continue
+		}
+		offline := now - last
+		rst[sn] = alertCheck{
+			firing:  offline >= rule.Duration*1000,
+			value:   float64(offline / 1000),
+			message: fmt.Sprintf("离线 %s, 最后在线 %s", (time.Duration(offline) * time.Millisecond).Round(time.Second), time.UnixMilli(last).Format(time.DateTime)),
+		}
+	}
+	return rst, nil
+}
+
+// 窗口内每个label的平均值，label为空时任意一个label超过阈值都算触发，值取最严重的
+func (s *alertService) checkMetric(rule *models.AlertRule, sns []string, now int64) (map[string]alertCheck, error) {
+	tier := models.MetricTiers[0]
+	start := now - rule.Duration*1000
+
+	rst := make(map[string]alertCheck, len(sns))
+	for _, sn := range sns {
+		points, err := repos.MetricsRepo.Query(tier, sn, []string{rule.Metric}, rule.Label, start, now, tier.Step)
+		if err != nil {
+			return nil, err
+		}
+		avgs := avgMetricPoints(points)
+		if len(avgs) == 0 {
+			continue
+		}
+
+		worst, worstLabel := 0.0, ""
+		for label, v := range avgs {
+			if worstLabel == "" || alertCompare(rule.Operator, v, worst) {
+				worst, worstLabel = v, label
+			}
+		}
+		rst[sn] = alertCheck{
+			firing:  alertCompare(rule.Operator, worst, rule.Threshold),
+			value:   worst,
+			message: fmt.Sprintf("%s[%s] %d分钟平均 %.2f, 阈值 %s %.2f", rule.Metric, worstLabel, rule.Duration/60, worst, rule.Operator, rule.Threshold),
+		}
+	}
+	return rst, nil
+}
+
+// 最近Duration秒的上行平均速率和之前一小时比
+func (s *alertService) checkThroughputDrop(rule *models.AlertRule, sns []string, now int64) (map[string]alertCheck, error) {
+	tier := models.MetricTiers[0]
+	step := tier.Step
+	split := now - rule.Duration*1000
+	start := split - alertDropBaseline.Milliseconds()
+
+	rst := make(map[string]alertCheck, len(sns))
+	for _, sn := range sns {
+		points, err := repos.MetricsRepo.Query(tier, sn, []string{models.METRIC_NET_SEND_RATE}, "total", start, now, step)
+		if err != nil {
+			return nil, err
+		}
+
+		var base, cur []models.MetricPoint
+		for _, p := range points {
+			if p.Ts < split {
+				base = append(base, p)
+			} else {
+				cur = append(cur, p)
+			}
+		}
+		baseAvg, curAvg := avgMetricPoints(base)["total"], avgMetricPoints(cur)
+		// 当前没数据是离线了，交给离线规则
+		if len(curAvg) == 0 || baseAvg < alertDropMinBits {
+			continue
+		}
+
+		drop := (baseAvg - curAvg["total"]) / baseAvg * 100
+		rst[sn] = alertCheck{
+			firing:  drop >= rule.Threshold,
+			value:   drop,
+			message: fmt.Sprintf("上行 %.2fMbps, 之前一小时 %.2fMbps, 下降 %.1f%%", curAvg["total"]/1e6, baseAvg/1e6, drop),
+		}
+	}
+	return rst, nil
+}
+
+// 窗口内任务数不够MinCount时按正常算
+func (s *alertService) checkTaskFail(rule *models.AlertRule, sns []string, now int64) (map[string]alertCheck, error) {
+	since := now - rule.Duration*1000
+
+	rst := make(map[string]alertCheck, len(sns))
+	for _, sn := range sns {
+		results, err := tcpservice.GetTaskResults(sn, since)
+		if err != nil {
+			return nil, err
+		}
+
+		total, failed := 0, 0
+		lastErr := ""
+		for _, r := range results {
+			if rule.TaskType != "" && r.TaskType != rule.TaskType {
+				continue
+			}
+			total++
+			if r.ErrMsg != "" {
+				failed++
+				if lastErr == "" {
+					lastErr = r.ErrMsg
+				}
+			}
+		}
+		if total < rule.MinCount || total == 0 {
+			rst[sn] = alertCheck{message: fmt.Sprintf("任务 %d 个", total)}
+			continue
+		}
+
+		rate := float64(failed) * 100 / float64(total)
+		c := alertCheck{
+			firing:  rate >= rule.Threshold,
+			value:   rate,
+			message: fmt.Sprintf("%d分钟内任务 %d 个, 失败 %d 个(%.1f%%)", rule.Duration/60, total, failed, rate),
+		}
+		if lastErr != "" {
+			c.message += ", 最近错误: " + lastErr
+		}
+		rst[sn] = c
+	}
+	return rst, nil
+}
+
+// 用户要有渠道的权限
+// 窗口内一次都没运行过的容器算异常；设备的数据不够整个窗口时(离线或刚上线)不判断
+func (s *alertService) checkContainer(rule *models.AlertRule, sns []string, now int64) (map[string]alertCheck, error) {
+	tier := models.MetricTiers[0]
+	start := now - rule.Duration*1000
+
+	rst := make(map[string]alertCheck, len(sns))
+	for _, sn := range sns {
+		points, err := repos.MetricsRepo.Query(tier, sn, []string{models.METRIC_CPU_USAGE, models.METRIC_CONTAINER_UP}, "", start, now, tier.Step)
+		if err != nil {
+			return nil, err
+		}
+
+		var first int64
+		running := make(map[string]bool)
+		seen := make(map[string]bool)
+		for _, p := range points {
+			switch p.Metric {
+			case models.METRIC_CPU_USAGE:
+				if first == 0 || p.Ts < first {
+					first = p.Ts
+				}
+			case models.METRIC_CONTAINER_UP:
+				seen[p.Label] = true
+				running[p.Label] = running[p.Label] || p.Max > 0
+			}
+		}
+		if first == 0 || first > start+tier.Step {
+			continue
+		}
+
+		var down []string
+		for _, name := range rule.Containers {
+			switch {
+			case !seen[name]:
+				down = append(down, name+"(不存在)")
+			case !running[name]:
+				down = append(down, name+"(未运行)")
+			}
+		}
+		c := alertCheck{
+			firing:  len(down) > 0,
+			value:   float64(len(down)),
+			message: fmt.Sprintf("容器 %d 个都在运行", len(rule.Containers)),
+		}
+		if len(down) > 0 {
+			c.message = fmt.Sprintf("%d分钟内没有运行的容器: %s", rule.Duration/60, strings.Join(down, ", "))
+		}
+		rst[sn] = c
+	}
+	return rst, nil
+}
+
+func (s *alertService) checkChannels(sessionUser *passportprotos.User, ids models.Int64Arr) error {
+	channels, err := repos.AlertRepo.GetChannels(ids)
+	if err != nil {
+		logger.Error("alertService.checkChannels DB ERR: ", zap.Error(err))
+		return common.ErrService
+	}
+	if len(channels) != len(ids) {
+		return common.ErrParam
+	}
+	for _, ch := range channels {
+		if !ownsAlertObject(sessionUser, ch.TenantId, ch.UserId) {
+			return common.ErrNoAuth
+		}
+	}
+	return nil
+}
+
+func ownsAlertObject(sessionUser *passportprotos.User, tenantId, uid uint64) bool {
+	if sessionUser.TenantID > 0 {
+		return tenantId == sessionUser.TenantID
+	}
+	return uid == sessionUser.UID
+}
+
+// 同一用户(租户)的静默，RuleId为0匹配所有规则，SN为空匹配所有设备
+func alertSilenced(rule *models.AlertRule, sn string, silences []models.AlertSilence) bool {
+	for _, si := range silences {
+		if rule.TenantId > 0 {
+			if si.TenantId != rule.TenantId {
+				continue
+			}
+		} else if si.UserId != rule.UserId {
+			continue
+		}
+		if (si.RuleId == 0 || si.RuleId == rule.Id) && (si.SN == "" || si.SN == sn) {
+			return true
+		}
+	}
+	return false
+}
+
+func alertCompare(op string, v, threshold float64) bool {
+	if op == "<" {
+		return v < threshold
+	}
+	return v > threshold
+}
+
+// 按label求采样数加权的平均值
+func avgMetricPoints(points []models.MetricPoint) map[string]float64 {
+	sums := make(map[string]float64)
+	counts := make(map[string]float64)
+	for _, p := range points {
+		sums[p.Label] += p.Avg * float64(p.Count)
+		counts[p.Label] += float64(p.Count)
+	}
+
+	rst := make(map[string]float64, len(sums))
+	for label, sum := range sums {
+		if counts[label] > 0 {
+			rst[label] = sum / counts[label]
+		}
+	}
+	return rst
+}
+
+func validateAlertRule(m *models.AlertRule) error {
+	if m == nil || m.Name == "" {
+		return common.ErrParam
+	}
+	if m.Severity == "" {
+		m.Severity = "warning"
+	}
+	if m.Severity != "info" && m.Severity != "warning" && m.Severity != "critical" {
+		return common.ErrParam
+	}
+	if m.Duration == 0 {
+		m.Duration = 300
+	}
+	if m.Duration < 60 || m.RepeatMinutes < 0 {
+		return common.ErrParam
+	}
+
+	switch m.Type {
+	case models.ALERT_RULE_OFFLINE:
+	case models.ALERT_RULE_METRIC:
+		known := false
+		for _, name := range models.AllMetrics {
+			known = known || name == m.Metric
+		}
+		if !known || (m.Operator != ">" && m.Operator != "<") {
+			return common.ErrParam
+		}
+	case models.ALERT_RULE_THROUGHPUT_DROP, models.ALERT_RULE_TASK_FAIL:
+		if m.Threshold <= 0 || m.Threshold > 100 {
+			return common.ErrParam
+		}
+		if m.MinCount <= 0 {
+			m.MinCount = 1
+		}
+	case models.ALERT_RULE_CONTAINER:
+		containers := make(models.StringArr, 0, len(m.Containers))
+		for _, name := range m.Containers {
+			if name = strings.TrimPrefix(strings.TrimSpace(name), "/"); name != "" {
+				containers = append(containers, name)
+			}
+		}
+		if len(containers) == 0 {
+			return common.ErrParam
+		}
+		m.Containers = containers
+	default:
+		return common.ErrParam
+	}
+	return nil
+}
+
+func validateAlertChannel(m *models.AlertChannel) error {
+	if m == nil || m.Name == "" {
+		return common.ErrParam
+	}
+
+	switch m.Type {
+	case models.ALERT_CHANNEL_WEBHOOK, models.ALERT_CHANNEL_DINGTALK, models.ALERT_CHANNEL_WECOM, models.ALERT_CHANNEL_FEISHU:
+		u, err := url.Parse(m.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return common.ErrParam
+		}
+	case models.ALERT_CHANNEL_SMTP:
+		if m.SmtpHost == "" || m.From == "" || len(m.To) == 0 || m.SmtpPort < 0 || m.SmtpPort > 65535 {
+			return common.ErrParam
+		}
+	default:
+		return common.ErrParam
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"pcdn-server/models"
+
+	"go.uber.org/zap"
+)
+
+// 通知地址是用户填的，只能连公网地址，不能用来访问内网和云主机的元数据服务
+var alertDialer = &net.Dialer{Timeout: 10 * time.Second, Control: alertDialControl}
+
+var alertHttpClient = &http.Client{
+	Timeout:   10 * time.Second,
+	Transport: &http.Transport{DialContext: alertDialer.DialContext, TLSHandshakeTimeout: 10 * time.Second},
+}
+
+// 运营商级NAT地址，有的云厂商元数据服务在这个段里
+var alertCGNAT = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// alertDialControl 域名解析以后、连接之前检查目标地址，重定向也会经过这里
+func alertDialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !alertPublicIP(ip) {
+		return fmt.Errorf("address not allowed: %s", host)
+	}
+	return nil
+}
+
+func alertPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || alertCGNAT.Contains(ip))
+}
+
+// 一条告警通知
+type alertNotice struct {
+	Status    string  `json:"status"`
+	RuleId    uint64  `json:"ruleId"`
+	RuleName  string  `json:"ruleName"`
+	Severity  string  `json:"severity"`
+	SN        string  `json:"sn"`
+	Value     float64 `json:"value"`
+	Message   string  `json:"message"`
+	StartTime int64   `json:"startTime"`
+	EndTime   int64   `json:"endTime,omitempty"`
+}
+
+func (n *alertNotice) title() string {
+	if n.Status == models.ALERT_STATUS_RESOLVED {
+		return fmt.Sprintf("[恢复] %s %s", n.RuleName, n.SN)
+	}
+	return fmt.Sprintf("[告警][%s] %s %s", n.Severity, n.RuleName, n.SN)
+}
+
+func (n *alertNotice) text() string {
+	var b strings.Builder
+	b.WriteString(n.title())
+	b.WriteString("\n设备: " + n.SN)
+	b.WriteString("\n详情: " + n.Message)
+	b.WriteString("\n开始: " + time.UnixMilli(n.StartTime).Format(time.DateTime))
+	if n.EndTime > 0 {
+		b.WriteString("\n恢复: " + time.UnixMilli(n.EndTime).Format(time.DateTime))
+	}
+	return b.String()
+}
+
+// sendAlertNotice 按渠道类型发通知
+func sendAlertNotice(ch *models.AlertChannel, n *alertNotice) error {
+	err := sendAlertNoticeTo(ch, n)
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	promAlertNotices.Inc(ch.Type, result)
+	return err
+}
+
+func sendAlertNoticeTo(ch *models.AlertChannel, n *alertNotice) error {
+	switch ch.Type {
+	case models.ALERT_CHANNEL_WEBHOOK:
+		return postAlertJson(ch.URL, n)
+	case models.ALERT_CHANNEL_DINGTALK:
+		u := ch.URL
+		if ch.Secret != "" {
+			ts := strconv.FormatInt(time.Now().UnixMilli(), 10)
+			u = appendQuery(u, url.Values{"timestamp": {ts}, "sign": {hmacBase64(ch.Secret, ts+"\n"+ch.Secret)}})
+		}
+		return postAlertJson(u, map[string]interface{}{
+			"msgtype": "text",
+			"text":    map[string]string{"content": n.text()},
+		})
+	case models.ALERT_CHANNEL_WECOM:
+		return postAlertJson(ch.URL, map[string]interface{}{
+			"msgtype": "text",
+			"text":    map[string]string{"content": n.text()},
+		})
+	case models.ALERT_CHANNEL_FEISHU:
+		body := map[string]interface{}{
+			"msg_type": "text",
+			"content":  map[string]string{"text": n.text()},
+		}
+		if ch.Secret != "" {
+			ts := strconv.FormatInt(time.Now().Unix(), 10)
+			body["timestamp"] = ts
+			body["sign"] = hmacBase64(ts+"\n"+ch.Secret, "")
+		}
+		return postAlertJson(ch.URL, body)
+	case models.ALERT_CHANNEL_SMTP:
+		return sendAlertMail(ch, n.title(), n.text())
+	}
+	return fmt.Errorf("unknown channel type: %s", ch.Type)
+}
+
+// postAlertJson POST JSON，机器人接口HTTP 200也可能返回错误码
+func postAlertJson(u string, body interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := alertHttpClient.Post(u, "application/json; charset=utf-8", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// 返回的内容只记日志，不带到错误里返回给用户
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		logger.Warn("postAlertJson http ERR: ", zap.Int("status", resp.StatusCode), zap.ByteString("body", respBody))
+		return fmt.Errorf("http %d", resp.StatusCode)
+	}
+
+	// 钉钉/企业微信: errcode; 飞书: code
+	var rst struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+		Code    int    `json:"code"`
+		Msg     string `json:"msg"`
+	}
+	if json.Unmarshal(respBody, &rst) == nil {
+		if rst.ErrCode != 0 {
+			logger.Warn("postAlertJson ERR: ", zap.Int("errcode", rst.ErrCode), zap.String("errmsg", rst.ErrMsg))
+			return fmt.Errorf("errcode %d", rst.ErrCode)
+		}
+		if rst.Code != 0 {
+			logger.Warn("postAlertJson ERR: ", zap.Int("code", rst.Code), zap.String("msg", rst.Msg))
+			return fmt.Errorf("code %d", rst.Code)
+		}
+	}
+	return nil
+}
+
+const alertMailTimeout = 30 * time.Second
+
+// sendAlertMail 发邮件，465端口用SSL，其它端口服务器支持时用STARTTLS
+func sendAlertMail(ch *models.AlertChannel, subject, body string) error {
+	port := ch.SmtpPort
+	if port == 0 {
+		port = 25
+	}
+	addr := net.JoinHostPort(ch.SmtpHost, strconv.Itoa(port))
+
+	var auth smtp.Auth
+	if ch.Username != "" {
+		auth = smtp.PlainAuth("", ch.Username, ch.Password, ch.SmtpHost)
+	}
+
+	var msg bytes.Buffer
+	msg.WriteString("From: " + ch.From + "\r\n")
+	msg.WriteString("To: " + strings.Join(ch.To, ", ") + "\r\n")
+	msg.WriteString("Subject: =?UTF-8?B?" + base64.StdEncoding.EncodeToString([]byte(subject)) + "?=\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	msg.WriteString(base64.StdEncoding.EncodeToString([]byte(body)) + "\r\n")
+
+	// 整个发送过程的超时，smtp.SendMail没有超时，服务器不应答时会一直等
+	conn, err := alertDialer.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(alertMailTimeout))
+	tlsConfig := &tls.Config{ServerName: ch.SmtpHost}
+	if port == 465 {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	c, err := smtp.NewClient(conn, ch.SmtpHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if port != 465 {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(tlsConfig); err != nil {
+				return err
+			}
+		}
+	}
+	if auth != nil {
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(ch.From); err != nil {
+		return err
+	}
+	for _, to := range ch.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Bytes()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func hmacBase64(key, data string) string {
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write([]byte(data))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func appendQuery(u string, q url.Values) string {
+	if strings.Contains(u, "?") {
+		return u + "&" + q.Encode()
+	}
+	return u + "?" + q.Encode()
+}
@@ -0,0 +1,30 @@
+package service
+
+import "testing"
+
+// go test -v -count=1 -run TestAlertDialControl pcdn-server/service
+func TestAlertDialControl(t *testing.T) {
+	cases := []struct {
+		address string
+		ok      bool
+	}{
+		{"203.0.113.10:443", true},
+		{"[2001:db8::1]:443", true},
+		{"127.0.0.1:80", false},
+		{"10.1.2.3:80", false},
+		{"172.16.0.1:80", false},
+		{"192.168.1.1:25", false},
+		{"169.254.169.254:80", false},
+		{"100.100.100.200:80", false},
+		{"0.0.0.0:80", false},
+		{"[::1]:80", false},
+		{"[fd00::1]:80", false},
+		{"[fe80::1]:80", false},
+		{"[::ffff:127.0.0.1]:80", false},
+	}
+	for _, c := range cases {
+		if err := alertDialControl("tcp", c.address, nil); (err == nil) != c.ok {
+			t.Errorf("%s: %v", c.address, err)
+		}
+	}
+}
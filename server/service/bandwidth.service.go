@@ -0,0 +1,197 @@
+package service
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+	"pcdn-server/repos"
+
+	passportprotos "github.com/liuhengloveyou/passport/protos"
+	"go.uber.org/zap"
+)
+
+type bandwidthService struct {
+}
+
+// 带宽报表
+// scope: device(target是SN)/group(target是分组路径，包括下级分组)/tag(target是逗号分隔的标签)/tenant(当前用户的租户)
+// period: day(date格式2006-01-02)/month(date格式2006-01), date为空时是今天/本月
+func (s *bandwidthService) Report(sessionUser *passportprotos.User, scope, target, iface, period, date string) (*models.BandwidthReport, error) {
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		return nil, common.ErrParam
+	}
+	if iface == "" {
+		iface = models.BANDWIDTH_TOTAL_IFACE
+	}
+
+	start, end, err := bandwidthPeriod(period, date)
+	if err != nil {
+		return nil, common.ErrParam
+	}
+
+	var sns []string
+	switch scope {
+	case "device":
+		sn, err := ownedDeviceSN(sessionUser, target, "bandwidth")
+		if err != nil {
+			return nil, err
+		}
+		sns = []string{sn}
+	case "group", "tag":
+		sel := &models.DeviceSelector{Group: target}
+		if scope == "tag" {
+			sel = &models.DeviceSelector{Tags: strings.Split(target, ",")}
+		}
+		if sns, err = DeviceService.SelectSNs(sessionUser, sel); err != nil {
+			return nil, err
+		}
+		if sel.Empty() {
+			return nil, common.ErrParam
+		}
+	case "tenant":
+		sns, err = repos.DeviceRepo.FindSNs(sessionUser.TenantID, sessionUser.UID, nil)
+	default:
+		return nil, common.ErrParam
+	}
+	if err != nil {
+		logger.Error("bandwidthService.Report device ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+
+	samples, err := repos.BandwidthRepo.Find(sns, iface, start.UnixMilli(), end.UnixMilli())
+	if err != nil {
+		logger.Error("bandwidthService.Report samples ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+
+	report := &models.BandwidthReport{
+		Scope:   scope,
+		Target:  target,
+		Iface:   iface,
+		Period:  period,
+		Start:   start.UnixMilli(),
+		End:     end.UnixMilli(),
+		Devices: make([]models.BandwidthStat, 0, len(sns)),
+	}
+	label := start.Format("2006-01-02")
+	if period == "month" {
+		label = start.Format("2006-01")
+	}
+
+	// 每台设备各自统计
+	bySN := make(map[string][]models.BandwidthSample)
+	for _, one := range samples {
+		bySN[one.SN] = append(bySN[one.SN], one)
+	}
+	for _, sn := range sns {
+		stat := bandwidthStat(label, bySN[sn])
+		stat.SN = sn
+		report.Devices = append(report.Devices, stat)
+	}
+
+	// 所有设备同一时刻的速率相加再统计
+	total := sumBandwidthSamples(samples)
+	report.Total = bandwidthStat(label, total)
+
+	if period == "month" {
+		for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+			next := day.AddDate(0, 0, 1)
+			var daySamples []models.BandwidthSample
+			for _, one := range total {
+				if one.SampleTime >= day.UnixMilli() && one.SampleTime < next.UnixMilli() {
+					daySamples = append(daySamples, one)
+				}
+			}
+			report.Daily = append(report.Daily, bandwidthStat(day.Format("2006-01-02"), daySamples))
+		}
+	}
+
+	return report, nil
+}
+
+// bandwidthPeriod 统计周期的起止时间 [start, end)
+func bandwidthPeriod(period, date string) (start, end time.Time, err error) {
+	now := time.Now()
+	switch period {
+	case "", "day":
+		start = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+		if date != "" {
+			if start, err = time.ParseInLocation("2006-01-02", date, time.Local); err != nil {
+				return
+			}
+		}
+		end = start.AddDate(0, 0, 1)
+	case "month":
+		start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+		if date != "" {
+			if start, err = time.ParseInLocation("2006-01", date, time.Local); err != nil {
+				return
+			}
+		}
+		end = start.AddDate(0, 1, 0)
+	default:
+		err = common.ErrParam
+	}
+	return
+}
+
+// sumBandwidthSamples 按采样时间把多台设备的速率相加，结果按时间排序
+func sumBandwidthSamples(samples []models.BandwidthSample) []models.BandwidthSample {
+	byTime := make(map[int64]*models.BandwidthSample)
+	for _, one := range samples {
+		sum, ok := byTime[one.SampleTime]
+		if !ok {
+			sum = &models.BandwidthSample{SampleTime: one.SampleTime}
+			byTime[one.SampleTime] = sum
+		}
+		sum.SendRate += one.SendRate
+		sum.RecvRate += one.RecvRate
+	}
+
+	rst := make([]models.BandwidthSample, 0, len(byTime))
+	for _, one := range byTime {
+		rst = append(rst, *one)
+	}
+	sort.Slice(rst, func(i, j int) bool { return rst[i].SampleTime < rst[j].SampleTime })
+	return rst
+}
+
+// bandwidthStat 计算95值、峰值和均值
+func bandwidthStat(period string, samples []models.BandwidthSample) models.BandwidthStat {
+	stat := models.BandwidthStat{Period: period, Samples: len(samples)}
+	if len(samples) == 0 {
+		return stat
+	}
+
+	send := make([]float64, len(samples))
+	recv := make([]float64, len(samples))
+	for i, one := range samples {
+		send[i] = one.SendRate
+		recv[i] = one.RecvRate
+	}
+	stat.P95Send, stat.PeakSend, stat.AvgSend = percentile95(send)
+	stat.P95Recv, stat.PeakRecv, stat.AvgRecv = percentile95(recv)
+
+	return stat
+}
+
+// percentile95 95计费: 所有5分钟点从小到大排序，去掉最高的5%后的最大值
+func percentile95(vals []float64) (p95, peak, avg float64) {
+	sorted := append([]float64{}, vals...)
+	sort.Float64s(sorted)
+
+	sum := float64(0)
+	for _, v := range sorted {
+		sum += v
+	}
+
+	idx := int(math.Ceil(float64(len(sorted))*0.95)) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return sorted[idx], sorted[len(sorted)-1], sum / float64(len(sorted))
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+	"pcdn-server/repos"
+	"pcdn-server/tcpservice"
+
+	passportprotos "github.com/liuhengloveyou/passport/protos"
+	"go.uber.org/zap"
+)
+
+// 流量曲线的时间范围和点的间隔
+var dashboardRanges = map[string]struct {
+	span time.Duration
+	step time.Duration
+}{
+	"24h": {span: 24 * time.Hour, step: 5 * time.Minute},
+	"7d":  {span: 7 * 24 * time.Hour, step: time.Hour},
+}
+
+type dashboardService struct {
+}
+
+// Overview 当前用户(租户)所有设备的在线数、当前流量、流量最高的设备、版本分布和流量曲线
+func (s *dashboardService) Overview(sessionUser *passportprotos.User, rangeName string, topN int) (*models.Dashboard, error) {
+	if rangeName == "" {
+		rangeName = "24h"
+	}
+	r, ok := dashboardRanges[rangeName]
+	if !ok {
+		return nil, common.ErrParam
+	}
+	if topN <= 0 || topN > 100 {
+		topN = 10
+	}
+
+	sns, err := repos.DeviceRepo.FindSNs(sessionUser.TenantID, sessionUser.UID, nil)
+	if err != nil {
+		logger.Error("dashboardService.Overview DB ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+	for i := range sns {
+		sns[i] = strings.ToUpper(sns[i])
+	}
+
+	statuses, err := tcpservice.GetAgentStatuses(sns)
+	if err != nil {
+		logger.Error("dashboardService.Overview redis ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+	monitors, err := tcpservice.GetAgentMonitors(sns)
+	if err != nil {
+		logger.Error("dashboardService.Overview redis ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+
+	rst := &models.Dashboard{
+		Total:    len(sns),
+		Versions: make(map[string]int),
+		Range:    rangeName,
+		Step:     r.step.Milliseconds(),
+	}
+	var devices []models.DashboardDevice
+	for _, sn := range sns {
+		agent := statuses[sn]
+		version := "unknown"
+		if agent != nil && agent.Version != "" {
+			version = agent.Version
+		}
+		rst.Versions[version]++
+
+		if !tcpservice.IsOnline(agent) {
+			continue
+		}
+		rst.Online++
+
+		one := models.DashboardDevice{SN: sn, Version: version}
+		if monitor, ok := monitors[sn]; ok {
+			one.SendRate, one.RecvRate = tcpservice.UplinkBits(monitor)
+		}
+		rst.SendRate += one.SendRate
+		rst.RecvRate += one.RecvRate
+		devices = append(devices, one)
+	}
+	rst.Offline = rst.Total - rst.Online
+
+	sort.Slice(devices, func(i, j int) bool { return devices[i].SendRate > devices[j].SendRate })
+	if len(devices) > topN {
+		devices = devices[:topN]
+	}
+	rst.TopDevices = devices
+
+	end := time.Now().UnixMilli()
+	start := end - r.span.Milliseconds()
+	tier, step := metricsTier(time.Now(), start, end, r.step.Milliseconds())
+	rst.Step = step
+	if rst.Send, err = repos.MetricsRepo.QuerySum(tier, sns, models.METRIC_NET_SEND_RATE, models.BANDWIDTH_TOTAL_IFACE, start, end, step); err != nil {
+		logger.Error("dashboardService.Overview DB ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+	if rst.Recv, err = repos.MetricsRepo.QuerySum(tier, sns, models.METRIC_NET_RECV_RATE, models.BANDWIDTH_TOTAL_IFACE, start, end, step); err != nil {
+		logger.Error("dashboardService.Overview DB ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+
+	return rst, nil
+}
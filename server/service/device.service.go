@@ -1,13 +1,18 @@
 package service
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"pcdn-server/common"
 	"pcdn-server/models"
 	"pcdn-server/repos"
 	"pcdn-server/tcpservice"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,6 +20,7 @@ import (
 	"github.com/liuhengloveyou/pcdn/protos"
 	"go.uber.org/zap"
 	"google.golang.org/protobuf/proto"
+	"gorm.io/gorm"
 )
 
 type deviceService struct {
@@ -26,8 +32,19 @@ func (s *deviceService) Create(sessionUser *passportprotos.User, req *models.Dev
 		return 0, common.ErrParam
 	}
 	req.UserId = sessionUser.UID
+	req.TenantId = sessionUser.TenantID
 	req.SN = strings.ToUpper(req.SN)
 	req.CreateTime = time.Now().UnixMilli()
+	var err error
+	if req.GroupName, err = normalizeGroup(req.GroupName); err != nil {
+		return 0, err
+	}
+	if req.Tags, err = normalizeTags(req.Tags); err != nil {
+		return 0, err
+	}
+	if len(req.Remark) > deviceRemarkMaxLen {
+		return 0, common.ErrParam
+	}
 	common.Logger.Debug("deviceService.Create", zap.Any("sess", sessionUser), zap.Any("req", req))
 
 	id, err := repos.DeviceRepo.Create(req)
@@ -53,10 +70,23 @@ func (s *deviceService) Create(sessionUser *passportprotos.User, req *models.Dev
 	return id, nil
 }
 
-// 查询设备
-func (s *deviceService) Find(uid uint64, page, pageSize int) ([]models.DeviceModel, int64, error) {
+// 查询设备，有租户时列出租户里所有的设备
+// 按在线状态、版本和连接地址过滤或排序时，这些在redis里，查出所有设备后在内存里过滤和分页
+func (s *deviceService) Find(sessionUser *passportprotos.User, filter *models.DeviceFilter, page, pageSize int) ([]models.DeviceModel, int64, error) {
+	if filter != nil {
+		group, err := normalizeGroup(filter.Group)
+		if err != nil {
+			return nil, 0, err
+		}
+		filter.Group = group
+	}
+	byStatus := filter != nil && filter.ByStatus()
+	dbPage, dbPageSize := page, pageSize
+	if byStatus {
+		dbPage, dbPageSize = 0, 0
+	}
 
-	result, total, err := repos.DeviceRepo.Find(uid, page, pageSize)
+	result, total, err := repos.DeviceRepo.Find(sessionUser.TenantID, sessionUser.UID, filter, dbPage, dbPageSize)
 	if err != nil {
 		logger.Error("deviceService.Find ERR: ", zap.Error(err))
 		return nil, 0, common.ErrService
@@ -86,10 +116,132 @@ func (s *deviceService) Find(uid uint64, page, pageSize int) ([]models.DeviceMod
 
 				}
 			}
+			result[i].Online = tcpservice.HeartbeatOnline(result[i].LastHeartbear)
+		}
+	}
+
+	if !byStatus {
+		return result, total, nil
+	}
+
+	match, err := deviceStatusMatcher(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	rst := result[:0]
+	for _, d := range result {
+		if match(&d) {
+			rst = append(rst, d)
+		}
+	}
+	sortDevicesByStatus(rst, filter)
+
+	total = int64(len(rst))
+	if page > 0 && pageSize > 0 {
+		start := min((page-1)*pageSize, len(rst))
+		rst = rst[start:min(start+pageSize, len(rst))]
+	}
+	return rst, total, nil
+}
+
+// 按心跳状态过滤
+func deviceStatusMatcher(filter *models.DeviceFilter) (func(d *models.DeviceModel) bool, error) {
+	var online *bool
+	switch filter.Online {
+	case "":
+	case "1", "true":
+		online = new(bool)
+		*online = true
+	case "0", "false":
+		online = new(bool)
+	default:
+		return nil, common.ErrParam
+	}
+
+	versions := make(map[string]bool)
+	for _, v := range strings.Split(filter.Version, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			versions[v] = true
+		}
+	}
+
+	var ipNet *net.IPNet
+	var ip net.IP
+	if filter.RemoteIP != "" {
+		if strings.Contains(filter.RemoteIP, "/") {
+			_, n, err := net.ParseCIDR(filter.RemoteIP)
+			if err != nil {
+				return nil, common.ErrParam
+			}
+			ipNet = n
+		} else if ip = net.ParseIP(filter.RemoteIP); ip == nil {
+			return nil, common.ErrParam
 		}
 	}
 
-	return result, total, nil
+	return func(d *models.DeviceModel) bool {
+		if online != nil && d.Online != *online {
+			return false
+		}
+		if len(versions) > 0 && !versions[d.Version] {
+			return false
+		}
+		if ipNet != nil || ip != nil {
+			remote := net.ParseIP(d.RemoteAddr)
+			if remote == nil || (ipNet != nil && !ipNet.Contains(remote)) || (ip != nil && !ip.Equal(remote)) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// 按心跳状态排序，一样时按SN
+func sortDevicesByStatus(devices []models.DeviceModel, filter *models.DeviceFilter) {
+	field, desc := filter.SortField()
+	if !models.DeviceStatusSorts[field] {
+		return
+	}
+
+	sort.SliceStable(devices, func(i, j int) bool {
+		a, b := &devices[i], &devices[j]
+		c := 0
+		switch field {
+		case "lastHeartbeat":
+			c = cmp.Compare(a.LastHeartbear, b.LastHeartbear)
+		case "version":
+			c = compareVersion(a.Version, b.Version)
+		case "remoteAddr":
+			c = strings.Compare(a.RemoteAddr, b.RemoteAddr)
+		}
+		if desc {
+			c = -c
+		}
+		if c == 0 {
+			return a.SN < b.SN
+		}
+		return c < 0
+	})
+}
+
+// 按.分段比较版本号，数字段按数值比较
+func compareVersion(a, b string) int {
+	as := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		c := 0
+		if aErr == nil && bErr == nil {
+			c = cmp.Compare(an, bn)
+		} else {
+			c = strings.Compare(as[i], bs[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(as), len(bs))
 }
 
 // 查询单个设备
@@ -156,8 +308,7 @@ func (s *deviceService) GetMonitorInfo(sn string) (*protos.SystemMonitorData, er
 		return nil, common.ErrParam
 	}
 
-	// TODO 当前用户有没有权限查看？
-
+	// 权限由调用方用Authorize检查
 	// 从Redis获取监控信息
 	key := fmt.Sprintf("%s%s", common.AGENT_MONITOR_KEY_PREFIX, strings.ToUpper(sn))
 	monitorData, err := common.RedisClient.Get(context.Background(), key).Result()
@@ -176,6 +327,72 @@ func (s *deviceService) GetMonitorInfo(sn string) (*protos.SystemMonitorData, er
 	return &monitorJson, nil
 }
 
+// Containers 设备最近一次心跳带上来的docker容器
+func (s *deviceService) Containers(sessionUser *passportprotos.User, sn string) ([]*protos.SystemMonitorContainer, error) {
+	sn, err := ownedDeviceSN(sessionUser, sn, "containers")
+	if err != nil {
+		return nil, err
+	}
+
+	monitor, err := s.GetMonitorInfo(sn)
+	if err != nil {
+		return nil, err
+	}
+	return monitor.Containers, nil
+}
+
+// Authorize 检查当前用户能不能操作这台设备: 用户有租户时设备要在同一租户，没有时要是自己的设备。
+// action是要做的操作，不通过时记到业务日志里
+func (s *deviceService) Authorize(sessionUser *passportprotos.User, sn, action string) (*models.DeviceModel, error) {
+	sn = strings.ToUpper(strings.TrimSpace(sn))
+	if sn == "" {
+		return nil, common.ErrParam
+	}
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		return nil, common.ErrNoAuth
+	}
+
+	dev, err := repos.DeviceRepo.GetBySN(sn)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		logger.Error("deviceService.Authorize DB ERR: ", zap.String("sn", sn), zap.Error(err))
+		return nil, common.ErrService
+	}
+
+	reason := ""
+	switch {
+	case err != nil:
+		reason = "not found"
+	case sessionUser.TenantID > 0 && dev.TenantId != sessionUser.TenantID:
+		reason = "other tenant"
+	case sessionUser.TenantID == 0 && dev.UserId != sessionUser.UID:
+		reason = "other owner"
+	default:
+		return dev, nil
+	}
+
+	logger.Warn("deviceService.Authorize deny: ", zap.String("sn", sn), zap.String("action", action), zap.Uint64("uid", sessionUser.UID), zap.String("reason", reason))
+	log := &models.BusinessLog{
+		UserName:     sessionUser.Cellphone.String,
+		BusinessType: models.BUSINESS_TYPE_DENY,
+		Payload:      fmt.Sprintf("%s | %s | %s", sn, action, reason),
+	}
+	log.UserId = sessionUser.UID
+	log.TenantId = sessionUser.TenantID
+	if _, err := BusinessLogService.Add(log); err != nil {
+		logger.Error("deviceService.Authorize Add BusinessLog ERR: ", zap.String("sn", sn), zap.Error(err))
+	}
+	return nil, common.ErrNoAuth
+}
+
+// 检查设备属于当前用户(租户)，返回大写的SN
+func ownedDeviceSN(sessionUser *passportprotos.User, sn, action string) (string, error) {
+	dev, err := DeviceService.Authorize(sessionUser, sn, action)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToUpper(dev.SN), nil
+}
+
 // GetRouterAdminURL 获取路由器管理界面URL
 func (s *deviceService) GetRouterAdminURL(sn string) (string, error) {
 	if sn == "" {
@@ -219,7 +436,7 @@ func (s *deviceService) GetRouterAdminURL(sn string) (string, error) {
 	// 检查任务是否成功
 	if task.ErrMsg != "" {
 		common.Logger.Sugar().Errorf("GetRouterAdminURL task error: %v", task.ErrMsg)
-		return "", fmt.Errorf(task.ErrMsg)
+		return "", errors.New(task.ErrMsg)
 	}
 
 	// 返回路由器管理URL
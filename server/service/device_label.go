@@ -0,0 +1,278 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+	"pcdn-server/repos"
+
+	passportprotos "github.com/liuhengloveyou/passport/protos"
+	"go.uber.org/zap"
+)
+
+const (
+	deviceGroupMaxLen  = 64
+	deviceGroupMaxDeep = 5
+	deviceTagMaxLen    = 32
+	deviceTagMax       = 20
+	deviceRemarkMaxLen = 256
+	// 一次最多批量设置这么多设备
+	deviceLabelMax = 1000
+)
+
+// normalizeGroup 整理分组路径: 去掉每级前后的空格和空的级别，如 " 华东/ 上海//A线 " 是 "华东/上海/A线"
+func normalizeGroup(group string) (string, error) {
+	var parts []string
+	for _, p := range strings.Split(group, "/") {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	rst := strings.Join(parts, "/")
+	if len(rst) > deviceGroupMaxLen || len(parts) > deviceGroupMaxDeep {
+		return "", common.ErrParam
+	}
+	return rst, nil
+}
+
+// normalizeTags 去掉空的和重复的标签，标签里不能有逗号
+func normalizeTags(tags []string) (models.StringArr, error) {
+	rst := models.StringArr{}
+	seen := make(map[string]bool, len(tags))
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		if utf8.RuneCountInString(t) > deviceTagMaxLen || strings.Contains(t, ",") {
+			return nil, common.ErrParam
+		}
+		seen[t] = true
+		rst = append(rst, t)
+	}
+	if len(rst) > deviceTagMax {
+		return nil, common.ErrParam
+	}
+	return rst, nil
+}
+
+// normalizeSelector 整理选择条件，指定的设备要是自己的
+func normalizeSelector(sessionUser *passportprotos.User, sel *models.DeviceSelector) error {
+	if sel == nil {
+		return nil
+	}
+
+	var err error
+	if sel.Group, err = normalizeGroup(sel.Group); err != nil {
+		return err
+	}
+	if sel.Tags, err = normalizeTags(sel.Tags); err != nil {
+		return err
+	}
+
+	if len(sel.Devices) == 0 {
+		return nil
+	}
+	devices := make(models.StringArr, 0, len(sel.Devices))
+	seen := make(map[string]bool, len(sel.Devices))
+	for _, sn := range sel.Devices {
+		if sn = strings.ToUpper(strings.TrimSpace(sn)); sn != "" && !seen[sn] {
+			seen[sn] = true
+			devices = append(devices, sn)
+		}
+	}
+	owned, err := repos.DeviceRepo.FindSNs(sessionUser.TenantID, sessionUser.UID, &models.DeviceSelector{Devices: devices})
+	if err != nil {
+		logger.Error("normalizeSelector DB ERR: ", zap.Error(err))
+		return common.ErrService
+	}
+	if len(owned) != len(devices) {
+		logger.Warn("normalizeSelector deny: ", zap.Uint64("uid", sessionUser.UID), zap.Int("devices", len(devices)), zap.Int("owned", len(owned)))
+		return common.ErrNoAuth
+	}
+	sel.Devices = devices
+	return nil
+}
+
+// SelectSNs 当前用户符合条件的设备
+func (s *deviceService) SelectSNs(sessionUser *passportprotos.User, sel *models.DeviceSelector) ([]string, error) {
+	if err := normalizeSelector(sessionUser, sel); err != nil {
+		return nil, err
+	}
+
+	sns, err := repos.DeviceRepo.FindSNs(sessionUser.TenantID, sessionUser.UID, sel)
+	if err != nil {
+		logger.Error("deviceService.SelectSNs DB ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+	for i := range sns {
+		sns[i] = strings.ToUpper(sns[i])
+	}
+	return sns, nil
+}
+
+// Label 批量设置设备的分组、标签和备注
+func (s *deviceService) Label(sessionUser *passportprotos.User, req *models.DeviceLabelReq) error {
+	if sessionUser == nil || sessionUser.UID <= 0 || req == nil || len(req.Devices) == 0 || len(req.Devices) > deviceLabelMax {
+		return common.ErrParam
+	}
+	if req.Group == nil && req.Tags == nil && len(req.AddTags) == 0 && len(req.RemoveTags) == 0 && req.Remark == nil {
+		return common.ErrParam
+	}
+
+	sel := &models.DeviceSelector{Devices: req.Devices}
+	if err := normalizeSelector(sessionUser, sel); err != nil {
+		return err
+	}
+
+	fields := make(map[string]interface{})
+	var changes []string
+	if req.Group != nil {
+		group, err := normalizeGroup(*req.Group)
+		if err != nil {
+			return err
+		}
+		fields["group_name"] = group
+		changes = append(changes, "group="+group)
+	}
+	if req.Remark != nil {
+		remark := strings.TrimSpace(*req.Remark)
+		if len(remark) > deviceRemarkMaxLen {
+			return common.ErrParam
+		}
+		fields["remark"] = remark
+		changes = append(changes, "remark")
+	}
+
+	var tags map[string]models.StringArr
+	if req.Tags != nil || len(req.AddTags) > 0 || len(req.RemoveTags) > 0 {
+		var err error
+		if tags, err = s.labelTags(sessionUser, sel.Devices, req); err != nil {
+			return err
+		}
+		changes = append(changes, "tags")
+	}
+
+	if err := repos.DeviceRepo.Label(sessionUser.TenantID, sessionUser.UID, sel.Devices, fields, tags); err != nil {
+		logger.Error("deviceService.Label DB ERR: ", zap.Error(err))
+		return common.ErrService
+	}
+
+	log := &models.BusinessLog{
+		UserName:     sessionUser.Cellphone.String,
+		BusinessType: models.BUSINESS_TYPE_UPDATE_DEVICE,
+		Payload:      fmt.Sprintf("label | %d devices | %s", len(sel.Devices), strings.Join(changes, " ")),
+	}
+	log.UserId = sessionUser.UID
+	log.TenantId = sessionUser.TenantID
+	BusinessLogService.Add(log)
+	return nil
+}
+
+// 每台设备新的标签: 有Tags时替换，再加上AddTags，去掉RemoveTags
+func (s *deviceService) labelTags(sessionUser *passportprotos.User, sns []string, req *models.DeviceLabelReq) (map[string]models.StringArr, error) {
+	add, err := normalizeTags(req.AddTags)
+	if err != nil {
+		return nil, err
+	}
+	remove, err := normalizeTags(req.RemoveTags)
+	if err != nil {
+		return nil, err
+	}
+	var replace models.StringArr
+	if req.Tags != nil {
+		if replace, err = normalizeTags(*req.Tags); err != nil {
+			return nil, err
+		}
+	}
+
+	old := make(map[string]models.StringArr)
+	if req.Tags == nil {
+		if old, err = repos.DeviceRepo.FindTags(sessionUser.TenantID, sessionUser.UID, sns); err != nil {
+			logger.Error("deviceService.Label DB ERR: ", zap.Error(err))
+			return nil, common.ErrService
+		}
+	}
+
+	removeSet := make(map[string]bool, len(remove))
+	for _, t := range remove {
+		removeSet[t] = true
+	}
+	rst := make(map[string]models.StringArr, len(sns))
+	for _, sn := range sns {
+		cur := replace
+		if req.Tags == nil {
+			cur = old[sn]
+		}
+		tags := make([]string, 0, len(cur)+len(add))
+		for _, t := range append(append([]string{}, cur...), add...) {
+			if !removeSet[t] {
+				tags = append(tags, t)
+			}
+		}
+		if rst[sn], err = normalizeTags(tags); err != nil {
+			return nil, err
+		}
+	}
+	return rst, nil
+}
+
+// Groups 分组树，没分组的设备数在根节点
+func (s *deviceService) Groups(sessionUser *passportprotos.User) (*models.DeviceGroupNode, error) {
+	counts, err := repos.DeviceRepo.GroupCounts(sessionUser.TenantID, sessionUser.UID)
+	if err != nil {
+		logger.Error("deviceService.Groups DB ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+
+	paths := make([]string, 0, len(counts))
+	for path := range counts {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	root := &models.DeviceGroupNode{}
+	nodes := map[string]*models.DeviceGroupNode{"": root}
+	for _, path := range paths {
+		n := counts[path]
+		root.Count += n
+		if path == "" {
+			continue
+		}
+
+		parent, cur := root, ""
+		for _, name := range strings.Split(path, "/") {
+			if cur == "" {
+				cur = name
+			} else {
+				cur += "/" + name
+			}
+			node, ok := nodes[cur]
+			if !ok {
+				node = &models.DeviceGroupNode{Name: name, Path: cur}
+				nodes[cur] = node
+				parent.Children = append(parent.Children, node)
+			}
+			node.Count += n
+			parent = node
+		}
+	}
+	return root, nil
+}
+
+// Tags 用到的标签和设备数
+func (s *deviceService) Tags(sessionUser *passportprotos.User) ([]models.DeviceTagCount, error) {
+	rr, err := repos.DeviceRepo.TagCounts(sessionUser.TenantID, sessionUser.UID)
+	if err != nil {
+		logger.Error("deviceService.Tags DB ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+	if rr == nil {
+		rr = []models.DeviceTagCount{}
+	}
+	return rr, nil
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"pcdn-server/models"
+)
+
+// go test -v -count=1 -run TestNormalizeGroup pcdn-server/service
+func TestNormalizeGroup(t *testing.T) {
+	tests := []struct {
+		group string
+		want  string
+		ok    bool
+	}{
+		{"", "", true},
+		{" 华东/ 上海//A线 ", "华东/上海/A线", true},
+		{"/a/b/", "a/b", true},
+		{"a/b/c/d/e", "a/b/c/d/e", true},
+		{"a/b/c/d/e/f", "", false},
+		{strings.Repeat("x", deviceGroupMaxLen+1), "", false},
+	}
+	for _, tt := range tests {
+		got, err := normalizeGroup(tt.group)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("%q: got %q %v", tt.group, got, err)
+		}
+	}
+}
+
+// go test -v -count=1 -run TestNormalizeTags pcdn-server/service
+func TestNormalizeTags(t *testing.T) {
+	many := make([]string, deviceTagMax+1)
+	for i := range many {
+		many[i] = strings.Repeat("t", i+1)
+	}
+	tests := []struct {
+		name string
+		tags []string
+		want models.StringArr
+		ok   bool
+	}{
+		{"nil", nil, models.StringArr{}, true},
+		{"trim and dedupe", []string{" a ", "b", "a", "", "  "}, models.StringArr{"a", "b"}, true},
+		{"comma", []string{"a,b"}, nil, false},
+		{"too long", []string{strings.Repeat("长", deviceTagMaxLen+1)}, nil, false},
+		{"max len", []string{strings.Repeat("长", deviceTagMaxLen)}, models.StringArr{strings.Repeat("长", deviceTagMaxLen)}, true},
+		{"too many", many, nil, false},
+	}
+	for _, tt := range tests {
+		got, err := normalizeTags(tt.tags)
+		if (err == nil) != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v %v", tt.name, got, err)
+		}
+	}
+}
+
+// go test -v -count=1 -run TestCompareVersion pcdn-server/service
+func TestCompareVersion(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"v1.2.3", "1.2.3", 0},
+		{"1.10.0", "1.9.0", 1},
+		{"1.2", "1.2.1", -1},
+		{"2.0", "10.0", -1},
+		{"1.2.beta", "1.2.alpha", 1},
+	}
+	for _, tt := range tests {
+		if got := compareVersion(tt.a, tt.b); got != tt.want {
+			t.Errorf("%s vs %s: got %d want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
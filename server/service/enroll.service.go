@@ -0,0 +1,190 @@
+package service
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+	"pcdn-server/repos"
+
+	passportprotos "github.com/liuhengloveyou/passport/protos"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 认领码输错这么多次后不能再认领，管理员重置后可以再认领
+const maxClaimAttempts = 10
+
+type enrollService struct {
+}
+
+// Claim 用设备显示的认领码认领待认领列表里的设备，设备下次认证时拿到凭证。
+// 手动添加的设备也要这样认领一次，证明设备在自己手上
+func (s *enrollService) Claim(sessionUser *passportprotos.User, req *models.DeviceClaimReq) (uint64, error) {
+	if sessionUser == nil || sessionUser.UID <= 0 || req == nil {
+		return 0, common.ErrParam
+	}
+	sn := strings.ToUpper(strings.TrimSpace(req.SN))
+	code := common.NormalizeClaimCode(req.Code)
+	if sn == "" || code == "" {
+		return 0, common.ErrParam
+	}
+	group, err := normalizeGroup(req.Group)
+	if err != nil {
+		return 0, err
+	}
+
+	pending, err := repos.DevicePendingRepo.Get(sn)
+	if err != nil {
+		logger.Error("enrollService.Claim DB ERR: ", zap.Error(err))
+		return 0, common.ErrService
+	}
+	if pending == nil {
+		if _, err := repos.DeviceRepo.GetBySN(sn); err == nil {
+			return 0, common.ErrAgentSNExists
+		}
+		return 0, common.ErrParam
+	}
+	if pending.Attempts >= maxClaimAttempts {
+		s.denyLog(sessionUser, sn, "too many attempts")
+		return 0, common.ErrNoAuth
+	}
+
+	codeHash := common.HashSecret(code)
+	if subtle.ConstantTimeCompare([]byte(codeHash), []byte(pending.ClaimCodeHash)) != 1 {
+		if err := repos.DevicePendingRepo.AddAttempt(sn); err != nil {
+			logger.Error("enrollService.Claim DB ERR: ", zap.Error(err))
+		}
+		s.denyLog(sessionUser, sn, "wrong claim code")
+		return 0, common.ErrNoAuth
+	}
+
+	if dev, err := repos.DeviceRepo.GetBySN(sn); err == nil {
+		return s.approve(sessionUser, dev, codeHash)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		logger.Error("enrollService.Claim DB ERR: ", zap.Error(err))
+		return 0, common.ErrService
+	}
+
+	dev := &models.DeviceModel{
+		SN:            sn,
+		GroupName:     group,
+		ClaimCodeHash: codeHash,
+	}
+	dev.UserId = sessionUser.UID
+	dev.TenantId = sessionUser.TenantID
+
+	id, err := repos.DevicePendingRepo.Claim(dev)
+	if err != nil {
+		logger.Error("enrollService.Claim ERR: ", zap.Error(err))
+		if strings.Contains(err.Error(), "duplicate key") {
+			return 0, common.ErrAgentSNExists
+		}
+		return 0, common.ErrService
+	}
+	logger.Debug("enrollService.Claim: ", zap.String("sn", sn), zap.Uint64("uid", sessionUser.UID), zap.Uint64("tenant", sessionUser.TenantID))
+
+	log := &models.BusinessLog{
+		UserName:     sessionUser.Cellphone.String,
+		BusinessType: models.BUSINESS_TYPE_CREATE_DEVICE,
+		Payload:      fmt.Sprintf("%v | claim | %s", id, sn),
+	}
+	log.UserId = sessionUser.UID
+	log.TenantId = sessionUser.TenantID
+	BusinessLogService.Add(log)
+
+	return id, nil
+}
+
+// 认领手动添加的设备，设备要是自己的，还没有凭证
+func (s *enrollService) approve(sessionUser *passportprotos.User, dev *models.DeviceModel, codeHash string) (uint64, error) {
+	if _, err := DeviceService.Authorize(sessionUser, dev.SN, "claim"); err != nil {
+		return 0, err
+	}
+	if dev.TokenHash != "" {
+		return 0, common.ErrAgentSNExists
+	}
+
+	if err := repos.DevicePendingRepo.Approve(dev.SN, codeHash); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, common.ErrAgentSNExists
+		}
+		logger.Error("enrollService.Claim approve ERR: ", zap.String("sn", dev.SN), zap.Error(err))
+		return 0, common.ErrService
+	}
+
+	log := &models.BusinessLog{
+		UserName:     sessionUser.Cellphone.String,
+		BusinessType: models.BUSINESS_TYPE_UPDATE_DEVICE,
+		Payload:      fmt.Sprintf("%v | claim | %s", dev.Id, dev.SN),
+	}
+	log.UserId = sessionUser.UID
+	log.TenantId = sessionUser.TenantID
+	BusinessLogService.Add(log)
+
+	return dev.Id, nil
+}
+
+// ResetPending 管理员把设备移出待认领列表: 认领码被别人抢先报上来或输错太多次时用，设备下次连上来重新加进来
+func (s *enrollService) ResetPending(sessionUser *passportprotos.User, sn string) error {
+	if sessionUser == nil || !isSystemAdmin(sessionUser) {
+		return common.ErrNoAuth
+	}
+	sn = strings.ToUpper(strings.TrimSpace(sn))
+	if sn == "" {
+		return common.ErrParam
+	}
+
+	if err := repos.DevicePendingRepo.Delete(sn); err != nil {
+		logger.Error("enrollService.ResetPending DB ERR: ", zap.Error(err))
+		return common.ErrService
+	}
+
+	log := &models.BusinessLog{
+		UserName:     sessionUser.Cellphone.String,
+		BusinessType: models.BUSINESS_TYPE_DEL_DEVICE,
+		Payload:      fmt.Sprintf("%s | reset pending", sn),
+	}
+	log.UserId = sessionUser.UID
+	log.TenantId = sessionUser.TenantID
+	BusinessLogService.Add(log)
+	return nil
+}
+
+// Pending 待认领的设备和它们上报的清单。设备还不属于任何租户，只有管理员能看
+func (s *enrollService) Pending(sessionUser *passportprotos.User, page, pageSize int) ([]models.DevicePending, int64, error) {
+	if sessionUser == nil || !isSystemAdmin(sessionUser) {
+		return nil, 0, common.ErrNoAuth
+	}
+
+	rr, total, err := repos.DevicePendingRepo.Find(page, pageSize)
+	if err != nil {
+		logger.Error("enrollService.Pending DB ERR: ", zap.Error(err))
+		return nil, 0, common.ErrService
+	}
+	for i := range rr {
+		inv, err := repos.InventoryRepo.Get(rr[i].SN)
+		if err != nil {
+			logger.Error("enrollService.Pending inventory ERR: ", zap.String("sn", rr[i].SN), zap.Error(err))
+			continue
+		}
+		rr[i].Inventory = inv
+	}
+	return rr, total, nil
+}
+
+func (s *enrollService) denyLog(sessionUser *passportprotos.User, sn, reason string) {
+	logger.Warn("enrollService.Claim deny: ", zap.Uint64("uid", sessionUser.UID), zap.String("sn", sn), zap.String("reason", reason))
+
+	log := &models.BusinessLog{
+		UserName:     sessionUser.Cellphone.String,
+		BusinessType: models.BUSINESS_TYPE_DENY,
+		Payload:      fmt.Sprintf("%s | claim | %s", sn, reason),
+	}
+	log.UserId = sessionUser.UID
+	log.TenantId = sessionUser.TenantID
+	BusinessLogService.Add(log)
+}
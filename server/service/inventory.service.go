@@ -0,0 +1,49 @@
+package service
+
+import (
+	"pcdn-server/common"
+	"pcdn-server/models"
+	"pcdn-server/repos"
+
+	passportprotos "github.com/liuhengloveyou/passport/protos"
+	"go.uber.org/zap"
+)
+
+type inventoryService struct {
+}
+
+// Get 设备当前的硬件和系统清单，没上报过时为nil
+func (s *inventoryService) Get(sessionUser *passportprotos.User, sn string) (*models.DeviceInventory, error) {
+	sn, err := ownedDeviceSN(sessionUser, sn, "inventory")
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := repos.InventoryRepo.Get(sn)
+	if err != nil {
+		logger.Error("inventoryService.Get DB ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+	return m, nil
+}
+
+// History 设备清单的变化历史，最新的在前
+func (s *inventoryService) History(sessionUser *passportprotos.User, sn string, page, pageSize int) ([]models.DeviceInventoryHistory, int64, error) {
+	sn, err := ownedDeviceSN(sessionUser, sn, "inventory/history")
+	if err != nil {
+		return nil, 0, err
+	}
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 30
+	}
+
+	rr, total, err := repos.InventoryRepo.FindHistory(sn, page, pageSize)
+	if err != nil {
+		logger.Error("inventoryService.History DB ERR: ", zap.Error(err))
+		return nil, 0, common.ErrService
+	}
+	return rr, total, nil
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+	"pcdn-server/repos"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// 一条曲线最多返回的点数，超过时加大step
+	metricsMaxPoints = 2000
+	// 第一层写入有一分钟左右的延迟，降采样晚一点做
+	metricsRollupDelay = 2 * time.Minute
+)
+
+type metricsService struct {
+}
+
+// Query 查询设备一段时间的指标曲线
+// start/end 毫秒，end为0时是现在，start为0时是end前1小时；step 秒，0时自动
+func (s *metricsService) Query(sn string, metrics []string, label string, start, end, step int64) ([]models.MetricSeries, error) {
+	if sn == "" {
+		return nil, common.ErrParam
+	}
+	sn = strings.ToUpper(sn)
+
+	if len(metrics) == 0 {
+		metrics = models.AllMetrics
+	}
+	for _, m := range metrics {
+		if !isKnownMetric(m) {
+			return nil, common.ErrParam
+		}
+	}
+
+	if end <= 0 {
+		end = time.Now().UnixMilli()
+	}
+	if start <= 0 {
+		start = end - time.Hour.Milliseconds()
+	}
+	if start >= end {
+		return nil, common.ErrParam
+	}
+
+	tier, stepMs := metricsTier(time.Now(), start, end, step*1000)
+	points, err := repos.MetricsRepo.Query(tier, sn, metrics, label, start, end, stepMs)
+	if err != nil {
+		logger.Error("metricsService.Query DB ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+
+	series := make([]models.MetricSeries, 0)
+	for _, p := range points {
+		n := len(series)
+		if n == 0 || series[n-1].Metric != p.Metric || series[n-1].Label != p.Label {
+			series = append(series, models.MetricSeries{Metric: p.Metric, Label: p.Label, Tier: tier.Name, Step: stepMs})
+			n++
+		}
+		p.Metric, p.Label = "", ""
+		series[n-1].Points = append(series[n-1].Points, p)
+	}
+	return series, nil
+}
+
+func isKnownMetric(name string) bool {
+	for _, m := range models.AllMetrics {
+		if m == name {
+			return true
+		}
+	}
+	return false
+}
+
+// metricsTier 选查询用的精度层和step(毫秒)
+// 在保存期内覆盖start、精度不比step细的最粗一层，曲线点数太多时加大step
+func metricsTier(now time.Time, start, end, step int64) (models.MetricTier, int64) {
+	var tier models.MetricTier
+	found := false
+	for _, t := range models.MetricTiers {
+		if now.Add(-t.Retention).UnixMilli() > start {
+			continue // 这一层已经没有start的数据了
+		}
+		if !found || t.Step <= step {
+			tier, found = t, true
+		}
+	}
+	if !found {
+		tier = models.MetricTiers[len(models.MetricTiers)-1]
+	}
+
+	if step < tier.Step {
+		step = tier.Step
+	}
+	if n := (end - start) / step; n > metricsMaxPoints {
+		step = (end - start + metricsMaxPoints - 1) / metricsMaxPoints
+		step = (step + tier.Step - 1) / tier.Step * tier.Step
+	}
+	return tier, step
+}
+
+// Rollup 逐层降采样已经结束的时间段
+func (s *metricsService) Rollup() {
+	now := time.Now().Add(-metricsRollupDelay)
+	for i := 1; i < len(models.MetricTiers); i++ {
+		from, to := models.MetricTiers[i-1], models.MetricTiers[i]
+
+		last, err := repos.MetricsRepo.LastTs(to)
+		if err != nil {
+			logger.Error("metricsService.Rollup DB ERR: ", zap.String("tier", to.Name), zap.Error(err))
+			return
+		}
+
+		start := last + to.Step
+		if last == 0 {
+			start = now.Add(-from.Retention).UnixMilli() / to.Step * to.Step
+		}
+		end := now.UnixMilli() / to.Step * to.Step
+		if end <= start {
+			continue
+		}
+
+		if err := repos.MetricsRepo.Rollup(from, to, start, end); err != nil {
+			logger.Error("metricsService.Rollup DB ERR: ", zap.String("tier", to.Name), zap.Error(err))
+			return
+		}
+	}
+}
+
+// Expire 删除各层超过保存期的数据
+func (s *metricsService) Expire() {
+	now := time.Now()
+	for _, tier := range models.MetricTiers {
+		if err := repos.MetricsRepo.Expire(tier, now.Add(-tier.Retention).UnixMilli()); err != nil {
+			logger.Error("metricsService.Expire DB ERR: ", zap.String("tier", tier.Name), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/url"
+	"strings"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+	"pcdn-server/repos"
+	"pcdn-server/tcpservice"
+
+	passportprotos "github.com/liuhengloveyou/passport/protos"
+	"github.com/liuhengloveyou/pcdn/protos"
+	"go.uber.org/zap"
+)
+
+const (
+	// 和agent一致
+	probeMaxTargets = 20
+	probeMaxCount   = 20
+)
+
+type probeService struct {
+}
+
+// 新增或修改探测目标，Id为0时新增；保存后马上下发给在线的设备
+func (s *probeService) Save(sessionUser *passportprotos.User, m *models.ProbeTargetModel) (uint64, error) {
+	if err := validateProbeTarget(m); err != nil {
+		return 0, err
+	}
+
+	existing, err := repos.ProbeRepo.Find(sessionUser.TenantID, sessionUser.UID)
+	if err != nil {
+		logger.Error("probeService.Save DB ERR: ", zap.Error(err))
+		return 0, common.ErrService
+	}
+	for _, e := range existing {
+		if e.Id != m.Id && e.Name == m.Name {
+			return 0, common.ErrParam
+		}
+	}
+	if m.Id == 0 && len(existing) >= probeMaxTargets {
+		return 0, common.ErrParam
+	}
+
+	sel := &models.DeviceSelector{Devices: m.Devices, Group: m.Group, Tags: m.Tags}
+	if err := normalizeSelector(sessionUser, sel); err != nil {
+		return 0, err
+	}
+	m.Devices, m.Group, m.Tags = sel.Devices, sel.Group, sel.Tags
+	m.UserId = sessionUser.UID
+	m.TenantId = sessionUser.TenantID
+
+	id, err := repos.ProbeRepo.Save(m)
+	if err != nil {
+		logger.Error("probeService.Save DB ERR: ", zap.Error(err))
+		return 0, common.ErrService
+	}
+
+	go s.syncOwner(sessionUser.TenantID, sessionUser.UID)
+	return id, nil
+}
+
+func (s *probeService) Delete(sessionUser *passportprotos.User, id uint64) error {
+	if id == 0 {
+		return common.ErrParam
+	}
+	if err := repos.ProbeRepo.Delete(id, sessionUser.UID); err != nil {
+		logger.Error("probeService.Delete DB ERR: ", zap.Error(err))
+		return common.ErrService
+	}
+
+	go s.syncOwner(sessionUser.TenantID, sessionUser.UID)
+	return nil
+}
+
+func (s *probeService) List(sessionUser *passportprotos.User) ([]models.ProbeTargetModel, error) {
+	rr, err := repos.ProbeRepo.Find(sessionUser.TenantID, sessionUser.UID)
+	if err != nil {
+		logger.Error("probeService.List DB ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+	return rr, nil
+}
+
+// Device 设备应有的探测设置、设备上的版本和最近一轮结果
+func (s *probeService) Device(sessionUser *passportprotos.User, sn string) (*models.DeviceProbes, error) {
+	sn, err := ownedDeviceSN(sessionUser, sn, "probe")
+	if err != nil {
+		return nil, err
+	}
+
+	cfgs, err := s.deviceConfigs(sessionUser.TenantID, sessionUser.UID, []string{sn})
+	if err != nil {
+		logger.Error("probeService.Device DB ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+	rst := &models.DeviceProbes{SN: sn, Version: cfgs[sn].Version, Targets: cfgs[sn].Targets}
+
+	if statuses, err := tcpservice.GetAgentStatuses([]string{sn}); err == nil && statuses[sn] != nil {
+		rst.DeviceVersion = statuses[sn].ProbeVersion
+	}
+	if rst.Results, err = tcpservice.GetAgentProbes(sn); err != nil {
+		logger.Error("probeService.Device redis ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+	return rst, nil
+}
+
+// SyncAll 定时对账: 在线设备上的探测设置版本和应有的不一样时重新下发
+func (s *probeService) SyncAll() {
+	type owner struct {
+		tenantId, uid uint64
+	}
+	owners := make(map[owner][]string)
+
+	for page := 1; ; page++ {
+		devices, _, err := repos.DeviceRepo.Find(0, 0, nil, page, 500)
+		if err != nil {
+			logger.Error("probeService.SyncAll DB ERR: ", zap.Error(err))
+			return
+		}
+		for _, d := range devices {
+			o := owner{tenantId: d.TenantId}
+			if d.TenantId == 0 {
+				o.uid = d.UserId
+			}
+			owners[o] = append(owners[o], strings.ToUpper(d.SN))
+		}
+		if len(devices) < 500 {
+			break
+		}
+	}
+
+	for o, sns := range owners {
+		s.sync(o.tenantId, o.uid, sns)
+	}
+}
+
+func (s *probeService) syncOwner(tenantId, uid uint64) {
+	sns, err := repos.DeviceRepo.FindSNs(tenantId, uid, nil)
+	if err != nil {
+		logger.Error("probeService.syncOwner DB ERR: ", zap.Error(err))
+		return
+	}
+	for i := range sns {
+		sns[i] = strings.ToUpper(sns[i])
+	}
+	s.sync(tenantId, uid, sns)
+}
+
+// 只下发给在线的设备，离线的等上线后下一次对账
+func (s *probeService) sync(tenantId, uid uint64, sns []string) {
+	cfgs, err := s.deviceConfigs(tenantId, uid, sns)
+	if err != nil {
+		logger.Error("probeService.sync DB ERR: ", zap.Error(err))
+		return
+	}
+	statuses, err := tcpservice.GetAgentStatuses(sns)
+	if err != nil {
+		logger.Error("probeService.sync redis ERR: ", zap.Error(err))
+		return
+	}
+
+	for _, sn := range sns {
+		agent := statuses[sn]
+		cfg := cfgs[sn]
+		if !tcpservice.IsOnline(agent) || agent.ProbeVersion == cfg.Version {
+			continue
+		}
+		if _, err := tcpservice.ProbeConfig(sn, cfg); err != nil {
+			logger.Warn("probeService.sync ERR: ", zap.String("sn", sn), zap.Error(err))
+			continue
+		}
+		logger.Info("probeService.sync: ", zap.String("sn", sn), zap.String("version", cfg.Version), zap.Int("targets", len(cfg.Targets)))
+	}
+}
+
+// 每台设备的探测设置，没有目标的设备版本为空
+func (s *probeService) deviceConfigs(tenantId, uid uint64, sns []string) (map[string]*protos.ProbeConfig, error) {
+	targets, err := repos.ProbeRepo.Find(tenantId, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	rst := make(map[string]*protos.ProbeConfig, len(sns))
+	for _, sn := range sns {
+		rst[sn] = &protos.ProbeConfig{}
+	}
+
+	groups := make(map[string]map[string]bool)
+	for _, t := range targets {
+		var scope map[string]bool
+		if len(t.Devices) > 0 {
+			scope = make(map[string]bool, len(t.Devices))
+			for _, sn := range t.Devices {
+				scope[sn] = true
+			}
+		} else if t.Group != "" || len(t.Tags) > 0 {
+			key := t.Group + "|" + strings.Join(t.Tags, ",")
+			if groups[key] == nil {
+				members, err := repos.DeviceRepo.FindSNs(tenantId, uid, &models.DeviceSelector{Group: t.Group, Tags: t.Tags})
+				if err != nil {
+					return nil, err
+				}
+				groups[key] = make(map[string]bool, len(members))
+				for _, sn := range members {
+					groups[key][strings.ToUpper(sn)] = true
+				}
+			}
+			scope = groups[key]
+		}
+
+		pt := &protos.ProbeTarget{
+			Name:      t.Name,
+			Type:      t.Type,
+			Target:    t.Target,
+			Interval:  t.Interval,
+			Count:     t.Count,
+			TimeoutMs: t.TimeoutMs,
+			DnsServer: t.DnsServer,
+		}
+		for sn, cfg := range rst {
+			if scope == nil || scope[sn] {
+				cfg.Targets = append(cfg.Targets, pt)
+			}
+		}
+	}
+
+	for _, cfg := range rst {
+		cfg.Version = probeVersion(cfg.Targets)
+	}
+	return rst, nil
+}
+
+// 探测设置的摘要，没有目标时为空和agent没有设置时一致
+func probeVersion(targets []*protos.ProbeTarget) string {
+	if len(targets) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(targets)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+func validateProbeTarget(m *models.ProbeTargetModel) error {
+	if m == nil || m.Name == "" || len(m.Name) > 32 || m.Target == "" {
+		return common.ErrParam
+	}
+	m.Target = strings.TrimSpace(m.Target)
+
+	switch m.Type {
+	case models.PROBE_TYPE_ICMP, models.PROBE_TYPE_DNS:
+	case models.PROBE_TYPE_TCP:
+		if _, _, err := net.SplitHostPort(m.Target); err != nil {
+			return common.ErrParam
+		}
+	case models.PROBE_TYPE_HTTP:
+		u, err := url.Parse(m.Target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return common.ErrParam
+		}
+	default:
+		return common.ErrParam
+	}
+	if m.DnsServer != "" {
+		if _, _, err := net.SplitHostPort(m.DnsServer); err != nil {
+			return common.ErrParam
+		}
+	}
+
+	if m.Interval == 0 {
+		m.Interval = 60
+	}
+	if m.Count == 0 {
+		m.Count = 5
+	}
+	if m.TimeoutMs == 0 {
+		m.TimeoutMs = 2000
+	}
+	if m.Interval < 10 || m.Interval > 3600 || m.Count > probeMaxCount || m.TimeoutMs < 100 || m.TimeoutMs > 10000 {
+		return common.ErrParam
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+package service
+
+import "github.com/liuhengloveyou/pcdn/protos/prom"
+
+// 业务层的运行指标，/metrics导出
+var (
+	promAlertNotices  = prom.NewCounter("pcdn_alert_notifications_total", "发出的告警通知数，result: ok/error", "channel", "result")
+	promAlertEvaluate = prom.NewHistogram("pcdn_alert_evaluate_seconds", "一轮告警规则检查的耗时", prom.DurationBuckets)
+)
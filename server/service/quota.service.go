@@ -0,0 +1,297 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+	"pcdn-server/repos"
+
+	passportprotos "github.com/liuhengloveyou/passport/protos"
+	"github.com/liuhengloveyou/pcdn/protos"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// 配额按运营商的习惯 1GB = 1000^3 字节
+	quotaBytesPerGB = 1000 * 1000 * 1000
+
+	// stop动作的上行速率，接入服务器的管理通道agent会单独放行
+	quotaStopRate = "8kbit"
+	quotaStopBits = 8000
+)
+
+type trafficQuotaService struct {
+}
+
+// 设置设备的流量配额，QuotaGB为0时删除配额并恢复限速
+func (s *trafficQuotaService) Save(ctx context.Context, m *models.TrafficQuotaModel) error {
+	if m == nil || m.SN == "" {
+		return common.ErrParam
+	}
+	m.SN = strings.ToUpper(m.SN)
+	if m.QuotaGB == 0 {
+		return s.Delete(ctx, m.SN)
+	}
+
+	if m.ResetDay == 0 {
+		m.ResetDay = 1
+	}
+	if m.Direction == "" {
+		m.Direction = "both"
+	}
+	if err := validateQuota(m); err != nil {
+		logger.Error("trafficQuotaService.Save param ERR: ", zap.Any("quota", m), zap.Error(err))
+		return common.ErrParam
+	}
+	sort.Slice(m.Actions, func(i, j int) bool { return m.Actions[i].Percent < m.Actions[j].Percent })
+
+	m.UserId = ctx.Value("UID").(uint64)
+	m.TenantId = ctx.Value("TID").(uint64)
+	if err := repos.TrafficQuotaRepo.Save(m); err != nil {
+		logger.Error("trafficQuotaService.Save DB ERR: ", zap.Error(err))
+		return common.ErrService
+	}
+
+	s.addLog(m.SN, fmt.Sprintf("%s | quota %dGB | day %d | %s | %d actions", m.SN, m.QuotaGB, m.ResetDay, m.Direction, len(m.Actions)), m.UserId, m.TenantId, ctx.Value("Nickname").(string))
+
+	// 新的阈值可能已经超了，马上检查一次
+	if q, err := repos.TrafficQuotaRepo.GetBySN(m.SN); err == nil {
+		s.checkOne(q)
+	}
+	return nil
+}
+
+func validateQuota(m *models.TrafficQuotaModel) error {
+	if m.ResetDay > 28 {
+		return fmt.Errorf("reset day: %d", m.ResetDay)
+	}
+	switch m.Direction {
+	case "send", "recv", "both":
+	default:
+		return fmt.Errorf("direction: %s", m.Direction)
+	}
+
+	for _, a := range m.Actions {
+		if a.Percent == 0 {
+			return fmt.Errorf("percent is 0")
+		}
+		switch a.Action {
+		case models.QUOTA_ACTION_WARN, models.QUOTA_ACTION_STOP:
+		case models.QUOTA_ACTION_THROTTLE:
+			if a.Rate == 0 {
+				return fmt.Errorf("throttle rate is 0")
+			}
+		default:
+			return fmt.Errorf("action: %s", a.Action)
+		}
+	}
+	return nil
+}
+
+// 删除配额，正在限速或停止的设备恢复原来的限速
+func (s *trafficQuotaService) Delete(ctx context.Context, sn string) error {
+	q, err := repos.TrafficQuotaRepo.GetBySN(sn)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		logger.Error("trafficQuotaService.Delete DB ERR: ", zap.Error(err))
+		return common.ErrService
+	}
+
+	if q.Enforced == models.QUOTA_ACTION_THROTTLE || q.Enforced == models.QUOTA_ACTION_STOP {
+		if err := restoreTcLimit(sn); err != nil {
+			return err
+		}
+	}
+	if err := repos.TrafficQuotaRepo.Delete(sn); err != nil {
+		logger.Error("trafficQuotaService.Delete DB ERR: ", zap.Error(err))
+		return common.ErrService
+	}
+
+	s.addLog(sn, fmt.Sprintf("%s | quota deleted", sn), ctx.Value("UID").(uint64), ctx.Value("TID").(uint64), ctx.Value("Nickname").(string))
+	return nil
+}
+
+// 查询设备的配额和本周期用量
+func (s *trafficQuotaService) Usage(sn string) (*models.TrafficQuotaUsage, error) {
+	if sn == "" {
+		return nil, common.ErrParam
+	}
+
+	q, err := repos.TrafficQuotaRepo.GetBySN(strings.ToUpper(sn))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, common.ErrParam
+		}
+		logger.Error("trafficQuotaService.Usage DB ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+
+	return quotaUsage(q), nil
+}
+
+// 列出当前用户(租户)所有设备的配额和用量
+func (s *trafficQuotaService) List(sessionUser *passportprotos.User, page int) ([]*models.TrafficQuotaUsage, error) {
+	if page < 1 {
+		page = 1
+	}
+
+	rr, err := repos.TrafficQuotaRepo.Find(sessionUser.TenantID, sessionUser.UID, page, 50)
+	if err != nil {
+		logger.Error("trafficQuotaService.List DB ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+
+	usages := make([]*models.TrafficQuotaUsage, len(rr))
+	for i := range rr {
+		usages[i] = quotaUsage(&rr[i])
+	}
+	return usages, nil
+}
+
+func quotaUsage(q *models.TrafficQuotaModel) *models.TrafficQuotaUsage {
+	_, end := quotaCycle(time.Now(), q.ResetDay)
+	return &models.TrafficQuotaUsage{
+		TrafficQuotaModel: *q,
+		CycleEnd:          end.UnixMilli(),
+		Used:              quotaUsed(q),
+		Percent:           quotaPercent(q),
+	}
+}
+
+// 定时检查所有配额
+func (s *trafficQuotaService) CheckAll() {
+	for page := 1; ; page++ {
+		rr, err := repos.TrafficQuotaRepo.Find(0, 0, page, 100)
+		if err != nil {
+			logger.Error("trafficQuotaService.CheckAll DB ERR: ", zap.Error(err))
+			return
+		}
+		if len(rr) == 0 {
+			return
+		}
+
+		for i := range rr {
+			s.checkOne(&rr[i])
+		}
+	}
+}
+
+// checkOne 进入新周期时清零并恢复限速；用量超过新的阈值时执行对应的动作
+func (s *trafficQuotaService) checkOne(q *models.TrafficQuotaModel) {
+	start, _ := quotaCycle(time.Now(), q.ResetDay)
+	if q.CycleStart != start.UnixMilli() {
+		if q.Enforced == models.QUOTA_ACTION_THROTTLE || q.Enforced == models.QUOTA_ACTION_STOP {
+			if err := restoreTcLimit(q.SN); err != nil {
+				return // 设备不在线，下次再试
+			}
+		}
+
+		q.CycleStart = start.UnixMilli()
+		q.UsedSend, q.UsedRecv = 0, 0
+		q.Triggered, q.Enforced, q.EnforcedRate = 0, "", 0
+		if err := repos.TrafficQuotaRepo.ResetCycle(q); err != nil {
+			logger.Error("trafficQuotaService.checkOne DB ERR: ", zap.Error(err))
+		}
+		return
+	}
+
+	action := pendingQuotaAction(q.Actions, quotaPercent(q), q.Triggered)
+	if action == nil {
+		return
+	}
+
+	var err error
+	switch action.Action {
+	// 带上速率上限，开了自适应限速的设备也不会超过
+	case models.QUOTA_ACTION_THROTTLE:
+		err = pushTcPolicy(q.SN, &protos.TcPolicy{Rate: fmt.Sprintf("%dmbit", action.Rate), CapBits: uint64(action.Rate) * 1000 * 1000})
+	case models.QUOTA_ACTION_STOP:
+		err = pushTcPolicy(q.SN, &protos.TcPolicy{Rate: quotaStopRate, CapBits: quotaStopBits})
+	}
+	if err != nil {
+		return // 设备不在线，下次再试
+	}
+
+	q.Triggered = action.Percent
+	if action.Action != models.QUOTA_ACTION_WARN {
+		q.Enforced, q.EnforcedRate = action.Action, action.Rate
+	} else if q.Enforced == "" {
+		q.Enforced = models.QUOTA_ACTION_WARN
+	}
+	if err := repos.TrafficQuotaRepo.UpdateState(q); err != nil {
+		logger.Error("trafficQuotaService.checkOne DB ERR: ", zap.Error(err))
+	}
+
+	s.addLog(q.SN, fmt.Sprintf("%s | quota %d%% | %s %d | used %d/%dGB", q.SN, action.Percent, action.Action, action.Rate, quotaUsed(q)/quotaBytesPerGB, q.QuotaGB), q.UserId, q.TenantId, "system")
+}
+
+func (s *trafficQuotaService) addLog(sn, payload string, uid, tid uint64, userName string) {
+	businessLog := &models.BusinessLog{
+		BusinessType: models.BUSINESS_TYPE_QUOTA,
+		Payload:      payload,
+	}
+	businessLog.UserId = uid
+	businessLog.TenantId = tid
+	businessLog.UserName = userName
+	if _, err := BusinessLogService.Add(businessLog); err != nil {
+		logger.Error("trafficQuotaService Add BusinessLog ERR: ", zap.String("sn", sn), zap.Error(err))
+	}
+}
+
+// quotaEnforced 设备是不是因为配额超了正在限速或停止
+func quotaEnforced(sn string) bool {
+	q, err := repos.TrafficQuotaRepo.GetBySN(sn)
+	return err == nil && (q.Enforced == models.QUOTA_ACTION_THROTTLE || q.Enforced == models.QUOTA_ACTION_STOP)
+}
+
+// pendingQuotaAction 用量达到、但本周期还没执行过的最高阈值
+func pendingQuotaAction(actions models.QuotaActionArray, percent float64, triggered uint) *models.QuotaAction {
+	var rst *models.QuotaAction
+	for i := range actions {
+		a := &actions[i]
+		if a.Percent > triggered && float64(a.Percent) <= percent {
+			if rst == nil || a.Percent > rst.Percent {
+				rst = a
+			}
+		}
+	}
+	return rst
+}
+
+func quotaUsed(q *models.TrafficQuotaModel) uint64 {
+	switch q.Direction {
+	case "send":
+		return q.UsedSend
+	case "recv":
+		return q.UsedRecv
+	}
+	return q.UsedSend + q.UsedRecv
+}
+
+func quotaPercent(q *models.TrafficQuotaModel) float64 {
+	if q.QuotaGB == 0 {
+		return 0
+	}
+	return float64(quotaUsed(q)) * 100 / float64(uint64(q.QuotaGB)*quotaBytesPerGB)
+}
+
+// quotaCycle 当前时间所在的计费周期 [start, end)，每月day号开始
+func quotaCycle(now time.Time, day uint32) (start, end time.Time) {
+	if day == 0 {
+		day = 1
+	}
+	start = time.Date(now.Year(), now.Month(), int(day), 0, 0, 0, 0, time.Local)
+	if now.Before(start) {
+		start = start.AddDate(0, -1, 0)
+	}
+	return start, start.AddDate(0, 1, 0)
+}
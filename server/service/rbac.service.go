@@ -0,0 +1,315 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+	"pcdn-server/repos"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/rbac"
+	"github.com/liuhengloveyou/passport/accessctl"
+	passportprotos "github.com/liuhengloveyou/passport/protos"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 自定义角色名
+var roleNameRegexp = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,31}$`)
+
+// 租户里按角色控制接口权限，租户是casbin的domain。
+// 内置角色由模型里的MyMatch判断: viewer只读，operator可以操作设备但不能管理权限，admin不限;
+// 另外可以给任意角色按接口单独授权。
+// 系统管理员和租户的所有者(passport里的root角色)不限制，租户里第一个角色只能由他们分配;
+// 没有租户、没有角色的用户和权限没加载时都不能调用要检查权限的接口
+type rbacService struct {
+	enforcer *casbin.SyncedEnforcer
+	roles    rbac.RoleManager
+}
+
+// InitRbac 加载casbin模型和rbac_rule表里的策略
+func InitRbac() error {
+	conf := common.ServConfig.RbacModel
+	if conf == "" {
+		conf = "rbac_with_domains_model.conf"
+	}
+
+	e, err := casbin.NewSyncedEnforcer(conf, repos.RbacRepo)
+	if err != nil {
+		return err
+	}
+	RbacService.setEnforcer(e)
+	return nil
+}
+
+func (s *rbacService) setEnforcer(e *casbin.SyncedEnforcer) {
+	s.roles = e.GetRoleManager()
+	e.AddFunction("MyMatch", s.builtinMatch)
+	s.enforcer = e
+}
+
+// MyMatch(sub, dom, obj, act) 内置角色的权限
+func (s *rbacService) builtinMatch(args ...interface{}) (interface{}, error) {
+	if len(args) != 4 {
+		return false, nil
+	}
+	sub, _ := args[0].(string)
+	dom, _ := args[1].(string)
+	obj, _ := args[2].(string)
+	act, _ := args[3].(string)
+
+	roles, _ := s.roles.GetRoles(sub, dom)
+	for _, role := range roles {
+		switch role {
+		case models.ROLE_ADMIN:
+			return true, nil
+		case models.ROLE_OPERATOR:
+			if !strings.HasPrefix(obj, "/rbac/") {
+				return true, nil
+			}
+		case models.ROLE_VIEWER:
+			if act == models.RBAC_ACT_READ {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// Enforce 当前用户能不能调用接口obj，act是read/write
+func (s *rbacService) Enforce(sessionUser *passportprotos.User, obj, act string) bool {
+	if sessionUser == nil || sessionUser.UID <= 0 {
+		return false
+	}
+	if isSystemAdmin(sessionUser) {
+		return true
+	}
+	// 没有租户的用户只能操作自己名下的资源，由各业务按UID检查；没有权限可管
+	if sessionUser.TenantID == 0 {
+		return !strings.HasPrefix(obj, "/rbac/")
+	}
+	if s.enforcer == nil {
+		logger.Warn("rbacService.Enforce deny: ", zap.Uint64("uid", sessionUser.UID), zap.Uint64("tenant", sessionUser.TenantID), zap.String("obj", obj), zap.Bool("loaded", false))
+		return false
+	}
+	if isTenantOwner(sessionUser) {
+		return true
+	}
+
+	dom := strconv.FormatUint(sessionUser.TenantID, 10)
+	ok, err := s.enforcer.Enforce(strconv.FormatUint(sessionUser.UID, 10), dom, obj, act)
+	if err != nil {
+		logger.Error("rbacService.Enforce ERR: ", zap.String("obj", obj), zap.Error(err))
+		return false
+	}
+	if !ok {
+		logger.Warn("rbacService.Enforce deny: ", zap.Uint64("uid", sessionUser.UID), zap.Uint64("tenant", sessionUser.TenantID), zap.String("obj", obj), zap.String("act", act))
+	}
+	return ok
+}
+
+// MyRoles 当前用户在租户里的角色
+func (s *rbacService) MyRoles(sessionUser *passportprotos.User) []string {
+	if s.enforcer == nil || sessionUser.TenantID == 0 {
+		return []string{}
+	}
+	roles := s.enforcer.GetRolesForUserInDomain(strconv.FormatUint(sessionUser.UID, 10), strconv.FormatUint(sessionUser.TenantID, 10))
+	if roles == nil {
+		roles = []string{}
+	}
+	return roles
+}
+
+// UserRoles 租户里所有用户的角色
+func (s *rbacService) UserRoles(sessionUser *passportprotos.User) ([]models.RbacUserRole, error) {
+	dom, err := s.domain(sessionUser)
+	if err != nil {
+		return nil, err
+	}
+
+	rr := []models.RbacUserRole{}
+	for _, g := range s.groupings(2, dom) {
+		uid, _ := strconv.ParseUint(g[0], 10, 64)
+		rr = append(rr, models.RbacUserRole{UID: uid, Role: g[1]})
+	}
+	return rr, nil
+}
+
+// AssignRole 给租户里的用户分配角色
+func (s *rbacService) AssignRole(sessionUser *passportprotos.User, m *models.RbacUserRole) error {
+	dom, err := s.domain(sessionUser)
+	if err != nil {
+		return err
+	}
+	if m == nil || m.UID == 0 || !roleNameRegexp.MatchString(m.Role) {
+		return common.ErrParam
+	}
+	// 租户里还没有角色时，只有所有者和系统管理员能分配
+	if len(s.groupings(2, dom)) == 0 && !isSystemAdmin(sessionUser) && !isTenantOwner(sessionUser) {
+		logger.Warn("rbacService.AssignRole deny: ", zap.Uint64("uid", sessionUser.UID), zap.Uint64("tenant", sessionUser.TenantID), zap.String("reason", "first role"))
+		return common.ErrNoAuth
+	}
+
+	tenantId, err := repos.UserRepo.TenantID(m.UID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return common.ErrParam
+	}
+	if err != nil {
+		logger.Error("rbacService.AssignRole DB ERR: ", zap.Uint64("uid", m.UID), zap.Error(err))
+		return common.ErrService
+	}
+	if tenantId != sessionUser.TenantID {
+		logger.Warn("rbacService.AssignRole deny: ", zap.Uint64("uid", sessionUser.UID), zap.Uint64("target", m.UID), zap.Uint64("tenant", sessionUser.TenantID), zap.String("reason", "other tenant"))
+		return common.ErrNoAuth
+	}
+
+	if _, err := s.enforcer.AddRoleForUserInDomain(strconv.FormatUint(m.UID, 10), m.Role, dom); err != nil {
+		logger.Error("rbacService.AssignRole ERR: ", zap.Any("role", m), zap.Error(err))
+		return common.ErrService
+	}
+	s.addLog(sessionUser, fmt.Sprintf("assign | %d | %s", m.UID, m.Role))
+	return nil
+}
+
+// RemoveRole 收回用户的角色，不能去掉最后一个admin
+func (s *rbacService) RemoveRole(sessionUser *passportprotos.User, m *models.RbacUserRole) error {
+	dom, err := s.domain(sessionUser)
+	if err != nil {
+		return err
+	}
+	if m == nil || m.UID == 0 || m.Role == "" {
+		return common.ErrParam
+	}
+
+	uid := strconv.FormatUint(m.UID, 10)
+	if m.Role == models.ROLE_ADMIN {
+		admins := s.groupings(1, models.ROLE_ADMIN, dom)
+		if len(admins) == 1 && admins[0][0] == uid {
+			return common.ErrParam
+		}
+	}
+
+	if _, err := s.enforcer.DeleteRoleForUserInDomain(uid, m.Role, dom); err != nil {
+		logger.Error("rbacService.RemoveRole ERR: ", zap.Any("role", m), zap.Error(err))
+		return common.ErrService
+	}
+	s.addLog(sessionUser, fmt.Sprintf("remove | %d | %s", m.UID, m.Role))
+	return nil
+}
+
+// Policies 租户里单独授权的接口
+func (s *rbacService) Policies(sessionUser *passportprotos.User) ([]models.RbacPolicy, error) {
+	dom, err := s.domain(sessionUser)
+	if err != nil {
+		return nil, err
+	}
+
+	policies, err := s.enforcer.GetFilteredPolicy(1, dom)
+	if err != nil {
+		logger.Error("rbacService.Policies ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+	rr := []models.RbacPolicy{}
+	for _, p := range policies {
+		rr = append(rr, models.RbacPolicy{Role: p[0], Obj: p[2], Act: p[3]})
+	}
+	return rr, nil
+}
+
+// AddPolicy 给角色授权一个接口
+func (s *rbacService) AddPolicy(sessionUser *passportprotos.User, m *models.RbacPolicy) error {
+	dom, err := s.domain(sessionUser)
+	if err != nil {
+		return err
+	}
+	if err := validatePolicy(m); err != nil {
+		return err
+	}
+
+	if _, err := s.enforcer.AddPolicy(m.Role, dom, m.Obj, m.Act); err != nil {
+		logger.Error("rbacService.AddPolicy ERR: ", zap.Any("policy", m), zap.Error(err))
+		return common.ErrService
+	}
+	s.addLog(sessionUser, fmt.Sprintf("allow | %s | %s | %s", m.Role, m.Obj, m.Act))
+	return nil
+}
+
+func (s *rbacService) RemovePolicy(sessionUser *passportprotos.User, m *models.RbacPolicy) error {
+	dom, err := s.domain(sessionUser)
+	if err != nil {
+		return err
+	}
+	if err := validatePolicy(m); err != nil {
+		return err
+	}
+
+	if _, err := s.enforcer.RemovePolicy(m.Role, dom, m.Obj, m.Act); err != nil {
+		logger.Error("rbacService.RemovePolicy ERR: ", zap.Any("policy", m), zap.Error(err))
+		return common.ErrService
+	}
+	s.addLog(sessionUser, fmt.Sprintf("disallow | %s | %s | %s", m.Role, m.Obj, m.Act))
+	return nil
+}
+
+// 按字段过滤用户的角色，g: 用户,角色,租户
+func (s *rbacService) groupings(fieldIndex int, fieldValues ...string) [][]string {
+	rr, err := s.enforcer.GetFilteredGroupingPolicy(fieldIndex, fieldValues...)
+	if err != nil {
+		logger.Error("rbacService.groupings ERR: ", zap.Error(err))
+	}
+	return rr
+}
+
+// 配置的系统管理员
+func isSystemAdmin(sessionUser *passportprotos.User) bool {
+	return common.ServConfig.AdminUID > 0 && sessionUser.UID == uint64(common.ServConfig.AdminUID)
+}
+
+// 租户的所有者，passport建租户时给的root角色
+func isTenantOwner(sessionUser *passportprotos.User) bool {
+	for _, role := range accessctl.GetRoleForUserInDomain(sessionUser.UID, sessionUser.TenantID) {
+		if role == "root" {
+			return true
+		}
+	}
+	return false
+}
+
+// 用户所在租户的domain，没有租户时不能管理权限
+func (s *rbacService) domain(sessionUser *passportprotos.User) (string, error) {
+	if sessionUser == nil || sessionUser.TenantID == 0 {
+		return "", common.ErrNoAuth
+	}
+	if s.enforcer == nil {
+		return "", common.ErrService
+	}
+	return strconv.FormatUint(sessionUser.TenantID, 10), nil
+}
+
+func validatePolicy(m *models.RbacPolicy) error {
+	if m == nil || !roleNameRegexp.MatchString(m.Role) || !strings.HasPrefix(m.Obj, "/") {
+		return common.ErrParam
+	}
+	if m.Act != models.RBAC_ACT_READ && m.Act != models.RBAC_ACT_WRITE {
+		return common.ErrParam
+	}
+	return nil
+}
+
+func (s *rbacService) addLog(sessionUser *passportprotos.User, payload string) {
+	log := &models.BusinessLog{
+		UserName:     sessionUser.Cellphone.String,
+		BusinessType: models.BUSINESS_TYPE_RBAC,
+		Payload:      payload,
+	}
+	log.UserId = sessionUser.UID
+	log.TenantId = sessionUser.TenantID
+	if _, err := BusinessLogService.Add(log); err != nil {
+		logger.Error("rbacService Add BusinessLog ERR: ", zap.Error(err))
+	}
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"testing"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+
+	"github.com/casbin/casbin/v2"
+	passportprotos "github.com/liuhengloveyou/passport/protos"
+)
+
+// go test -v -count=1 -run TestRbacEnforce pcdn-server/service
+func TestRbacEnforce(t *testing.T) {
+	old, oldAdmin := *RbacService, common.ServConfig.AdminUID
+	defer func() {
+		*RbacService = old
+		common.ServConfig.AdminUID = oldAdmin
+	}()
+	common.ServConfig.AdminUID = 1
+
+	viewer := &passportprotos.User{UID: 100, TenantID: 7}
+	admin := &passportprotos.User{UID: 1}
+
+	// 权限还没加载
+	RbacService.enforcer = nil
+	if RbacService.Enforce(viewer, "/device/list", models.RBAC_ACT_READ) {
+		t.Fatal("allowed without enforcer")
+	}
+
+	e, err := casbin.NewSyncedEnforcer("../rbac_with_domains_model.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	RbacService.setEnforcer(e)
+
+	tests := []struct {
+		name string
+		user *passportprotos.User
+		obj  string
+		act  string
+		ok   bool
+	}{
+		{"no tenant", &passportprotos.User{UID: 100}, "/device/list", models.RBAC_ACT_READ, true},
+		{"no tenant write", &passportprotos.User{UID: 100}, "/device/tc", models.RBAC_ACT_WRITE, true},
+		{"no tenant rbac", &passportprotos.User{UID: 100}, "/rbac/role", models.RBAC_ACT_READ, false},
+		{"tenant without roles", viewer, "/device/list", models.RBAC_ACT_READ, false},
+		{"system admin", admin, "/rbac/role", models.RBAC_ACT_WRITE, true},
+	}
+	for _, tt := range tests {
+		if ok := RbacService.Enforce(tt.user, tt.obj, tt.act); ok != tt.ok {
+			t.Errorf("%s: got %v", tt.name, ok)
+		}
+	}
+
+	if _, err := e.AddRoleForUserInDomain("100", models.ROLE_VIEWER, "7"); err != nil {
+		t.Fatal(err)
+	}
+	tests = []struct {
+		name string
+		user *passportprotos.User
+		obj  string
+		act  string
+		ok   bool
+	}{
+		{"viewer read", viewer, "/device/list", models.RBAC_ACT_READ, true},
+		{"viewer write", viewer, "/device/update", models.RBAC_ACT_WRITE, false},
+		{"other tenant", &passportprotos.User{UID: 100, TenantID: 8}, "/device/list", models.RBAC_ACT_READ, false},
+		{"no role in tenant", &passportprotos.User{UID: 101, TenantID: 7}, "/device/list", models.RBAC_ACT_READ, false},
+	}
+	for _, tt := range tests {
+		if ok := RbacService.Enforce(tt.user, tt.obj, tt.act); ok != tt.ok {
+			t.Errorf("%s: got %v", tt.name, ok)
+		}
+	}
+}
@@ -12,6 +12,19 @@ var (
 	TcService          = &tcService{}
 	DeviceService      = &deviceService{}
 	BusinessLogService = &businessLogService{}
+	BandwidthService   = &bandwidthService{}
+
+	TrafficQuotaService = &trafficQuotaService{}
+	SiteService         = &siteService{}
+	MetricsService      = &metricsService{}
+	DashboardService    = &dashboardService{}
+	SessionService      = &sessionService{}
+	AlertService        = &alertService{}
+	ProbeService        = &probeService{}
+	InventoryService    = &inventoryService{}
+	TrafficService      = &trafficService{}
+	RbacService         = &rbacService{}
+	EnrollService       = &enrollService{}
 )
 
 func init() {
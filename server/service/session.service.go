@@ -0,0 +1,215 @@
+package service
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+	"pcdn-server/repos"
+
+	passportprotos "github.com/liuhengloveyou/passport/protos"
+	"go.uber.org/zap"
+)
+
+const (
+	// 没有配置sla_threshold时的可用性阈值 %
+	defaultSlaThreshold = 99.0
+	// 没结束的会话最后在线时间超过这么久，说明接入服务器已经不在了，按最后在线时间算
+	sessionStaleTimeout = 3 * time.Minute
+)
+
+type sessionService struct {
+}
+
+// 设备的在线会话记录，最新的在前
+func (s *sessionService) Sessions(sn string, page int) ([]models.DeviceSession, error) {
+	if sn == "" {
+		return nil, common.ErrParam
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	rr, err := repos.SessionRepo.Find(strings.ToUpper(sn), page, 50)
+	if err != nil {
+		logger.Error("sessionService.Sessions DB ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+	return rr, nil
+}
+
+// Uptime 设备一个月每天的在线率，month为空时是本月
+func (s *sessionService) Uptime(sn, month string, threshold float64) (*models.DeviceUptime, error) {
+	if sn == "" {
+		return nil, common.ErrParam
+	}
+	sn = strings.ToUpper(sn)
+
+	rr, err := s.uptimes([]string{sn}, month, threshold, true)
+	if err != nil {
+		return nil, err
+	}
+	return &rr[0], nil
+}
+
+// SlaReport 当前用户(租户)所有设备一个月的在线率，低于阈值的标记出来，在线率低的在前
+func (s *sessionService) SlaReport(sessionUser *passportprotos.User, month string, threshold float64) ([]models.DeviceUptime, error) {
+	sns, err := repos.DeviceRepo.FindSNs(sessionUser.TenantID, sessionUser.UID, nil)
+	if err != nil {
+		logger.Error("sessionService.SlaReport DB ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+	for i := range sns {
+		sns[i] = strings.ToUpper(sns[i])
+	}
+
+	rr, err := s.uptimes(sns, month, threshold, false)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(rr, func(i, j int) bool { return rr[i].Uptime < rr[j].Uptime })
+	return rr, nil
+}
+
+func (s *sessionService) uptimes(sns []string, month string, threshold float64, withDays bool) ([]models.DeviceUptime, error) {
+	now := time.Now()
+	start, end, err := monthRange(month, now)
+	if err != nil {
+		return nil, common.ErrParam
+	}
+	if threshold <= 0 {
+		threshold = common.ServConfig.SlaThreshold
+	}
+	if threshold <= 0 {
+		threshold = defaultSlaThreshold
+	}
+
+	sessions, err := repos.SessionRepo.FindRange(sns, start.UnixMilli(), end.UnixMilli())
+	if err != nil {
+		logger.Error("sessionService.uptimes DB ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+	firstSeen, err := repos.SessionRepo.FirstSeen(sns)
+	if err != nil {
+		logger.Error("sessionService.uptimes DB ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+
+	intervals := make(map[string][][2]int64)
+	for _, one := range sessions {
+		intervals[one.SN] = append(intervals[one.SN], [2]int64{one.StartTime, sessionEnd(&one, now)})
+	}
+
+	rst := make([]models.DeviceUptime, 0, len(sns))
+	for _, sn := range sns {
+		// 到这个月底还没上线过的设备没有在线率，报表里不算，单台查询时返回空的
+		if first := firstSeen[sn]; first == 0 || first >= end.UnixMilli() {
+			if withDays {
+				rst = append(rst, models.DeviceUptime{SN: sn, Month: start.Format("2006-01")})
+			}
+			continue
+		}
+
+		u := deviceUptime(intervals[sn], firstSeen[sn], start, end, now, withDays)
+		u.SN = sn
+		u.Month = start.Format("2006-01")
+		u.Flagged = u.Uptime < threshold
+		rst = append(rst, u)
+	}
+	return rst, nil
+}
+
+// monthRange 月份的时间范围 [start, end)，格式 2006-01
+func monthRange(month string, now time.Time) (time.Time, time.Time, error) {
+	if month == "" {
+		month = now.Format("2006-01")
+	}
+	start, err := time.ParseInLocation("2006-01", month, time.Local)
+	if err != nil {
+		return start, start, err
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+// sessionEnd 会话结束时间，还在线的按现在算
+func sessionEnd(one *models.DeviceSession, now time.Time) int64 {
+	if one.EndTime > 0 {
+		return one.EndTime
+	}
+	if now.Sub(time.UnixMilli(one.LastSeen)) > sessionStaleTimeout {
+		return one.LastSeen
+	}
+	return now.UnixMilli()
+}
+
+// deviceUptime 按会话算[start, end)的在线率，第一次上线之前和还没到的时间不算
+func deviceUptime(intervals [][2]int64, firstSeen int64, start, end, now time.Time, withDays bool) models.DeviceUptime {
+	merged := mergeIntervals(intervals)
+	rst := models.DeviceUptime{}
+
+	var online, total int64
+	for day := start; day.Before(end) && day.Before(now); day = day.AddDate(0, 0, 1) {
+		from, to := day.UnixMilli(), day.AddDate(0, 0, 1).UnixMilli()
+		if firstSeen > from {
+			from = firstSeen
+		}
+		if to > now.UnixMilli() {
+			to = now.UnixMilli()
+		}
+		if firstSeen > 0 && from >= to {
+			continue // 设备还没上线过
+		}
+
+		n := overlapMs(merged, from, to)
+		online += n
+		total += to - from
+		if withDays {
+			rst.Days = append(rst.Days, models.UptimeDay{
+				Date:   day.Format("2006-01-02"),
+				Uptime: uptimePercent(n, to-from),
+				Online: n / 1000,
+			})
+		}
+	}
+
+	rst.Uptime = uptimePercent(online, total)
+	return rst
+}
+
+// mergeIntervals 合并重叠的时间段，重连时新旧会话可能有重叠
+func mergeIntervals(intervals [][2]int64) [][2]int64 {
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i][0] < intervals[j][0] })
+
+	var rst [][2]int64
+	for _, one := range intervals {
+		if one[1] <= one[0] {
+			continue
+		}
+		if n := len(rst); n > 0 && one[0] <= rst[n-1][1] {
+			rst[n-1][1] = max(rst[n-1][1], one[1])
+			continue
+		}
+		rst = append(rst, one)
+	}
+	return rst
+}
+
+// overlapMs 合并后的时间段和[from, to)重叠的毫秒数
+func overlapMs(merged [][2]int64, from, to int64) int64 {
+	var n int64
+	for _, one := range merged {
+		if s, e := max(one[0], from), min(one[1], to); e > s {
+			n += e - s
+		}
+	}
+	return n
+}
+
+func uptimePercent(n, total int64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// go test -v -count=1 -run TestDeviceUptime pcdn-server/service
+func TestDeviceUptime(t *testing.T) {
+	start := time.Date(2025, 6, 1, 0, 0, 0, 0, time.Local)
+	end := start.AddDate(0, 1, 0)
+	day := func(d, h int) int64 { return start.AddDate(0, 0, d-1).Add(time.Duration(h) * time.Hour).UnixMilli() }
+
+	cases := []struct {
+		name      string
+		intervals [][2]int64
+		firstSeen int64
+		now       time.Time
+		uptime    float64
+		days      int
+	}{
+		{"always online", [][2]int64{{day(1, 0), day(31, 0)}}, day(1, 0), end.Add(time.Hour), 100, 30},
+		// 第一次上线之前的时间不算
+		{"first seen mid month", [][2]int64{{day(16, 0), day(31, 0)}}, day(16, 0), end.Add(time.Hour), 100, 15},
+		// 还没到的时间不算
+		{"half of today", [][2]int64{{day(1, 0), day(1, 6)}}, day(1, 0), start.Add(12 * time.Hour), 50, 1},
+		// 重连时新旧会话有重叠
+		{"overlap", [][2]int64{{day(1, 0), day(1, 8)}, {day(1, 6), day(1, 12)}}, day(1, 0), start.Add(24 * time.Hour), 50, 1},
+		{"offline", nil, day(1, 0), start.Add(24 * time.Hour), 0, 1},
+	}
+	for _, c := range cases {
+		u := deviceUptime(c.intervals, c.firstSeen, start, end, c.now, true)
+		if math.Abs(u.Uptime-c.uptime) > 0.01 || len(u.Days) != c.days {
+			t.Errorf("%s: uptime %.2f days %d", c.name, u.Uptime, len(u.Days))
+		}
+	}
+}
+
+func TestMergeIntervals(t *testing.T) {
+	got := mergeIntervals([][2]int64{{10, 20}, {1, 5}, {15, 30}, {40, 40}, {30, 35}})
+	want := [][2]int64{{1, 5}, {10, 35}}
+	if len(got) != len(want) {
+		t.Fatalf("%v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("%v", got)
+		}
+	}
+	if n := overlapMs(got, 3, 12); n != 4 {
+		t.Fatalf("overlap %d", n)
+	}
+}
@@ -0,0 +1,382 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+	"pcdn-server/repos"
+	"pcdn-server/tcpservice"
+
+	passportprotos "github.com/liuhengloveyou/passport/protos"
+	"github.com/liuhengloveyou/pcdn/protos"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// 设备用到分配值的这个比例就认为被限住了，还想要更多
+	siteSaturation = 0.9
+)
+
+type siteService struct {
+}
+
+var (
+	// 正在重新分配的线路，同一条线路同时只分配一次
+	siteRebalanceMu sync.Mutex
+	siteRebalancing = make(map[uint64]bool)
+)
+
+// 新增或修改线路，Id为0时新增
+func (s *siteService) Save(sessionUser *passportprotos.User, m *models.SiteModel) (uint64, error) {
+	if m == nil || m.Name == "" || m.UplinkMbps == 0 {
+		return 0, common.ErrParam
+	}
+
+	members := make(models.StringArr, 0, len(m.Members))
+	seen := make(map[string]bool)
+	for _, sn := range m.Members {
+		sn = strings.ToUpper(strings.TrimSpace(sn))
+		if sn == "" || seen[sn] {
+			continue
+		}
+		seen[sn] = true
+
+		if _, err := DeviceService.Authorize(sessionUser, sn, "site"); err != nil {
+			return 0, err
+		}
+		// 一台设备只能在一条线路上
+		if other, err := repos.SiteRepo.GetBySN(sn); err == nil && other.Id != m.Id {
+			logger.Warn("siteService.Save member in other site: ", zap.String("sn", sn), zap.Uint64("site", other.Id))
+			return 0, common.ErrParam
+		}
+		// 自适应限速会覆盖分配的限速
+		if adaptive, err := repos.TcAdaptiveRepo.GetBySN(sn); err == nil && adaptive.Enabled {
+			logger.Warn("siteService.Save member adaptive enabled: ", zap.String("sn", sn))
+			return 0, common.ErrParam
+		}
+		members = append(members, sn)
+	}
+	if len(members) == 0 {
+		return 0, common.ErrParam
+	}
+	m.Members = members
+	m.UserId = sessionUser.UID
+	m.TenantId = sessionUser.TenantID
+
+	var removed []string
+	if m.Id == 0 {
+		id, err := repos.SiteRepo.Create(m)
+		if err != nil {
+			logger.Error("siteService.Save DB ERR: ", zap.Error(err))
+			return 0, common.ErrService
+		}
+		m.Id = id
+	} else {
+		old, err := repos.SiteRepo.Get(m.Id)
+		if err != nil || old.UserId != sessionUser.UID {
+			return 0, common.ErrNoAuth
+		}
+		if err := repos.SiteRepo.Update(m); err != nil {
+			logger.Error("siteService.Save DB ERR: ", zap.Error(err))
+			return 0, common.ErrService
+		}
+		for _, sn := range old.Members {
+			if !seen[sn] {
+				removed = append(removed, sn)
+			}
+		}
+	}
+
+	s.addLog(sessionUser, fmt.Sprintf("%d | %s | %dmbps | %s", m.Id, m.Name, m.UplinkMbps, strings.Join(m.Members, ",")))
+
+	// 下发要等设备应答，放到后台: 移出线路的设备恢复自己的限速，再重新分配
+	go func(id uint64) {
+		for _, sn := range removed {
+			restoreTcLimit(sn)
+		}
+		if site, err := repos.SiteRepo.Get(id); err == nil {
+			s.rebalance(site)
+		}
+	}(m.Id)
+	return m.Id, nil
+}
+
+// 删除线路，成员设备恢复自己的限速
+func (s *siteService) Delete(sessionUser *passportprotos.User, id uint64) error {
+	if id == 0 {
+		return common.ErrParam
+	}
+
+	site, err := repos.SiteRepo.Get(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		logger.Error("siteService.Delete DB ERR: ", zap.Error(err))
+		return common.ErrService
+	}
+	if site.UserId != sessionUser.UID {
+		return common.ErrNoAuth
+	}
+
+	if err := repos.SiteRepo.Delete(id, sessionUser.UID); err != nil {
+		logger.Error("siteService.Delete DB ERR: ", zap.Error(err))
+		return common.ErrService
+	}
+	s.addLog(sessionUser, fmt.Sprintf("%d | %s | deleted", site.Id, site.Name))
+
+	for _, sn := range site.Members {
+		restoreTcLimit(sn)
+	}
+	return nil
+}
+
+func (s *siteService) List(sessionUser *passportprotos.User, page int) ([]models.SiteModel, error) {
+	if page < 1 {
+		page = 1
+	}
+
+	rr, err := repos.SiteRepo.Find(sessionUser.TenantID, sessionUser.UID, page, 50)
+	if err != nil {
+		logger.Error("siteService.List DB ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+	return rr, nil
+}
+
+// Suggest 按上报的出口IP把设备分组，同一个出口IP的多台设备很可能在同一条线路上
+func (s *siteService) Suggest(sessionUser *passportprotos.User) ([]models.SiteSuggestion, error) {
+	sns, err := repos.DeviceRepo.FindSNs(sessionUser.TenantID, sessionUser.UID, nil)
+	if err != nil {
+		logger.Error("siteService.Suggest DB ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+
+	groups := make(map[string][]string)
+	for _, sn := range sns {
+		agent, err := tcpservice.GetAgentStatusFromRedis(strings.ToUpper(sn))
+		if err != nil || agent.RemoteAddr == "" {
+			continue
+		}
+		groups[agent.RemoteAddr] = append(groups[agent.RemoteAddr], agent.SN)
+	}
+
+	rst := make([]models.SiteSuggestion, 0)
+	for addr, members := range groups {
+		if len(members) < 2 {
+			continue
+		}
+		sort.Strings(members)
+		rst = append(rst, models.SiteSuggestion{RemoteAddr: addr, Members: members})
+	}
+	sort.Slice(rst, func(i, j int) bool { return rst[i].RemoteAddr < rst[j].RemoteAddr })
+	return rst, nil
+}
+
+// 定时按各设备的流量重新分配所有线路的带宽
+func (s *siteService) RebalanceAll() {
+	for page := 1; ; page++ {
+		rr, err := repos.SiteRepo.Find(0, 0, page, 100)
+		if err != nil {
+			logger.Error("siteService.RebalanceAll DB ERR: ", zap.Error(err))
+			return
+		}
+		if len(rr) == 0 {
+			return
+		}
+
+		for i := range rr {
+			s.rebalance(&rr[i])
+		}
+	}
+}
+
+// rebalance 重新分配一条线路的带宽，变化明显的设备才下发。
+// 先下发调小的再下发调大的，过程中各设备的限速加起来不超过线路带宽。
+// 这条线路正在分配时直接返回，下一轮定时任务会按最新的成员再分配。
+func (s *siteService) rebalance(site *models.SiteModel) {
+	siteRebalanceMu.Lock()
+	if siteRebalancing[site.Id] {
+		siteRebalanceMu.Unlock()
+		return
+	}
+	siteRebalancing[site.Id] = true
+	siteRebalanceMu.Unlock()
+	defer func() {
+		siteRebalanceMu.Lock()
+		delete(siteRebalancing, site.Id)
+		siteRebalanceMu.Unlock()
+	}()
+
+	budget := site.UplinkMbps
+	demand := make(map[string]float64)
+	for _, sn := range site.Members {
+		// 配额超了被限速或停掉的设备按配额的速率占用线路，不参与分配
+		if q, err := repos.TrafficQuotaRepo.GetBySN(sn); err == nil {
+			if q.Enforced == models.QUOTA_ACTION_STOP {
+				continue
+			}
+			if q.Enforced == models.QUOTA_ACTION_THROTTLE {
+				if q.EnforcedRate < budget {
+					budget -= q.EnforcedRate
+				} else {
+					budget = 0
+				}
+				continue
+			}
+		}
+
+		demand[sn] = 0
+		// 离线的设备只分保底带宽
+		if agent, err := tcpservice.GetAgentStatusFromRedis(sn); err != nil || !tcpservice.IsOnline(agent) {
+			continue
+		}
+		if bits, err := tcpservice.UplinkSendBits(sn); err == nil {
+			demand[sn] = bits / 1000 / 1000
+		}
+	}
+	if len(demand) == 0 {
+		return
+	}
+
+	if site.Allocation == nil {
+		site.Allocation = make(models.MapStringInt)
+	}
+	alloc := splitSiteBudget(budget, site.MinMbps, demand, site.Allocation)
+
+	var down, up []string
+	for sn, mbps := range alloc {
+		old, ok := site.Allocation[sn]
+		if !ok || mbps < uint(old) {
+			down = append(down, sn)
+		} else if allocGrown(uint(old), mbps) {
+			up = append(up, sn)
+		}
+	}
+	if len(down) == 0 && len(up) == 0 {
+		return
+	}
+
+	// 调小的都下发完再下发调大的，设备不在线的下次再试
+	changed := false
+	for _, sns := range [][]string{down, up} {
+		for _, sn := range pushSiteAllocation(sns, alloc) {
+			site.Allocation[sn] = int(alloc[sn])
+			changed = true
+		}
+	}
+	// 移出线路的设备
+	for sn := range site.Allocation {
+		if _, ok := alloc[sn]; !ok {
+			delete(site.Allocation, sn)
+			changed = true
+		}
+	}
+
+	if changed {
+		site.RebalanceTime = time.Now().UnixMilli()
+		if err := repos.SiteRepo.UpdateAllocation(site); err != nil {
+			logger.Error("siteService.rebalance DB ERR: ", zap.Error(err))
+		}
+		logger.Info("site rebalanced: ", zap.Uint64("site", site.Id), zap.Any("allocation", site.Allocation))
+	}
+}
+
+// pushSiteAllocation 逐台下发分配的限速，返回下发成功的设备
+func pushSiteAllocation(sns []string, alloc map[string]uint) []string {
+	var ok []string
+	for _, sn := range sns {
+		if err := pushTcPolicy(sn, &protos.TcPolicy{Rate: fmt.Sprintf("%dmbit", alloc[sn])}); err != nil {
+			continue
+		}
+		ok = append(ok, sn)
+	}
+	return ok
+}
+
+func (s *siteService) addLog(sessionUser *passportprotos.User, payload string) {
+	businessLog := &models.BusinessLog{
+		UserName:     sessionUser.Cellphone.String,
+		BusinessType: models.BUSINESS_TYPE_SITE,
+		Payload:      payload,
+	}
+	businessLog.UserId = sessionUser.UID
+	businessLog.TenantId = sessionUser.TenantID
+	BusinessLogService.Add(businessLog)
+}
+
+// splitSiteBudget 按需求分配线路带宽(mbps)。
+// 每台设备先分到保底带宽，剩下的按需求逐轮平均分给还不够的设备；
+// 用到当前分配值90%以上的设备认为被限住了，需求按当前值的1.5倍算。
+// 都满足以后还有剩余就平均分给所有设备，让空闲的线路也能跑满。
+func splitSiteBudget(budget, floor uint, demand map[string]float64, current models.MapStringInt) map[string]uint {
+	n := len(demand)
+	rst := make(map[string]uint, n)
+	if n == 0 {
+		return rst
+	}
+	if floor == 0 {
+		floor = budget / uint(n) / 4
+	}
+	if floor*uint(n) > budget {
+		floor = budget / uint(n)
+	}
+
+	want := make(map[string]float64, n)
+	alloc := make(map[string]float64, n)
+	for sn, d := range demand {
+		if cur := float64(current[sn]); cur > 0 && d >= cur*siteSaturation {
+			d = cur * 1.5
+		}
+		want[sn] = max(d, float64(floor))
+		alloc[sn] = float64(floor)
+	}
+
+	remaining := float64(budget - floor*uint(n))
+	for remaining >= 1 {
+		hungry := 0
+		for sn := range alloc {
+			if alloc[sn] < want[sn] {
+				hungry++
+			}
+		}
+		if hungry == 0 {
+			break
+		}
+
+		share := remaining / float64(hungry)
+		for sn := range alloc {
+			if gap := want[sn] - alloc[sn]; gap > 0 {
+				add := min(gap, share)
+				alloc[sn] += add
+				remaining -= add
+			}
+		}
+	}
+	if remaining > 0 {
+		share := remaining / float64(n)
+		for sn := range alloc {
+			alloc[sn] += share
+		}
+	}
+
+	for sn, v := range alloc {
+		rst[sn] = uint(v)
+	}
+	return rst
+}
+
+// 调大超过10%(至少1mbps)才下发，避免流量抖动时频繁改限速
+func allocGrown(old, mbps uint) bool {
+	if mbps <= old {
+		return false
+	}
+	return mbps-old >= max(1, old/10)
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"testing"
+
+	"pcdn-server/models"
+)
+
+// go test -v -count=1 -run TestSplitSiteBudget pcdn-server/service
+func TestSplitSiteBudget(t *testing.T) {
+	cases := []struct {
+		name    string
+		budget  uint
+		floor   uint
+		demand  map[string]float64
+		current models.MapStringInt
+		want    map[string]uint
+	}{
+		{"empty", 100, 10, map[string]float64{}, nil, map[string]uint{}},
+		// 都不够用时剩下的平均分，空闲的带宽也分完
+		{"idle", 100, 10, map[string]float64{"A": 0, "B": 0}, nil, map[string]uint{"A": 50, "B": 50}},
+		// 需求小的满足后，剩下的给需求大的
+		{"uneven", 100, 10, map[string]float64{"A": 20, "B": 200}, nil, map[string]uint{"A": 20, "B": 80}},
+		// 保底带宽加起来超过线路时按线路平分
+		{"floor too big", 30, 20, map[string]float64{"A": 100, "B": 100, "C": 100}, nil, map[string]uint{"A": 10, "B": 10, "C": 10}},
+		// 没设保底时按平均值的1/4
+		{"default floor", 80, 0, map[string]float64{"A": 0, "B": 100}, nil, map[string]uint{"A": 10, "B": 70}},
+		// 用满当前分配的设备按1.5倍算需求
+		{"saturated", 100, 10, map[string]float64{"A": 19, "B": 10}, models.MapStringInt{"A": 20, "B": 80}, map[string]uint{"A": 60, "B": 40}},
+	}
+	for _, c := range cases {
+		got := splitSiteBudget(c.budget, c.floor, c.demand, c.current)
+		if len(got) != len(c.want) {
+			t.Errorf("%s: %v", c.name, got)
+			continue
+		}
+		var total uint
+		for sn, v := range c.want {
+			if got[sn] != v {
+				t.Errorf("%s: %s %d != %d", c.name, sn, got[sn], v)
+			}
+			total += got[sn]
+		}
+		if total > c.budget {
+			t.Errorf("%s: total %d > %d", c.name, total, c.budget)
+		}
+	}
+}
+
+func TestAllocGrown(t *testing.T) {
+	cases := []struct {
+		old, mbps uint
+		want      bool
+	}{
+		{10, 10, false},
+		{10, 5, false},
+		{0, 1, true},
+		{5, 6, true},
+		{100, 109, false},
+		{100, 110, true},
+	}
+	for _, c := range cases {
+		if got := allocGrown(c.old, c.mbps); got != c.want {
+			t.Errorf("allocGrown(%d, %d) = %v", c.old, c.mbps, got)
+		}
+	}
+}
@@ -2,41 +2,98 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"pcdn-server/common"
 	"pcdn-server/models"
 	"pcdn-server/repos"
 	"pcdn-server/tcpservice"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
+	passportprotos "github.com/liuhengloveyou/passport/protos"
 	"github.com/liuhengloveyou/pcdn/protos"
+	redis "github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 	"google.golang.org/protobuf/proto"
+	"gorm.io/gorm"
+)
+
+const (
+	// agent上不限速的class速率是10000mbit
+	tcUnlimitedBits = 10000 * 1000 * 1000
+	// 限速验证最长采样时间，和agent一致
+	tcVerifyMaxSeconds = 60
+	// 批量限速一次最多的设备数和同时下发的设备数
+	tcBatchMax     = 500
+	tcBatchWorkers = 10
+	// 批量限速最长执行时间，超时后没开始的设备不再下发；结果保留的时间
+	tcBatchTimeout = time.Hour
+	tcBatchKeep    = 24 * time.Hour
 )
 
 type tcService struct {
 }
 
 // 设置设备的限速规则，每个设备有一条记录
-func (s *tcService) TrifficLimit(ctx context.Context, sn, iFaceName string, uploadLimit uint) (val, detail string, err error) {
-	if sn == "" {
-		return "", "", common.ErrParam
+// verifySeconds 大于0时设置后让agent采样验证，结果和设置一起保存
+func (s *tcService) TrifficLimit(ctx context.Context, sn, iFaceName string, uploadLimit uint, rules models.TcRuleArray, verifySeconds uint32) (val, detail string, verify *models.TcVerify, err error) {
+	// 没有总限速时至少要有一条规则
+	if sn == "" || verifySeconds > tcVerifyMaxSeconds || (uploadLimit == 0 && len(rules) == 0) {
+		return "", "", nil, common.ErrParam
+	}
+	if err = validateTcRules(rules); err != nil {
+		logger.Error("TrifficLimit rules ERR: ", zap.Any("rules", rules), zap.Error(err))
+		return "", "", nil, common.ErrParam
+	}
+	if rules == nil {
+		rules = models.TcRuleArray{}
+	}
+	// 查状态时按规则名对应设备上的class
+	for i := range rules {
+		rules[i].Name = tcRuleName(rules[i], i)
 	}
 	sn = strings.ToUpper(sn)
 
-	taskId, err := tcpservice.TrifficLimit(sn, iFaceName, uploadLimit)
+	taskId, err := tcpservice.TrifficLimit(sn, iFaceName, uploadLimit, rules, verifySeconds)
 	if err != nil {
 		logger.Error("TrifficLimit ERR: ", zap.Error(err))
-		return "", "", err
+		return "", "", nil, err
 	}
 
-	// 等待任务响应
+	// 等待任务响应，验证时要多等采样的时间
 	redisKey := fmt.Sprintf("%s%s", common.TASK_RESPONSE_KEY_PREFIX, taskId)
-	rstByte, err := common.RedisClient.BRPop(context.Background(), time.Second*10, redisKey).Result()
+	timeout := time.Second*10 + time.Duration(verifySeconds)*time.Second
+	rstByte, err := common.RedisClient.BRPop(ctx, timeout, redisKey).Result()
 	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			tcpservice.RecordTaskTimeout(taskId)
+		}
+		if ctx.Err() != nil {
+			return "", "", nil, ctx.Err()
+		}
 		logger.Error("TrifficLimit redis ERR: ", zap.String("key", redisKey), zap.Error(err))
-		return "", "", common.ErrService
+		return "", "", nil, common.ErrService
+	}
+
+	var task protos.Task
+	if err = proto.Unmarshal([]byte(rstByte[1]), &task); err != nil {
+		common.Logger.Sugar().Errorf("TrifficLimit msg ERR: ", err)
+		return "", "", nil, err
+	}
+	common.Logger.Sugar().Infof("TrifficLimit: %v %v\n", task.TaskId, task.ErrMsg)
+
+	verify = &models.TcVerify{}
+	if task.TcVerify != nil {
+		verify.Passed = task.TcVerify.Passed
+		verify.Seconds = task.TcVerify.Seconds
+		verify.VerifyTime = time.Now().UnixMilli()
+		verify.Ifaces = task.TcVerify.Ifaces
 	}
 
 	// 下发成功以后，保存到数据库
@@ -44,20 +101,15 @@ func (s *tcService) TrifficLimit(ctx context.Context, sn, iFaceName string, uplo
 		TaskID:  taskId,
 		SN:      sn,
 		UpLimit: uploadLimit,
+		Rules:   rules,
+		Verify:  *verify,
 	}
 	m.UserId = ctx.Value("UID").(uint64)
 	m.TenantId = ctx.Value("TID").(uint64)
 	if err = repos.TcRepo.Save(m); err != nil {
 		logger.Error("TrifficLimit DB ERR: ", zap.Error(err))
-		return "", "", err
-	}
-
-	var task protos.Task
-	if err = proto.Unmarshal([]byte(rstByte[1]), &task); err != nil {
-		common.Logger.Sugar().Errorf("TrifficLimit msg ERR: ", err)
-		return "", "", err
+		return "", "", nil, err
 	}
-	common.Logger.Sugar().Infof("TrifficLimit: %v %v\n", task.TaskId, task.ErrMsg)
 
 	rate := ""
 	if task.Rate != nil {
@@ -67,7 +119,15 @@ func (s *tcService) TrifficLimit(ctx context.Context, sn, iFaceName string, uplo
 	// 记录业务日志
 	businessLog := &models.BusinessLog{
 		BusinessType: models.BUSINESS_TYPE_CREATE_TC,
-		Payload:      fmt.Sprintf("%s | %s | %v | %s", sn, iFaceName, uploadLimit, rate),
+		Payload:      fmt.Sprintf("%s | %s | %v | %d rules | %s", sn, iFaceName, uploadLimit, len(rules), rate),
+	}
+	if verify.Seconds > 0 {
+		businessLog.Payload += fmt.Sprintf(" | verify %ds passed=%v", verify.Seconds, verify.Passed)
+	}
+	// 程序标记失败不影响网卡限速，agent之后检查漂移时会重试并上报
+	if task.TcProgramErr != "" {
+		logger.Warn("TrifficLimit program marks ERR: ", zap.String("sn", sn), zap.String("err", task.TcProgramErr))
+		businessLog.Payload += " | program marks: " + task.TcProgramErr
 	}
 	businessLog.UserId = ctx.Value("UID").(uint64)
 	businessLog.TenantId = ctx.Value("TID").(uint64)
@@ -78,43 +138,268 @@ func (s *tcService) TrifficLimit(ctx context.Context, sn, iFaceName string, uplo
 		common.Logger.Sugar().Errorf("TrifficLimit Add BusinessLog ERR: ", err)
 	}
 
-	return rate, task.ErrMsg, nil
+	return rate, task.ErrMsg, verify, nil
 }
 
-func (s *tcService) TrifficLimitStat(sn, iFaceName string) (val, detail string, err error) {
+// TrifficLimitBatch 给选中的设备设置同样的限速，每台设备单独下发和记录。
+// 设备多时要很久，在后台执行，返回任务ID，用TrifficLimitBatchJob查进度和每台设备的结果
+func (s *tcService) TrifficLimitBatch(ctx context.Context, sessionUser *passportprotos.User, req *models.TrifficLimitBatchReq) (string, error) {
+	if req == nil || req.DeviceSelector.Empty() || req.VerifySeconds > tcVerifyMaxSeconds {
+		return "", common.ErrParam
+	}
+	if err := validateTcRules(req.Rules); err != nil {
+		return "", common.ErrParam
+	}
+
+	sns, err := DeviceService.SelectSNs(sessionUser, &req.DeviceSelector)
+	if err != nil {
+		return "", err
+	}
+	if len(sns) > tcBatchMax {
+		return "", common.ErrParam
+	}
+	sort.Strings(sns)
+
+	job := &models.TrifficLimitBatchJob{
+		Id:        uuid.New().String(),
+		UserId:    sessionUser.UID,
+		TenantId:  sessionUser.TenantID,
+		Total:     len(sns),
+		StartTime: time.Now().UnixMilli(),
+		Results:   make([]models.TrifficLimitBatchResult, len(sns)),
+	}
+	for i, sn := range sns {
+		job.Results[i].SN = sn
+	}
+	if err := saveTcBatchJob(job); err != nil {
+		logger.Error("TrifficLimitBatch redis ERR: ", zap.Error(err))
+		return "", common.ErrService
+	}
+
+	// 请求返回后接着做，只保留ctx里的用户信息
+	jobCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), tcBatchTimeout)
+	go func() {
+		defer cancel()
+		s.runBatch(jobCtx, job, req)
+	}()
+	return job.Id, nil
+}
+
+// 最多tcBatchWorkers台设备同时下发，每做完一台保存一次进度；ctx结束后没开始的设备不再下发
+func (s *tcService) runBatch(ctx context.Context, job *models.TrifficLimitBatchJob, req *models.TrifficLimitBatchReq) {
+	var mu sync.Mutex
+	finish := func(i int, one models.TrifficLimitBatchResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		job.Results[i] = one
+		job.Done++
+		if err := saveTcBatchJob(job); err != nil {
+			logger.Error("TrifficLimitBatch redis ERR: ", zap.String("job", job.Id), zap.Error(err))
+		}
+	}
+
+	sem := make(chan struct{}, tcBatchWorkers)
+	var wg sync.WaitGroup
+	for i := range job.Results {
+		sn := job.Results[i].SN
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			finish(i, models.TrifficLimitBatchResult{SN: sn, Err: ctx.Err().Error()})
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, sn string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			// TrifficLimit会给规则补名字，每台设备用自己的副本
+			rules := append(models.TcRuleArray(nil), req.Rules...)
+			one := models.TrifficLimitBatchResult{SN: sn}
+			val, detail, verify, err := s.TrifficLimit(ctx, sn, req.IfaceName, req.UploadLimit, rules, req.VerifySeconds)
+			if err != nil {
+				one.Err = err.Error()
+			} else {
+				one.Val, one.Detail, one.Verify = val, detail, verify
+			}
+			finish(i, one)
+		}(i, sn)
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	job.Finished = true
+	job.EndTime = time.Now().UnixMilli()
+	if err := saveTcBatchJob(job); err != nil {
+		logger.Error("TrifficLimitBatch redis ERR: ", zap.String("job", job.Id), zap.Error(err))
+	}
+}
+
+// TrifficLimitBatchJob 批量限速的进度和结果，只有发起的用户(租户)能看
+func (s *tcService) TrifficLimitBatchJob(sessionUser *passportprotos.User, id string) (*models.TrifficLimitBatchJob, error) {
+	if sessionUser == nil || sessionUser.UID <= 0 || id == "" {
+		return nil, common.ErrParam
+	}
+
+	b, err := common.RedisClient.Get(context.Background(), common.TC_BATCH_KEY_PREFIX+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, common.ErrParam
+	}
+	if err != nil {
+		logger.Error("TrifficLimitBatchJob redis ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+	job := &models.TrifficLimitBatchJob{}
+	if err := json.Unmarshal(b, job); err != nil {
+		logger.Error("TrifficLimitBatchJob json ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+
+	if (sessionUser.TenantID > 0 && job.TenantId != sessionUser.TenantID) ||
+		(sessionUser.TenantID == 0 && job.UserId != sessionUser.UID) {
+		return nil, common.ErrNoAuth
+	}
+	return job, nil
+}
+
+func saveTcBatchJob(job *models.TrifficLimitBatchJob) error {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return common.RedisClient.Set(context.Background(), common.TC_BATCH_KEY_PREFIX+job.Id, b, tcBatchKeep).Err()
+}
+
+// 查询设备实际的限速状态，并和数据库里保存的设置对比
+func (s *tcService) TrifficLimitStat(sn, iFaceName string) (*models.TcStatus, error) {
 	if sn == "" || iFaceName == "" {
-		return "", "", common.ErrParam
+		return nil, common.ErrParam
 	}
 	sn = strings.ToUpper(sn)
 
 	taskId, err := tcpservice.TrifficLimitStat(sn, iFaceName)
 	if err != nil {
 		logger.Error("TrifficLimitStat ERR: ", zap.Error(err))
-		return "", "", err
+		return nil, err
 	}
 
 	redisKey := fmt.Sprintf("%s%s", common.TASK_RESPONSE_KEY_PREFIX, taskId)
 	rstByte, err := common.RedisClient.BRPop(context.Background(), time.Second*10, redisKey).Result()
 	if err != nil {
 		logger.Error("TrifficLimitStat redis ERR: ", zap.String("key", redisKey), zap.Error(err))
-		return "", "", common.ErrService
+		return nil, common.ErrService
 	}
 
 	var task protos.Task
 	if err := proto.Unmarshal([]byte(rstByte[1]), &task); err != nil {
 		common.Logger.Sugar().Errorf("TrifficLimitStat msg ERR: ", err)
-		return "", "", err
+		return nil, err
 	}
 	common.Logger.Sugar().Infof("TrifficLimitStat: %v %v\n", task.TaskId, task.ErrMsg)
 
-	rate := ""
-	if task.Rate != nil {
-		rate = *task.Rate
+	stat := &models.TcStatus{
+		Rate:    task.GetRate(),
+		Detail:  task.ErrMsg,
+		Qdiscs:  task.TcQdiscStats,
+		Classes: task.TcStats,
+	}
+	if task.ErrMsg != "" {
+		return stat, nil
+	}
+
+	expected, err := repos.TcRepo.GetBySN(sn)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.Error("TrifficLimitStat DB ERR: ", zap.Error(err))
+		}
+		return stat, nil
+	}
+	stat.Expected = expected
+	// 开了自适应限速时默认class的速率由agent调整
+	adaptive, err := repos.TcAdaptiveRepo.GetBySN(sn)
+	skipDefault := err == nil && adaptive.Enabled
+	stat.Mismatches = compareTcStatus(expected, task.TcQdiscStats, task.TcStats, skipDefault)
+
+	return stat, nil
+}
+
+// compareTcStatus 对比设备上的qdisc/class和数据库里的限速设置
+// 设备上的class布局见agent: 1:20 是默认class，每条规则一个class，用规则名对应
+func compareTcStatus(expected *models.TcModel, qdiscs []*protos.TcQdiscStat, classes []*protos.TcClassStat, skipDefault bool) []models.TcMismatch {
+	var mismatches []models.TcMismatch
+
+	limited := expected.UpLimit > 0 || len(expected.Rules) > 0
+	hasHtb := false
+	for _, q := range qdiscs {
+		if q.Kind == "htb" && q.Parent == "root" {
+			hasHtb = true
+		}
+	}
+	if !hasHtb {
+		if limited {
+			mismatches = append(mismatches, models.TcMismatch{Field: "qdisc", Expected: "htb", Actual: "none"})
+		}
+		return mismatches
+	}
+
+	byName := make(map[string]*protos.TcClassStat, len(classes))
+	for _, c := range classes {
+		if c.RuleName != "" {
+			byName[c.RuleName] = c
+		}
+	}
+
+	checkRate := func(rule, field string, wantMbit uint, actual *protos.TcClassStat) {
+		want := uint64(wantMbit) * 1000 * 1000
+		if wantMbit == 0 {
+			want = tcUnlimitedBits
+		}
+		got := actual.RateBits
+		if field == "ceil" {
+			got = actual.CeilBits
+		}
+		// tc显示的速率有取整，差1%以内算一致
+		if got*100 < want*99 || got*100 > want*101 {
+			mismatches = append(mismatches, models.TcMismatch{
+				Rule:     rule,
+				Field:    field,
+				Expected: fmt.Sprintf("%dbit", want),
+				Actual:   fmt.Sprintf("%dbit", got),
+			})
+		}
+	}
+
+	if c, ok := byName["default"]; ok {
+		if !skipDefault {
+			checkRate("default", "rate", expected.UpLimit, c)
+		}
+	} else {
+		mismatches = append(mismatches, models.TcMismatch{Rule: "default", Field: "class", Expected: "present", Actual: "missing"})
+	}
+
+	for _, rule := range expected.Rules {
+		c, ok := byName[rule.Name]
+		if !ok {
+			mismatches = append(mismatches, models.TcMismatch{Rule: rule.Name, Field: "class", Expected: "present", Actual: "missing"})
+			continue
+		}
+		ceil := rule.Ceil
+		if ceil == 0 {
+			ceil = rule.Rate
+		}
+		checkRate(rule.Name, "rate", rule.Rate, c)
+		checkRate(rule.Name, "ceil", ceil, c)
 	}
-	return rate, task.ErrMsg, nil
+
+	return mismatches
 }
 
-// 定时同步数据库中的限速规则
+// 定时对账: 把数据库里每台设备期望的限速状态下发给设备
+// 有限速时下发策略，agent只在策略变了或内核规则漂移时才重新设置；没有限速时清除设备上残留的规则
 func (s *tcService) SyncAllTrifficLimitToDevice() {
 	for page := 1; ; page++ {
 		tcList, _, err := repos.TcRepo.List(page, 100)
@@ -126,16 +411,30 @@ func (s *tcService) SyncAllTrifficLimitToDevice() {
 			break
 		}
 
-		// 下发限速任务
 		for _, tcConf := range tcList {
-			if tcConf.UpLimit == 0 {
-				// 不限速
+			// 配额超了正在限速或停止的设备，由配额检查负责恢复
+			if quotaEnforced(tcConf.SN) {
+				continue
+			}
+			// 共享线路上的设备按线路分配的带宽限速
+			if _, err := repos.SiteRepo.GetBySN(tcConf.SN); err == nil {
 				continue
 			}
-			// 限速
-			taskId, err := tcpservice.TrifficLimit(tcConf.SN, "", tcConf.UpLimit)
+
+			action := "apply"
+			var taskId string
+			if tcConf.UpLimit == 0 && len(tcConf.Rules) == 0 {
+				// 开了自适应限速的设备默认class由agent调整，清除会把它也清掉
+				if adaptive, err := repos.TcAdaptiveRepo.GetBySN(tcConf.SN); err == nil && adaptive.Enabled {
+					continue
+				}
+				action = "clean"
+				taskId, err = tcpservice.TrifficLimitClean(tcConf.SN)
+			} else {
+				taskId, err = tcpservice.TrifficLimit(tcConf.SN, "", tcConf.UpLimit, tcConf.Rules, 0)
+			}
 			if err != nil {
-				logger.Error("SyncAllTrifficLimitToDevice ERR: ", zap.Error(err))
+				logger.Error("SyncAllTrifficLimitToDevice ERR: ", zap.String("sn", tcConf.SN), zap.Error(err))
 				continue
 			}
 
@@ -143,14 +442,23 @@ func (s *tcService) SyncAllTrifficLimitToDevice() {
 			redisKey := fmt.Sprintf("%s%s", common.TASK_RESPONSE_KEY_PREFIX, taskId)
 			rstByte, err := common.RedisClient.BRPop(context.Background(), time.Second*10, redisKey).Result()
 			if err != nil {
+				if errors.Is(err, redis.Nil) {
+					tcpservice.RecordTaskTimeout(taskId)
+				}
 				logger.Error("SyncAllTrifficLimitToDevice redis ERR: ", zap.String("key", redisKey), zap.Error(err))
 				continue
 			}
 
+			var task protos.Task
+			if err := proto.Unmarshal([]byte(rstByte[1]), &task); err != nil {
+				logger.Error("SyncAllTrifficLimitToDevice msg ERR: ", zap.Error(err))
+				continue
+			}
+
 			// 记录业务日志
 			businessLog := &models.BusinessLog{
 				BusinessType: models.BUSINESS_TYPE_CREATE_TC,
-				Payload:      fmt.Sprintf("%v | %v | %s", tcConf.SN, tcConf.UpLimit, string(rstByte[1])),
+				Payload:      fmt.Sprintf("%v | %s | %v | %d rules | %s", tcConf.SN, action, tcConf.UpLimit, len(tcConf.Rules), task.ErrMsg),
 			}
 			businessLog.UserId = 0
 			businessLog.TenantId = 0
@@ -161,3 +469,274 @@ func (s *tcService) SyncAllTrifficLimitToDevice() {
 		}
 	}
 }
+
+// 设置自适应限速，下发成功后保存
+func (s *tcService) SetAdaptive(ctx context.Context, m *models.TcAdaptiveModel) error {
+	if m == nil || m.SN == "" {
+		return common.ErrParam
+	}
+	m.SN = strings.ToUpper(m.SN)
+	if m.BillingDay == 0 {
+		m.BillingDay = 1
+	}
+	if m.Enabled && (m.IfaceName == "" || m.Target == 0 || m.Max == 0 || m.Min > m.Max || m.BillingDay > 28) {
+		return common.ErrParam
+	}
+	// 共享线路上的设备由线路分配带宽，不能再自己调整
+	if _, err := repos.SiteRepo.GetBySN(m.SN); m.Enabled && err == nil {
+		return common.ErrParam
+	}
+
+	cfg := &protos.TcAdaptiveConfig{
+		Enabled:    m.Enabled,
+		IfaceName:  m.IfaceName,
+		TargetBits: uint64(m.Target) * 1000 * 1000,
+		MinBits:    uint64(m.Min) * 1000 * 1000,
+		MaxBits:    uint64(m.Max) * 1000 * 1000,
+		BillingDay: m.BillingDay,
+	}
+	taskId, err := tcpservice.TrifficLimitAdaptive(m.SN, cfg)
+	if err != nil {
+		logger.Error("SetAdaptive ERR: ", zap.Error(err))
+		return err
+	}
+
+	redisKey := fmt.Sprintf("%s%s", common.TASK_RESPONSE_KEY_PREFIX, taskId)
+	rstByte, err := common.RedisClient.BRPop(context.Background(), time.Second*10, redisKey).Result()
+	if err != nil {
+		logger.Error("SetAdaptive redis ERR: ", zap.String("key", redisKey), zap.Error(err))
+		return common.ErrService
+	}
+	var task protos.Task
+	if err := proto.Unmarshal([]byte(rstByte[1]), &task); err != nil {
+		logger.Error("SetAdaptive msg ERR: ", zap.Error(err))
+		return err
+	}
+	if task.ErrMsg != "" {
+		return fmt.Errorf("%s", task.ErrMsg)
+	}
+
+	m.UserId = ctx.Value("UID").(uint64)
+	m.TenantId = ctx.Value("TID").(uint64)
+	if err := repos.TcAdaptiveRepo.Save(m); err != nil {
+		logger.Error("SetAdaptive DB ERR: ", zap.Error(err))
+		return common.ErrService
+	}
+
+	// 关闭后默认class还是自适应最后设置的速率，按保存的限速重新下发
+	if !m.Enabled && !quotaEnforced(m.SN) {
+		if err := restoreTcLimit(m.SN); err != nil {
+			logger.Error("SetAdaptive restore ERR: ", zap.String("sn", m.SN), zap.Error(err))
+		}
+	}
+
+	businessLog := &models.BusinessLog{
+		BusinessType: models.BUSINESS_TYPE_CREATE_TC,
+		Payload:      fmt.Sprintf("%s | adaptive=%v | %s | target %d | %d-%d | day %d", m.SN, m.Enabled, m.IfaceName, m.Target, m.Min, m.Max, m.BillingDay),
+	}
+	businessLog.UserId = m.UserId
+	businessLog.TenantId = m.TenantId
+	businessLog.UserName = ctx.Value("Nickname").(string)
+	if _, err := BusinessLogService.Add(businessLog); err != nil {
+		logger.Error("SetAdaptive Add BusinessLog ERR: ", zap.Error(err))
+	}
+
+	return nil
+}
+
+// 查询自适应限速设置，没设置过时返回关闭状态
+func (s *tcService) GetAdaptive(sn string) (*models.TcAdaptiveModel, error) {
+	if sn == "" {
+		return nil, common.ErrParam
+	}
+	sn = strings.ToUpper(sn)
+
+	m, err := repos.TcAdaptiveRepo.GetBySN(sn)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &models.TcAdaptiveModel{SN: sn}, nil
+		}
+		logger.Error("GetAdaptive DB ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+	return m, nil
+}
+
+// 自适应限速的调整记录
+func (s *tcService) AdjustLogs(sn string, page int) ([]models.TcAdjustLog, error) {
+	if sn == "" {
+		return nil, common.ErrParam
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	logs, err := repos.TcAdaptiveRepo.FindAdjustLogs(strings.ToUpper(sn), page, 50)
+	if err != nil {
+		logger.Error("AdjustLogs DB ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+	return logs, nil
+}
+
+// waitTaskResp 等待agent的任务应答
+func waitTaskResp(taskId string, timeout time.Duration) (*protos.Task, error) {
+	redisKey := fmt.Sprintf("%s%s", common.TASK_RESPONSE_KEY_PREFIX, taskId)
+	rstByte, err := common.RedisClient.BRPop(context.Background(), timeout, redisKey).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			tcpservice.RecordTaskTimeout(taskId)
+		}
+		logger.Error("waitTaskResp redis ERR: ", zap.String("key", redisKey), zap.Error(err))
+		return nil, common.ErrService
+	}
+
+	var task protos.Task
+	if err := proto.Unmarshal([]byte(rstByte[1]), &task); err != nil {
+		logger.Error("waitTaskResp msg ERR: ", zap.Error(err))
+		return nil, err
+	}
+	return &task, nil
+}
+
+// pushTcPolicy 按策略下发限速并等待设备应答，覆盖设备原来的限速规则
+func pushTcPolicy(sn string, policy *protos.TcPolicy) error {
+	taskId, err := tcpservice.TrifficLimitPolicy(sn, "", policy, 0)
+	if err != nil {
+		logger.Warn("pushTcPolicy ERR: ", zap.String("sn", sn), zap.Error(err))
+		return err
+	}
+
+	task, err := waitTaskResp(taskId, time.Second*10)
+	if err != nil {
+		return err
+	}
+	if task.ErrMsg != "" {
+		logger.Error("pushTcPolicy agent ERR: ", zap.String("sn", sn), zap.String("err", task.ErrMsg))
+		return fmt.Errorf("%s", task.ErrMsg)
+	}
+	return nil
+}
+
+// restoreTcLimit 恢复设备平时的限速：在共享线路上的按线路分配的带宽，
+// 否则按数据库里保存的限速设置，没有设置时清除限速
+func restoreTcLimit(sn string) error {
+	if site, err := repos.SiteRepo.GetBySN(sn); err == nil {
+		if mbps, ok := site.Allocation[sn]; ok {
+			return pushTcPolicy(sn, &protos.TcPolicy{Rate: fmt.Sprintf("%dmbit", mbps)})
+		}
+	}
+
+	var taskId string
+	tc, err := repos.TcRepo.GetBySN(sn)
+	if err == nil && (tc.UpLimit > 0 || len(tc.Rules) > 0) {
+		taskId, err = tcpservice.TrifficLimit(sn, "", tc.UpLimit, tc.Rules, 0)
+	} else {
+		taskId, err = tcpservice.TrifficLimitClean(sn)
+	}
+	if err != nil {
+		logger.Warn("restoreTcLimit ERR: ", zap.String("sn", sn), zap.Error(err))
+		return err
+	}
+
+	_, err = waitTaskResp(taskId, time.Second*10)
+	return err
+}
+
+// 设备上报的限速漂移事件，最新的在前
+func (s *tcService) DriftEvents(sn string) ([]*protos.TcDriftEvent, error) {
+	if sn == "" {
+		return nil, common.ErrParam
+	}
+
+	key := fmt.Sprintf("%s%s", common.TC_DRIFT_KEY_PREFIX, strings.ToUpper(sn))
+	list, err := common.RedisClient.LRange(context.Background(), key, 0, -1).Result()
+	if err != nil {
+		logger.Error("DriftEvents redis ERR: ", zap.String("key", key), zap.Error(err))
+		return nil, common.ErrService
+	}
+
+	events := make([]*protos.TcDriftEvent, 0, len(list))
+	for _, one := range list {
+		var ev protos.TcDriftEvent
+		if err := json.Unmarshal([]byte(one), &ev); err != nil {
+			logger.Error("DriftEvents Unmarshal ERR: ", zap.Error(err))
+			continue
+		}
+		events = append(events, &ev)
+	}
+
+	return events, nil
+}
+
+// 保留的规则名: agent放行接入服务器的规则和没匹配规则的默认class用的名字
+var tcReservedRuleNames = map[string]bool{"access": true, "default": true}
+
+// 没起名字的规则按位置命名
+func tcRuleName(rule models.TcRule, i int) string {
+	if name := strings.TrimSpace(rule.Name); name != "" {
+		return name
+	}
+	return fmt.Sprintf("rule%d", i+1)
+}
+
+// validateTcRules 检查限速规则，和agent端的检查一致
+func validateTcRules(rules models.TcRuleArray) error {
+	if len(rules) > 50 {
+		return fmt.Errorf("too many rules: %d", len(rules))
+	}
+
+	names := make(map[string]bool, len(rules))
+	for i, rule := range rules {
+		// 查状态时按规则名对应class，不能重名，也不能用agent自己的规则名
+		name := tcRuleName(rule, i)
+		if tcReservedRuleNames[strings.ToLower(name)] {
+			return fmt.Errorf("rule %s: reserved name", name)
+		}
+		if names[name] {
+			return fmt.Errorf("rule %s: duplicate name", name)
+		}
+		names[name] = true
+
+		switch rule.Protocol {
+		case "", "all", "tcp", "udp":
+		default:
+			return fmt.Errorf("rule %s protocol: %s", rule.Name, rule.Protocol)
+		}
+		if rule.Prio > 7 {
+			return fmt.Errorf("rule %s prio: %d", rule.Name, rule.Prio)
+		}
+		if rule.Ceil > 0 && rule.Ceil < rule.Rate {
+			return fmt.Errorf("rule %s ceil < rate", rule.Name)
+		}
+		for _, port := range rule.Ports {
+			if port == 0 || port > 65535 {
+				return fmt.Errorf("rule %s port: %d", rule.Name, port)
+			}
+		}
+		for _, cidr := range rule.CIDRs {
+			if _, _, err := net.ParseCIDR(cidr); err != nil && net.ParseIP(cidr) == nil {
+				return fmt.Errorf("rule %s cidr: %s", rule.Name, cidr)
+			}
+		}
+
+		// 按程序匹配只能三选一，不能再带地址/端口/协议
+		targets := 0
+		for _, s := range []string{rule.Process, rule.Unit, rule.Cgroup} {
+			if s != "" {
+				targets++
+			}
+		}
+		if targets > 1 {
+			return fmt.Errorf("rule %s: only one of process/unit/cgroup", rule.Name)
+		}
+		if targets == 1 && (len(rule.CIDRs) > 0 || len(rule.Ports) > 0 || (rule.Protocol != "" && rule.Protocol != "all")) {
+			return fmt.Errorf("rule %s: program rule with cidr/port/protocol", rule.Name)
+		}
+		if strings.Contains(rule.Cgroup, "..") {
+			return fmt.Errorf("rule %s cgroup: %s", rule.Name, rule.Cgroup)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"testing"
+
+	"pcdn-server/models"
+)
+
+// go test -v -count=1 -run TestValidateTcRules pcdn-server/service
+func TestValidateTcRules(t *testing.T) {
+	cases := []struct {
+		name  string
+		rules models.TcRuleArray
+		ok    bool
+	}{
+		{"empty", nil, true},
+		{"named", models.TcRuleArray{{Name: "web", Ports: []uint32{80}}, {Name: "dns", Protocol: "udp"}}, true},
+		{"unnamed", models.TcRuleArray{{Ports: []uint32{80}}, {Ports: []uint32{443}}}, true},
+		{"duplicate", models.TcRuleArray{{Name: "web"}, {Name: "web"}}, false},
+		{"duplicate generated", models.TcRuleArray{{Name: "rule2"}, {}}, false},
+		{"reserved access", models.TcRuleArray{{Name: "access"}}, false},
+		{"reserved default", models.TcRuleArray{{Name: "Default"}}, false},
+		{"protocol", models.TcRuleArray{{Name: "a", Protocol: "icmp"}}, false},
+		{"ceil", models.TcRuleArray{{Name: "a", Rate: 10, Ceil: 5}}, false},
+		{"cidr", models.TcRuleArray{{Name: "a", CIDRs: []string{"10.0.0.0/8", "::1"}}}, true},
+		{"bad cidr", models.TcRuleArray{{Name: "a", CIDRs: []string{"10.0.0/33"}}}, false},
+		{"program", models.TcRuleArray{{Name: "a", Process: "nginx", Ports: []uint32{80}}}, false},
+	}
+	for _, c := range cases {
+		if err := validateTcRules(c.rules); (err == nil) != c.ok {
+			t.Errorf("%s: %v", c.name, err)
+		}
+	}
+}
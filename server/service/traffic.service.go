@@ -0,0 +1,94 @@
+package service
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+	"pcdn-server/repos"
+
+	passportprotos "github.com/liuhengloveyou/passport/protos"
+	"go.uber.org/zap"
+)
+
+type trafficService struct {
+}
+
+// Query 设备每个网卡的流量合计，用来和厂商结算单对账
+// granularity: hour/day，按服务器所在时区分天
+// start/end: 2006-01-02，包含end这一天；为空时是最近7天(hour是今天)
+// iface为空时所有网卡，total是上行网卡的合计
+func (s *trafficService) Query(sessionUser *passportprotos.User, sn, iface, granularity, start, end string) ([]models.TrafficTotal, error) {
+	sn, err := ownedDeviceSN(sessionUser, sn, "traffic")
+	if err != nil {
+		return nil, err
+	}
+
+	var layout string
+	var maxDays int
+	switch granularity {
+	case "hour":
+		layout, maxDays = "2006-01-02 15:00", 31
+	case "", "day":
+		layout, maxDays = "2006-01-02", 366
+	default:
+		return nil, common.ErrParam
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	to := today
+	if end != "" {
+		if to, err = time.ParseInLocation("2006-01-02", end, time.Local); err != nil {
+			return nil, common.ErrParam
+		}
+	}
+	from := to.AddDate(0, 0, -6)
+	if granularity == "hour" {
+		from = to
+	}
+	if start != "" {
+		if from, err = time.ParseInLocation("2006-01-02", start, time.Local); err != nil {
+			return nil, common.ErrParam
+		}
+	}
+	to = to.AddDate(0, 0, 1)
+	if !from.Before(to) || from.AddDate(0, 0, maxDays).Before(to) {
+		return nil, common.ErrParam
+	}
+
+	rows, err := repos.TrafficRepo.FindHourly(sn, strings.TrimSpace(iface), from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		logger.Error("trafficService.Query DB ERR: ", zap.Error(err))
+		return nil, common.ErrService
+	}
+
+	type key struct{ period, iface string }
+	byPeriod := make(map[key]*models.TrafficTotal)
+	for _, row := range rows {
+		k := key{period: time.UnixMilli(row.Ts).In(time.Local).Format(layout), iface: row.Iface}
+		one, ok := byPeriod[k]
+		if !ok {
+			one = &models.TrafficTotal{Period: k.period, Iface: row.Iface}
+			byPeriod[k] = one
+		}
+		one.BytesSent += row.BytesSent
+		one.BytesRecv += row.BytesRecv
+		one.PacketsSent += row.PacketsSent
+		one.PacketsRecv += row.PacketsRecv
+		one.Resets += row.Resets
+	}
+	rst := make([]models.TrafficTotal, 0, len(byPeriod))
+	for _, one := range byPeriod {
+		rst = append(rst, *one)
+	}
+	sort.Slice(rst, func(i, j int) bool {
+		if rst[i].Period != rst[j].Period {
+			return rst[i].Period < rst[j].Period
+		}
+		return rst[i].Iface < rst[j].Iface
+	})
+	return rst, nil
+}
@@ -15,6 +15,34 @@ func RunTasks() {
 		service.TcService.SyncAllTrifficLimitToDevice()
 	})
 
+	// 每分钟按流量重新分配共享线路的带宽
+	c.AddFunc("* * * * *", func() {
+		service.SiteService.RebalanceAll()
+	})
+
+	// 每5分钟检查流量配额
+	c.AddFunc("*/5 * * * *", func() {
+		service.TrafficQuotaService.CheckAll()
+	})
+
+	// 历史指标降采样和过期清理
+	c.AddFunc("*/5 * * * *", func() {
+		service.MetricsService.Rollup()
+	})
+	c.AddFunc("17 * * * *", func() {
+		service.MetricsService.Expire()
+	})
+
+	// 每分钟检查告警规则
+	c.AddFunc("* * * * *", func() {
+		service.AlertService.Evaluate()
+	})
+
+	// 设备上的探测设置和应有的不一致时重新下发
+	c.AddFunc("*/5 * * * *", func() {
+		service.ProbeService.SyncAll()
+	})
+
 	c.Start()
 }
 
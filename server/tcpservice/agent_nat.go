@@ -0,0 +1,108 @@
+package tcpservice
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+	"pcdn-server/repos"
+
+	"github.com/liuhengloveyou/pcdn/protos"
+	"go.uber.org/zap"
+)
+
+// 这么久没心跳的设备从natRecorded里去掉，重连后再写一次库
+const natRecordTTL = 30 * time.Minute
+
+type natRecord struct {
+	key  string
+	seen time.Time
+}
+
+var (
+	natMu sync.Mutex
+	// 每台设备最近一次写库的网络信息
+	natRecorded = make(map[string]*natRecord)
+)
+
+// 心跳带上来的NAT类型和公网地址有变化时写库，顺便查IP库得到运营商和地区
+func recordNat(heartbeat *protos.Heartbeat, remoteAddr string) {
+	nat := heartbeat.Nat
+	if nat == nil || nat.DetectedAt == 0 {
+		return
+	}
+
+	sn := strings.ToUpper(heartbeat.Sn)
+	key := strings.Join([]string{nat.NatType, nat.PublicIpv4, strings.Join(nat.PublicIpv6, ","), nat.LocalIpv4}, "|")
+
+	natMu.Lock()
+	rec, ok := natRecorded[sn]
+	if ok {
+		rec.seen = time.Now()
+	}
+	natMu.Unlock()
+	if ok && rec.key == key {
+		return
+	}
+
+	m := &models.DeviceModel{
+		NatType:       nat.NatType,
+		PublicIPv4:    nat.PublicIpv4,
+		PublicIPv6:    models.StringArr(nat.PublicIpv6),
+		LocalIPv4:     nat.LocalIpv4,
+		NetUpdateTime: nat.ChangedAt,
+	}
+	if m.NetUpdateTime == 0 {
+		m.NetUpdateTime = time.Now().UnixMilli()
+	}
+	if m.PublicIPv6 == nil {
+		m.PublicIPv6 = models.StringArr{}
+	}
+
+	// 没检测到公网IPv4时用连接的来源地址查归属地
+	lookup := nat.PublicIpv4
+	if lookup == "" && len(nat.PublicIpv6) > 0 {
+		lookup = nat.PublicIpv6[0]
+	}
+	if lookup == "" {
+		lookup, _, _ = net.SplitHostPort(remoteAddr)
+	}
+	if loc := common.LookupIP(lookup); loc != nil {
+		m.Country, m.Province, m.City, m.ISP = loc.Country, loc.Province, loc.City, loc.ISP
+	}
+
+	if err := repos.DeviceRepo.UpdateNet(sn, m); err != nil {
+		common.Logger.Error("recordNat DB ERR: ", zap.String("sn", sn), zap.Error(err))
+		return
+	}
+	natMu.Lock()
+	natRecorded[sn] = &natRecord{key: key, seen: time.Now()}
+	natMu.Unlock()
+
+	if ok {
+		common.Logger.Info("device nat changed: ", zap.String("sn", sn), zap.String("old", rec.key), zap.String("new", key), zap.String("isp", m.ISP))
+	}
+}
+
+// 定时去掉离线设备的记录
+func startNatPruneTask() {
+	ticker := time.NewTicker(natRecordTTL / 3)
+	go func() {
+		for range ticker.C {
+			pruneNatRecorded(time.Now().Add(-natRecordTTL))
+		}
+	}()
+}
+
+func pruneNatRecorded(before time.Time) {
+	natMu.Lock()
+	defer natMu.Unlock()
+	for sn, rec := range natRecorded {
+		if rec.seen.Before(before) {
+			delete(natRecorded, sn)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package tcpservice
+
+import (
+	"testing"
+	"time"
+)
+
+// go test -v -count=1 -run TestPruneNatRecorded pcdn-server/tcpservice
+func TestPruneNatRecorded(t *testing.T) {
+	now := time.Now()
+	natMu.Lock()
+	natRecorded["TEST-NAT-OLD"] = &natRecord{key: "a", seen: now.Add(-time.Hour)}
+	natRecorded["TEST-NAT-NEW"] = &natRecord{key: "b", seen: now}
+	natMu.Unlock()
+	defer func() {
+		natMu.Lock()
+		delete(natRecorded, "TEST-NAT-OLD")
+		delete(natRecorded, "TEST-NAT-NEW")
+		natMu.Unlock()
+	}()
+
+	pruneNatRecorded(now.Add(-natRecordTTL))
+
+	natMu.Lock()
+	defer natMu.Unlock()
+	if _, ok := natRecorded["TEST-NAT-OLD"]; ok {
+		t.Fatal("stale record kept")
+	}
+	if _, ok := natRecorded["TEST-NAT-NEW"]; !ok {
+		t.Fatal("fresh record pruned")
+	}
+}
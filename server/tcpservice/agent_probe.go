@@ -0,0 +1,45 @@
+package tcpservice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"pcdn-server/common"
+
+	"github.com/liuhengloveyou/pcdn/protos"
+	redis "github.com/redis/go-redis/v9"
+)
+
+// 心跳带上来的网络质量探测结果，每个目标只保留最近一轮
+func updateAgentProbeToRedis(heartbeat *protos.Heartbeat) error {
+	if len(heartbeat.Probes) == 0 {
+		return nil
+	}
+
+	probesJson, err := json.Marshal(heartbeat.Probes)
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("%s%s", common.AGENT_PROBE_KEY_PREFIX, strings.ToUpper(heartbeat.Sn))
+	return common.RedisClient.Set(context.Background(), key, probesJson, 30*time.Minute).Err()
+}
+
+// GetAgentProbes 设备最近一轮的探测结果
+func GetAgentProbes(sn string) ([]*protos.ProbeResult, error) {
+	key := fmt.Sprintf("%s%s", common.AGENT_PROBE_KEY_PREFIX, strings.ToUpper(sn))
+	val, err := common.RedisClient.Get(context.Background(), key).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var rr []*protos.ProbeResult
+	err = json.Unmarshal([]byte(val), &rr)
+	return rr, err
+}
@@ -13,6 +13,35 @@ import (
 	"go.uber.org/zap"
 )
 
+// GetAgentMonitors 批量读设备最近一次心跳的监控信息
+func GetAgentMonitors(sns []string) (map[string]*protos.SystemMonitorData, error) {
+	rst := make(map[string]*protos.SystemMonitorData, len(sns))
+	if len(sns) == 0 {
+		return rst, nil
+	}
+
+	keys := make([]string, len(sns))
+	for i, sn := range sns {
+		keys[i] = fmt.Sprintf("%s%s", common.AGENT_MONITOR_KEY_PREFIX, strings.ToUpper(sn))
+	}
+	vals, err := common.RedisClient.MGet(context.Background(), keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, v := range vals {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var monitor protos.SystemMonitorData
+		if err := json.Unmarshal([]byte(s), &monitor); err == nil {
+			rst[strings.ToUpper(sns[i])] = &monitor
+		}
+	}
+	return rst, nil
+}
+
 func updateAgentMonitorToRedis(heartbeat *protos.Heartbeat) error {
 	if heartbeat.Sn == "" {
 		return fmt.Errorf("heartbeat.Sn is empty")
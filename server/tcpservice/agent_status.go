@@ -26,6 +26,48 @@ func getAgentStatusFromRedis(sn string) (agent *models.DeviceAgent, err error) {
 	return agent, nil
 }
 
+// 超过这个时间没有心跳算离线
+const agentOnlineTimeout = 2 * time.Minute
+
+// IsOnline 设备最近有没有心跳
+func IsOnline(agent *models.DeviceAgent) bool {
+	return agent != nil && HeartbeatOnline(agent.LastHeartbear)
+}
+
+// HeartbeatOnline 最后心跳时间(毫秒)算不算在线
+func HeartbeatOnline(lastHeartbeat int64) bool {
+	return lastHeartbeat > 0 && time.Since(time.UnixMilli(lastHeartbeat)) <= agentOnlineTimeout
+}
+
+// GetAgentStatuses 批量读设备状态，没有状态的设备不在结果里
+func GetAgentStatuses(sns []string) (map[string]*models.DeviceAgent, error) {
+	rst := make(map[string]*models.DeviceAgent, len(sns))
+	if len(sns) == 0 {
+		return rst, nil
+	}
+
+	keys := make([]string, len(sns))
+	for i, sn := range sns {
+		keys[i] = snToKey(sn)
+	}
+	vals, err := common.RedisClient.MGet(context.Background(), keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range vals {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var agent models.DeviceAgent
+		if err := json.Unmarshal([]byte(s), &agent); err == nil {
+			rst[strings.ToUpper(agent.SN)] = &agent
+		}
+	}
+	return rst, nil
+}
+
 func updateAgentStatusToRedis(agent *models.DeviceAgent) error {
 	agent.AccessName = common.ServConfig.AccessName
 
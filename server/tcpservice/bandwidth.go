@@ -0,0 +1,190 @@
+package tcpservice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+	"pcdn-server/repos"
+
+	"github.com/liuhengloveyou/pcdn/protos"
+	"go.uber.org/zap"
+)
+
+// 带宽采样周期，95计费按5分钟一个点
+const bandwidthSampleInterval = 5 * time.Minute
+
+// 不计入设备总带宽的虚拟网卡
+var virtualIfacePrefixes = []string{"lo", "docker", "veth", "br-", "virbr", "tun", "tap", "wg", "ifb", "cni", "flannel", "kube", "dummy"}
+
+// 一台设备一个采样周期内心跳带上来的速率累加
+type bandwidthBucket struct {
+	start int64 // 周期开始时间 毫秒
+	count map[string]int
+	send  map[string]float64 // bits/s
+	recv  map[string]float64
+}
+
+var (
+	bandwidthMu      sync.Mutex
+	bandwidthBuckets = make(map[string]*bandwidthBucket)
+)
+
+// 心跳里的网卡速率累加到当前5分钟的采样里
+func recordBandwidth(heartbeat *protos.Heartbeat) {
+	if heartbeat.Monitor == nil || len(heartbeat.Monitor.Network) == 0 {
+		return
+	}
+
+	now := time.Now()
+	start := now.Truncate(bandwidthSampleInterval).UnixMilli()
+
+	var done []models.BandwidthSample
+	defer func() {
+		saveBandwidthSamples(heartbeat.Sn, done)
+	}()
+
+	bandwidthMu.Lock()
+	defer bandwidthMu.Unlock()
+
+	bucket, ok := bandwidthBuckets[heartbeat.Sn]
+	if ok && bucket.start != start {
+		// 上一个周期还没落库，放锁以后存掉
+		done = bucketSamples(heartbeat.Sn, bucket)
+		ok = false
+	}
+	if !ok {
+		bucket = &bandwidthBucket{
+			start: start,
+			count: make(map[string]int),
+			send:  make(map[string]float64),
+			recv:  make(map[string]float64),
+		}
+		bandwidthBuckets[heartbeat.Sn] = bucket
+	}
+
+	uplinks := uplinkIfaces(heartbeat.Monitor.Network)
+	var totalSend, totalRecv float64
+	for _, n := range heartbeat.Monitor.Network {
+		bucket.count[n.Name]++
+		bucket.send[n.Name] += n.SendRate * 8
+		bucket.recv[n.Name] += n.RecvRate * 8
+		if uplinks[n.Name] {
+			totalSend += n.SendRate * 8
+			totalRecv += n.RecvRate * 8
+		}
+	}
+	bucket.count[models.BANDWIDTH_TOTAL_IFACE]++
+	bucket.send[models.BANDWIDTH_TOTAL_IFACE] += totalSend
+	bucket.recv[models.BANDWIDTH_TOTAL_IFACE] += totalRecv
+}
+
+// uplinkIfaces 计入设备总带宽的网卡
+// 有ppp拨号时只算ppp，下面的物理网卡上是同一份流量；没有时算除虚拟网卡外的所有网卡
+func uplinkIfaces(networks []*protos.SystemMonitorNetwork) map[string]bool {
+	rst := make(map[string]bool)
+	for _, n := range networks {
+		if strings.HasPrefix(n.Name, "ppp") {
+			rst[n.Name] = true
+		}
+	}
+	if len(rst) > 0 {
+		return rst
+	}
+
+	for _, n := range networks {
+		if !virtualIface(n.Name) {
+			rst[n.Name] = true
+		}
+	}
+	return rst
+}
+
+func virtualIface(name string) bool {
+	for _, prefix := range virtualIfacePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// UplinkSendBits 设备最近一次心跳上报的上行速率 bits/s
+func UplinkSendBits(sn string) (float64, error) {
+	key := fmt.Sprintf("%s%s", common.AGENT_MONITOR_KEY_PREFIX, strings.ToUpper(sn))
+	monitorData, err := common.RedisClient.Get(context.Background(), key).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	var monitor protos.SystemMonitorData
+	if err := json.Unmarshal([]byte(monitorData), &monitor); err != nil {
+		return 0, err
+	}
+
+	send, _ := UplinkBits(&monitor)
+	return send, nil
+}
+
+// UplinkBits 上行网卡的发送和接收速率合计 bits/s
+func UplinkBits(monitor *protos.SystemMonitorData) (send, recv float64) {
+	uplinks := uplinkIfaces(monitor.Network)
+	for _, n := range monitor.Network {
+		if uplinks[n.Name] {
+			send += n.SendRate * 8
+			recv += n.RecvRate * 8
+		}
+	}
+	return send, recv
+}
+
+// 一个周期的平均速率，调用时需持有bandwidthMu
+func bucketSamples(sn string, bucket *bandwidthBucket) []models.BandwidthSample {
+	samples := make([]models.BandwidthSample, 0, len(bucket.count))
+	for iface, n := range bucket.count {
+		samples = append(samples, models.BandwidthSample{
+			SN:         sn,
+			Iface:      iface,
+			SampleTime: bucket.start,
+			SendRate:   bucket.send[iface] / float64(n),
+			RecvRate:   bucket.recv[iface] / float64(n),
+		})
+	}
+	return samples
+}
+
+// 保存采样，不能持有bandwidthMu
+func saveBandwidthSamples(sn string, samples []models.BandwidthSample) {
+	if err := repos.BandwidthRepo.CreateBatch(samples); err != nil {
+		common.Logger.Error("saveBandwidthSamples ERR: ", zap.String("sn", sn), zap.Error(err))
+	}
+}
+
+// 定时保存已经结束的采样周期，设备离线后最后一个周期也能落库
+func startBandwidthFlushTask() {
+	ticker := time.NewTicker(time.Minute)
+	go func() {
+		for range ticker.C {
+			start := time.Now().Truncate(bandwidthSampleInterval).UnixMilli()
+
+			done := make(map[string][]models.BandwidthSample)
+			bandwidthMu.Lock()
+			for sn, bucket := range bandwidthBuckets {
+				if bucket.start < start {
+					done[sn] = bucketSamples(sn, bucket)
+					delete(bandwidthBuckets, sn)
+				}
+			}
+			bandwidthMu.Unlock()
+
+			for sn, samples := range done {
+				saveBandwidthSamples(sn, samples)
+			}
+		}
+	}()
+}
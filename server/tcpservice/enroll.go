@@ -0,0 +1,302 @@
+package tcpservice
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+	"pcdn-server/repos"
+
+	"github.com/liuhengloveyou/pcdn/protos"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"gorm.io/gorm"
+)
+
+// 连接的认证状态
+type connAuth struct {
+	sn      string
+	pending bool // 还没被认领，只收清单
+}
+
+var (
+	connAuthMu sync.Mutex
+	connAuths  = make(map[net.Conn]*connAuth)
+)
+
+func getConnAuth(conn net.Conn) *connAuth {
+	connAuthMu.Lock()
+	defer connAuthMu.Unlock()
+	return connAuths[conn]
+}
+
+func setConnAuth(conn net.Conn, a *connAuth) {
+	connAuthMu.Lock()
+	defer connAuthMu.Unlock()
+	if a == nil {
+		delete(connAuths, conn)
+		return
+	}
+	connAuths[conn] = a
+}
+
+// 连接上除认证外的消息要不要处理。没发过认证的是老版本agent，只能先发心跳
+func connAllowed(conn net.Conn, msgType uint32) bool {
+	a := getConnAuth(conn)
+	switch {
+	case a == nil:
+		return msgType == uint32(protos.MsgType_MSG_TYPE_HEARTBEAT)
+	case a.pending:
+		return msgType == uint32(protos.MsgType_MSG_TYPE_INVENTORY)
+	}
+	return true
+}
+
+// 消息里的SN要是这个连接认证过的设备
+func connOwnsSN(conn net.Conn, sn string) bool {
+	a := getConnAuth(conn)
+	return a != nil && a.sn == sn
+}
+
+// 心跳绑定连接和设备。没发过认证的连接，只有手动添加、还没有凭证的设备可以直接用
+func authorizeHeartbeat(conn net.Conn, sn string) bool {
+	if a := getConnAuth(conn); a != nil {
+		return !a.pending && a.sn == sn
+	}
+
+	dev, err := repos.DeviceRepo.GetBySN(sn)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			common.Logger.Error("authorizeHeartbeat DB ERR: ", zap.String("sn", sn), zap.Error(err))
+		}
+		return false
+	}
+	if dev.TokenHash != "" {
+		common.Logger.Warn("authorizeHeartbeat need enroll: ", zap.String("sn", sn), zap.String("addr", conn.RemoteAddr().String()))
+		return false
+	}
+	setConnAuth(conn, &connAuth{sn: sn})
+	return true
+}
+
+const (
+	// 这么久没再连上来的待认领设备从列表里去掉
+	pendingTTL = 7 * 24 * time.Hour
+	// 同一个来源地址最多这么多台待认领设备
+	pendingPerSource = 256
+)
+
+type enrollAction int
+
+const (
+	enrollReject enrollAction = iota
+	enrollPending
+	enrollOK
+	enrollIssueToken
+)
+
+// 认证的状态机，dev为nil表示库里没有这台设备:
+// 库里没有的放进待认领列表; 有凭证的核对凭证;
+// 还没有凭证的，认领码和认领时的一致才发凭证; 手动添加、还没认领过的也放进待认领列表，等用认领码认领
+func decideEnroll(dev *models.DeviceModel, token, codeHash string) enrollAction {
+	switch {
+	case dev == nil || (dev.TokenHash == "" && dev.ClaimCodeHash == ""):
+		if codeHash == "" {
+			return enrollReject
+		}
+		return enrollPending
+	case dev.TokenHash != "":
+		if token != "" && secretEqual(common.HashSecret(token), dev.TokenHash) {
+			return enrollOK
+		}
+		return enrollReject
+	case codeHash != "" && secretEqual(codeHash, dev.ClaimCodeHash):
+		return enrollIssueToken
+	}
+	return enrollReject
+}
+
+// agent连上后的认证，见decideEnroll
+func processEnrollMsg(conn net.Conn, msgByte []byte) error {
+	var req protos.Enroll
+	if err := proto.Unmarshal(msgByte, &req); err != nil {
+		common.Logger.Sugar().Errorf("processEnrollMsg msg ERR: ", conn.RemoteAddr(), err)
+		promDecodeErrors.Inc(protos.MsgType_MSG_TYPE_ENROLL.String())
+		return err
+	}
+	sn := strings.ToUpper(strings.TrimSpace(req.Sn))
+	if sn == "" {
+		return common.ErrParam
+	}
+	remoteAddr := strings.Split(conn.RemoteAddr().String(), ":")[0]
+	codeHash := ""
+	if code := common.NormalizeClaimCode(req.ClaimCode); code != "" {
+		codeHash = common.HashSecret(code)
+	}
+
+	resp := &protos.Enroll{Sn: sn, Status: protos.EnrollStatus_ENROLL_STATUS_REJECTED}
+	defer func() {
+		promEnrolls.Inc(resp.Status.String())
+		if err := sendProtoMsg(conn, protos.MsgType_MSG_TYPE_ENROLL, resp); err != nil {
+			common.Logger.Error("processEnrollMsg send ERR: ", zap.String("sn", sn), zap.Error(err))
+		}
+	}()
+
+	dev, err := repos.DeviceRepo.GetBySN(sn)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		dev, err = nil, nil
+	}
+	if err != nil {
+		common.Logger.Error("processEnrollMsg DB ERR: ", zap.Error(err))
+		resp.Status = protos.EnrollStatus_ENROLL_STATUS_UNKNOWN
+		return common.ErrService
+	}
+
+	switch decideEnroll(dev, req.Token, codeHash) {
+	case enrollPending:
+		n, err := repos.DevicePendingRepo.CountBySource(remoteAddr, sn)
+		if err == nil && n >= pendingPerSource {
+			common.Logger.Warn("processEnrollMsg too many pending: ", zap.String("sn", sn), zap.String("addr", remoteAddr))
+			setConnAuth(conn, nil)
+			return common.ErrNoAuth
+		}
+		if err == nil {
+			pending := &models.DevicePending{SN: sn, ClaimCodeHash: codeHash, Version: req.Ver, RemoteAddr: remoteAddr}
+			err = repos.DevicePendingRepo.Touch(pending)
+		}
+		if err != nil {
+			common.Logger.Error("processEnrollMsg DB ERR: ", zap.Error(err))
+			resp.Status = protos.EnrollStatus_ENROLL_STATUS_UNKNOWN
+			return common.ErrService
+		}
+		setConnAuth(conn, &connAuth{sn: sn, pending: true})
+		resp.Status = protos.EnrollStatus_ENROLL_STATUS_PENDING
+		common.Logger.Debug("processEnrollMsg pending: ", zap.String("sn", sn), zap.String("addr", remoteAddr))
+		return nil
+	case enrollIssueToken:
+		token := common.GenerateToken()
+		if err := repos.DeviceRepo.SetToken(sn, common.HashSecret(token)); err != nil {
+			common.Logger.Error("processEnrollMsg DB ERR: ", zap.Error(err))
+			resp.Status = protos.EnrollStatus_ENROLL_STATUS_UNKNOWN
+			return common.ErrService
+		}
+		resp.Token = token
+		common.Logger.Debug("processEnrollMsg token issued: ", zap.String("sn", sn), zap.String("addr", remoteAddr))
+	case enrollOK:
+	default:
+		common.Logger.Warn("processEnrollMsg deny: ", zap.String("sn", sn), zap.String("addr", remoteAddr))
+		setConnAuth(conn, nil)
+		return common.ErrNoAuth
+	}
+
+	setConnAuth(conn, &connAuth{sn: sn})
+	resp.Status = protos.EnrollStatus_ENROLL_STATUS_OK
+	return nil
+}
+
+// 定时清理很久没再连上来的待认领设备
+func startPendingCleanupTask() {
+	ticker := time.NewTicker(time.Hour)
+	go func() {
+		for range ticker.C {
+			n, err := repos.DevicePendingRepo.DeleteBefore(time.Now().Add(-pendingTTL).UnixMilli())
+			if err != nil {
+				common.Logger.Error("startPendingCleanupTask DB ERR: ", zap.Error(err))
+				continue
+			}
+			if n > 0 {
+				common.Logger.Info("startPendingCleanupTask: ", zap.Int64("deleted", n))
+			}
+		}
+	}()
+}
+
+// 下发的任务和发给的设备、连接，应答要从同一个连接回来
+type sentTask struct {
+	sn   string
+	conn net.Conn
+	at   time.Time
+}
+
+// 任务应答在redis里保留的时间，过了没应答的也不再等
+const sentTaskTTL = 10 * time.Minute
+
+var (
+	sentTasksMu sync.Mutex
+	sentTasks   = make(map[string]*sentTask)
+)
+
+func bindTask(taskId, sn string, conn net.Conn) {
+	sentTasksMu.Lock()
+	defer sentTasksMu.Unlock()
+	sentTasks[taskId] = &sentTask{sn: sn, conn: conn, at: time.Now()}
+}
+
+func unbindTask(taskId string) {
+	sentTasksMu.Lock()
+	defer sentTasksMu.Unlock()
+	delete(sentTasks, taskId)
+}
+
+// 任务应答是不是这个连接上的设备的，是的话取出来，一个任务只收一次应答
+func takeTask(conn net.Conn, taskId, sn string) bool {
+	if a := getConnAuth(conn); a == nil || a.pending || a.sn != sn {
+		return false
+	}
+	sentTasksMu.Lock()
+	defer sentTasksMu.Unlock()
+	t, ok := sentTasks[taskId]
+	if !ok || t.sn != sn || t.conn != conn {
+		return false
+	}
+	delete(sentTasks, taskId)
+	return true
+}
+
+// 定时去掉很久没应答的任务
+func startSentTaskPruneTask() {
+	ticker := time.NewTicker(sentTaskTTL)
+	go func() {
+		for range ticker.C {
+			before := time.Now().Add(-sentTaskTTL)
+			sentTasksMu.Lock()
+			for id, t := range sentTasks {
+				if t.at.Before(before) {
+					delete(sentTasks, id)
+				}
+			}
+			sentTasksMu.Unlock()
+		}
+	}()
+}
+
+// 认证应答。认证是连接上的第一批消息，这时还没有别的地方往这个连接写
+func sendProtoMsg(conn net.Conn, msgType protos.MsgType, msg proto.Message) error {
+	msgByte, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	buff := bytes.NewBuffer([]byte("\r\n"))
+	if err := binary.Write(buff, binary.LittleEndian, uint32(msgType)); err != nil {
+		return err
+	}
+	if err := binary.Write(buff, binary.LittleEndian, uint32(len(msgByte))); err != nil {
+		return err
+	}
+	buff.Write(msgByte)
+
+	_, err = conn.Write(buff.Bytes())
+	return err
+}
+
+func secretEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,80 @@
+package tcpservice
+
+import (
+	"net"
+	"testing"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+)
+
+// go test -v -count=1 -run TestDecideEnroll pcdn-server/tcpservice
+func TestDecideEnroll(t *testing.T) {
+	code := common.HashSecret("ABCD2345")
+	other := common.HashSecret("WXYZ6789")
+	token := common.HashSecret("token")
+
+	tests := []struct {
+		name     string
+		dev      *models.DeviceModel
+		token    string
+		codeHash string
+		want     enrollAction
+	}{
+		{"unknown with code", nil, "", code, enrollPending},
+		{"unknown without code", nil, "", "", enrollReject},
+		{"manual with code", &models.DeviceModel{}, "", code, enrollPending},
+		{"manual without code", &models.DeviceModel{}, "", "", enrollReject},
+		{"claimed", &models.DeviceModel{ClaimCodeHash: code}, "", code, enrollIssueToken},
+		{"claimed wrong code", &models.DeviceModel{ClaimCodeHash: code}, "", other, enrollReject},
+		{"claimed without code", &models.DeviceModel{ClaimCodeHash: code}, "", "", enrollReject},
+		{"token", &models.DeviceModel{ClaimCodeHash: code, TokenHash: token}, "token", "", enrollOK},
+		{"wrong token", &models.DeviceModel{ClaimCodeHash: code, TokenHash: token}, "other", code, enrollReject},
+		{"no token", &models.DeviceModel{TokenHash: token}, "", code, enrollReject},
+	}
+	for _, tt := range tests {
+		if got := decideEnroll(tt.dev, tt.token, tt.codeHash); got != tt.want {
+			t.Errorf("%s: got %v want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// go test -v -count=1 -run TestTakeTask pcdn-server/tcpservice
+func TestTakeTask(t *testing.T) {
+	conn, peer := net.Pipe()
+	other, otherPeer := net.Pipe()
+	defer func() {
+		for _, c := range []net.Conn{conn, peer, other, otherPeer} {
+			c.Close()
+		}
+		setConnAuth(conn, nil)
+		setConnAuth(other, nil)
+	}()
+	setConnAuth(conn, &connAuth{sn: "SN-A"})
+	setConnAuth(other, &connAuth{sn: "SN-B"})
+
+	bindTask("task-1", "SN-A", conn)
+	if takeTask(other, "task-1", "SN-B") {
+		t.Fatal("other device took the task")
+	}
+	if takeTask(other, "task-1", "SN-A") {
+		t.Fatal("other connection took the task")
+	}
+	if takeTask(conn, "task-2", "SN-A") {
+		t.Fatal("unknown task taken")
+	}
+	if !takeTask(conn, "task-1", "SN-A") {
+		t.Fatal("own task rejected")
+	}
+	if takeTask(conn, "task-1", "SN-A") {
+		t.Fatal("task taken twice")
+	}
+
+	// 认证还没通过的连接
+	bindTask("task-3", "SN-A", conn)
+	setConnAuth(conn, &connAuth{sn: "SN-A", pending: true})
+	defer unbindTask("task-3")
+	if takeTask(conn, "task-3", "SN-A") {
+		t.Fatal("pending connection took the task")
+	}
+}
@@ -25,6 +25,8 @@ type HttpProxySession struct {
 	ProxyID    string
 	ResponseCh chan *protos.HttpProxyResponse
 	CreatedAt  time.Time
+	// 请求发给的连接，响应要从同一个连接回来
+	conn net.Conn
 }
 
 var (
@@ -43,8 +45,12 @@ func SendHttpProxyRequest(deviceSN, method, url, proxyID string, headers map[str
 	httpProxySessionsMutex.RUnlock()
 
 	if !ok || tmpAgent.ClientTcpConn == nil {
+		promProxyRequests.Inc("offline")
 		return nil, fmt.Errorf("设备 %s 不在线", deviceSN)
 	}
+	defer func(start time.Time) {
+		promProxyDuration.Observe(time.Since(start).Seconds())
+	}(time.Now())
 
 	// 创建会话ID
 	sessionID := uuid.New().String()
@@ -59,6 +65,7 @@ func SendHttpProxyRequest(deviceSN, method, url, proxyID string, headers map[str
 		ProxyID:    proxyID,
 		ResponseCh: respCh,
 		CreatedAt:  time.Now(),
+		conn:       tmpAgent.ClientTcpConn,
 	}
 
 	httpProxySessionsMutex.Lock()
@@ -79,6 +86,7 @@ func SendHttpProxyRequest(deviceSN, method, url, proxyID string, headers map[str
 	// 序列化请求
 	msgByte, err := proto.Marshal(request)
 	if err != nil {
+		promProxyRequests.Inc("error")
 		return nil, err
 	}
 
@@ -97,6 +105,7 @@ func SendHttpProxyRequest(deviceSN, method, url, proxyID string, headers map[str
 	tmpAgent.MU.Lock()
 	if n, err := tmpAgent.ClientTcpConn.Write(buff.Bytes()); n != buff.Len() || err != nil {
 		tmpAgent.MU.Unlock()
+		promProxyRequests.Inc("error")
 		return nil, err
 	}
 	tmpAgent.MU.Unlock()
@@ -111,12 +120,14 @@ func SendHttpProxyRequest(deviceSN, method, url, proxyID string, headers map[str
 		httpProxySessionsMutex.Lock()
 		delete(httpProxySessions, sessionID)
 		httpProxySessionsMutex.Unlock()
+		promProxyRequests.Inc("ok")
 		return resp, nil
 	case <-ctx.Done():
 		// 超时，清理会话
 		httpProxySessionsMutex.Lock()
 		delete(httpProxySessions, sessionID)
 		httpProxySessionsMutex.Unlock()
+		promProxyRequests.Inc("timeout")
 		return nil, fmt.Errorf("请求超时")
 	}
 }
@@ -126,6 +137,7 @@ func processHttpProxyRespMsg(conn net.Conn, msgByte []byte) error {
 	var response protos.HttpProxyResponse
 	if err := proto.Unmarshal(msgByte, &response); err != nil {
 		common.Logger.Error("解析HTTP代理响应失败", zap.Error(err))
+		promDecodeErrors.Inc(protos.MsgType_MSG_TYPE_HTTP_PROXY_RESP.String())
 		return err
 	}
 
@@ -138,6 +150,10 @@ func processHttpProxyRespMsg(conn net.Conn, msgByte []byte) error {
 		common.Logger.Error("找不到HTTP代理会话", zap.String("session_id", response.SessionId))
 		return fmt.Errorf("会话不存在: %s", response.SessionId)
 	}
+	if session.conn != conn || !connOwnsSN(conn, session.DeviceSN) {
+		common.Logger.Warn("processHttpProxyRespMsg deny: ", zap.String("sn", session.DeviceSN), zap.String("addr", conn.RemoteAddr().String()))
+		return common.ErrNoAuth
+	}
 
 	// 发送响应到通道
 	select {
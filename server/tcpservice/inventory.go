@@ -0,0 +1,154 @@
+package tcpservice
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+	"pcdn-server/repos"
+
+	"github.com/liuhengloveyou/pcdn/protos"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+// agent连上时和清单有变化时上报，和库里的不一样时保存并记变化历史
+func processInventoryMsg(conn net.Conn, msgByte []byte) error {
+	var inv protos.Inventory
+	if err := proto.Unmarshal(msgByte, &inv); err != nil {
+		common.Logger.Sugar().Errorf("processInventoryMsg msg ERR: ", conn.RemoteAddr(), err)
+		promDecodeErrors.Inc(protos.MsgType_MSG_TYPE_INVENTORY.String())
+		return err
+	}
+	sn := strings.ToUpper(inv.Sn)
+	if sn == "" {
+		return common.ErrParam
+	}
+	if !connOwnsSN(conn, sn) {
+		return common.ErrNoAuth
+	}
+
+	old, err := repos.InventoryRepo.Get(sn)
+	if err != nil {
+		common.Logger.Error("processInventoryMsg DB ERR: ", zap.Error(err))
+		return common.ErrService
+	}
+	if old != nil && old.Hash == inv.Hash {
+		return nil
+	}
+
+	m := inventoryModel(sn, &inv)
+	history := &models.DeviceInventoryHistory{
+		SN:         sn,
+		NewHash:    inv.Hash,
+		Changes:    models.InventoryChanges{},
+		CreateTime: m.UpdateTime,
+	}
+	if old != nil {
+		m.Id = old.Id
+		history.OldHash = old.Hash
+		history.Changes = inventoryChanges(old, m)
+	}
+
+	if err := repos.InventoryRepo.Save(m, history); err != nil {
+		common.Logger.Error("processInventoryMsg DB ERR: ", zap.Error(err))
+		return common.ErrService
+	}
+	common.Logger.Info("processInventoryMsg: ", zap.String("sn", sn), zap.String("hash", inv.Hash), zap.Int("changes", len(history.Changes)))
+
+	return nil
+}
+
+func inventoryModel(sn string, inv *protos.Inventory) *models.DeviceInventory {
+	m := &models.DeviceInventory{
+		SN:              sn,
+		Hash:            inv.Hash,
+		Hostname:        inv.Hostname,
+		OS:              inv.Os,
+		Platform:        inv.Platform,
+		PlatformVersion: inv.PlatformVersion,
+		KernelVersion:   inv.KernelVersion,
+		Arch:            inv.Arch,
+		CpuModel:        inv.CpuModel,
+		CpuCores:        inv.CpuCores,
+		CpuPhysicalCore: inv.CpuPhysicalCores,
+		MemoryTotal:     inv.MemoryTotal,
+		Disks:           make(models.InventoryDisks, 0, len(inv.Disks)),
+		Nics:            make(models.InventoryNics, 0, len(inv.Nics)),
+		SysVendor:       inv.SysVendor,
+		ProductName:     inv.ProductName,
+		ProductSerial:   inv.ProductSerial,
+		BiosVersion:     inv.BiosVersion,
+		CollectTime:     inv.Timestamp,
+		UpdateTime:      time.Now().UnixMilli(),
+	}
+	for _, d := range inv.Disks {
+		m.Disks = append(m.Disks, models.InventoryDisk{Name: d.Name, Model: d.Model, Serial: d.Serial, Size: d.Size, Rotational: d.Rotational})
+	}
+	for _, n := range inv.Nics {
+		m.Nics = append(m.Nics, models.InventoryNic{Name: n.Name, Mac: n.Mac, Speed: n.Speed, Driver: n.Driver, Mtu: n.Mtu})
+	}
+	return m
+}
+
+// 两份清单的差异，磁盘和网卡按名字对比
+func inventoryChanges(old, cur *models.DeviceInventory) models.InventoryChanges {
+	changes := models.InventoryChanges{}
+	add := func(field, o, n string) {
+		if o != n {
+			changes = append(changes, models.InventoryChange{Field: field, Old: o, New: n})
+		}
+	}
+
+	add("hostname", old.Hostname, cur.Hostname)
+	add("os", old.OS, cur.OS)
+	add("platform", old.Platform, cur.Platform)
+	add("platformVersion", old.PlatformVersion, cur.PlatformVersion)
+	add("kernelVersion", old.KernelVersion, cur.KernelVersion)
+	add("arch", old.Arch, cur.Arch)
+	add("cpuModel", old.CpuModel, cur.CpuModel)
+	add("cpuCores", fmt.Sprint(old.CpuCores), fmt.Sprint(cur.CpuCores))
+	add("cpuPhysicalCores", fmt.Sprint(old.CpuPhysicalCore), fmt.Sprint(cur.CpuPhysicalCore))
+	add("memoryTotal", fmt.Sprint(old.MemoryTotal), fmt.Sprint(cur.MemoryTotal))
+	add("sysVendor", old.SysVendor, cur.SysVendor)
+	add("productName", old.ProductName, cur.ProductName)
+	add("productSerial", old.ProductSerial, cur.ProductSerial)
+	add("biosVersion", old.BiosVersion, cur.BiosVersion)
+
+	oldDisks, curDisks := make(map[string]string), make(map[string]string)
+	var diskNames []string
+	for _, d := range old.Disks {
+		oldDisks[d.Name] = fmt.Sprintf("%s %s %d", d.Model, d.Serial, d.Size)
+		diskNames = append(diskNames, d.Name)
+	}
+	for _, d := range cur.Disks {
+		curDisks[d.Name] = fmt.Sprintf("%s %s %d", d.Model, d.Serial, d.Size)
+		if _, ok := oldDisks[d.Name]; !ok {
+			diskNames = append(diskNames, d.Name)
+		}
+	}
+	for _, name := range diskNames {
+		add("disk."+name, oldDisks[name], curDisks[name])
+	}
+
+	oldNics, curNics := make(map[string]string), make(map[string]string)
+	var nicNames []string
+	for _, n := range old.Nics {
+		oldNics[n.Name] = fmt.Sprintf("%s %dMbps %s mtu%d", n.Mac, n.Speed, n.Driver, n.Mtu)
+		nicNames = append(nicNames, n.Name)
+	}
+	for _, n := range cur.Nics {
+		curNics[n.Name] = fmt.Sprintf("%s %dMbps %s mtu%d", n.Mac, n.Speed, n.Driver, n.Mtu)
+		if _, ok := oldNics[n.Name]; !ok {
+			nicNames = append(nicNames, n.Name)
+		}
+	}
+	for _, name := range nicNames {
+		add("nic."+name, oldNics[name], curNics[name])
+	}
+
+	return changes
+}
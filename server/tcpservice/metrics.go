@@ -0,0 +1,195 @@
+package tcpservice
+
+import (
+	"sync"
+	"time"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+	"pcdn-server/repos"
+
+	"github.com/liuhengloveyou/pcdn/protos"
+	"go.uber.org/zap"
+)
+
+// 心跳里的指标按分钟汇总后写入时序存储
+const metricsInterval = time.Minute
+
+type metricKey struct {
+	metric string
+	label  string
+}
+
+// 一台设备一分钟内的指标
+type metricsBucket struct {
+	start  int64 // 毫秒
+	points map[metricKey]*models.MetricPoint
+	// 每个探测目标已经记过的结果时间，跟着设备的桶一起清掉
+	probes map[string]int64
+}
+
+var (
+	metricsMu      sync.Mutex
+	metricsBuckets = make(map[string]*metricsBucket)
+)
+
+// 心跳里的指标累加到当前分钟
+func recordMetrics(heartbeat *protos.Heartbeat) {
+	monitor := heartbeat.Monitor
+	if monitor == nil && len(heartbeat.Probes) == 0 {
+		return
+	}
+
+	start := time.Now().Truncate(metricsInterval).UnixMilli()
+
+	var done []models.MetricPoint
+	defer func() {
+		saveMetricPoints(heartbeat.Sn, done)
+	}()
+
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	bucket, ok := metricsBuckets[heartbeat.Sn]
+	probes := make(map[string]int64)
+	if ok && bucket.start != start {
+		// 上一分钟还没落库，放锁以后存掉
+		done = bucketPoints(bucket)
+		probes = bucket.probes
+		ok = false
+	}
+	if !ok {
+		bucket = &metricsBucket{start: start, points: make(map[metricKey]*models.MetricPoint), probes: probes}
+		metricsBuckets[heartbeat.Sn] = bucket
+	}
+
+	add := func(metric, label string, v float64) {
+		key := metricKey{metric: metric, label: label}
+		p, ok := bucket.points[key]
+		if !ok {
+			bucket.points[key] = &models.MetricPoint{SN: heartbeat.Sn, Metric: metric, Label: label, Ts: start, Avg: v, Min: v, Max: v, Count: 1}
+			return
+		}
+		// 先累加，落库时再除
+		p.Avg += v
+		p.Min = min(p.Min, v)
+		p.Max = max(p.Max, v)
+		p.Count++
+	}
+
+	if monitor == nil {
+		monitor = &protos.SystemMonitorData{}
+	}
+	if monitor.Cpu != nil {
+		add(models.METRIC_CPU_USAGE, "", float64(monitor.Cpu.Usage))
+		add(models.METRIC_CPU_LOAD1, "", float64(monitor.Cpu.Load1))
+		if monitor.Cpu.Temperature > 0 {
+			add(models.METRIC_CPU_TEMPERATURE, "", float64(monitor.Cpu.Temperature))
+		}
+	}
+	if monitor.Memory != nil {
+		add(models.METRIC_MEM_USED, "", float64(monitor.Memory.Used))
+		add(models.METRIC_MEM_USED_PERCENT, "", float64(monitor.Memory.UsedPercent))
+	}
+	for _, d := range monitor.Disks {
+		add(models.METRIC_DISK_USED_PERCENT, d.Mount, float64(d.UsedPercent))
+	}
+
+	if len(monitor.Network) > 0 {
+		uplinks := uplinkIfaces(monitor.Network)
+		var totalSend, totalRecv float64
+		for _, n := range monitor.Network {
+			add(models.METRIC_NET_SEND_RATE, n.Name, n.SendRate*8)
+			add(models.METRIC_NET_RECV_RATE, n.Name, n.RecvRate*8)
+			if uplinks[n.Name] {
+				totalSend += n.SendRate * 8
+				totalRecv += n.RecvRate * 8
+			}
+		}
+		add(models.METRIC_NET_SEND_RATE, models.BANDWIDTH_TOTAL_IFACE, totalSend)
+		add(models.METRIC_NET_RECV_RATE, models.BANDWIDTH_TOTAL_IFACE, totalRecv)
+	}
+
+	if c := monitor.Conn; c != nil {
+		if c.ConntrackMax > 0 {
+			add(models.METRIC_CONNTRACK_USAGE, "", float64(c.ConntrackCount)*100/float64(c.ConntrackMax))
+		}
+		for state, n := range c.TcpStates {
+			add(models.METRIC_TCP_CONNS, state, float64(n))
+		}
+	}
+
+	for _, c := range monitor.Containers {
+		if c.Name == "" {
+			continue
+		}
+		if c.State != "running" {
+			add(models.METRIC_CONTAINER_UP, c.Name, 0)
+			continue
+		}
+		add(models.METRIC_CONTAINER_UP, c.Name, 1)
+		add(models.METRIC_CONTAINER_CPU, c.Name, float64(c.Cpu))
+		add(models.METRIC_CONTAINER_MEM, c.Name, float64(c.MemoryUsage))
+		add(models.METRIC_CONTAINER_NET_RX, c.Name, c.NetRxRate*8)
+		add(models.METRIC_CONTAINER_NET_TX, c.Name, c.NetTxRate*8)
+	}
+
+	// 探测结果在下一轮之前每个心跳都会带上，只记一次
+	for _, p := range heartbeat.Probes {
+		if p.Timestamp <= bucket.probes[p.Name] {
+			continue
+		}
+		bucket.probes[p.Name] = p.Timestamp
+
+		add(models.METRIC_PROBE_LOSS, p.Name, p.LossPercent)
+		if p.Received > 0 {
+			add(models.METRIC_PROBE_RTT, p.Name, p.AvgMs)
+		}
+		if p.Received > 1 {
+			add(models.METRIC_PROBE_JITTER, p.Name, p.JitterMs)
+		}
+	}
+}
+
+// 一分钟的汇总，调用时需持有metricsMu
+func bucketPoints(bucket *metricsBucket) []models.MetricPoint {
+	points := make([]models.MetricPoint, 0, len(bucket.points))
+	for _, p := range bucket.points {
+		p.Avg /= float64(p.Count)
+		points = append(points, *p)
+	}
+	return points
+}
+
+// 保存汇总，不能持有metricsMu
+func saveMetricPoints(sn string, points []models.MetricPoint) {
+	if err := repos.MetricsRepo.Write(points); err != nil {
+		common.Logger.Error("saveMetricPoints ERR: ", zap.String("sn", sn), zap.Error(err))
+	}
+}
+
+// 定时保存已经结束的分钟，设备离线后最后一分钟也能落库
+func startMetricsFlushTask() {
+	ticker := time.NewTicker(metricsInterval)
+	go func() {
+		for range ticker.C {
+			for sn, points := range takeFinishedBuckets(time.Now().Truncate(metricsInterval).UnixMilli()) {
+				saveMetricPoints(sn, points)
+			}
+		}
+	}()
+}
+
+// 取出start之前的分钟并删掉这些设备的桶，探测记录也一起删掉
+func takeFinishedBuckets(start int64) map[string][]models.MetricPoint {
+	done := make(map[string][]models.MetricPoint)
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	for sn, bucket := range metricsBuckets {
+		if bucket.start < start {
+			done[sn] = bucketPoints(bucket)
+			delete(metricsBuckets, sn)
+		}
+	}
+	return done
+}
@@ -0,0 +1,99 @@
+package tcpservice
+
+import (
+	"testing"
+
+	"pcdn-server/models"
+
+	"github.com/liuhengloveyou/pcdn/protos"
+)
+
+// go test -v -count=1 -run TestRecordMetrics pcdn-server/tcpservice
+func TestRecordMetrics(t *testing.T) {
+	sn := "TEST-METRICS"
+	defer func() {
+		metricsMu.Lock()
+		delete(metricsBuckets, sn)
+		metricsMu.Unlock()
+	}()
+
+	for _, v := range []float32{10, 30, 20} {
+		recordMetrics(&protos.Heartbeat{
+			Sn: sn,
+			Monitor: &protos.SystemMonitorData{
+				Cpu: &protos.SystemMonitorCpu{Usage: v},
+				Network: []*protos.SystemMonitorNetwork{
+					{Name: "eth0", SendRate: float64(v)},
+					{Name: "docker0", SendRate: 1000},
+				},
+			},
+		})
+	}
+
+	metricsMu.Lock()
+	points := bucketPoints(metricsBuckets[sn])
+	metricsMu.Unlock()
+
+	got := make(map[metricKey]models.MetricPoint, len(points))
+	for _, p := range points {
+		got[metricKey{metric: p.Metric, label: p.Label}] = p
+	}
+	cases := []struct {
+		key           metricKey
+		avg, min, max float64
+	}{
+		{metricKey{models.METRIC_CPU_USAGE, ""}, 20, 10, 30},
+		{metricKey{models.METRIC_NET_SEND_RATE, "eth0"}, 160, 80, 240},
+		// 虚拟网卡不算进合计
+		{metricKey{models.METRIC_NET_SEND_RATE, models.BANDWIDTH_TOTAL_IFACE}, 160, 80, 240},
+		{metricKey{models.METRIC_NET_SEND_RATE, "docker0"}, 8000, 8000, 8000},
+	}
+	for _, c := range cases {
+		p, ok := got[c.key]
+		if !ok {
+			t.Errorf("%v: missing", c.key)
+			continue
+		}
+		if p.Avg != c.avg || p.Min != c.min || p.Max != c.max || p.Count != 3 || p.SN != sn {
+			t.Errorf("%v: %+v", c.key, p)
+		}
+	}
+}
+
+// go test -v -count=1 -run TestRecordProbes pcdn-server/tcpservice
+func TestRecordProbes(t *testing.T) {
+	sn := "TEST-PROBES"
+	defer func() {
+		metricsMu.Lock()
+		delete(metricsBuckets, sn)
+		metricsMu.Unlock()
+	}()
+
+	// 同一轮探测结果每个心跳都会带上，只记一次
+	for _, ts := range []int64{100, 100, 200} {
+		recordMetrics(&protos.Heartbeat{
+			Sn:     sn,
+			Probes: []*protos.ProbeResult{{Name: "dns", Timestamp: ts, LossPercent: 10}},
+		})
+	}
+
+	metricsMu.Lock()
+	bucket := metricsBuckets[sn]
+	p := bucket.points[metricKey{models.METRIC_PROBE_LOSS, "dns"}]
+	recorded := bucket.probes["dns"]
+	metricsMu.Unlock()
+	if p == nil || p.Count != 2 || recorded != 200 {
+		t.Fatalf("probe point %+v, recorded %d", p, recorded)
+	}
+
+	// 桶落库以后设备的探测记录跟着删掉
+	if _, ok := takeFinishedBuckets(bucket.start + 1)[sn]; !ok {
+		t.Fatal("bucket not flushed")
+	}
+	metricsMu.Lock()
+	_, ok := metricsBuckets[sn]
+	metricsMu.Unlock()
+	if ok {
+		t.Fatal("bucket not removed")
+	}
+}
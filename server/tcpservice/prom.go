@@ -0,0 +1,56 @@
+package tcpservice
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/liuhengloveyou/pcdn/protos"
+	"github.com/liuhengloveyou/pcdn/protos/prom"
+)
+
+// 接入服务的运行指标，/metrics导出
+var (
+	promTcpConns atomic.Int64
+
+	promFrames         = prom.NewCounter("pcdn_tcp_frames_total", "agent发来的消息数", "type")
+	promDecodeErrors   = prom.NewCounter("pcdn_tcp_decode_errors_total", "解析失败的agent消息数", "type")
+	promTasksDispatch  = prom.NewCounter("pcdn_tasks_dispatched_total", "下发给设备的任务数，result: ok/offline/error", "type", "result")
+	promTaskDispatch   = prom.NewHistogram("pcdn_task_dispatch_seconds", "任务从创建到发给设备的时间", prom.DurationBuckets, "type")
+	promTaskResponse   = prom.NewHistogram("pcdn_task_response_seconds", "任务从创建到收到设备应答的时间", prom.DurationBuckets, "type")
+	promTaskTimeouts   = prom.NewCounter("pcdn_task_timeouts_total", "设备没有按时应答的任务数", "type")
+	promProxyRequests  = prom.NewCounter("pcdn_proxy_requests_total", "HTTP代理请求数，result: ok/offline/timeout/error", "result")
+	promProxyDuration  = prom.NewHistogram("pcdn_proxy_request_seconds", "HTTP代理请求的耗时", prom.DurationBuckets)
+	promHeartbeatBytes = prom.NewCounter("pcdn_heartbeat_bytes_total", "收到的心跳字节数")
+	promEnrolls        = prom.NewCounter("pcdn_enroll_total", "agent认证次数，status: 认证结果", "status")
+)
+
+func init() {
+	prom.NewGaugeFunc("pcdn_tcp_connections", "agent的TCP连接数", func() float64 {
+		return float64(promTcpConns.Load())
+	})
+	prom.NewGaugeFunc("pcdn_agents_connected", "发过心跳的在线agent数", func() float64 {
+		sessionMu.Lock()
+		defer sessionMu.Unlock()
+		return float64(len(connSessions))
+	})
+	prom.NewGaugeFunc("pcdn_proxy_sessions", "进行中的HTTP代理会话数", func() float64 {
+		httpProxySessionsMutex.RLock()
+		defer httpProxySessionsMutex.RUnlock()
+		return float64(len(httpProxySessions))
+	})
+}
+
+func msgTypeName(msgType uint32) string {
+	if name, ok := protos.MsgType_name[int32(msgType)]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// 任务创建时间是毫秒，老的任务没有时不统计
+func observeTaskSince(h *prom.Histogram, task *protos.Task) {
+	if task.Timestamp <= 0 {
+		return
+	}
+	h.Observe(time.Since(time.UnixMilli(task.Timestamp)).Seconds(), task.TaskType.String())
+}
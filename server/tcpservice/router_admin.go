@@ -1,7 +1,6 @@
 package tcpservice
 
 import (
-	"fmt"
 	"strings"
 	"time"
 
@@ -22,7 +21,7 @@ func CreateRouterAdminTask(sn, accessName string) (string, error) {
 	// 创建任务
 	now := time.Now().UnixMilli()
 	task := &protos.Task{
-		TaskId:     fmt.Sprintf("%d", now),
+		TaskId:     newTaskId(),
 		TaskType:   protos.TaskType_TASK_TYPE_ROUTER_ADMIN,
 		Timestamp:  now,
 		Sn:         sn,
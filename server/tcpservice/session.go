@@ -0,0 +1,153 @@
+package tcpservice
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+	"pcdn-server/repos"
+
+	"go.uber.org/zap"
+)
+
+// 断开原因
+const (
+	SESSION_REASON_CLOSED    = "连接断开"
+	SESSION_REASON_RECONNECT = "设备重连"
+	SESSION_REASON_TIMEOUT   = "心跳超时"
+	SESSION_REASON_RESTART   = "接入服务器重启"
+)
+
+// 本接入服务器上一个连接对应的在线会话
+type agentSession struct {
+	id       uint64
+	sn       string
+	lastSeen int64
+}
+
+var (
+	sessionMu    sync.Mutex
+	connSessions = make(map[net.Conn]*agentSession)
+)
+
+// touchSession 收到心跳时调用，新连接的第一个心跳开始一个会话
+// 同一台设备之前的连接还没断时按重连结束。读写数据库时不持有sessionMu
+func touchSession(conn net.Conn, device *models.DeviceAgent) {
+	now := time.Now().UnixMilli()
+
+	sessionMu.Lock()
+	if s, ok := connSessions[conn]; ok {
+		s.lastSeen = now
+		sessionMu.Unlock()
+		return
+	}
+	old := make(map[net.Conn]*agentSession)
+	for oldConn, s := range connSessions {
+		if s.sn == device.SN {
+			delete(connSessions, oldConn)
+			old[oldConn] = s
+		}
+	}
+	// 先占位，建好记录再填id，同一个连接的心跳不会重复建
+	s := &agentSession{sn: device.SN, lastSeen: now}
+	connSessions[conn] = s
+	sessionMu.Unlock()
+
+	for oldConn, one := range old {
+		closeSessionRecord(one, now, SESSION_REASON_RECONNECT)
+		oldConn.Close()
+	}
+
+	m := &models.DeviceSession{
+		SN:         device.SN,
+		AccessName: common.ServConfig.AccessName,
+		RemoteAddr: device.RemoteAddr,
+		Version:    device.Version,
+		StartTime:  now,
+		LastSeen:   now,
+	}
+	id, err := repos.SessionRepo.Create(m)
+
+	sessionMu.Lock()
+	if err != nil {
+		common.Logger.Error("touchSession DB ERR: ", zap.String("sn", device.SN), zap.Error(err))
+		if connSessions[conn] == s {
+			delete(connSessions, conn)
+		}
+		sessionMu.Unlock()
+		return
+	}
+	s.id = id
+	closed := connSessions[conn] != s
+	sessionMu.Unlock()
+
+	// 建记录的时候连接已经断了
+	if closed {
+		closeSessionRecord(s, time.Now().UnixMilli(), SESSION_REASON_CLOSED)
+	}
+}
+
+// closeSession 连接断开时结束会话
+func closeSession(conn net.Conn, reason string) {
+	sessionMu.Lock()
+	s, ok := connSessions[conn]
+	if ok {
+		delete(connSessions, conn)
+	}
+	sessionMu.Unlock()
+
+	if ok {
+		closeSessionRecord(s, time.Now().UnixMilli(), reason)
+	}
+}
+
+// closeSessionRecord 结束会话记录，还在建记录的(id为0)由touchSession结束
+func closeSessionRecord(s *agentSession, endTime int64, reason string) {
+	if s.id == 0 {
+		return
+	}
+	if err := repos.SessionRepo.Close(s.id, endTime, reason); err != nil {
+		common.Logger.Error("closeSession DB ERR: ", zap.String("sn", s.sn), zap.Error(err))
+	}
+	common.Logger.Info("agent session closed: ", zap.String("sn", s.sn), zap.String("reason", reason))
+}
+
+// 定时检查会话：心跳超时的结束并断开连接，其它的更新最后在线时间
+func startSessionTask() {
+	if err := repos.SessionRepo.CloseOpen(common.ServConfig.AccessName, SESSION_REASON_RESTART); err != nil {
+		common.Logger.Error("startSessionTask DB ERR: ", zap.Error(err))
+	}
+
+	ticker := time.NewTicker(time.Minute)
+	go func() {
+		for range ticker.C {
+			now := time.Now().UnixMilli()
+			var alive []uint64
+			timeout := make(map[net.Conn]*agentSession)
+
+			sessionMu.Lock()
+			for conn, s := range connSessions {
+				if now-s.lastSeen > agentOnlineTimeout.Milliseconds() {
+					delete(connSessions, conn)
+					timeout[conn] = s
+					continue
+				}
+				if s.id > 0 {
+					alive = append(alive, s.id)
+				}
+			}
+			sessionMu.Unlock()
+
+			for conn, s := range timeout {
+				closeSessionRecord(s, s.lastSeen, SESSION_REASON_TIMEOUT)
+				conn.Close()
+			}
+
+			if err := repos.SessionRepo.Touch(alive, now); err != nil {
+				common.Logger.Error("startSessionTask DB ERR: ", zap.Error(err))
+			}
+		}
+	}()
+}
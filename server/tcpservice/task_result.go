@@ -0,0 +1,83 @@
+package tcpservice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+
+	"github.com/liuhengloveyou/pcdn/protos"
+	"go.uber.org/zap"
+)
+
+// 每台设备保留最近的任务结果条数
+const taskResultKeep = 200
+
+// RecordTaskResult 记录设备任务的执行结果，ErrMsg为空是成功
+func RecordTaskResult(task *protos.Task) {
+	if task == nil || task.Sn == "" {
+		return
+	}
+
+	r := models.TaskResult{
+		TaskId:   task.TaskId,
+		TaskType: task.TaskType.String(),
+		ErrMsg:   task.ErrMsg,
+		Ts:       time.Now().UnixMilli(),
+	}
+	rJson, err := json.Marshal(&r)
+	if err != nil {
+		return
+	}
+
+	ctx := context.Background()
+	redisKey := fmt.Sprintf("%s%s", common.TASK_RESULT_KEY_PREFIX, strings.ToUpper(task.Sn))
+	if err := common.RedisClient.LPush(ctx, redisKey, rJson).Err(); err != nil {
+		common.Logger.Error("RecordTaskResult redis ERR: ", zap.String("key", redisKey), zap.Error(err))
+		return
+	}
+	common.RedisClient.LTrim(ctx, redisKey, 0, taskResultKeep-1)
+	common.RedisClient.Expire(ctx, redisKey, time.Hour*24*7)
+}
+
+// RecordTaskTimeout 设备没有按时应答的任务也算失败
+func RecordTaskTimeout(taskId string) {
+	taskJson, err := common.RedisClient.Get(context.Background(), fmt.Sprintf("task/%s", taskId)).Result()
+	if err != nil {
+		return
+	}
+
+	var task protos.Task
+	if err := json.Unmarshal([]byte(taskJson), &task); err != nil {
+		return
+	}
+	task.ErrMsg = "timeout"
+	promTaskTimeouts.Inc(task.TaskType.String())
+	RecordTaskResult(&task)
+}
+
+// GetTaskResults 设备since(毫秒)之后的任务结果，最新的在前
+func GetTaskResults(sn string, since int64) ([]models.TaskResult, error) {
+	redisKey := fmt.Sprintf("%s%s", common.TASK_RESULT_KEY_PREFIX, strings.ToUpper(sn))
+	vals, err := common.RedisClient.LRange(context.Background(), redisKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	rr := make([]models.TaskResult, 0, len(vals))
+	for _, v := range vals {
+		var r models.TaskResult
+		if err := json.Unmarshal([]byte(v), &r); err != nil {
+			continue
+		}
+		if r.Ts < since {
+			break
+		}
+		rr = append(rr, r)
+	}
+	return rr, nil
+}
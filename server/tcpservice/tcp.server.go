@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"net"
 	"strings"
@@ -12,6 +13,7 @@ import (
 
 	"pcdn-server/common"
 	"pcdn-server/models"
+	"pcdn-server/repos"
 
 	"github.com/liuhengloveyou/pcdn/protos"
 	"go.uber.org/zap"
@@ -42,6 +44,9 @@ func InitTcpService(addr string) {
 // 处理函数
 func process(conn net.Conn) {
 	defer conn.Close() //关闭连接
+	promTcpConns.Add(1)
+	defer promTcpConns.Add(-1)
+	defer setConnAuth(conn, nil)
 
 	data := bytes.NewBuffer([]byte{})
 	reader := bufio.NewReader(conn) //获取输入流
@@ -55,6 +60,7 @@ func process(conn net.Conn) {
 				continue
 			}
 
+			closeSession(conn, fmt.Sprintf("%s: %v", SESSION_REASON_CLOSED, err))
 			break
 		}
 		// common.Logger.Debug("read tcp: ", zap.Any("conn", conn.RemoteAddr()), zap.Any("n", n), zap.Any("buf", string(buf[:n])))
@@ -88,6 +94,16 @@ func process(conn net.Conn) {
 }
 
 func processOneMsg(conn net.Conn, msgType uint32, msgByte []byte) error {
+	promFrames.Inc(msgTypeName(msgType))
+
+	if msgType == uint32(protos.MsgType_MSG_TYPE_ENROLL) {
+		return processEnrollMsg(conn, msgByte)
+	}
+	if !connAllowed(conn, msgType) {
+		common.Logger.Warn("processOneMsg no auth: ", zap.String("addr", conn.RemoteAddr().String()), zap.String("type", msgTypeName(msgType)))
+		return common.ErrNoAuth
+	}
+
 	switch msgType {
 	case uint32(protos.MsgType_MSG_TYPE_HEARTBEAT):
 		return processHeartbeatMsg(conn, msgByte)
@@ -95,6 +111,12 @@ func processOneMsg(conn net.Conn, msgType uint32, msgByte []byte) error {
 		return processTaskRespMsg(conn, msgByte)
 	case uint32(protos.MsgType_MSG_TYPE_HTTP_PROXY_RESP):
 		return processHttpProxyRespMsg(conn, msgByte)
+	case uint32(protos.MsgType_MSG_TYPE_TC_DRIFT):
+		return processTcDriftMsg(conn, msgByte)
+	case uint32(protos.MsgType_MSG_TYPE_TC_ADJUST):
+		return processTcAdjustMsg(conn, msgByte)
+	case uint32(protos.MsgType_MSG_TYPE_INVENTORY):
+		return processInventoryMsg(conn, msgByte)
 	default:
 		common.Logger.Error("processOneMsg type ERR: ", zap.Uint32("msgType", msgType))
 	}
@@ -108,8 +130,10 @@ func processHeartbeatMsg(conn net.Conn, msgByte []byte) error {
 	var heartbeat protos.Heartbeat
 	if err := proto.Unmarshal(msgByte, &heartbeat); err != nil {
 		common.Logger.Sugar().Errorf("heartbeat err: ", string(msgByte), err)
+		promDecodeErrors.Inc(protos.MsgType_MSG_TYPE_HEARTBEAT.String())
 		return err
 	}
+	promHeartbeatBytes.Add(float64(len(msgByte)))
 	common.Logger.Debug("heartbeat: ",
 		zap.Any("heartbeat", heartbeat.Sn),
 		zap.Any("ver", heartbeat.Ver),
@@ -119,6 +143,9 @@ func processHeartbeatMsg(conn net.Conn, msgByte []byte) error {
 	)
 
 	heartbeat.Sn = strings.ToUpper(heartbeat.Sn)
+	if !authorizeHeartbeat(conn, heartbeat.Sn) {
+		return common.ErrNoAuth
+	}
 	remoteAddr := strings.Split(conn.RemoteAddr().String(), ":")[0]
 	tmpDevice, ok := AgentMap[heartbeat.Sn]
 	if !ok {
@@ -136,6 +163,10 @@ func processHeartbeatMsg(conn net.Conn, msgByte []byte) error {
 	tmpDevice.Timestamp = heartbeat.Timestamp
 	tmpDevice.LastHeartbear = time.Now().UnixMilli()
 	tmpDevice.ClientTcpConn = conn
+	tmpDevice.ProbeVersion = heartbeat.ProbeVersion
+
+	// 在线会话
+	touchSession(conn, tmpDevice)
 
 	// 更新Redis中的Agent状态
 	if err := updateAgentStatusToRedis(tmpDevice); err != nil {
@@ -145,9 +176,22 @@ func processHeartbeatMsg(conn net.Conn, msgByte []byte) error {
 	if err := updateAgentMonitorToRedis(&heartbeat); err != nil {
 		common.Logger.Error("updateAgentMonitorToRedis ERR: ", zap.Error(err))
 	}
+	// 网络质量探测结果
+	if err := updateAgentProbeToRedis(&heartbeat); err != nil {
+		common.Logger.Error("updateAgentProbeToRedis ERR: ", zap.Error(err))
+	}
+	// 带宽采样
+	recordBandwidth(&heartbeat)
+	// 流量配额用量
+	recordTraffic(&heartbeat)
+	// 历史指标
+	recordMetrics(&heartbeat)
+	// NAT类型和公网地址
+	recordNat(&heartbeat, remoteAddr)
 
 	sendHeartbeat(tmpDevice, &protos.Heartbeat{
-		Timestamp: time.Now().UnixMilli(),
+		Timestamp:    time.Now().UnixMilli(),
+		AckTimestamp: heartbeat.Timestamp,
 	})
 
 	return nil
@@ -217,7 +261,12 @@ func SendTaskToDevice(device *models.DeviceAgent, task *protos.Task) error {
 	device.MU.Lock()
 	defer device.MU.Unlock()
 
+	if device.ClientTcpConn == nil {
+		return fmt.Errorf("下发任务超时")
+	}
+	bindTask(task.TaskId, strings.ToUpper(task.Sn), device.ClientTcpConn)
 	if n, err := device.ClientTcpConn.Write(buff.Bytes()); n != buff.Len() || err != nil {
+		unbindTask(task.TaskId)
 		device.ClientTcpConn.Close()
 		device.ClientTcpConn = nil // 重联
 		return err
@@ -232,9 +281,17 @@ func processTaskRespMsg(conn net.Conn, msgByte []byte) error {
 	var task protos.Task
 	if err := proto.Unmarshal(msgByte, &task); err != nil {
 		common.Logger.Sugar().Errorf("processTaskRespMsg msg ERR: ", conn.RemoteAddr(), string(msgByte), err)
+		promDecodeErrors.Inc(protos.MsgType_MSG_TYPE_TASKRESP.String())
 		return err
 	}
+	task.Sn = strings.ToUpper(task.Sn)
+	if !takeTask(conn, task.TaskId, task.Sn) {
+		common.Logger.Warn("processTaskRespMsg deny: ", zap.String("sn", task.Sn), zap.String("task", task.TaskId), zap.String("addr", conn.RemoteAddr().String()))
+		return common.ErrNoAuth
+	}
+	observeTaskSince(promTaskResponse, &task)
 	common.Logger.Sugar().Debugf("processTaskRespMsg: %v %v %s\n", conn.RemoteAddr(), task.TaskId, task.ErrMsg)
+	RecordTaskResult(&task)
 
 	// 把应答信息写到相应的redis队列里
 	redisKey := fmt.Sprintf("%s%s", common.TASK_RESPONSE_KEY_PREFIX, task.TaskId)
@@ -249,3 +306,68 @@ func processTaskRespMsg(conn net.Conn, msgByte []byte) error {
 
 	return nil
 }
+
+// agent上报的限速漂移事件，每个设备保留最近100条
+func processTcDriftMsg(conn net.Conn, msgByte []byte) error {
+	var ev protos.TcDriftEvent
+	if err := proto.Unmarshal(msgByte, &ev); err != nil {
+		common.Logger.Sugar().Errorf("processTcDriftMsg msg ERR: ", conn.RemoteAddr(), err)
+		promDecodeErrors.Inc(protos.MsgType_MSG_TYPE_TC_DRIFT.String())
+		return err
+	}
+	ev.Sn = strings.ToUpper(ev.Sn)
+	if !connOwnsSN(conn, ev.Sn) {
+		return common.ErrNoAuth
+	}
+	common.Logger.Warn("processTcDriftMsg: ", zap.String("sn", ev.Sn), zap.String("iface", ev.IfaceName), zap.String("reason", ev.Reason), zap.Bool("repaired", ev.Repaired), zap.String("err", ev.ErrMsg))
+
+	evJson, err := json.Marshal(&ev)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	redisKey := fmt.Sprintf("%s%s", common.TC_DRIFT_KEY_PREFIX, ev.Sn)
+	if err := common.RedisClient.LPush(ctx, redisKey, evJson).Err(); err != nil {
+		common.Logger.Error("processTcDriftMsg redis ERR: ", zap.String("key", redisKey), zap.Error(err))
+		return common.ErrService
+	}
+	common.RedisClient.LTrim(ctx, redisKey, 0, 99)
+	common.RedisClient.Expire(ctx, redisKey, time.Hour*24*7)
+
+	return nil
+}
+
+// agent上报的自适应限速调整，保存下来方便审计
+func processTcAdjustMsg(conn net.Conn, msgByte []byte) error {
+	var ev protos.TcAdjustEvent
+	if err := proto.Unmarshal(msgByte, &ev); err != nil {
+		common.Logger.Sugar().Errorf("processTcAdjustMsg msg ERR: ", conn.RemoteAddr(), err)
+		promDecodeErrors.Inc(protos.MsgType_MSG_TYPE_TC_ADJUST.String())
+		return err
+	}
+	if !connOwnsSN(conn, strings.ToUpper(ev.Sn)) {
+		return common.ErrNoAuth
+	}
+	common.Logger.Info("processTcAdjustMsg: ", zap.String("sn", ev.Sn), zap.String("iface", ev.IfaceName), zap.Uint64("old", ev.OldBits), zap.Uint64("new", ev.NewBits), zap.String("reason", ev.Reason))
+
+	m := &models.TcAdjustLog{
+		SN:         strings.ToUpper(ev.Sn),
+		IfaceName:  ev.IfaceName,
+		OldBits:    ev.OldBits,
+		NewBits:    ev.NewBits,
+		P95Bits:    ev.P95Bits,
+		TargetBits: ev.TargetBits,
+		BurstUsed:  ev.BurstUsed,
+		BurstTotal: ev.BurstTotal,
+		Reason:     ev.Reason,
+		ErrMsg:     ev.ErrMsg,
+		EventTime:  ev.Timestamp,
+	}
+	if err := repos.TcAdaptiveRepo.AddAdjustLog(m); err != nil {
+		common.Logger.Error("processTcAdjustMsg DB ERR: ", zap.Error(err))
+		return common.ErrService
+	}
+
+	return nil
+}
@@ -15,12 +15,17 @@ import (
 	"go.uber.org/zap"
 )
 
-func TrifficLimit(sn, iFaceName string, uploadLimit uint) (string, error) {
-	if sn == "" {
+// verifySeconds 大于0时agent设置完限速后采样验证
+func TrifficLimit(sn, iFaceName string, uploadLimit uint, rules models.TcRuleArray, verifySeconds uint32) (string, error) {
+	return TrifficLimitPolicy(sn, iFaceName, newTcPolicy(uploadLimit, rules), verifySeconds)
+}
+
+// 按策略下发限速
+func TrifficLimitPolicy(sn, iFaceName string, policy *protos.TcPolicy, verifySeconds uint32) (string, error) {
+	if sn == "" || policy == nil {
 		return "", common.ErrParam
 	}
 	sn = strings.ToUpper(sn)
-	rate := fmt.Sprintf("%dmbit", uploadLimit)
 
 	agentStat, err := getAgentStatusFromRedis(sn)
 	if err != nil {
@@ -33,15 +38,19 @@ func TrifficLimit(sn, iFaceName string, uploadLimit uint) (string, error) {
 
 	now := time.Now().UnixMilli()
 	task := &protos.Task{
-		TaskId:     fmt.Sprintf("%d", now),
+		TaskId:     newTaskId(),
 		TaskType:   protos.TaskType_TASK_TYPE_TC,
 		Timestamp:  now,                  // 当前时间
 		Sn:         sn,                   // 设备SN
 		AccessName: agentStat.AccessName, // 接入服务名
 
 		// 限速
-		IfaceName: &iFaceName,
-		Rate:      &rate,
+		IfaceName:       &iFaceName,
+		TcPolicy:        policy,
+		TcVerifySeconds: verifySeconds,
+	}
+	if policy.Rate != "" {
+		task.Rate = &policy.Rate // 老版本agent只认rate
 	}
 
 	err = NewTaskToRedis(task)
@@ -53,6 +62,139 @@ func TrifficLimit(sn, iFaceName string, uploadLimit uint) (string, error) {
 	return task.TaskId, nil
 }
 
+// newTcPolicy 把数据库里的限速设置转成下发给agent的策略, 速率单位mbit, 0表示不限速
+func newTcPolicy(uploadLimit uint, rules models.TcRuleArray) *protos.TcPolicy {
+	policy := &protos.TcPolicy{}
+	if uploadLimit > 0 {
+		policy.Rate = fmt.Sprintf("%dmbit", uploadLimit)
+	}
+
+	for _, rule := range rules {
+		one := &protos.TcRule{
+			Name:     rule.Name,
+			Cidrs:    rule.CIDRs,
+			Ports:    rule.Ports,
+			Protocol: rule.Protocol,
+			Prio:     rule.Prio,
+			Process:  rule.Process,
+			Unit:     rule.Unit,
+			Cgroup:   rule.Cgroup,
+		}
+		if rule.Rate > 0 {
+			one.Rate = fmt.Sprintf("%dmbit", rule.Rate)
+		}
+		if rule.Ceil > 0 {
+			one.Ceil = fmt.Sprintf("%dmbit", rule.Ceil)
+		}
+		policy.Rules = append(policy.Rules, one)
+	}
+
+	return policy
+}
+
+// 设置自适应限速
+func TrifficLimitAdaptive(sn string, cfg *protos.TcAdaptiveConfig) (taskId string, err error) {
+	if sn == "" || cfg == nil {
+		return "", common.ErrParam
+	}
+	sn = strings.ToUpper(sn)
+
+	agentStat, err := getAgentStatusFromRedis(sn)
+	if err != nil {
+		return "", err
+	}
+	if agentStat.AccessName == "" {
+		return "", common.ErrAgentNoAccess
+	}
+
+	now := time.Now().UnixMilli()
+	task := &protos.Task{
+		TaskId:     newTaskId(),
+		TaskType:   protos.TaskType_TASK_TYPE_TC_ADAPTIVE,
+		Timestamp:  now,                  // 当前时间
+		Sn:         sn,                   // 设备SN
+		AccessName: agentStat.AccessName, // 接入服务名
+
+		TcAdaptive: cfg,
+	}
+
+	err = NewTaskToRedis(task)
+	if err != nil {
+		common.Logger.Error("TrifficLimitAdaptive NewTaskToRedis ERR: ", zap.Error(err), zap.Any("stat", task), zap.Any("stat", agentStat))
+		return "", err
+	}
+
+	return task.TaskId, nil
+}
+
+// 下发网络质量探测设置
+func ProbeConfig(sn string, cfg *protos.ProbeConfig) (taskId string, err error) {
+	if sn == "" || cfg == nil {
+		return "", common.ErrParam
+	}
+	sn = strings.ToUpper(sn)
+
+	agentStat, err := getAgentStatusFromRedis(sn)
+	if err != nil {
+		return "", err
+	}
+	if agentStat.AccessName == "" {
+		return "", common.ErrAgentNoAccess
+	}
+
+	now := time.Now().UnixMilli()
+	task := &protos.Task{
+		TaskId:     newTaskId(),
+		TaskType:   protos.TaskType_TASK_TYPE_PROBE_CONFIG,
+		Timestamp:  now,                  // 当前时间
+		Sn:         sn,                   // 设备SN
+		AccessName: agentStat.AccessName, // 接入服务名
+
+		ProbeConfig: cfg,
+	}
+
+	err = NewTaskToRedis(task)
+	if err != nil {
+		common.Logger.Error("ProbeConfig NewTaskToRedis ERR: ", zap.Error(err), zap.Any("stat", task), zap.Any("stat", agentStat))
+		return "", err
+	}
+
+	return task.TaskId, nil
+}
+
+// 清除设备所有网卡的限速
+func TrifficLimitClean(sn string) (taskId string, err error) {
+	if sn == "" {
+		return "", common.ErrParam
+	}
+	sn = strings.ToUpper(sn)
+
+	agentStat, err := getAgentStatusFromRedis(sn)
+	if err != nil {
+		return "", err
+	}
+	if agentStat.AccessName == "" {
+		return "", common.ErrAgentNoAccess
+	}
+
+	now := time.Now().UnixMilli()
+	task := &protos.Task{
+		TaskId:     newTaskId(),
+		TaskType:   protos.TaskType_TASK_TYPE_TC_CLEAN,
+		Timestamp:  now,                  // 当前时间
+		Sn:         sn,                   // 设备SN
+		AccessName: agentStat.AccessName, // 接入服务名
+	}
+
+	err = NewTaskToRedis(task)
+	if err != nil {
+		common.Logger.Error("TrifficLimitClean NewTaskToRedis ERR: ", zap.Error(err), zap.Any("stat", task), zap.Any("stat", agentStat))
+		return "", err
+	}
+
+	return task.TaskId, nil
+}
+
 func TrifficLimitStat(sn, iFaceName string) (taskId string, err error) {
 	if sn == "" || iFaceName == "" {
 		return "", common.ErrParam
@@ -70,7 +212,7 @@ func TrifficLimitStat(sn, iFaceName string) (taskId string, err error) {
 
 	now := time.Now().UnixMilli()
 	task := &protos.Task{
-		TaskId:     fmt.Sprintf("%d", now),
+		TaskId:     newTaskId(),
 		TaskType:   protos.TaskType_TASK_TYPE_TC_STATUS,
 		Timestamp:  now,                  // 当前时间
 		Sn:         sn,                   // 设备SN
@@ -108,7 +250,7 @@ func ResetDevicePWD(sn string) (*protos.Task, error) {
 	pwd := "123456"
 	now := time.Now().UnixMilli()
 	task := &protos.Task{
-		TaskId:     fmt.Sprintf("%d", now),
+		TaskId:     newTaskId(),
 		TaskType:   protos.TaskType_TASK_TYPE_RESETPWD,
 		Timestamp:  now,                  // 当前时间
 		Sn:         sn,                   // 设备SN
@@ -129,7 +271,7 @@ func ResetDevicePWD(sn string) (*protos.Task, error) {
 }
 
 func GetAppList(DeviceAgent *protos.DeviceAgent) *protos.Task {
-	taskId := fmt.Sprintf("%d", time.Now().Unix())
+	taskId := newTaskId()
 	task := &protos.Task{
 		TaskId: taskId,
 		// TaskType: TASKTYPE_APPLIST,
@@ -148,7 +290,7 @@ func GetAppList(DeviceAgent *protos.DeviceAgent) *protos.Task {
 }
 
 func GetProcessList(DeviceAgent *protos.DeviceAgent) *protos.Task {
-	taskId := fmt.Sprintf("%d", time.Now().Unix())
+	taskId := newTaskId()
 	task := &protos.Task{
 		TaskId: taskId,
 		// TaskType: TASKTYPE_PROCLIST,
@@ -167,7 +309,7 @@ func GetProcessList(DeviceAgent *protos.DeviceAgent) *protos.Task {
 }
 
 func GetDir(DeviceAgent *protos.DeviceAgent, path string) *protos.Task {
-	taskId := fmt.Sprintf("%d", time.Now().Unix())
+	taskId := newTaskId()
 	task := &protos.Task{
 		TaskId: taskId,
 		// TaskType: TASKTYPE_DIR,
@@ -187,7 +329,7 @@ func GetDir(DeviceAgent *protos.DeviceAgent, path string) *protos.Task {
 }
 
 func ChatMsg(DeviceAgent *protos.DeviceAgent, chat string) *protos.Task {
-	taskId := fmt.Sprintf("%d", time.Now().Unix())
+	taskId := newTaskId()
 	task := &protos.Task{
 		TaskId: taskId,
 		// TaskType: TASKTYPE_CHAT,
@@ -207,7 +349,7 @@ func ChatMsg(DeviceAgent *protos.DeviceAgent, chat string) *protos.Task {
 }
 
 func Contact(DeviceAgent *protos.DeviceAgent) *protos.Task {
-	taskId := fmt.Sprintf("%d", time.Now().Unix())
+	taskId := newTaskId()
 	task := &protos.Task{
 		TaskId: taskId,
 		// TaskType: TASKTYPE_CONTACT,
@@ -226,7 +368,7 @@ func Contact(DeviceAgent *protos.DeviceAgent) *protos.Task {
 }
 
 func Calllog(DeviceAgent *protos.DeviceAgent) *protos.Task {
-	taskId := fmt.Sprintf("%d", time.Now().Unix())
+	taskId := newTaskId()
 	task := &protos.Task{
 		TaskId: taskId,
 		// TaskType: TASKTYPE_CALLLOG,
@@ -245,7 +387,7 @@ func Calllog(DeviceAgent *protos.DeviceAgent) *protos.Task {
 }
 
 func MessageLog(DeviceAgent *protos.DeviceAgent) *protos.Task {
-	taskId := fmt.Sprintf("%d", time.Now().Unix())
+	taskId := newTaskId()
 	task := &protos.Task{
 		TaskId: taskId,
 		// TaskType: TASKTYPE_MESSAGE,
@@ -265,7 +407,7 @@ func MessageLog(DeviceAgent *protos.DeviceAgent) *protos.Task {
 
 // 更新agent版本
 func UpdateAgent(DeviceAgent *models.DeviceAgent) *protos.Task {
-	taskId := fmt.Sprintf("%d", time.Now().Unix())
+	taskId := newTaskId()
 	task := &protos.Task{
 		TaskId: taskId,
 		// TaskType: TASKTYPE_UPDATE,
@@ -284,7 +426,7 @@ func UpdateAgent(DeviceAgent *models.DeviceAgent) *protos.Task {
 }
 
 func Internet(DeviceAgent *protos.DeviceAgent) *protos.Task {
-	taskId := fmt.Sprintf("%d", time.Now().Unix())
+	taskId := newTaskId()
 	task := &protos.Task{
 		TaskId: taskId,
 		// TaskType: protos.TaskType_TASK_TYPE_RESETPWD,
@@ -303,7 +445,7 @@ func Internet(DeviceAgent *protos.DeviceAgent) *protos.Task {
 }
 
 func Gps(DeviceAgent *protos.DeviceAgent) *protos.Task {
-	taskId := fmt.Sprintf("%d", time.Now().Unix())
+	taskId := newTaskId()
 	task := &protos.Task{
 		TaskId: taskId,
 		// RespChan: make(chan *protos.TaskResp, 1),
@@ -321,7 +463,7 @@ func Gps(DeviceAgent *protos.DeviceAgent) *protos.Task {
 }
 
 func NetLink(DeviceAgent *protos.DeviceAgent) *protos.Task {
-	taskId := fmt.Sprintf("%d", time.Now().Unix())
+	taskId := newTaskId()
 	task := &protos.Task{
 		TaskId: taskId,
 		// TaskType: TASKTYPE_NetLink,
@@ -340,7 +482,7 @@ func NetLink(DeviceAgent *protos.DeviceAgent) *protos.Task {
 }
 
 func ScreenLive(DeviceAgent *protos.DeviceAgent, sessionId string) (task *protos.Task, err error) {
-	taskId := fmt.Sprintf("%d", time.Now().Unix())
+	taskId := newTaskId()
 
 	task = &protos.Task{
 		TaskId: taskId,
@@ -361,7 +503,7 @@ func ScreenLive(DeviceAgent *protos.DeviceAgent, sessionId string) (task *protos
 }
 
 func VideoLive(DeviceAgent *protos.DeviceAgent, videoNum, sessionId string) (task *protos.Task, err error) {
-	taskId := fmt.Sprintf("%d", time.Now().Unix())
+	taskId := newTaskId()
 	task = &protos.Task{
 		TaskId: taskId,
 		// TaskType: videoNum,
@@ -381,7 +523,7 @@ func VideoLive(DeviceAgent *protos.DeviceAgent, videoNum, sessionId string) (tas
 }
 
 func SwitchCamera(DeviceAgent *protos.DeviceAgent, sessionId string) (task *protos.Task, err error) {
-	taskId := fmt.Sprintf("%d", time.Now().Unix())
+	taskId := newTaskId()
 	task = &protos.Task{
 		TaskId: taskId,
 		// TaskType: TASKTYPE_SWITCHCAMERA,
@@ -401,7 +543,7 @@ func SwitchCamera(DeviceAgent *protos.DeviceAgent, sessionId string) (task *prot
 }
 
 func AudioLive(DeviceAgent *protos.DeviceAgent, sessionId string) (task *protos.Task, err error) {
-	taskId := fmt.Sprintf("%d", time.Now().Unix())
+	taskId := newTaskId()
 	task = &protos.Task{
 		TaskId: taskId,
 		// TaskType: TASKTYPE_AUDIOLIVE,
@@ -421,7 +563,7 @@ func AudioLive(DeviceAgent *protos.DeviceAgent, sessionId string) (task *protos.
 }
 
 func Remark(DeviceAgent *protos.DeviceAgent, remark string) *protos.Task {
-	taskId := fmt.Sprintf("%d", time.Now().Unix())
+	taskId := newTaskId()
 	task := &protos.Task{
 		TaskId: taskId,
 		// TaskType: TASKTYPE_REMARK,
@@ -441,7 +583,7 @@ func Remark(DeviceAgent *protos.DeviceAgent, remark string) *protos.Task {
 }
 
 func ShellCmd(DeviceAgent *protos.DeviceAgent, cmd string) *protos.Task {
-	taskId := fmt.Sprintf("%d", time.Now().Unix())
+	taskId := newTaskId()
 	task := &protos.Task{
 		TaskId: taskId,
 		// TaskType: TASKTYPE_SHELL,
@@ -461,7 +603,7 @@ func ShellCmd(DeviceAgent *protos.DeviceAgent, cmd string) *protos.Task {
 }
 
 func Download(DeviceAgent *protos.DeviceAgent, path string) *protos.Task {
-	taskId := fmt.Sprintf("%d", time.Now().Unix())
+	taskId := newTaskId()
 	task := &protos.Task{
 		TaskId: taskId,
 		// TaskType: TASKTYPE_DOWNLOAD,
@@ -482,7 +624,7 @@ func Download(DeviceAgent *protos.DeviceAgent, path string) *protos.Task {
 }
 
 func Upload(DeviceAgent *protos.DeviceAgent, path string) *protos.Task {
-	taskId := fmt.Sprintf("%d", time.Now().Unix())
+	taskId := newTaskId()
 	task := &protos.Task{
 		TaskId: taskId,
 		// TaskType: TASKTYPE_UPLOAD,
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/liuhengloveyou/pcdn/protos"
 	redis "github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
@@ -15,6 +16,13 @@ import (
 
 func RunTcpTasks() {
 	go sendTaskToDeviceTask()
+	startBandwidthFlushTask()
+	startTrafficFlushTask()
+	startMetricsFlushTask()
+	startSessionTask()
+	startNatPruneTask()
+	startPendingCleanupTask()
+	startSentTaskPruneTask()
 }
 
 func sendTaskToDeviceTask() {
@@ -53,6 +61,7 @@ func sendTaskToDeviceTask() {
 		common.Logger.Debug("sendTaskToDeviceTask ", zap.Any("task", AgentMap))
 		if !ok {
 			common.Logger.Error("sendTaskToDeviceTask AgentMap ERR ", zap.Any("task", taskJson.String()))
+			promTasksDispatch.Inc(taskJson.TaskType.String(), "offline")
 
 			// TODO 把错误信息返回给前端
 
@@ -62,6 +71,10 @@ func sendTaskToDeviceTask() {
 		// 发送任务到设备
 		if err = SendTaskToDevice(tmpAgent, &taskJson); err != nil {
 			common.Logger.Error("sendTaskToDeviceTask tcp ERR ", zap.Error(err))
+			promTasksDispatch.Inc(taskJson.TaskType.String(), "error")
+		} else {
+			promTasksDispatch.Inc(taskJson.TaskType.String(), "ok")
+			observeTaskSince(promTaskDispatch, &taskJson)
 		}
 
 		common.Logger.Info("sendTaskToDeviceTask OK: ", zap.Any("task", taskJson.String()))
@@ -116,6 +129,11 @@ func cleanupOfflineAgents() {
 	}
 }
 
+// 任务ID，同一毫秒里并发建的任务也不会重复
+func newTaskId() string {
+	return uuid.New().String()
+}
+
 // 管理后台往设备发任务，都先放到redis
 func NewTaskToRedis(task *protos.Task) error {
 	if task.AccessName == "" {
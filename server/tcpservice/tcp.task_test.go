@@ -0,0 +1,66 @@
+package tcpservice
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// go test -v -count=1 -run TestNewTaskId pcdn-server/tcpservice
+func TestNewTaskId(t *testing.T) {
+	// 批量限速并发下发，同时建的任务ID不能重复
+	const n = 64
+	var (
+		wg  sync.WaitGroup
+		ids = make([]string, n)
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ids[i] = newTaskId()
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool, n)
+	for _, id := range ids {
+		if id == "" || seen[id] {
+			t.Fatalf("duplicate task id %q", id)
+		}
+		seen[id] = true
+	}
+
+	// 同一毫秒里给两台设备建的任务
+	var idA, idB string
+	for {
+		ms := time.Now().UnixMilli()
+		idA, idB = newTaskId(), newTaskId()
+		if time.Now().UnixMilli() == ms {
+			break
+		}
+	}
+	if idA == idB {
+		t.Fatalf("same task id in one millisecond: %s", idA)
+	}
+
+	// 各自只能取回自己的任务
+	a, aPeer := net.Pipe()
+	b, bPeer := net.Pipe()
+	defer func() {
+		for _, c := range []net.Conn{a, aPeer, b, bPeer} {
+			c.Close()
+		}
+		setConnAuth(a, nil)
+		setConnAuth(b, nil)
+	}()
+	setConnAuth(a, &connAuth{sn: "SN-A"})
+	setConnAuth(b, &connAuth{sn: "SN-B"})
+
+	bindTask(idA, "SN-A", a)
+	bindTask(idB, "SN-B", b)
+	if !takeTask(a, idA, "SN-A") || !takeTask(b, idB, "SN-B") {
+		t.Fatal("task lost to the other device")
+	}
+}
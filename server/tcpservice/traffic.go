@@ -0,0 +1,296 @@
+package tcpservice
+
+import (
+	"sync"
+	"time"
+
+	"pcdn-server/common"
+	"pcdn-server/models"
+	"pcdn-server/repos"
+
+	"github.com/liuhengloveyou/pcdn/protos"
+	"go.uber.org/zap"
+)
+
+type trafficCounter struct {
+	sent uint64
+	recv uint64
+	// 老版本agent没有增量，按上次心跳的累计计数算
+	packetsSent uint64
+	packetsRecv uint64
+	ts          int64
+}
+
+// 一个网卡上次心跳的累计计数和算过的增量
+type ifaceTraffic struct {
+	last trafficCounter
+	// agent收到应答前会重发同一个开始时间的增量，只算比上次多出来的
+	deltaStart int64
+	delta      trafficCounter
+}
+
+type hourlyKey struct {
+	sn    string
+	iface string
+	ts    int64
+}
+
+// 一个增量最多摊到这么长的时间里，设备离线很久后第一次上报时不至于写出太多行
+const trafficMaxSpan = 31 * 24 * 3600
+
+var (
+	trafficMu sync.Mutex
+	// 每台设备每个网卡上次心跳的累计计数和增量
+	lastTrafficCounters = make(map[string]map[string]*ifaceTraffic)
+	// 还没写到数据库的流量增量
+	pendingTraffic = make(map[string]*trafficCounter)
+	// 还没写到数据库的小时流量
+	pendingHourly = make(map[hourlyKey]*models.TrafficHourly)
+)
+
+// 按心跳里的计数器增量统计设备的流量：上行网卡的合计算配额，每个非虚拟网卡和合计按小时记流量
+func recordTraffic(heartbeat *protos.Heartbeat) {
+	if heartbeat.Monitor == nil || len(heartbeat.Monitor.Network) == 0 {
+		return
+	}
+	uplinks := uplinkIfaces(heartbeat.Monitor.Network)
+
+	trafficMu.Lock()
+	defer trafficMu.Unlock()
+
+	last, ok := lastTrafficCounters[heartbeat.Sn]
+	if !ok {
+		last = make(map[string]*ifaceTraffic)
+		lastTrafficCounters[heartbeat.Sn] = last
+	}
+
+	var total trafficCounter
+	var totalStart int64
+	var totalReset bool
+	for _, n := range heartbeat.Monitor.Network {
+		d, start, reset, ok := networkDelta(last, n)
+		if !ok || virtualIface(n.Name) {
+			continue
+		}
+		addHourlyTraffic(heartbeat.Sn, n.Name, start, n.Timestamp, d, reset)
+
+		if !uplinks[n.Name] {
+			continue
+		}
+		total.sent += d.sent
+		total.recv += d.recv
+		total.packetsSent += d.packetsSent
+		total.packetsRecv += d.packetsRecv
+		if totalStart == 0 || start < totalStart {
+			totalStart = start
+		}
+		totalReset = totalReset || reset
+		total.ts = n.Timestamp
+	}
+	if total.sent == 0 && total.recv == 0 {
+		return
+	}
+	addHourlyTraffic(heartbeat.Sn, models.BANDWIDTH_TOTAL_IFACE, totalStart, total.ts, total, totalReset)
+
+	pending, ok := pendingTraffic[heartbeat.Sn]
+	if !ok {
+		pending = &trafficCounter{}
+		pendingTraffic[heartbeat.Sn] = pending
+	}
+	pending.sent += total.sent
+	pending.recv += total.recv
+}
+
+// 网卡这次心跳的增量、增量的开始时间(秒)和计数器是否清零过。agent带了增量时直接用，回绕和重启agent已经处理了，
+// 开始时间和上次一样的是没收到应答重发的，只算多出来的部分；老版本agent按上次心跳的累计计数算，第一次心跳只记基数
+func networkDelta(last map[string]*ifaceTraffic, n *protos.SystemMonitorNetwork) (trafficCounter, int64, bool, bool) {
+	it, hasPrev := last[n.Name]
+	if !hasPrev {
+		it = &ifaceTraffic{}
+		last[n.Name] = it
+	}
+	prev := it.last
+	it.last = trafficCounter{sent: n.BytesSent, recv: n.BytesRecv, packetsSent: n.PacketsSent, packetsRecv: n.PacketsRecv, ts: n.Timestamp}
+
+	if n.DeltaStart > 0 {
+		d := trafficCounter{sent: n.DeltaSent, recv: n.DeltaRecv, packetsSent: n.DeltaPacketsSent, packetsRecv: n.DeltaPacketsRecv, ts: n.Timestamp}
+		if it.deltaStart != n.DeltaStart {
+			it.deltaStart, it.delta = n.DeltaStart, d
+			return d, n.DeltaStart, n.CounterReset, true
+		}
+		counted := it.delta
+		if d.ts > counted.ts {
+			it.delta = d
+		}
+		return trafficCounter{
+			sent:        excess(counted.sent, d.sent),
+			recv:        excess(counted.recv, d.recv),
+			packetsSent: excess(counted.packetsSent, d.packetsSent),
+			packetsRecv: excess(counted.packetsRecv, d.packetsRecv),
+		}, counted.ts, false, true
+	}
+	if !hasPrev {
+		return trafficCounter{}, 0, false, false
+	}
+	return trafficCounter{
+		sent:        counterDelta(prev.sent, n.BytesSent),
+		recv:        counterDelta(prev.recv, n.BytesRecv),
+		packetsSent: counterDelta(prev.packetsSent, n.PacketsSent),
+		packetsRecv: counterDelta(prev.packetsRecv, n.PacketsRecv),
+	}, prev.ts, false, true
+}
+
+// 重发的增量比算过的多出来的部分
+func excess(counted, curr uint64) uint64 {
+	if curr > counted {
+		return curr - counted
+	}
+	return 0
+}
+
+// 把[start, end]秒的增量按时长摊到每个小时上，调用时需持有trafficMu
+func addHourlyTraffic(sn, iface string, start, end int64, d trafficCounter, reset bool) {
+	if d.sent == 0 && d.recv == 0 && d.packetsSent == 0 && d.packetsRecv == 0 && !reset {
+		return
+	}
+	if end < start {
+		end = start
+	}
+	if end-start > trafficMaxSpan {
+		start = end - trafficMaxSpan
+	}
+
+	parts := splitHourly(start, end)
+	var used trafficCounter
+	for i, p := range parts {
+		row := pendingHourlyRow(sn, iface, p.hour)
+		// 最后一段拿余数，摊完和总数一致
+		if i == len(parts)-1 {
+			row.BytesSent += d.sent - used.sent
+			row.BytesRecv += d.recv - used.recv
+			row.PacketsSent += d.packetsSent - used.packetsSent
+			row.PacketsRecv += d.packetsRecv - used.packetsRecv
+			if reset {
+				row.Resets++
+			}
+			break
+		}
+		one := trafficCounter{
+			sent:        uint64(float64(d.sent) * p.ratio),
+			recv:        uint64(float64(d.recv) * p.ratio),
+			packetsSent: uint64(float64(d.packetsSent) * p.ratio),
+			packetsRecv: uint64(float64(d.packetsRecv) * p.ratio),
+		}
+		row.BytesSent += one.sent
+		row.BytesRecv += one.recv
+		row.PacketsSent += one.packetsSent
+		row.PacketsRecv += one.packetsRecv
+		used.sent += one.sent
+		used.recv += one.recv
+		used.packetsSent += one.packetsSent
+		used.packetsRecv += one.packetsRecv
+	}
+}
+
+func pendingHourlyRow(sn, iface string, hour int64) *models.TrafficHourly {
+	key := hourlyKey{sn: sn, iface: iface, ts: hour}
+	row, ok := pendingHourly[key]
+	if !ok {
+		row = &models.TrafficHourly{SN: sn, Iface: iface, Ts: hour}
+		pendingHourly[key] = row
+	}
+	return row
+}
+
+type hourPart struct {
+	hour  int64 // 小时开始时间 毫秒
+	ratio float64
+}
+
+// [start, end]秒跨过的每个小时和占的比例
+func splitHourly(start, end int64) []hourPart {
+	if end <= start {
+		return []hourPart{{hour: end / 3600 * 3600 * 1000, ratio: 1}}
+	}
+	var parts []hourPart
+	span := float64(end - start)
+	for t := start; t < end; {
+		hour := t / 3600 * 3600
+		next := hour + 3600
+		if next > end {
+			next = end
+		}
+		parts = append(parts, hourPart{hour: hour * 1000, ratio: float64(next-t) / span})
+		t = next
+	}
+	return parts
+}
+
+// counterDelta 计数器变小说明设备重启过，这次的值就是重启后的增量
+func counterDelta(prev, curr uint64) uint64 {
+	if curr >= prev {
+		return curr - prev
+	}
+	return curr
+}
+
+// 每分钟把流量增量加到配额用量和小时流量上
+func startTrafficFlushTask() {
+	ticker := time.NewTicker(time.Minute)
+	go func() {
+		for range ticker.C {
+			trafficMu.Lock()
+			pending := pendingTraffic
+			pendingTraffic = make(map[string]*trafficCounter)
+			hourly := pendingHourly
+			pendingHourly = make(map[hourlyKey]*models.TrafficHourly)
+			trafficMu.Unlock()
+
+			flushTraffic(pending, hourly)
+		}
+	}()
+}
+
+// 写库失败的放回去，下一轮再写
+func flushTraffic(pending map[string]*trafficCounter, hourly map[hourlyKey]*models.TrafficHourly) {
+	failed := make(map[string]*trafficCounter)
+	for sn, one := range pending {
+		if err := repos.TrafficQuotaRepo.AddUsage(sn, one.sent, one.recv); err != nil {
+			common.Logger.Error("startTrafficFlushTask ERR: ", zap.String("sn", sn), zap.Error(err))
+			failed[sn] = one
+		}
+	}
+
+	rows := make([]models.TrafficHourly, 0, len(hourly))
+	for _, row := range hourly {
+		rows = append(rows, *row)
+	}
+	if err := repos.TrafficRepo.AddHourly(rows); err != nil {
+		common.Logger.Error("startTrafficFlushTask hourly ERR: ", zap.Int("rows", len(rows)), zap.Error(err))
+	} else {
+		hourly = nil
+	}
+	if len(failed) == 0 && len(hourly) == 0 {
+		return
+	}
+
+	trafficMu.Lock()
+	defer trafficMu.Unlock()
+	for sn, one := range failed {
+		cur, ok := pendingTraffic[sn]
+		if !ok {
+			cur = &trafficCounter{}
+			pendingTraffic[sn] = cur
+		}
+		cur.sent += one.sent
+		cur.recv += one.recv
+	}
+	for key, one := range hourly {
+		row := pendingHourlyRow(key.sn, key.iface, key.ts)
+		row.BytesSent += one.BytesSent
+		row.BytesRecv += one.BytesRecv
+		row.PacketsSent += one.PacketsSent
+		row.PacketsRecv += one.PacketsRecv
+		row.Resets += one.Resets
+	}
+}
@@ -0,0 +1,34 @@
+package tcpservice
+
+import (
+	"testing"
+
+	"github.com/liuhengloveyou/pcdn/protos"
+)
+
+// go test -v -count=1 -run TestNetworkDelta pcdn-server/tcpservice
+func TestNetworkDelta(t *testing.T) {
+	last := make(map[string]*ifaceTraffic)
+	tests := []struct {
+		name  string
+		n     *protos.SystemMonitorNetwork
+		sent  uint64
+		start int64
+		reset bool
+		ok    bool
+	}{
+		{"old agent first", &protos.SystemMonitorNetwork{Name: "eth0", BytesSent: 1000, Timestamp: 100}, 0, 0, false, false},
+		{"old agent", &protos.SystemMonitorNetwork{Name: "eth0", BytesSent: 1500, Timestamp: 110}, 500, 100, false, true},
+		{"delta", &protos.SystemMonitorNetwork{Name: "eth0", DeltaSent: 300, DeltaStart: 110, CounterReset: true, Timestamp: 120}, 300, 110, true, true},
+		// 没收到应答，同一个开始时间重发，只算多出来的
+		{"resent", &protos.SystemMonitorNetwork{Name: "eth0", DeltaSent: 450, DeltaStart: 110, CounterReset: true, Timestamp: 130}, 150, 120, false, true},
+		{"duplicate", &protos.SystemMonitorNetwork{Name: "eth0", DeltaSent: 450, DeltaStart: 110, Timestamp: 130}, 0, 130, false, true},
+		{"next", &protos.SystemMonitorNetwork{Name: "eth0", DeltaSent: 50, DeltaStart: 130, Timestamp: 140}, 50, 130, false, true},
+	}
+	for _, tt := range tests {
+		d, start, reset, ok := networkDelta(last, tt.n)
+		if d.sent != tt.sent || start != tt.start || reset != tt.reset || ok != tt.ok {
+			t.Errorf("%s: got sent=%d start=%d reset=%v ok=%v", tt.name, d.sent, start, reset, ok)
+		}
+	}
+}